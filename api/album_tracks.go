@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// AlbumTrackV3 is a track on an album, with its place in the album's running order.
+// Disc and Number are nil where the track has no (valid) disc_number or track_number tag.
+type AlbumTrackV3 struct {
+	Disc   *int    `json:"disc,omitempty"`
+	Number *int    `json:"number,omitempty"`
+	Track  TrackV3 `json:"track"`
+}
+
+// AlbumPositionV3 is a place in an album's running order: a track number on a disc.
+// TrackIDs lists the tracks claiming the position, where more than one does.
+type AlbumPositionV3 struct {
+	Disc     int   `json:"disc"`
+	Number   int   `json:"number"`
+	TrackIDs []int `json:"trackIds,omitempty"`
+}
+
+// AlbumTracksV3 is an album's track listing.
+// Gaps are track numbers missing from a disc, up to the highest number on that disc.
+// Duplicates are positions claimed by more than one track.
+// Unnumbered lists the IDs of tracks without a track number, which are listed after
+// the numbered tracks on their disc.
+type AlbumTracksV3 struct {
+	Album      AlbumV3           `json:"album"`
+	Tracks     []AlbumTrackV3    `json:"tracks"`
+	Gaps       []AlbumPositionV3 `json:"gaps"`
+	Duplicates []AlbumPositionV3 `json:"duplicates"`
+	Unnumbered []int             `json:"unnumbered"`
+}
+
+// tagNumber parses a numeric tag value, returning nil if it's absent or not a positive integer.
+func tagNumber(tags TagList, predicate string) *int {
+	number, err := strconv.Atoi(tags.GetValue(predicate))
+	if err != nil || number < 1 {
+		return nil
+	}
+	return &number
+}
+
+// getAlbumTracks lists the tracks tagged with an album, ordered by disc number then
+// track number.  Tracks without a disc number are taken to be on disc 1.
+func (store Datastore) getAlbumTracks(id int) (listing AlbumTracksV3, err error) {
+	listing.Album, err = store.getAlbumByID(id)
+	if err != nil {
+		return
+	}
+	tracks := []Track{}
+	err = store.DB.Select(&tracks, "SELECT id, url, fingerprint, duration, weighting FROM track WHERE id IN (SELECT trackid FROM tag WHERE predicateid = 'album' AND uri = $1)", listing.Album.URI)
+	if err != nil {
+		return
+	}
+	listing.Tracks = make([]AlbumTrackV3, 0, len(tracks))
+	for _, track := range tracks {
+		track.Tags, err = store.getAllTagsForTrack(track.ID)
+		if err != nil {
+			return
+		}
+		listing.Tracks = append(listing.Tracks, AlbumTrackV3{
+			Disc:   tagNumber(track.Tags, "disc_number"),
+			Number: tagNumber(track.Tags, "track_number"),
+			Track:  TrackToV3(track),
+		})
+	}
+	sort.SliceStable(listing.Tracks, func(i, j int) bool {
+		a, b := listing.Tracks[i], listing.Tracks[j]
+		if a.disc() != b.disc() {
+			return a.disc() < b.disc()
+		}
+		if (a.Number == nil) != (b.Number == nil) {
+			return b.Number == nil
+		}
+		if a.Number != nil && *a.Number != *b.Number {
+			return *a.Number < *b.Number
+		}
+		return a.Track.ID < b.Track.ID
+	})
+	listing.Gaps, listing.Duplicates, listing.Unnumbered = checkAlbumRunningOrder(listing.Tracks)
+	return
+}
+
+// disc returns the disc a track is on, defaulting to 1.
+func (entry AlbumTrackV3) disc() int {
+	if entry.Disc == nil {
+		return 1
+	}
+	return *entry.Disc
+}
+
+// checkAlbumRunningOrder finds the gaps, duplicate positions and unnumbered tracks
+// in a track listing, which must already be sorted by position.
+func checkAlbumRunningOrder(entries []AlbumTrackV3) (gaps []AlbumPositionV3, duplicates []AlbumPositionV3, unnumbered []int) {
+	gaps = []AlbumPositionV3{}
+	duplicates = []AlbumPositionV3{}
+	unnumbered = []int{}
+	disc, last := 0, 0
+	for i, entry := range entries {
+		if entry.Number == nil {
+			unnumbered = append(unnumbered, entry.Track.ID)
+			continue
+		}
+		if entry.disc() != disc {
+			disc, last = entry.disc(), 0
+		}
+		number := *entry.Number
+		if number == last {
+			previous := entries[i-1]
+			if len(duplicates) > 0 && duplicates[len(duplicates)-1].Disc == disc && duplicates[len(duplicates)-1].Number == number {
+				duplicates[len(duplicates)-1].TrackIDs = append(duplicates[len(duplicates)-1].TrackIDs, entry.Track.ID)
+			} else {
+				duplicates = append(duplicates, AlbumPositionV3{Disc: disc, Number: number, TrackIDs: []int{previous.Track.ID, entry.Track.ID}})
+			}
+			continue
+		}
+		for missing := last + 1; missing < number; missing++ {
+			gaps = append(gaps, AlbumPositionV3{Disc: disc, Number: missing})
+		}
+		last = number
+	}
+	return
+}
+
+// albumTracksHandler handles requests to /v3/albums/{id}/tracks.
+func (store Datastore) albumTracksHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != "GET" {
+		MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	listing, err := store.getAlbumTracks(id)
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	writeJSONResponse(w, listing, nil)
+}
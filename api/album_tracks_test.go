@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// setupAlbumTrack creates a track on the album "White Album", with the given disc and track numbers
+// (left out when empty).
+func setupAlbumTrack(test *testing.T, id int, disc string, number string) {
+	tags := `"title":[{"name":"Song ` + fmt.Sprint(id) + `"}],"album":[{"name":"White Album"}]`
+	if disc != "" {
+		tags += `,"disc_number":[{"name":"` + disc + `"}]`
+	}
+	if number != "" {
+		tags += `,"track_number":[{"name":"` + number + `"}]`
+	}
+	setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", id), fmt.Sprintf(`{"fingerprint":"album%d","url":"http://example.org/album/%d","duration":100,"tags":{%s}}`, id, id, tags), 200)
+}
+
+// getAlbumTracks fetches an album's track listing.
+func getAlbumTracks(test *testing.T, path string) (listing AlbumTracksV3) {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	assertEqual(test, "Album tracks status", 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&listing)
+	return
+}
+
+// TestAlbumTracksInRunningOrder checks an album's tracks are listed by disc then track number, not by id.
+func TestAlbumTracksInRunningOrder(test *testing.T) {
+	clearData()
+	setupAlbumTrack(test, 1, "2", "1")
+	setupAlbumTrack(test, 2, "", "2")
+	setupAlbumTrack(test, 3, "1", "1")
+	setupAlbumTrack(test, 4, "2", "2")
+	setupRequest(test, "PUT", "/v3/tracks/5", `{"fingerprint":"other","url":"http://example.org/other","duration":100,"tags":{"title":[{"name":"Elsewhere"}]}}`, 200)
+
+	listing := getAlbumTracks(test, "/v3/albums/1/tracks")
+	assertEqual(test, "Album", "White Album", listing.Album.Name)
+	ids := []int{}
+	for _, entry := range listing.Tracks {
+		ids = append(ids, entry.Track.ID)
+	}
+	assertEqual(test, "Running order", "[3 2 1 4]", fmt.Sprint(ids))
+	assertEqual(test, "First disc", (*int)(nil), listing.Tracks[1].Disc)
+	assertEqual(test, "Third track number", 1, *listing.Tracks[2].Number)
+	assertEqual(test, "Gaps", 0, len(listing.Gaps))
+	assertEqual(test, "Duplicates", 0, len(listing.Duplicates))
+	assertEqual(test, "Unnumbered", 0, len(listing.Unnumbered))
+}
+
+// TestAlbumTracksReportsProblems checks gaps, duplicate positions and unnumbered tracks are reported.
+func TestAlbumTracksReportsProblems(test *testing.T) {
+	clearData()
+	setupAlbumTrack(test, 1, "", "1")
+	setupAlbumTrack(test, 2, "", "4")
+	setupAlbumTrack(test, 3, "", "4")
+	setupAlbumTrack(test, 4, "", "")
+	setupAlbumTrack(test, 5, "2", "2")
+	setupAlbumTrack(test, 6, "", "4")
+
+	listing := getAlbumTracks(test, "/v3/albums/1/tracks")
+	ids := []int{}
+	for _, entry := range listing.Tracks {
+		ids = append(ids, entry.Track.ID)
+	}
+	assertEqual(test, "Running order", "[1 2 3 6 4 5]", fmt.Sprint(ids))
+	problems, _ := json.Marshal(map[string]interface{}{"gaps": listing.Gaps, "duplicates": listing.Duplicates, "unnumbered": listing.Unnumbered})
+	assertEqual(test, "Problems", `{"duplicates":[{"disc":1,"number":4,"trackIds":[2,3,6]}],"gaps":[{"disc":1,"number":2},{"disc":1,"number":3},{"disc":2,"number":1}],"unnumbered":[4]}`, string(problems))
+}
+
+// TestAlbumTracksErrors checks requests for missing albums and unsupported methods.
+func TestAlbumTracksErrors(test *testing.T) {
+	clearData()
+	makeRequest(test, "GET", "/v3/albums/1/tracks", "", 404, `{"error":"Album Not Found","code":"not_found"}`, true)
+	makeRequest(test, "GET", "/v3/albums/one/tracks", "", 404, `{"error":"Album Not Found","code":"not_found"}`, true)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Empty"}`, 201)
+	makeRequest(test, "GET", "/v3/albums/1/tracks", "", 200, `{"album":{"id":1,"name":"Empty","uri":"/albums/1"},"tracks":[],"gaps":[],"duplicates":[],"unnumbered":[]}`, true)
+	makeRequestWithUnallowedMethod(test, "/v3/albums/1/tracks", "POST", []string{"GET"})
+}
+
+// TestTrackNumberTagsValidated checks disc and track numbers must be positive integers.
+func TestTrackNumberTagsValidated(test *testing.T) {
+	clearData()
+	setupAlbumTrack(test, 1, "1", "1")
+	makeRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"track_number":[{"name":"3/12"}]}}`, 400, `{"error":"value \"3/12\" is not a positive integer","code":"invalid_tag_value","predicate":"track_number"}`, true)
+	makeRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"disc_number":[{"name":"0"}]}}`, 400, `{"error":"value \"0\" is not a positive integer","code":"invalid_tag_value","predicate":"disc_number"}`, true)
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"track_number":[{"name":"12"}]}}`, 200)
+	listing := getAlbumTracks(test, "/v3/albums/1/tracks")
+	assertEqual(test, "Track number", 12, *listing.Tracks[0].Number)
+}
@@ -1,23 +1,78 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
+
+	"lucos_media_metadata_api/predicateconfig"
 	"lucos_media_metadata_api/rdfgen"
 )
 
 // AlbumV3 is the v3 wire representation of an album.
+// Albums may share a name; Artists, Year and MBIDRelease tell them apart.
 type AlbumV3 struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-	URI  string `json:"uri"`
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	URI         string       `json:"uri"`
+	Artists     []TagValueV3 `json:"artists,omitempty"`
+	Year        *int         `json:"year,omitempty"`
+	MBIDRelease string       `json:"mbidRelease,omitempty"`
+	TrackCount  *int         `json:"trackCount,omitempty"`
+	DiscCount   *int         `json:"discCount,omitempty"`
+	Artwork     string       `json:"artwork,omitempty"`    // URL of the album's cover image
+	UsageCount  *int         `json:"usageCount,omitempty"` // the number of tracks tagged with the album, in listings
+}
+
+// AlbumInputV3 is the request body for creating or updating an album.
+// When updating, fields left out keep their current values; an empty artists
+// list, a number of 0 or an empty string clears them.
+type AlbumInputV3 struct {
+	Name        string        `json:"name"`
+	Artists     *[]TagValueV3 `json:"artists"`
+	Year        *int          `json:"year"`
+	MBIDRelease *string       `json:"mbidRelease"`
+	TrackCount  *int          `json:"trackCount"`
+	DiscCount   *int          `json:"discCount"`
+	Artwork     *string       `json:"artwork"`
+}
+
+// albumRow is a row of the album table.
+type albumRow struct {
+	ID          int            `db:"id"`
+	Name        string         `db:"name"`
+	Year        sql.NullInt64  `db:"year"`
+	MBIDRelease sql.NullString `db:"mbid_release"`
+	TrackCount  sql.NullInt64  `db:"track_count"`
+	DiscCount   sql.NullInt64  `db:"disc_count"`
+	Artwork     sql.NullString `db:"artwork"`
+	UsageCount  sql.NullInt64  `db:"usage_count"` // only selected for listings
+}
+
+// albumColumns lists the album table columns scanned into an albumRow.
+const albumColumns = "id, name, year, mbid_release, track_count, disc_count, artwork"
+
+// mbidPattern matches a MusicBrainz identifier, which is a lowercase UUID.
+var mbidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// nullIntToPtr converts a sql.NullInt64 to an *int, nil for NULL.
+func nullIntToPtr(ni sql.NullInt64) *int {
+	if !ni.Valid {
+		return nil
+	}
+	i := int(ni.Int64)
+	return &i
 }
 
 // AlbumListV3 wraps a paginated list of albums.
@@ -58,50 +113,44 @@ func ParseAlbumIDFromURI(uri string) (int, error) {
 	return id, nil
 }
 
-// getAllAlbums returns a paginated list of albums, optionally filtered by a
-// case-insensitive substring match on name via the q parameter.
-func (store Datastore) getAllAlbums(rawpage, q string) (list AlbumListV3, err error) {
+// getAllAlbums returns a paginated list of albums, each with the number of tracks tagged
+// with it, optionally filtered by a case-insensitive substring match on name via the q parameter.
+// Orphaned albums are those tagged on no tracks.
+func (store Datastore) getAllAlbums(options listOptions) (list AlbumListV3, err error) {
 	const standardLimit = 20
 
-	offset, limit := parsePageParam(rawpage, standardLimit)
+	offset, limit := parsePageParam(options.Page, standardLimit)
 
-	page, parseErr := strconv.Atoi(rawpage)
+	page, parseErr := strconv.Atoi(options.Page)
 	if parseErr != nil || page < 1 {
 		page = 1
 	}
 
-	type albumRow struct {
-		ID   int    `db:"id"`
-		Name string `db:"name"`
+	from := "FROM album " + tagUsageJoin("album", "album") + " WHERE 1"
+	args := []interface{}{store.ManagerOrigin}
+	if options.Query != "" {
+		from += " AND name LIKE ?"
+		args = append(args, "%"+options.Query+"%")
+	}
+	if options.Orphans {
+		from += " AND " + orphanedAlbum
 	}
 
 	var total int
-	var rows []albumRow
-	if q != "" {
-		like := "%" + q + "%"
-		err = store.DB.Get(&total, "SELECT COUNT(*) FROM album WHERE name LIKE $1", like)
-		if err != nil {
-			return
-		}
-		err = store.DB.Select(&rows, "SELECT id, name FROM album WHERE name LIKE $1 ORDER BY name LIMIT $2 OFFSET $3", like, limit, offset)
-	} else {
-		err = store.DB.Get(&total, "SELECT COUNT(*) FROM album")
-		if err != nil {
-			return
-		}
-		err = store.DB.Select(&rows, "SELECT id, name FROM album ORDER BY name LIMIT $1 OFFSET $2", limit, offset)
+	err = store.DB.Get(&total, "SELECT COUNT(*) "+from, args...)
+	if err != nil {
+		return
 	}
+	var rows []albumRow
+	err = store.DB.Select(&rows, "SELECT "+albumColumns+", IFNULL(usage.count, 0) AS usage_count "+from+
+		" ORDER BY "+options.orderBy("name, id")+" LIMIT ? OFFSET ?", append(args, limit, offset)...)
 	if err != nil {
 		return
 	}
 
-	albums := make([]AlbumV3, len(rows))
-	for i, row := range rows {
-		albums[i] = AlbumV3{
-			ID:   row.ID,
-			Name: row.Name,
-			URI:  store.albumURI(row.ID),
-		}
+	albums, err := store.albumsFromRows(rows)
+	if err != nil {
+		return
 	}
 
 	list = AlbumListV3{
@@ -113,111 +162,328 @@ func (store Datastore) getAllAlbums(rawpage, q string) (list AlbumListV3, err er
 	return
 }
 
+// albumsFromRows converts album table rows to AlbumV3s, along with each album's credited artists.
+func (store Datastore) albumsFromRows(rows []albumRow) (albums []AlbumV3, err error) {
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	artists, err := store.getAlbumArtists(ids)
+	if err != nil {
+		return
+	}
+	albums = make([]AlbumV3, len(rows))
+	for i, row := range rows {
+		albums[i] = AlbumV3{
+			ID:          row.ID,
+			Name:        row.Name,
+			URI:         store.albumURI(row.ID),
+			Artists:     artists[row.ID],
+			Year:        nullIntToPtr(row.Year),
+			MBIDRelease: row.MBIDRelease.String,
+			TrackCount:  nullIntToPtr(row.TrackCount),
+			DiscCount:   nullIntToPtr(row.DiscCount),
+			Artwork:     row.Artwork.String,
+			UsageCount:  nullIntToPtr(row.UsageCount),
+		}
+	}
+	return
+}
+
+// getAlbumArtists returns the artists credited on each of the given albums, in credit order, keyed by album id.
+func (store Datastore) getAlbumArtists(albumIDs []int) (artists map[int][]TagValueV3, err error) {
+	artists = make(map[int][]TagValueV3, len(albumIDs))
+	if len(albumIDs) == 0 {
+		return
+	}
+	query, args, err := sqlx.In(`SELECT album_artist.albumid, artist.id, artist.name
+		FROM album_artist INNER JOIN artist ON album_artist.artistid = artist.id
+		WHERE album_artist.albumid IN (?)
+		ORDER BY album_artist.albumid, album_artist.position`, albumIDs)
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		AlbumID  int    `db:"albumid"`
+		ArtistID int    `db:"id"`
+		Name     string `db:"name"`
+	}
+	err = store.DB.Select(&rows, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		artists[row.AlbumID] = append(artists[row.AlbumID], TagValueV3{Name: row.Name, URI: store.artistURI(row.ArtistID)})
+	}
+	return
+}
+
 // getAlbumByID returns a single album by its integer ID.
 func (store Datastore) getAlbumByID(id int) (album AlbumV3, err error) {
-	type albumRow struct {
-		ID   int    `db:"id"`
-		Name string `db:"name"`
-	}
 	var row albumRow
-	err = store.DB.Get(&row, "SELECT id, name FROM album WHERE id = $1", id)
+	err = store.DB.Get(&row, "SELECT "+albumColumns+" FROM album WHERE id = $1", id)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			err = errors.New("Album Not Found")
 		}
 		return
 	}
-	album = AlbumV3{
-		ID:   row.ID,
-		Name: row.Name,
-		URI:  store.albumURI(row.ID),
+	albums, err := store.albumsFromRows([]albumRow{row})
+	if err != nil {
+		return
 	}
+	album = albums[0]
 	return
 }
 
-// createAlbum inserts a new album with the given name and returns the created AlbumV3.
-// Returns a "duplicate_name" error if the name already exists.
-func (store Datastore) createAlbum(name string) (album AlbumV3, err error) {
-	slog.Info("Create Album", "name", name)
-	result, err := store.DB.Exec("INSERT INTO album(name) VALUES($1)", name)
-	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			err = errors.New("album_duplicate_name")
+// applyAlbumNumber validates a number given in an AlbumInputV3 and copies it to
+// the album field it's for. Numbers must be between 0 and max; 0 clears the field.
+func applyAlbumNumber(field string, value *int, max int, target **int) error {
+	if value == nil {
+		return nil
+	}
+	if *value < 0 || *value > max {
+		return errors.New("Album " + field + " " + strconv.Itoa(*value) + " not allowed")
+	}
+	*target = value
+	if *value == 0 {
+		*target = nil
+	}
+	return nil
+}
+
+// applyAlbumInput validates the fields given in an AlbumInputV3 and copies them onto an album.
+// Artists are resolved like artist tags on a track: by name (creating the artist
+// if need be) or by URI.
+func (store Datastore) applyAlbumInput(album *AlbumV3, input AlbumInputV3) (err error) {
+	album.Name = input.Name
+	if err = applyAlbumNumber("year", input.Year, 9999, &album.Year); err != nil {
+		return
+	}
+	if err = applyAlbumNumber("trackCount", input.TrackCount, 9999, &album.TrackCount); err != nil {
+		return
+	}
+	if err = applyAlbumNumber("discCount", input.DiscCount, 999, &album.DiscCount); err != nil {
+		return
+	}
+	if input.MBIDRelease != nil {
+		album.MBIDRelease = strings.ToLower(strings.TrimSpace(*input.MBIDRelease))
+		if album.MBIDRelease != "" && !mbidPattern.MatchString(album.MBIDRelease) {
+			return errors.New("Album mbidRelease \"" + album.MBIDRelease + "\", which isn't a MusicBrainz id, not allowed")
+		}
+	}
+	if input.Artwork != nil {
+		album.Artwork = strings.TrimSpace(*input.Artwork)
+		if album.Artwork != "" {
+			artwork, parseErr := url.Parse(album.Artwork)
+			if parseErr != nil || (artwork.Scheme != "http" && artwork.Scheme != "https") || artwork.Host == "" {
+				return errors.New("Album artwork \"" + album.Artwork + "\", which isn't an http(s) URL, not allowed")
+			}
+		}
+	}
+	if input.Artists != nil {
+		config := predicateconfig.GetConfig("artist")
+		album.Artists = []TagValueV3{}
+		seen := map[string]bool{}
+		for _, artist := range *input.Artists {
+			if artist.Name == "" && artist.URI == "" {
+				continue
+			}
+			artist, err = resolveTagValue(store, "artist", config, artist, nil)
+			if err != nil {
+				return
+			}
+			if seen[artist.URI] {
+				continue
+			}
+			seen[artist.URI] = true
+			album.Artists = append(album.Artists, artist)
+		}
+	}
+	return
+}
+
+// sameIdentity reports whether two albums can't be told apart: they share a name,
+// year and MusicBrainz release, and are credited to the same artists.
+func (album AlbumV3) sameIdentity(other AlbumV3) bool {
+	if album.Name != other.Name || album.MBIDRelease != other.MBIDRelease {
+		return false
+	}
+	if (album.Year == nil) != (other.Year == nil) || (album.Year != nil && *album.Year != *other.Year) {
+		return false
+	}
+	if len(album.Artists) != len(other.Artists) {
+		return false
+	}
+	artistURIs := make(map[string]bool, len(album.Artists))
+	for _, artist := range album.Artists {
+		artistURIs[artist.URI] = true
+	}
+	for _, artist := range other.Artists {
+		if !artistURIs[artist.URI] {
+			return false
 		}
+	}
+	return true
+}
+
+// checkAlbumDistinct returns an "album_duplicate_name" error if another album
+// has the same name and can't be told apart from the given one.
+func (store Datastore) checkAlbumDistinct(album AlbumV3) (err error) {
+	var rows []albumRow
+	err = store.DB.Select(&rows, "SELECT "+albumColumns+" FROM album WHERE name = $1 AND id != $2", album.Name, album.ID)
+	if err != nil {
 		return
 	}
-	id64, err := result.LastInsertId()
+	others, err := store.albumsFromRows(rows)
 	if err != nil {
 		return
 	}
-	album = AlbumV3{
-		ID:   int(id64),
-		Name: name,
-		URI:  store.albumURI(int(id64)),
+	for _, other := range others {
+		if album.sameIdentity(other) {
+			return errors.New("album_duplicate_name")
+		}
 	}
-	store.Loganne.albumPost("albumCreated", "Album \""+name+"\" created", album, true)
 	return
 }
 
-// updateAlbum renames an existing album.
-// Returns "Album Not Found" if the id doesn't exist.
-func (store Datastore) updateAlbum(id int, name string) (album AlbumV3, err error) {
-	slog.Info("Update Album", "id", id, "name", name)
+// setAlbumArtists replaces the artists credited on an album.
+func setAlbumArtists(tx *sqlx.Tx, albumID int, artists []TagValueV3) (err error) {
+	_, err = tx.Exec("DELETE FROM album_artist WHERE albumid = $1", albumID)
+	if err != nil {
+		return
+	}
+	for i, artist := range artists {
+		var artistID int
+		artistID, err = ParseArtistIDFromURI(artist.URI)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec("INSERT INTO album_artist(albumid, position, artistid) VALUES($1, $2, $3)", albumID, i+1, artistID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// albumWriteError maps constraint failures when writing an album row to the errors the controller expects.
+func albumWriteError(err error) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: album.mbid_release") {
+		return errors.New("album_duplicate_release")
+	}
+	return err
+}
+
+// createAlbum inserts a new album and returns the created AlbumV3.
+// Returns an "album_duplicate_name" error if an album with the same name can't be
+// told apart from it, or "album_duplicate_release" if its MusicBrainz release is taken.
+func (store Datastore) createAlbum(input AlbumInputV3) (album AlbumV3, err error) {
+	slog.Info("Create Album", "name", input.Name)
+	err = store.applyAlbumInput(&album, input)
+	if err != nil {
+		return
+	}
+	err = store.checkAlbumDistinct(album)
+	if err != nil {
+		return
+	}
 
-	// Wrap both operations in a transaction to ensure atomicity.
 	tx, err := store.DB.Beginx()
 	if err != nil {
 		return
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	result, err := tx.Exec("UPDATE album SET name = $1 WHERE id = $2", name, id)
+	result, err := tx.Exec("INSERT INTO album(name, year, mbid_release, track_count, disc_count, artwork) VALUES($1, $2, $3, $4, $5, $6)",
+		album.Name, album.Year, nullIfEmpty(album.MBIDRelease), album.TrackCount, album.DiscCount, nullIfEmpty(album.Artwork))
+	if err != nil {
+		err = albumWriteError(err)
+		return
+	}
+	id64, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
+	err = setAlbumArtists(tx, int(id64), album.Artists)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	album.ID = int(id64)
+	album.URI = store.albumURI(album.ID)
+	store.Loganne.albumPost("albumCreated", "Album \""+album.Name+"\" created", album, true)
+	return
+}
+
+// nullIfEmpty converts an empty string to nil, so it's stored as NULL.
+func nullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// updateAlbum renames an existing album and updates whichever of its other fields are given.
+// Returns "Album Not Found" if the id doesn't exist.
+func (store Datastore) updateAlbum(id int, input AlbumInputV3) (album AlbumV3, err error) {
+	slog.Info("Update Album", "id", id, "name", input.Name)
+	album, err = store.getAlbumByID(id)
+	if err != nil {
+		return
+	}
+	err = store.applyAlbumInput(&album, input)
 	if err != nil {
-		_ = tx.Rollback()
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			err = errors.New("album_duplicate_name")
-		}
 		return
 	}
-	rows, err := result.RowsAffected()
+	err = store.checkAlbumDistinct(album)
+	if err != nil {
+		return
+	}
+
+	// Wrap all the writes in a transaction to ensure atomicity.
+	tx, err := store.DB.Beginx()
 	if err != nil {
-		_ = tx.Rollback()
 		return
 	}
-	if rows == 0 {
-		_ = tx.Rollback()
-		err = errors.New("Album Not Found")
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("UPDATE album SET name = $1, year = $2, mbid_release = $3, track_count = $4, disc_count = $5, artwork = $6 WHERE id = $7",
+		album.Name, album.Year, nullIfEmpty(album.MBIDRelease), album.TrackCount, album.DiscCount, nullIfEmpty(album.Artwork), id)
+	if err != nil {
+		err = albumWriteError(err)
 		return
 	}
+	if input.Artists != nil {
+		err = setAlbumArtists(tx, id, album.Artists)
+		if err != nil {
+			return
+		}
+	}
 
 	// Cascade the name change to all tag rows referencing this album.
-	albumURI := store.albumURI(id)
 	_, err = tx.Exec(
 		"UPDATE tag SET value = $1 WHERE predicateid = 'album' AND uri = $2",
-		name, albumURI,
+		album.Name, album.URI,
 	)
 	if err != nil {
-		_ = tx.Rollback()
 		return
 	}
 
-	// Commit both operations atomically.
+	// Commit all operations atomically.
 	err = tx.Commit()
 	if err != nil {
 		return
 	}
-
-	album = AlbumV3{
-		ID:   id,
-		Name: name,
-		URI:  albumURI,
-	}
-	store.Loganne.albumPost("albumUpdated", "Album \""+name+"\" updated", album, true)
+	store.Loganne.albumPost("albumUpdated", "Album \""+album.Name+"\" updated", album, true)
 	return
 }
 
 // deleteAlbum removes an album by id.
-// Returns an error if any tracks reference it.
+// Returns an error if any tracks reference it; deleteAlbumWithStrategy deals with those instead.
 func (store Datastore) deleteAlbum(id int) error {
 	slog.Info("Delete Album", "id", id)
 	// First check the album exists.
@@ -243,8 +509,8 @@ func (store Datastore) deleteAlbum(id int) error {
 }
 
 // mergeAlbums merges one or more source albums into the target album.
-// In a single transaction it repoints all tag rows referencing source album
-// URIs to the target album URI, then deletes the source album records.
+// In a single transaction it records each merge so it can be undone, repoints all tag
+// rows referencing source album URIs to the target album URI, then deletes the source album records.
 // An albumMerged Loganne event is emitted for each source deleted.
 // Returns the updated target album on success.
 func (store Datastore) mergeAlbums(targetID int, sourceIDs []int) (album AlbumV3, err error) {
@@ -284,6 +550,11 @@ func (store Datastore) mergeAlbums(targetID int, sourceIDs []int) (album AlbumV3
 	defer func() { _ = tx.Rollback() }()
 
 	for _, src := range sources {
+		err = recordMerge(tx, "album", src.ID, targetID, src.URI, mergeSnapshot{Album: &src})
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
 		// Repoint all tag rows that reference this source album URI.
 		_, err = tx.Exec(
 			"UPDATE tag SET uri = $1, value = $2 WHERE predicateid = 'album' AND uri = $3",
@@ -317,8 +588,8 @@ func (store Datastore) mergeAlbums(targetID int, sourceIDs []int) (album AlbumV3
 
 // ResolveOrCreateAlbumByName satisfies the predicateconfig.NameURIResolver interface.
 // It looks up an album by name (creating it if absent) and returns its URI.
-func (store Datastore) ResolveOrCreateAlbumByName(name string) (string, error) {
-	album, err := store.resolveOrCreateAlbumByName(name)
+func (store Datastore) ResolveOrCreateAlbumByName(name string, hints predicateconfig.TagHints) (string, error) {
+	album, err := store.resolveOrCreateAlbumByName(name, hints)
 	if err != nil {
 		return "", err
 	}
@@ -331,25 +602,92 @@ func (store Datastore) ResolveAlbumNameFromURI(uri string) (string, error) {
 	return store.resolveAlbumNameFromURI(uri)
 }
 
-// resolveOrCreateAlbumByName looks up an album by name. If no album with that
-// name exists, one is created. Wired up via ResolveOrCreateAlbumByName as the
-// ResolveNameToURI function for the album predicate in the predicateconfig registry.
-func (store Datastore) resolveOrCreateAlbumByName(name string) (album AlbumV3, err error) {
-	type albumRow struct {
-		ID   int    `db:"id"`
-		Name string `db:"name"`
+// matchHints reports whether an album fits the other tags on a track, and how
+// many of them it matches. An album whose MusicBrainz release or year differs
+// from the track's doesn't fit; artists only ever count in an album's favour,
+// as a compilation's tracks needn't be by its album artist.
+func (album AlbumV3) matchHints(hints predicateconfig.TagHints) (score int, fits bool) {
+	if releases := hints.Values("mbid_release"); album.MBIDRelease != "" && len(releases) > 0 {
+		if !slices.Contains(releases, album.MBIDRelease) {
+			return 0, false
+		}
+		score++
+	}
+	if years := hints.Values("year"); album.Year != nil && len(years) > 0 {
+		// Year tags may be full dates, so only compare the leading year
+		year, err := strconv.Atoi(strings.SplitN(years[0], "-", 2)[0])
+		if err == nil {
+			if year != *album.Year {
+				return 0, false
+			}
+			score++
+		}
 	}
-	var row albumRow
-	err = store.DB.Get(&row, "SELECT id, name FROM album WHERE name = $1", name)
-	if err == nil {
-		album = AlbumV3{ID: row.ID, Name: row.Name, URI: store.albumURI(row.ID)}
+	for _, artist := range album.Artists {
+		if slices.ContainsFunc(hints["artist"], func(hint predicateconfig.TagHint) bool {
+			return (hint.URI != "" && hint.URI == artist.URI) || strings.EqualFold(hint.Name, artist.Name)
+		}) {
+			score++
+			break
+		}
+	}
+	return score, true
+}
+
+// resolveOrCreateAlbumByName looks up an album by name, using hints from the
+// track's other tags (artist, year and mbid_release) to pick between albums
+// sharing that name: the album fitting the most hints wins. If no album with
+// that name fits, one is created, taking its MusicBrainz release from the hints
+// when no other album has claimed it. If several fit equally well, returns an
+// AmbiguousNameError rather than guess. Wired up via ResolveOrCreateAlbumByName as
+// the ResolveNameToURI function for the album predicate in the predicateconfig registry.
+func (store Datastore) resolveOrCreateAlbumByName(name string, hints predicateconfig.TagHints) (album AlbumV3, err error) {
+	var rows []albumRow
+	err = store.DB.Select(&rows, "SELECT "+albumColumns+" FROM album WHERE name = $1 ORDER BY id", name)
+	if err != nil {
 		return
 	}
-	if err.Error() != "sql: no rows in result set" {
+	candidates, err := store.albumsFromRows(rows)
+	if err != nil {
+		return
+	}
+	var best []AlbumV3
+	bestScore := -1
+	for _, candidate := range candidates {
+		score, fits := candidate.matchHints(hints)
+		if !fits {
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = []AlbumV3{candidate}, score
+		} else if score == bestScore {
+			best = append(best, candidate)
+		}
+	}
+	if len(best) == 1 {
+		return best[0], nil
+	}
+	if len(best) > 1 {
+		uris := make([]string, len(best))
+		for i, candidate := range best {
+			uris[i] = candidate.URI
+		}
+		err = &AmbiguousNameError{Predicate: "album", Name: name, URIs: uris}
 		return
 	}
-	err = nil
-	return store.createAlbum(name)
+
+	input := AlbumInputV3{Name: name}
+	if releases := hints.Values("mbid_release"); len(releases) == 1 && mbidPattern.MatchString(releases[0]) {
+		var claimed int
+		err = store.DB.Get(&claimed, "SELECT COUNT(*) FROM album WHERE mbid_release = $1", releases[0])
+		if err != nil {
+			return
+		}
+		if claimed == 0 {
+			input.MBIDRelease = &releases[0]
+		}
+	}
+	return store.createAlbum(input)
 }
 
 // resolveAlbumNameFromURI extracts the album id from a URI and returns the
@@ -375,10 +713,41 @@ func writeAlbumRDFByID(store Datastore, w http.ResponseWriter, id int, rdfType s
 		writeRDFResponse(w, nil, rdfType, err)
 		return
 	}
-	graph, err := rdfgen.AlbumToRdf([]rdfgen.AlbumData{{ID: album.ID, Name: album.Name}})
+	graph, err := rdfgen.AlbumToRdf([]rdfgen.AlbumData{album.rdfData()})
 	writeRDFResponse(w, graph, rdfType, err)
 }
 
+// rdfData converts an album to the form rdfgen uses to build its triples.
+func (album AlbumV3) rdfData() rdfgen.AlbumData {
+	data := rdfgen.AlbumData{
+		ID:          album.ID,
+		Name:        album.Name,
+		Year:        album.Year,
+		MBIDRelease: album.MBIDRelease,
+		TrackCount:  album.TrackCount,
+		DiscCount:   album.DiscCount,
+		Artwork:     album.Artwork,
+	}
+	for _, artist := range album.Artists {
+		if id, err := ParseArtistIDFromURI(artist.URI); err == nil {
+			data.ArtistIDs = append(data.ArtistIDs, id)
+		}
+	}
+	return data
+}
+
+// writeAlbumWriteError writes the response for an error creating or updating an album.
+func writeAlbumWriteError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "album_duplicate_name":
+		writeV3ErrorResponse(w, http.StatusConflict, "An album with that name already exists", "duplicate_name")
+	case "album_duplicate_release":
+		writeV3ErrorResponse(w, http.StatusConflict, "An album for that MusicBrainz release already exists", "duplicate_release")
+	default:
+		writeV3Error(w, err)
+	}
+}
+
 // AlbumsV3Controller handles all requests to /v3/albums endpoints.
 func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request) {
 	normalisedpath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v3/albums"), "/")
@@ -390,7 +759,12 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 		// /v3/albums
 		switch r.Method {
 		case "GET":
-			list, err := store.getAllAlbums(r.URL.Query().Get("page"), r.URL.Query().Get("q"))
+			options, err := listOptionsFromQuery(r.URL.Query())
+			if err != nil {
+				writeV3Error(w, err)
+				return
+			}
+			list, err := store.getAllAlbums(options)
 			if err != nil {
 				writeV3Error(w, err)
 				return
@@ -402,20 +776,14 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 				writeV3Error(w, err)
 				return
 			}
-			var input struct {
-				Name string `json:"name"`
-			}
+			var input AlbumInputV3
 			if err = json.Unmarshal(body, &input); err != nil || input.Name == "" {
 				writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a non-empty \"name\" field", "bad_request")
 				return
 			}
-			album, err := store.createAlbum(input.Name)
+			album, err := store.createAlbum(input)
 			if err != nil {
-				if err.Error() == "album_duplicate_name" {
-					writeV3ErrorResponse(w, http.StatusConflict, "An album with that name already exists", "duplicate_name")
-					return
-				}
-				writeV3Error(w, err)
+				writeAlbumWriteError(w, err)
 				return
 			}
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -425,6 +793,24 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 		default:
 			MethodNotAllowed(w, []string{"GET", "POST"})
 		}
+	} else if len(pathparts) >= 2 && pathparts[1] == "merges" {
+		// /v3/albums/merges, /v3/albums/merges/{id} and /v3/albums/merges/{id}/undo
+		store.mergesHandler(w, r, "album", pathparts[2:])
+	} else if len(pathparts) == 2 && pathparts[1] == "orphans" {
+		// /v3/albums/orphans
+		if r.Method != "DELETE" {
+			MethodNotAllowed(w, []string{"DELETE"})
+			return
+		}
+		deleted, err := store.deleteOrphanedAlbums()
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, deleted, nil)
+	} else if len(pathparts) == 2 && pathparts[1] == "duplicates" {
+		// /v3/albums/duplicates
+		duplicatesHandler(w, r, store.getAlbumDuplicates)
 	} else if len(pathparts) == 2 && pathparts[1] == "merge" {
 		// /v3/albums/merge
 		if r.Method != "POST" {
@@ -436,10 +822,7 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 			writeV3Error(w, err)
 			return
 		}
-		var input struct {
-			TargetID  int   `json:"targetId"`
-			SourceIDs []int `json:"sourceIds"`
-		}
+		var input MergeRequestV3
 		if err = json.Unmarshal(body, &input); err != nil || input.TargetID <= 0 || len(input.SourceIDs) == 0 {
 			writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a positive \"targetId\" and a non-empty \"sourceIds\" array", "bad_request")
 			return
@@ -480,25 +863,33 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 				writeV3Error(w, err)
 				return
 			}
-			var input struct {
-				Name string `json:"name"`
-			}
+			var input AlbumInputV3
 			if err = json.Unmarshal(body, &input); err != nil || input.Name == "" {
 				writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a non-empty \"name\" field", "bad_request")
 				return
 			}
-			album, err := store.updateAlbum(id, input.Name)
+			album, err := store.updateAlbum(id, input)
 			if err != nil {
-				if err.Error() == "album_duplicate_name" {
-					writeV3ErrorResponse(w, http.StatusConflict, "An album with that name already exists", "duplicate_name")
-					return
-				}
-				writeV3Error(w, err)
+				writeAlbumWriteError(w, err)
 				return
 			}
 			writeJSONResponse(w, album, nil)
 		case "DELETE":
-			err := store.deleteAlbum(id)
+			strategy, err := deleteStrategyFromQuery(r.URL.Query())
+			if err != nil {
+				writeV3Error(w, err)
+				return
+			}
+			if strategy.Name != "" {
+				deletion, err := store.deleteAlbumWithStrategy(id, strategy)
+				if err != nil {
+					writeV3Error(w, err)
+					return
+				}
+				writeJSONResponse(w, deletion, nil)
+				return
+			}
+			err = store.deleteAlbum(id)
 			if err != nil {
 				if err.Error() == "album_in_use" {
 					writeV3ErrorResponse(w, http.StatusConflict, "Album is referenced by one or more tracks", "in_use")
@@ -511,6 +902,14 @@ func (store Datastore) AlbumsV3Controller(w http.ResponseWriter, r *http.Request
 		default:
 			MethodNotAllowed(w, []string{"GET", "PUT", "DELETE"})
 		}
+	} else if len(pathparts) == 3 && pathparts[2] == "tracks" {
+		// /v3/albums/{id}/tracks
+		id, err := strconv.Atoi(pathparts[1])
+		if err != nil || id <= 0 {
+			writeV3ErrorResponse(w, http.StatusNotFound, "Album Not Found", "not_found")
+			return
+		}
+		store.albumTracksHandler(w, r, id)
 	} else {
 		writeV3ErrorResponse(w, http.StatusNotFound, "Album Endpoint Not Found", "not_found")
 	}
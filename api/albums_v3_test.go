@@ -684,3 +684,125 @@ func TestV3PutSetsTrackActionHeader(test *testing.T) {
 		test.Error("Expected Track-Action header to be present on no-op PUT response, got empty")
 	}
 }
+
+// getTrackAlbumURI fetches a v3 track and returns the uri of its album tag, or "" if it has none.
+func getTrackAlbumURI(test *testing.T, path string) string {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	var track TrackV3
+	json.NewDecoder(resp.Body).Decode(&track)
+	if len(track.Tags["album"]) == 0 {
+		return ""
+	}
+	return track.Tags["album"][0].URI
+}
+
+// TestAlbumsSharingName checks albums can share a name as long as their artists, year or MusicBrainz release differ.
+func TestAlbumsSharingName(test *testing.T) {
+	clearData()
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"Queen"}],"year":1981}`, 201, `{"id":1,"name":"Greatest Hits","uri":"/albums/1","artists":[{"name":"Queen","uri":"/artists/1"}],"year":1981}`, true)
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"ABBA"}],"mbidRelease":"0d8e0f5a-8d3c-4b0a-9d6e-0f0c1e1a2b3c"}`, 201, `{"id":2,"name":"Greatest Hits","uri":"/albums/2","artists":[{"name":"ABBA","uri":"/artists/2"}],"mbidRelease":"0d8e0f5a-8d3c-4b0a-9d6e-0f0c1e1a2b3c"}`, true)
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits"}`, 201, `{"id":3,"name":"Greatest Hits","uri":"/albums/3"}`, true)
+
+	// Artists given by uri match those given by name
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"uri":"/artists/1"}],"year":1981}`, 409, `{"error":"An album with that name already exists","code":"duplicate_name"}`, true)
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits"}`, 409, `{"error":"An album with that name already exists","code":"duplicate_name"}`, true)
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Gold","mbidRelease":"0d8e0f5a-8d3c-4b0a-9d6e-0f0c1e1a2b3c"}`, 409, `{"error":"An album for that MusicBrainz release already exists","code":"duplicate_release"}`, true)
+	makeRequest(test, "POST", "/v3/albums", `{"name":"Gold","year":-4}`, 400, `{"error":"Album year -4 not allowed","code":"bad_request"}`, true)
+
+	makeRequest(test, "GET", "/v3/albums?q=Greatest", "", 200, `{"albums":[
+		{"id":1,"name":"Greatest Hits","uri":"/albums/1","artists":[{"name":"Queen","uri":"/artists/1"}],"year":1981,"usageCount":0},
+		{"id":2,"name":"Greatest Hits","uri":"/albums/2","artists":[{"name":"ABBA","uri":"/artists/2"}],"mbidRelease":"0d8e0f5a-8d3c-4b0a-9d6e-0f0c1e1a2b3c","usageCount":0},
+		{"id":3,"name":"Greatest Hits","uri":"/albums/3","usageCount":0}
+	],"totalPages":1,"page":1,"totalItems":3}`, true)
+	restartServer()
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Greatest Hits","uri":"/albums/1","artists":[{"name":"Queen","uri":"/artists/1"}],"year":1981}`, true)
+}
+
+// TestAlbumUpdateDisambiguation checks PUT only changes the artists, year and MusicBrainz release it's given.
+func TestAlbumUpdateDisambiguation(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Live","artists":[{"name":"Nirvana"}],"year":1996}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Live","year":1975}`, 201)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Live","mbidRelease":"c1f0a9b8-6b8e-4c7f-9f61-3e3a0d4f2e11"}`, 200, `{"id":1,"name":"Live","uri":"/albums/1","artists":[{"name":"Nirvana","uri":"/artists/1"}],"year":1996,"mbidRelease":"c1f0a9b8-6b8e-4c7f-9f61-3e3a0d4f2e11"}`, true)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Live","artists":[],"year":0,"mbidRelease":""}`, 200, `{"id":1,"name":"Live","uri":"/albums/1"}`, true)
+	makeRequest(test, "PUT", "/v3/albums/2", `{"name":"Live","year":0}`, 409, `{"error":"An album with that name already exists","code":"duplicate_name"}`, true)
+	makeRequest(test, "GET", "/v3/albums/2", "", 200, `{"id":2,"name":"Live","uri":"/albums/2","year":1975}`, true)
+}
+
+// TestTrackAlbumTagResolvesByHints checks a bare album name on a track picks between
+// albums sharing that name using the track's artist, year and mbid_release tags.
+func TestTrackAlbumTagResolvesByHints(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"Queen"}],"year":1981}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"ABBA"}],"mbidRelease":"0d8e0f5a-8d3c-4b0a-9d6e-0f0c1e1a2b3c"}`, 201)
+
+	setupRequest(test, "PUT", "/v3/tracks/1", `{"fingerprint":"hints1","url":"http://example.org/hints/1","duration":100,"tags":{"artist":[{"name":"Queen"}],"album":[{"name":"Greatest Hits"}]}}`, 200)
+	assertEqual(test, "Album picked by artist", "/albums/1", getTrackAlbumURI(test, "/v3/tracks/1"))
+
+	setupRequest(test, "PUT", "/v3/tracks/2", `{"fingerprint":"hints2","url":"http://example.org/hints/2","duration":100,"tags":{"year":[{"name":"1981-10-26"}],"album":[{"name":"Greatest Hits"}]}}`, 200)
+	assertEqual(test, "Album picked by year", "/albums/1", getTrackAlbumURI(test, "/v3/tracks/2"))
+
+	// Hints can come from tags already stored on the track
+	setupRequest(test, "PUT", "/v3/tracks/3", `{"fingerprint":"hints3","url":"http://example.org/hints/3","duration":100,"tags":{"artist":[{"name":"ABBA"}]}}`, 200)
+	setupRequest(test, "PATCH", "/v3/tracks/3", `{"tags":{"album":[{"name":"Greatest Hits"}]}}`, 200)
+	assertEqual(test, "Album picked by stored artist", "/albums/2", getTrackAlbumURI(test, "/v3/tracks/3"))
+
+	// Nothing to pick between the two
+	makeRequest(test, "PUT", "/v3/tracks/4", `{"fingerprint":"hints4","url":"http://example.org/hints/4","duration":100,"tags":{"album":[{"name":"Greatest Hits"}]}}`, 400, `{"error":"\"Greatest Hits\" matches more than one album (/albums/1, /albums/2); give a uri to pick one","code":"invalid_tag_value","predicate":"album"}`, true)
+
+	// A release which contradicts both albums is a different album, so gets created
+	setupRequest(test, "PUT", "/v3/tracks/5", `{"fingerprint":"hints5","url":"http://example.org/hints/5","duration":100,"tags":{"year":[{"name":"1992"}],"mbid_release":[{"name":"9a1d2c3b-4e5f-4a6b-8c7d-0e1f2a3b4c5d"}],"album":[{"name":"Greatest Hits"}]}}`, 200)
+	assertEqual(test, "Album created for new release", "/albums/3", getTrackAlbumURI(test, "/v3/tracks/5"))
+	makeRequest(test, "GET", "/v3/albums/3", "", 200, `{"id":3,"name":"Greatest Hits","uri":"/albums/3","mbidRelease":"9a1d2c3b-4e5f-4a6b-8c7d-0e1f2a3b4c5d"}`, true)
+	setupRequest(test, "PUT", "/v3/tracks/6", `{"fingerprint":"hints6","url":"http://example.org/hints/6","duration":100,"tags":{"mbid_release":[{"name":"9a1d2c3b-4e5f-4a6b-8c7d-0e1f2a3b4c5d"}],"album":[{"name":"Greatest Hits"}]}}`, 200)
+	assertEqual(test, "Album picked by release", "/albums/3", getTrackAlbumURI(test, "/v3/tracks/6"))
+}
+
+// TestAlbumArtistCredits checks credited artists can't be deleted, and merging artists moves their credits.
+func TestAlbumArtistCredits(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Arrival","artists":[{"name":"ABBA"},{"name":"Abba"}]}`, 201)
+	makeRequest(test, "DELETE", "/v3/artists/2", "", 409, `{"error":"Artist is credited on one or more albums","code":"in_use"}`, true)
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Arrival","uri":"/albums/1","artists":[{"name":"ABBA","uri":"/artists/1"}]}`, true)
+	setupRequest(test, "DELETE", "/v3/albums/1", "", 204)
+	setupRequest(test, "DELETE", "/v3/artists/1", "", 204)
+}
+
+// TestAlbumDetails checks track count, disc count, artwork and MusicBrainz release can be set, validated and cleared.
+func TestAlbumDetails(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road"}`, 201)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","trackCount":17,"discCount":1,"artwork":"https://example.org/abbey.jpg","mbidRelease":"DE4C8B16-7D8B-4E6D-A6E3-2F9A0A6D8A5E"}`, 200, `{"id":1,"name":"Abbey Road","uri":"/albums/1","mbidRelease":"de4c8b16-7d8b-4e6d-a6e3-2f9a0a6d8a5e","trackCount":17,"discCount":1,"artwork":"https://example.org/abbey.jpg"}`, true)
+
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","trackCount":-1}`, 400, `{"error":"Album trackCount -1 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","discCount":1000}`, 400, `{"error":"Album discCount 1000 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","artwork":"ftp://example.org/abbey.jpg"}`, 400, `{"error":"Album artwork \"ftp://example.org/abbey.jpg\", which isn't an http(s) URL, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","mbidRelease":"abbey"}`, 400, `{"error":"Album mbidRelease \"abbey\", which isn't a MusicBrainz id, not allowed","code":"bad_request"}`, true)
+
+	// Zero and empty values clear a detail; omitted ones are left alone
+	makeRequest(test, "PUT", "/v3/albums/1", `{"name":"Abbey Road","trackCount":0,"artwork":""}`, 200, `{"id":1,"name":"Abbey Road","uri":"/albums/1","mbidRelease":"de4c8b16-7d8b-4e6d-a6e3-2f9a0a6d8a5e","discCount":1}`, true)
+	restartServer()
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Abbey Road","uri":"/albums/1","mbidRelease":"de4c8b16-7d8b-4e6d-a6e3-2f9a0a6d8a5e","discCount":1}`, true)
+}
+
+// TestAlbumDetailsRDF checks album details are included in an album's RDF.
+func TestAlbumDetailsRDF(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road","artists":[{"name":"The Beatles"}],"year":1969,"trackCount":17,"artwork":"https://example.org/abbey.jpg"}`, 201)
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	defer os.Unsetenv("MEDIA_METADATA_MANAGER_ORIGIN")
+
+	request := basicRequest(test, "GET", "/v3/albums/1", "")
+	request.Header.Set("Accept", "text/turtle")
+	response, _ := doRawRequest(test, request)
+	responseData, _ := ioutil.ReadAll(response.Body)
+	body := string(responseData)
+	assertEqual(test, "Status", 200, response.StatusCode)
+	for _, expected := range []string{"http://localhost:8020/artists/1", "1969", "gYear", "track_count", "17", "https://example.org/abbey.jpg"} {
+		if !strings.Contains(body, expected) {
+			test.Errorf("Expected %q in album RDF, got: %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"lucos_media_metadata_api/predicateconfig"
+	"lucos_media_metadata_api/rdfgen"
+)
+
+// ArtistMemberV3 is a member of a group: either another artist, or an eolas Person
+// who isn't an artist in their own right.
+// From and Until are ISO 8601 dates, to whatever precision is known (eg "1960" or "1962-08").
+type ArtistMemberV3 struct {
+	Artist    *TagValueV3 `json:"artist,omitempty"`
+	PersonURI string      `json:"personUri,omitempty"`
+	Role      string      `json:"role,omitempty"` // eg "drums"
+	From      string      `json:"from,omitempty"`
+	Until     string      `json:"until,omitempty"`
+}
+
+// ArtistMembersV3 is a group's membership, listed in the order it was given.
+type ArtistMembersV3 struct {
+	Artist  ArtistV3         `json:"artist"`
+	Members []ArtistMemberV3 `json:"members"`
+}
+
+// membershipDatePattern matches an ISO 8601 year, month or day.
+var membershipDatePattern = regexp.MustCompile(`^[0-9]{4}(-[0-9]{2}(-[0-9]{2})?)?$`)
+
+// getArtistMembers returns the members of a group, in order.
+func (store Datastore) getArtistMembers(groupID int) (members []ArtistMemberV3, err error) {
+	var rows []struct {
+		MemberID   sql.NullInt64  `db:"memberid"`
+		MemberName sql.NullString `db:"name"`
+		PersonURI  sql.NullString `db:"person_uri"`
+		Role       sql.NullString `db:"role"`
+		StartDate  sql.NullString `db:"start_date"`
+		EndDate    sql.NullString `db:"end_date"`
+	}
+	err = store.DB.Select(&rows, `SELECT artist_member.memberid, artist.name, artist_member.person_uri, artist_member.role, artist_member.start_date, artist_member.end_date
+		FROM artist_member LEFT JOIN artist ON artist_member.memberid = artist.id
+		WHERE artist_member.groupid = $1 ORDER BY artist_member.position`, groupID)
+	if err != nil {
+		return
+	}
+	members = make([]ArtistMemberV3, len(rows))
+	for i, row := range rows {
+		members[i] = ArtistMemberV3{
+			PersonURI: row.PersonURI.String,
+			Role:      row.Role.String,
+			From:      row.StartDate.String,
+			Until:     row.EndDate.String,
+		}
+		if row.MemberID.Valid {
+			members[i].Artist = &TagValueV3{Name: row.MemberName.String, URI: store.artistURI(int(row.MemberID.Int64))}
+		}
+	}
+	return
+}
+
+// applyArtistMember validates a member given for a group, resolving its artist by name or URI
+// like artist tags on a track (creating the artist if need be).
+func (store Datastore) applyArtistMember(group ArtistV3, member ArtistMemberV3) (ArtistMemberV3, error) {
+	member.PersonURI = strings.TrimSpace(member.PersonURI)
+	member.Role = strings.TrimSpace(member.Role)
+	if member.Artist != nil && member.Artist.Name == "" && member.Artist.URI == "" {
+		member.Artist = nil
+	}
+	if (member.Artist == nil) == (member.PersonURI == "") {
+		return member, errors.New("Member of artist " + strconv.Itoa(group.ID) + " without exactly one of an artist or a personUri not allowed")
+	}
+	for _, date := range []string{member.From, member.Until} {
+		if date != "" && !membershipDatePattern.MatchString(date) {
+			return member, errors.New("Membership date \"" + date + "\", which isn't an ISO 8601 date, not allowed")
+		}
+	}
+	if member.From != "" && member.Until != "" && member.Until < member.From {
+		return member, errors.New("Membership from " + member.From + " until " + member.Until + " not allowed")
+	}
+	if member.Artist != nil {
+		artist, err := resolveTagValue(store, "artist", predicateconfig.GetConfig("artist"), *member.Artist, nil)
+		if err != nil {
+			return member, err
+		}
+		if artist.URI == group.URI {
+			return member, errors.New("Artist " + strconv.Itoa(group.ID) + " being a member of itself not allowed")
+		}
+		member.Artist = &artist
+	}
+	return member, nil
+}
+
+// setArtistMembers replaces the members of a group.
+// Returns "Artist Not Found" if the group doesn't exist.
+func (store Datastore) setArtistMembers(id int, members []ArtistMemberV3) (listing ArtistMembersV3, err error) {
+	slog.Info("Set Artist Members", "id", id, "members", len(members))
+	listing.Artist, err = store.getArtistByID(id)
+	if err != nil {
+		return
+	}
+	if listing.Artist.Type == "person" && len(members) > 0 {
+		err = errors.New("Members for artist " + strconv.Itoa(id) + ", a person, not allowed")
+		return
+	}
+	listing.Members = make([]ArtistMemberV3, len(members))
+	for i, member := range members {
+		listing.Members[i], err = store.applyArtistMember(listing.Artist, member)
+		if err != nil {
+			return
+		}
+	}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("DELETE FROM artist_member WHERE groupid = $1", id)
+	if err != nil {
+		return
+	}
+	for i, member := range listing.Members {
+		var memberID *int
+		if member.Artist != nil {
+			var artistID int
+			artistID, err = ParseArtistIDFromURI(member.Artist.URI)
+			if err != nil {
+				return
+			}
+			memberID = &artistID
+		}
+		_, err = tx.Exec("INSERT INTO artist_member(groupid, position, memberid, person_uri, role, start_date, end_date) VALUES($1, $2, $3, $4, $5, $6, $7)",
+			id, i+1, memberID, nullIfEmpty(member.PersonURI), nullIfEmpty(member.Role), nullIfEmpty(member.From), nullIfEmpty(member.Until))
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	store.Loganne.artistPost("artistUpdated", "Members of artist \""+listing.Artist.Name+"\" updated", listing.Artist, true)
+	return
+}
+
+// deleteArtistMemberships removes an artist's members and its memberships of groups, ahead of
+// deleting the artist.  Deleting them explicitly means it doesn't depend on foreign key cascades,
+// and memberid has no ON DELETE action, so a member couldn't otherwise be deleted.
+func deleteArtistMemberships(tx *sqlx.Tx, id int) error {
+	_, err := tx.Exec("DELETE FROM artist_member WHERE groupid = $1 OR memberid = $1", id)
+	return err
+}
+
+// rdfMembers converts a group's members to the form rdfgen uses to build mo:member triples.
+func rdfMembers(members []ArtistMemberV3) (data []rdfgen.MemberData) {
+	for _, member := range members {
+		if member.Artist != nil {
+			artistID, err := ParseArtistIDFromURI(member.Artist.URI)
+			if err != nil {
+				continue
+			}
+			data = append(data, rdfgen.MemberData{ArtistID: artistID})
+		} else {
+			data = append(data, rdfgen.MemberData{PersonURI: member.PersonURI})
+		}
+	}
+	return
+}
+
+// artistMembersHandler handles requests to /v3/artists/{id}/members.
+// PUT replaces the whole membership with the members given.
+func (store Datastore) artistMembersHandler(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case "GET":
+		artist, err := store.getArtistByID(id)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		members, err := store.getArtistMembers(id)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, ArtistMembersV3{Artist: artist, Members: members}, nil)
+	case "PUT":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		var input struct {
+			Members *[]ArtistMemberV3 `json:"members"`
+		}
+		if err = json.Unmarshal(body, &input); err != nil || input.Members == nil {
+			writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a \"members\" array", "bad_request")
+			return
+		}
+		for _, member := range *input.Members {
+			if member.PersonURI != "" {
+				if msg := validateArtistPersonURI(member.PersonURI); msg != "" {
+					writeV3ErrorResponse(w, http.StatusBadRequest, msg, "invalid_person_uri")
+					return
+				}
+			}
+		}
+		listing, err := store.setArtistMembers(id, *input.Members)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, listing, nil)
+	default:
+		MethodNotAllowed(w, []string{"GET", "PUT"})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestArtistMembers checks a group's members can be set, listed and replaced.
+func TestArtistMembers(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles","type":"group"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"John Lennon"}`, 201)
+	makeRequest(test, "GET", "/v3/artists/1/members", "", 200, `{"artist":{"id":1,"name":"The Beatles","uri":"/artists/1","type":"group"},"members":[]}`, true)
+
+	makeRequest(test, "PUT", "/v3/artists/1/members", `{"members":[
+		{"artist":{"uri":"/artists/2"},"role":"guitar","from":"1960","until":"1970"},
+		{"artist":{"name":"Paul McCartney"},"role":" bass "},
+		{"personUri":"https://eolas.l42.eu/metadata/person/7/","from":"1960-08","until":"1962-08-16"}
+	]}`, 200, `{"artist":{"id":1,"name":"The Beatles","uri":"/artists/1","type":"group"},"members":[`+
+		`{"artist":{"name":"John Lennon","uri":"/artists/2"},"role":"guitar","from":"1960","until":"1970"},`+
+		`{"artist":{"name":"Paul McCartney","uri":"/artists/3"},"role":"bass"},`+
+		`{"personUri":"https://eolas.l42.eu/metadata/person/7/","from":"1960-08","until":"1962-08-16"}]}`, true)
+	restartServer()
+	makeRequest(test, "GET", "/v3/artists/1/members", "", 200, `{"artist":{"id":1,"name":"The Beatles","uri":"/artists/1","type":"group"},"members":[`+
+		`{"artist":{"name":"John Lennon","uri":"/artists/2"},"role":"guitar","from":"1960","until":"1970"},`+
+		`{"artist":{"name":"Paul McCartney","uri":"/artists/3"},"role":"bass"},`+
+		`{"personUri":"https://eolas.l42.eu/metadata/person/7/","from":"1960-08","until":"1962-08-16"}]}`, true)
+
+	makeRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"uri":"/artists/3"}}]}`, 200, `{"artist":{"id":1,"name":"The Beatles","uri":"/artists/1","type":"group"},"members":[{"artist":{"name":"Paul McCartney","uri":"/artists/3"}}]}`, true)
+}
+
+// TestArtistMembersErrors checks invalid memberships are rejected without changing the members.
+func TestArtistMembersErrors(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Wings"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Linda McCartney","type":"person"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"uri":"/artists/2"}}]}`, 200)
+	path := "/v3/artists/1/members"
+
+	makeRequest(test, "PUT", path, `{}`, 400, `{"error":"Request body must include a \"members\" array","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"role":"drums"}]}`, 400, `{"error":"Member of artist 1 without exactly one of an artist or a personUri not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"artist":{"uri":"/artists/2"},"personUri":"https://eolas.l42.eu/metadata/person/7/"}]}`, 400, `{"error":"Member of artist 1 without exactly one of an artist or a personUri not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"personUri":"https://contacts.l42.eu/people/7/"}]}`, 400, `{"error":"personUri must start with the eolas origin (https://eolas.l42.eu/)","code":"invalid_person_uri"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"artist":{"uri":"/artists/2"},"from":"71"}]}`, 400, `{"error":"Membership date \"71\", which isn't an ISO 8601 date, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"artist":{"uri":"/artists/2"},"from":"1981","until":"1971"}]}`, 400, `{"error":"Membership from 1981 until 1971 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", path, `{"members":[{"artist":{"uri":"/artists/1"}}]}`, 400, `{"error":"Artist 1 being a member of itself not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/artists/2/members", `{"members":[{"artist":{"uri":"/artists/1"}}]}`, 400, `{"error":"Members for artist 2, a person, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "GET", "/v3/artists/9/members", "", 404, `{"error":"Artist Not Found","code":"not_found"}`, true)
+	makeRequestWithUnallowedMethod(test, path, "POST", []string{"GET", "PUT"})
+	makeRequest(test, "GET", path, "", 200, `{"artist":{"id":1,"name":"Wings","uri":"/artists/1"},"members":[{"artist":{"name":"Linda McCartney","uri":"/artists/2"}}]}`, true)
+
+	// Members can't be deleted while they're in a group, but groups can
+	makeRequest(test, "DELETE", "/v3/artists/2", "", 409, `{"error":"Artist is a member of one or more groups","code":"in_use"}`, true)
+	setupRequest(test, "DELETE", "/v3/artists/1", "", 204)
+	setupRequest(test, "DELETE", "/v3/artists/2", "", 204)
+}
+
+// TestArtistMergeMovesMemberships checks merging artists keeps their memberships and members.
+func TestArtistMergeMovesMemberships(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Beatles"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Plastic Ono Band"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"name":"Ringo Starr"}}]}`, 200)
+	setupRequest(test, "PUT", "/v3/artists/2/members", `{"members":[{"artist":{"name":"George Harrison"}},{"artist":{"uri":"/artists/1"}}]}`, 200)
+	setupRequest(test, "PUT", "/v3/artists/3/members", `{"members":[{"artist":{"uri":"/artists/1"}}]}`, 200)
+
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":2,"sourceIds":[1]}`, 200)
+	makeRequest(test, "GET", "/v3/artists/2/members", "", 200, `{"artist":{"id":2,"name":"The Beatles","uri":"/artists/2"},"members":[{"artist":{"name":"George Harrison","uri":"/artists/5"}},{"artist":{"name":"Ringo Starr","uri":"/artists/4"}}]}`, true)
+	makeRequest(test, "GET", "/v3/artists/3/members", "", 200, `{"artist":{"id":3,"name":"Plastic Ono Band","uri":"/artists/3"},"members":[{"artist":{"name":"The Beatles","uri":"/artists/2"}}]}`, true)
+}
+
+// TestArtistMembersRDF checks a group's members are included in its RDF as mo:member.
+func TestArtistMembersRDF(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"name":"John Lennon"}},{"personUri":"https://eolas.l42.eu/metadata/person/7/"}]}`, 200)
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	defer os.Unsetenv("MEDIA_METADATA_MANAGER_ORIGIN")
+
+	request := basicRequest(test, "GET", "/v3/artists/1", "")
+	request.Header.Set("Accept", "text/turtle")
+	response, _ := doRawRequest(test, request)
+	responseData, _ := ioutil.ReadAll(response.Body)
+	body := string(responseData)
+	assertEqual(test, "Status", 200, response.StatusCode)
+	for _, expected := range []string{"http://purl.org/ontology/mo/member", "http://localhost:8020/artists/2", "https://eolas.l42.eu/metadata/person/7/"} {
+		if !strings.Contains(body, expected) {
+			test.Errorf("Expected %q in artist RDF, got: %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ArtistSplitTargetV3 is one of the artists a combined credit is split into, given
+// either by the id of an existing artist or by name.
+type ArtistSplitTargetV3 struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// ArtistSplitInputV3 is the request body for splitting an artist.
+// The original artist is kept unless DeleteOriginal is set.
+type ArtistSplitInputV3 struct {
+	Artists        []ArtistSplitTargetV3 `json:"artists"`
+	DeleteOriginal bool                  `json:"deleteOriginal"`
+}
+
+// ArtistSplitV3 is the outcome of splitting an artist: the original artist, the
+// artists its tracks are now credited to, and the tracks which were changed.
+type ArtistSplitV3 struct {
+	Artist   ArtistV3   `json:"artist"`
+	Artists  []ArtistV3 `json:"artists"`
+	TrackIDs []int      `json:"trackIds"`
+	Deleted  bool       `json:"deleted"`
+}
+
+// resolveSplitTargets finds the artists an artist is being split into, creating any
+// given by a name no artist is known by.  An artist given more than once is only included once.
+func (store Datastore) resolveSplitTargets(original ArtistV3, targets []ArtistSplitTargetV3) (artists []ArtistV3, names []string, err error) {
+	// Check every target is valid before creating any artists
+	for _, target := range targets {
+		target.Name = strings.TrimSpace(target.Name)
+		if (target.ID == 0) == (target.Name == "") {
+			return nil, nil, errors.New("Split target without exactly one of an id or a name not allowed")
+		}
+		if target.Name != "" {
+			target.ID, err = store.findArtistIDByName(target.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if target.ID == original.ID {
+			return nil, nil, errors.New("Artist " + strconv.Itoa(original.ID) + " being split into itself not allowed")
+		}
+		if target.ID != 0 && target.Name == "" {
+			if _, err = store.getArtistByID(target.ID); err != nil {
+				if err.Error() == "Artist Not Found" {
+					err = errors.New("Split into missing artist " + strconv.Itoa(target.ID) + " not allowed")
+				}
+				return nil, nil, err
+			}
+		}
+	}
+	seen := map[int]bool{}
+	for _, target := range targets {
+		var artist ArtistV3
+		name := strings.TrimSpace(target.Name)
+		if target.ID != 0 {
+			artist, err = store.getArtistByID(target.ID)
+			name = artist.Name
+		} else {
+			artist, err = store.resolveOrCreateArtistByName(name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if seen[artist.ID] {
+			continue
+		}
+		seen[artist.ID] = true
+		artists = append(artists, artist)
+		names = append(names, name)
+	}
+	return
+}
+
+// splitArtist replaces the artist tags referencing a combined credit, such as
+// "Simon & Garfunkel", with tags for each of the artists it's split into.
+// Tracks already tagged with one of those artists aren't given it twice.
+// The original artist is deleted if asked, in which case it returns the same errors as
+// deleteArtist if it's credited on an album or is a member of a group, before changing anything.
+func (store Datastore) splitArtist(id int, input ArtistSplitInputV3) (split ArtistSplitV3, err error) {
+	slog.Info("Split Artist", "id", id, "artists", len(input.Artists))
+	split.Artist, err = store.getArtistByID(id)
+	if err != nil {
+		return
+	}
+	if input.DeleteOriginal {
+		err = store.checkArtistUncredited(id)
+		if err != nil {
+			return
+		}
+	}
+	var names []string
+	split.Artists, names, err = store.resolveSplitTargets(split.Artist, input.Artists)
+	if err != nil {
+		return
+	}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	split.TrackIDs = []int{}
+	err = tx.Select(&split.TrackIDs, "SELECT DISTINCT trackid FROM tag WHERE predicateid = 'artist' AND uri = $1 ORDER BY trackid", split.Artist.URI)
+	if err != nil {
+		return
+	}
+	for _, trackID := range split.TrackIDs {
+		_, err = tx.Exec("DELETE FROM tag WHERE trackid = $1 AND predicateid = 'artist' AND uri = $2", trackID, split.Artist.URI)
+		if err != nil {
+			return
+		}
+		for i, artist := range split.Artists {
+			_, err = tx.Exec(`INSERT INTO tag(trackid, predicateid, value, uri) SELECT $1, 'artist', $2, $3
+				WHERE NOT EXISTS (SELECT 1 FROM tag WHERE trackid = $1 AND predicateid = 'artist' AND uri = $3)`,
+				trackID, names[i], artist.URI)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if input.DeleteOriginal {
+		err = deleteArtistMemberships(tx, id)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec("DELETE FROM artist WHERE id = $1", id)
+		if err != nil {
+			return
+		}
+		split.Deleted = true
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	quoted := make([]string, len(split.Artists))
+	for i, artist := range split.Artists {
+		quoted[i] = "\"" + artist.Name + "\""
+	}
+	store.Loganne.artistPost("artistSplit", "Artist \""+split.Artist.Name+"\" split into "+strings.Join(quoted, ", "), split.Artist, !split.Deleted)
+	return
+}
+
+// artistSplitHandler handles requests to /v3/artists/{id}/split.
+func (store Datastore) artistSplitHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != "POST" {
+		MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	var input ArtistSplitInputV3
+	if err = json.Unmarshal(body, &input); err != nil || len(input.Artists) < 2 {
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include an \"artists\" array of at least two artists", "bad_request")
+		return
+	}
+	split, err := store.splitArtist(id, input)
+	if err != nil {
+		writeArtistDeleteError(w, err)
+		return
+	}
+	writeJSONResponse(w, split, nil)
+}
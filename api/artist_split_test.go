@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestArtistSplit checks a combined artist credit is replaced on every track by the
+// artists it's split into, keeping the original artist unless asked otherwise.
+func TestArtistSplit(test *testing.T) {
+	clearData()
+	first := setupMergeTrack(test, 1, `"artist":[{"name":"Simon & Garfunkel"}]`)
+	second := setupMergeTrack(test, 2, `"artist":[{"name":"Simon & Garfunkel"},{"name":"Paul Simon"}]`)
+	other := setupMergeTrack(test, 3, `"artist":[{"name":"Paul Simon"}]`)
+
+	makeRequest(test, "POST", "/v3/artists/1/split", `{"artists":[{"id":2},{"name":" Art Garfunkel "}]}`, 200,
+		`{"artist":{"id":1,"name":"Simon & Garfunkel","uri":"/artists/1"},"artists":[{"id":2,"name":"Paul Simon","uri":"/artists/2"},{"id":3,"name":"Art Garfunkel","uri":"/artists/3"}],"trackIds":[1,2],"deleted":false}`, true)
+	assertEqual(test, "loganne event type", "artistSplit", lastLoganneType)
+	assertEqual(test, "loganne message", `Artist "Simon & Garfunkel" split into "Paul Simon", "Art Garfunkel"`, lastLoganneMessage)
+
+	assertEqual(test, "First track artists", fmt.Sprint([]TagValueV3{{Name: "Paul Simon", URI: "/artists/2"}, {Name: "Art Garfunkel", URI: "/artists/3"}}), fmt.Sprint(getTagsForTrack(test, first)["artist"]))
+	assertEqual(test, "Second track artists", fmt.Sprint([]TagValueV3{{Name: "Paul Simon", URI: "/artists/2"}, {Name: "Art Garfunkel", URI: "/artists/3"}}), fmt.Sprint(getTagsForTrack(test, second)["artist"]))
+	assertEqual(test, "Other track artists", fmt.Sprint([]TagValueV3{{Name: "Paul Simon", URI: "/artists/2"}}), fmt.Sprint(getTagsForTrack(test, other)["artist"]))
+	makeRequest(test, "GET", "/v3/artists/1", "", 200, `{"id":1,"name":"Simon & Garfunkel","uri":"/artists/1"}`, true)
+}
+
+// TestArtistSplitDeletesOriginal checks the original artist can be deleted as part of the split,
+// but not if it's still credited on an album.
+func TestArtistSplitDeletesOriginal(test *testing.T) {
+	clearData()
+	trackURL := setupMergeTrack(test, 1, `"artist":[{"name":"Santana feat. Rob Thomas"}]`)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Supernatural","artists":[{"uri":"/artists/1"}]}`, 201)
+	body := `{"artists":[{"name":"Santana"},{"name":"Rob Thomas"}],"deleteOriginal":true}`
+
+	makeRequest(test, "POST", "/v3/artists/1/split", body, 409, `{"error":"Artist is credited on one or more albums","code":"in_use"}`, true)
+	assertEqual(test, "Track unchanged", fmt.Sprint([]TagValueV3{{Name: "Santana feat. Rob Thomas", URI: "/artists/1"}}), fmt.Sprint(getTagsForTrack(test, trackURL)["artist"]))
+
+	setupRequest(test, "PUT", "/v3/albums/1", `{"name":"Supernatural","artists":[]}`, 200)
+	makeRequest(test, "POST", "/v3/artists/1/split", body, 200,
+		`{"artist":{"id":1,"name":"Santana feat. Rob Thomas","uri":"/artists/1"},"artists":[{"id":2,"name":"Santana","uri":"/artists/2"},{"id":3,"name":"Rob Thomas","uri":"/artists/3"}],"trackIds":[1],"deleted":true}`, true)
+	makeRequest(test, "GET", "/v3/artists/1", "", 404, `{"error":"Artist Not Found","code":"not_found"}`, true)
+	assertEqual(test, "Track split", fmt.Sprint([]TagValueV3{{Name: "Santana", URI: "/artists/2"}, {Name: "Rob Thomas", URI: "/artists/3"}}), fmt.Sprint(getTagsForTrack(test, trackURL)["artist"]))
+}
+
+// TestArtistSplitErrors checks invalid splits are rejected.
+func TestArtistSplitErrors(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Crosby, Stills & Nash","aliases":["CSN"]}`, 201)
+	path := "/v3/artists/1/split"
+
+	makeRequest(test, "POST", path, `{"artists":[{"name":"David Crosby"}]}`, 400, `{"error":"Request body must include an \"artists\" array of at least two artists","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path, `{"artists":[{"name":"David Crosby"},{}]}`, 400, `{"error":"Split target without exactly one of an id or a name not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path, `{"artists":[{"name":"David Crosby"},{"id":1}]}`, 400, `{"error":"Artist 1 being split into itself not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path, `{"artists":[{"name":"David Crosby"},{"name":"CSN"}]}`, 400, `{"error":"Artist 1 being split into itself not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path, `{"artists":[{"name":"David Crosby"},{"id":99}]}`, 400, `{"error":"Split into missing artist 99 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", "/v3/artists/99/split", `{"artists":[{"name":"David Crosby"},{"name":"Graham Nash"}]}`, 404, `{"error":"Artist Not Found","code":"not_found"}`, true)
+	makeRequestWithUnallowedMethod(test, path, "GET", []string{"POST"})
+	makeRequest(test, "GET", "/v3/artists", "", 200, `{"artists":[{"id":1,"name":"Crosby, Stills & Nash","uri":"/artists/1","aliases":["CSN"],"usageCount":0}],"totalPages":1,"page":1,"totalItems":1}`, true)
+}
@@ -9,20 +9,57 @@ import (
 	"log/slog"
 	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
+
 	"lucos_media_metadata_api/rdfgen"
 )
 
 // ArtistV3 is the v3 wire representation of an artist.
 type ArtistV3 struct {
-	ID        int     `json:"id"`
-	Name      string  `json:"name"`
-	URI       string  `json:"uri"`
-	PersonURI *string `json:"personUri,omitempty"` // optional eolas:Person identity link (ADR-0009)
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	PersonURI  *string  `json:"personUri,omitempty"` // optional eolas:Person identity link (ADR-0009)
+	SortName   string   `json:"sortName,omitempty"`  // eg "Beatles, The"; listings sort by Name when unset
+	Aliases    []string `json:"aliases,omitempty"`   // other names the artist is known by
+	MBIDArtist string   `json:"mbidArtist,omitempty"`
+	Type       string   `json:"type,omitempty"`       // one of artistTypes
+	UsageCount *int     `json:"usageCount,omitempty"` // the number of tracks tagged with the artist, in listings
+}
+
+// ArtistInputV3 is the request body for creating or updating an artist.
+// When updating, fields left out keep their current values; an empty string or
+// aliases list clears them.
+type ArtistInputV3 struct {
+	Name       string    `json:"name"`
+	PersonURI  *string   `json:"personUri"`
+	SortName   *string   `json:"sortName"`
+	Aliases    *[]string `json:"aliases"`
+	MBIDArtist *string   `json:"mbidArtist"`
+	Type       *string   `json:"type"`
+}
+
+// artistTypes lists the kinds of artist which can be given as an artist's type.
+var artistTypes = []string{"person", "group", "orchestra", "choir"}
+
+// artistRow is a row of the artist table.
+type artistRow struct {
+	ID         int            `db:"id"`
+	Name       string         `db:"name"`
+	PersonURI  sql.NullString `db:"person_uri"`
+	SortName   sql.NullString `db:"sort_name"`
+	MBIDArtist sql.NullString `db:"mbid_artist"`
+	Type       sql.NullString `db:"type"`
+	UsageCount sql.NullInt64  `db:"usage_count"` // only selected for listings
 }
 
+// artistColumns lists the artist table columns scanned into an artistRow.
+const artistColumns = "id, name, person_uri, sort_name, mbid_artist, type"
+
 // validateArtistPersonURI checks that personURI, if non-empty, starts with the
 // configured eolas origin (host-validated per ADR-0005/#245). Returns a non-empty
 // error message suitable for a 400 response if validation fails, empty string if OK.
@@ -70,52 +107,47 @@ func ParseArtistIDFromURI(uri string) (int, error) {
 	return id, nil
 }
 
-// getAllArtists returns a paginated list of artists, optionally filtered by a
-// case-insensitive substring match on name via the q parameter.
-func (store Datastore) getAllArtists(rawpage, q string) (list ArtistListV3, err error) {
+// getAllArtists returns a paginated list of artists, each with the number of tracks tagged
+// with it, optionally filtered by a case-insensitive substring match on name (or sort name
+// or alias) via the q parameter.
+// Orphaned artists are those tagged on no tracks, credited on no albums and in no groups.
+func (store Datastore) getAllArtists(options listOptions) (list ArtistListV3, err error) {
 	const standardLimit = 20
 
-	offset, limit := parsePageParam(rawpage, standardLimit)
+	offset, limit := parsePageParam(options.Page, standardLimit)
 
-	page, parseErr := strconv.Atoi(rawpage)
+	page, parseErr := strconv.Atoi(options.Page)
 	if parseErr != nil || page < 1 {
 		page = 1
 	}
 
-	type artistRow struct {
-		ID        int            `db:"id"`
-		Name      string         `db:"name"`
-		PersonURI sql.NullString `db:"person_uri"`
+	from := "FROM artist " + tagUsageJoin("artist", "artist") + " WHERE 1"
+	args := []interface{}{store.ManagerOrigin}
+	if options.Query != "" {
+		like := "%" + options.Query + "%"
+		from += " AND (name LIKE ? OR sort_name LIKE ? OR id IN (SELECT artistid FROM artist_alias WHERE name LIKE ?))"
+		args = append(args, like, like, like)
+	}
+	if options.Orphans {
+		from += " AND " + orphanedArtist
 	}
 
 	var total int
-	var rows []artistRow
-	if q != "" {
-		like := "%" + q + "%"
-		err = store.DB.Get(&total, "SELECT COUNT(*) FROM artist WHERE name LIKE $1", like)
-		if err != nil {
-			return
-		}
-		err = store.DB.Select(&rows, "SELECT id, name, person_uri FROM artist WHERE name LIKE $1 ORDER BY name LIMIT $2 OFFSET $3", like, limit, offset)
-	} else {
-		err = store.DB.Get(&total, "SELECT COUNT(*) FROM artist")
-		if err != nil {
-			return
-		}
-		err = store.DB.Select(&rows, "SELECT id, name, person_uri FROM artist ORDER BY name LIMIT $1 OFFSET $2", limit, offset)
+	err = store.DB.Get(&total, "SELECT COUNT(*) "+from, args...)
+	if err != nil {
+		return
 	}
+	// Artists are listed by sort name where they have one, so "The Beatles" sorts under B.
+	var rows []artistRow
+	err = store.DB.Select(&rows, "SELECT "+artistColumns+", IFNULL(usage.count, 0) AS usage_count "+from+
+		" ORDER BY "+options.orderBy("IFNULL(sort_name, name), name")+" LIMIT ? OFFSET ?", append(args, limit, offset)...)
 	if err != nil {
 		return
 	}
 
-	artists := make([]ArtistV3, len(rows))
-	for i, row := range rows {
-		artists[i] = ArtistV3{
-			ID:        row.ID,
-			Name:      row.Name,
-			URI:       store.artistURI(row.ID),
-			PersonURI: nullStringToPtr(row.PersonURI),
-		}
+	artists, err := store.artistsFromRows(rows)
+	if err != nil {
+		return
 	}
 
 	list = ArtistListV3{
@@ -127,27 +159,72 @@ func (store Datastore) getAllArtists(rawpage, q string) (list ArtistListV3, err
 	return
 }
 
+// artistsFromRows converts artist table rows to ArtistV3s, along with each artist's aliases.
+func (store Datastore) artistsFromRows(rows []artistRow) (artists []ArtistV3, err error) {
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	aliases, err := store.getArtistAliases(ids)
+	if err != nil {
+		return
+	}
+	artists = make([]ArtistV3, len(rows))
+	for i, row := range rows {
+		artists[i] = ArtistV3{
+			ID:         row.ID,
+			Name:       row.Name,
+			URI:        store.artistURI(row.ID),
+			PersonURI:  nullStringToPtr(row.PersonURI),
+			SortName:   row.SortName.String,
+			Aliases:    aliases[row.ID],
+			MBIDArtist: row.MBIDArtist.String,
+			Type:       row.Type.String,
+			UsageCount: nullIntToPtr(row.UsageCount),
+		}
+	}
+	return
+}
+
+// getArtistAliases returns the aliases of each of the given artists, in alphabetical order, keyed by artist id.
+func (store Datastore) getArtistAliases(artistIDs []int) (aliases map[int][]string, err error) {
+	aliases = make(map[int][]string, len(artistIDs))
+	if len(artistIDs) == 0 {
+		return
+	}
+	query, args, err := sqlx.In("SELECT artistid, name FROM artist_alias WHERE artistid IN (?) ORDER BY artistid, name", artistIDs)
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		ArtistID int    `db:"artistid"`
+		Name     string `db:"name"`
+	}
+	err = store.DB.Select(&rows, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		aliases[row.ArtistID] = append(aliases[row.ArtistID], row.Name)
+	}
+	return
+}
+
 // getArtistByID returns a single artist by its integer ID.
 func (store Datastore) getArtistByID(id int) (artist ArtistV3, err error) {
-	type artistRow struct {
-		ID        int            `db:"id"`
-		Name      string         `db:"name"`
-		PersonURI sql.NullString `db:"person_uri"`
-	}
 	var row artistRow
-	err = store.DB.Get(&row, "SELECT id, name, person_uri FROM artist WHERE id = $1", id)
+	err = store.DB.Get(&row, "SELECT "+artistColumns+" FROM artist WHERE id = $1", id)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			err = errors.New("Artist Not Found")
 		}
 		return
 	}
-	artist = ArtistV3{
-		ID:        row.ID,
-		Name:      row.Name,
-		URI:       store.artistURI(row.ID),
-		PersonURI: nullStringToPtr(row.PersonURI),
+	artists, err := store.artistsFromRows([]artistRow{row})
+	if err != nil {
+		return
 	}
+	artist = artists[0]
 	return
 }
 
@@ -161,41 +238,174 @@ func nullStringToPtr(ns sql.NullString) *string {
 	return &s
 }
 
-// createArtist inserts a new artist with the given name and returns the created ArtistV3.
-// Returns an "artist_duplicate_name" error if the name already exists.
-func (store Datastore) createArtist(name string) (artist ArtistV3, err error) {
-	slog.Info("Create Artist", "name", name)
-	result, err := store.DB.Exec("INSERT INTO artist(name) VALUES($1)", name)
+// applyArtistInput validates the fields given in an ArtistInputV3 and copies them onto an artist.
+func applyArtistInput(artist *ArtistV3, input ArtistInputV3) error {
+	artist.Name = input.Name
+	if input.PersonURI != nil {
+		artist.PersonURI = nil
+		if *input.PersonURI != "" {
+			personURI := *input.PersonURI
+			artist.PersonURI = &personURI
+		}
+	}
+	if input.SortName != nil {
+		artist.SortName = strings.TrimSpace(*input.SortName)
+	}
+	if input.MBIDArtist != nil {
+		artist.MBIDArtist = strings.ToLower(strings.TrimSpace(*input.MBIDArtist))
+		if artist.MBIDArtist != "" && !mbidPattern.MatchString(artist.MBIDArtist) {
+			return errors.New("Artist mbidArtist \"" + artist.MBIDArtist + "\", which isn't a MusicBrainz id, not allowed")
+		}
+	}
+	if input.Type != nil {
+		artist.Type = strings.ToLower(strings.TrimSpace(*input.Type))
+		if artist.Type != "" && !slices.Contains(artistTypes, artist.Type) {
+			return errors.New("Artist type \"" + artist.Type + "\", which isn't one of " + strings.Join(artistTypes, ", ") + ", not allowed")
+		}
+	}
+	if input.Aliases != nil {
+		artist.Aliases = []string{}
+		for _, alias := range *input.Aliases {
+			alias = strings.TrimSpace(alias)
+			if alias == "" || alias == artist.Name || slices.Contains(artist.Aliases, alias) {
+				continue
+			}
+			artist.Aliases = append(artist.Aliases, alias)
+		}
+		slices.Sort(artist.Aliases)
+	}
+	// A rename can make an existing alias redundant
+	artist.Aliases = slices.DeleteFunc(artist.Aliases, func(alias string) bool { return alias == artist.Name })
+	return nil
+}
+
+// checkArtistNamesFree returns an "artist_duplicate_alias" error if the artist's
+// name is another artist's alias, or any of its aliases is another artist's name
+// or alias.  Otherwise resolving a tag by that name couldn't tell which artist is meant.
+func (store Datastore) checkArtistNamesFree(artist ArtistV3) (err error) {
+	names := append([]string{artist.Name}, artist.Aliases...)
+	query, args, err := sqlx.In(`SELECT COUNT(*) FROM artist_alias WHERE artistid != ? AND name IN (?)`, artist.ID, names)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			err = errors.New("artist_duplicate_name")
+		return
+	}
+	var count int
+	err = store.DB.Get(&count, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	if count == 0 && len(artist.Aliases) > 0 {
+		query, args, err = sqlx.In(`SELECT COUNT(*) FROM artist WHERE id != ? AND name IN (?)`, artist.ID, artist.Aliases)
+		if err != nil {
+			return
+		}
+		err = store.DB.Get(&count, store.DB.Rebind(query), args...)
+		if err != nil {
+			return
+		}
+	}
+	if count > 0 {
+		err = errors.New("artist_duplicate_alias")
+	}
+	return
+}
+
+// setArtistAliases replaces an artist's aliases.
+func setArtistAliases(tx *sqlx.Tx, artistID int, aliases []string) (err error) {
+	_, err = tx.Exec("DELETE FROM artist_alias WHERE artistid = $1", artistID)
+	if err != nil {
+		return
+	}
+	for _, alias := range aliases {
+		_, err = tx.Exec("INSERT INTO artist_alias(artistid, name) VALUES($1, $2)", artistID, alias)
+		if err != nil {
+			return
 		}
+	}
+	return
+}
+
+// artistWriteError maps constraint failures when writing an artist to the errors the controller expects.
+func artistWriteError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), "UNIQUE constraint failed: artist.mbid_artist"):
+		return errors.New("artist_duplicate_mbid")
+	case strings.Contains(err.Error(), "UNIQUE constraint failed: artist_alias.name"):
+		return errors.New("artist_duplicate_alias")
+	case strings.Contains(err.Error(), "UNIQUE constraint failed"):
+		return errors.New("artist_duplicate_name")
+	}
+	return err
+}
+
+// createArtist inserts a new artist and returns the created ArtistV3.
+// Returns an "artist_duplicate_name" error if the name already exists, "artist_duplicate_alias"
+// if another artist is known by its name or one of its aliases, or "artist_duplicate_mbid"
+// if its MusicBrainz id is taken.
+func (store Datastore) createArtist(input ArtistInputV3) (artist ArtistV3, err error) {
+	slog.Info("Create Artist", "name", input.Name)
+	err = applyArtistInput(&artist, input)
+	if err != nil {
+		return
+	}
+	err = store.checkArtistNamesFree(artist)
+	if err != nil {
+		return
+	}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec("INSERT INTO artist(name, person_uri, sort_name, mbid_artist, type) VALUES($1, $2, $3, $4, $5)",
+		artist.Name, artist.PersonURI, nullIfEmpty(artist.SortName), nullIfEmpty(artist.MBIDArtist), nullIfEmpty(artist.Type))
+	if err != nil {
+		err = artistWriteError(err)
 		return
 	}
 	id64, err := result.LastInsertId()
 	if err != nil {
 		return
 	}
-	artist = ArtistV3{
-		ID:   int(id64),
-		Name: name,
-		URI:  store.artistURI(int(id64)),
+	err = setArtistAliases(tx, int(id64), artist.Aliases)
+	if err != nil {
+		err = artistWriteError(err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
 	}
-	store.Loganne.artistPost("artistCreated", "Artist \""+name+"\" created", artist, true)
+	artist.ID = int(id64)
+	artist.URI = store.artistURI(artist.ID)
+	store.Loganne.artistPost("artistCreated", "Artist \""+artist.Name+"\" created", artist, true)
 	return
 }
 
-// updateArtist renames an existing artist and optionally updates the eolas:Person
-// identity link (ADR-0009).
+// updateArtist renames an existing artist and updates whichever of its other fields are given.
 //
-// personURI semantics:
+// personURI semantics (the eolas:Person identity link, ADR-0009):
 //   - nil: do not change the existing person_uri value
 //   - pointer to "": clear person_uri (set to NULL — un-curate the identity link)
 //   - pointer to non-empty string: set person_uri to that value
 //
 // Returns "Artist Not Found" if the id doesn't exist.
-func (store Datastore) updateArtist(id int, name string, personURI *string) (artist ArtistV3, err error) {
-	slog.Info("Update Artist", "id", id, "name", name)
+func (store Datastore) updateArtist(id int, input ArtistInputV3) (artist ArtistV3, err error) {
+	slog.Info("Update Artist", "id", id, "name", input.Name)
+	artist, err = store.getArtistByID(id)
+	if err != nil {
+		return
+	}
+	oldName := artist.Name
+	err = applyArtistInput(&artist, input)
+	if err != nil {
+		return
+	}
+	err = store.checkArtistNamesFree(artist)
+	if err != nil {
+		return
+	}
 
 	tx, err := store.DB.Beginx()
 	if err != nil {
@@ -203,44 +413,25 @@ func (store Datastore) updateArtist(id int, name string, personURI *string) (art
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	var result sql.Result
-	if personURI == nil {
-		// Don't touch person_uri
-		result, err = tx.Exec("UPDATE artist SET name = $1 WHERE id = $2", name, id)
-	} else {
-		// Set or clear person_uri
-		var personURIVal sql.NullString
-		if *personURI != "" {
-			personURIVal = sql.NullString{String: *personURI, Valid: true}
-		}
-		result, err = tx.Exec("UPDATE artist SET name = $1, person_uri = $2 WHERE id = $3", name, personURIVal, id)
-	}
+	_, err = tx.Exec("UPDATE artist SET name = $1, person_uri = $2, sort_name = $3, mbid_artist = $4, type = $5 WHERE id = $6",
+		artist.Name, artist.PersonURI, nullIfEmpty(artist.SortName), nullIfEmpty(artist.MBIDArtist), nullIfEmpty(artist.Type), id)
 	if err != nil {
-		_ = tx.Rollback()
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			err = errors.New("artist_duplicate_name")
-		}
+		err = artistWriteError(err)
 		return
 	}
-	rows, err := result.RowsAffected()
+	err = setArtistAliases(tx, id, artist.Aliases)
 	if err != nil {
-		_ = tx.Rollback()
-		return
-	}
-	if rows == 0 {
-		_ = tx.Rollback()
-		err = errors.New("Artist Not Found")
+		err = artistWriteError(err)
 		return
 	}
 
-	// Cascade the name change to all tag rows referencing this artist.
-	artistURI := store.artistURI(id)
+	// Cascade the name change to tag rows referencing this artist by its old name.
+	// Tags crediting it by another name, such as an alias, keep the name as credited.
 	_, err = tx.Exec(
-		"UPDATE tag SET value = $1 WHERE predicateid = 'artist' AND uri = $2",
-		name, artistURI,
+		"UPDATE tag SET value = $1 WHERE predicateid = 'artist' AND uri = $2 AND value = $3",
+		artist.Name, artist.URI, oldName,
 	)
 	if err != nil {
-		_ = tx.Rollback()
 		return
 	}
 
@@ -248,18 +439,14 @@ func (store Datastore) updateArtist(id int, name string, personURI *string) (art
 	if err != nil {
 		return
 	}
-
-	// Re-fetch the full artist row so PersonURI reflects the DB state.
-	artist, err = store.getArtistByID(id)
-	if err != nil {
-		return
-	}
-	store.Loganne.artistPost("artistUpdated", "Artist \""+name+"\" updated", artist, true)
+	store.Loganne.artistPost("artistUpdated", "Artist \""+artist.Name+"\" updated", artist, true)
 	return
 }
 
 // deleteArtist removes an artist by id.
-// Returns an error if any tracks reference it.
+// Returns an error if any tracks reference it, any albums are credited to it or it's a member of a group;
+// deleteArtistWithStrategy deals with those instead.
+// Its own members are removed along with it.
 func (store Datastore) deleteArtist(id int) error {
 	slog.Info("Delete Artist", "id", id)
 	artist, err := store.getArtistByID(id)
@@ -274,7 +461,24 @@ func (store Datastore) deleteArtist(id int) error {
 	if count > 0 {
 		return errors.New("artist_in_use")
 	}
-	_, err = store.DB.Exec("DELETE FROM artist WHERE id = $1", id)
+	err = store.checkArtistUncredited(id)
+	if err != nil {
+		return err
+	}
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	err = deleteArtistMemberships(tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM artist WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
@@ -282,7 +486,29 @@ func (store Datastore) deleteArtist(id int) error {
 	return nil
 }
 
-// mergeArtists merges one or more source artists into the target artist.
+// checkArtistUncredited returns an "artist_credited" error if an artist is credited on
+// any albums, or "artist_member" if it's a member of any groups, as it can't then be deleted.
+func (store Datastore) checkArtistUncredited(id int) error {
+	var count int
+	err := store.DB.Get(&count, "SELECT COUNT(*) FROM album_artist WHERE artistid = $1", id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("artist_credited")
+	}
+	err = store.DB.Get(&count, "SELECT COUNT(*) FROM artist_member WHERE memberid = $1", id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("artist_member")
+	}
+	return nil
+}
+
+// mergeArtists merges one or more source artists into the target artist, recording
+// each merge so it can be undone.
 func (store Datastore) mergeArtists(targetID int, sourceIDs []int) (artist ArtistV3, err error) {
 	slog.Info("Merge Artists", "targetID", targetID, "sourceIDs", sourceIDs)
 
@@ -317,6 +543,17 @@ func (store Datastore) mergeArtists(targetID int, sourceIDs []int) (artist Artis
 	defer func() { _ = tx.Rollback() }()
 
 	for _, src := range sources {
+		var snapshot mergeSnapshot
+		snapshot, err = artistMergeSnapshot(tx, src, targetID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = recordMerge(tx, "artist", src.ID, targetID, src.URI, snapshot)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
 		_, err = tx.Exec(
 			"UPDATE tag SET uri = $1, value = $2 WHERE predicateid = 'artist' AND uri = $3",
 			targetURI, target.Name, src.URI,
@@ -325,6 +562,39 @@ func (store Datastore) mergeArtists(targetID int, sourceIDs []int) (artist Artis
 			_ = tx.Rollback()
 			return
 		}
+		// Credit the source's albums to the target, unless they're already credited to both.
+		_, err = tx.Exec("UPDATE OR IGNORE album_artist SET artistid = $1 WHERE artistid = $2", targetID, src.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		_, err = tx.Exec("DELETE FROM album_artist WHERE artistid = $1", src.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		// Move the source's memberships and members to the target, dropping any
+		// which would make the target a member of itself.
+		_, err = tx.Exec("UPDATE artist_member SET memberid = $1 WHERE memberid = $2", targetID, src.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		_, err = tx.Exec("UPDATE artist_member SET groupid = $1, position = position + (SELECT IFNULL(MAX(position), 0) FROM artist_member WHERE groupid = $1) WHERE groupid = $2", targetID, src.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		_, err = tx.Exec("DELETE FROM artist_member WHERE groupid = memberid")
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = deleteArtistMemberships(tx, src.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
 		_, err = tx.Exec("DELETE FROM artist WHERE id = $1", src.ID)
 		if err != nil {
 			_ = tx.Rollback()
@@ -361,25 +631,26 @@ func (store Datastore) ResolveArtistNameFromURI(uri string) (string, error) {
 	return store.resolveArtistNameFromURI(uri)
 }
 
-// resolveOrCreateArtistByName looks up an artist by name. If no artist with that
-// name exists, one is created.
+// resolveOrCreateArtistByName looks up an artist by name, or failing that by alias.
+// If no artist is known by that name, one is created.
 func (store Datastore) resolveOrCreateArtistByName(name string) (artist ArtistV3, err error) {
-	type artistRow struct {
-		ID        int            `db:"id"`
-		Name      string         `db:"name"`
-		PersonURI sql.NullString `db:"person_uri"`
-	}
-	var row artistRow
-	err = store.DB.Get(&row, "SELECT id, name, person_uri FROM artist WHERE name = $1", name)
-	if err == nil {
-		artist = ArtistV3{ID: row.ID, Name: row.Name, URI: store.artistURI(row.ID), PersonURI: nullStringToPtr(row.PersonURI)}
+	id, err := store.findArtistIDByName(name)
+	if err != nil {
 		return
 	}
-	if err.Error() != "sql: no rows in result set" {
-		return
+	if id != 0 {
+		return store.getArtistByID(id)
+	}
+	return store.createArtist(ArtistInputV3{Name: name})
+}
+
+// findArtistIDByName returns the id of the artist known by a name or alias, or 0 if there isn't one.
+func (store Datastore) findArtistIDByName(name string) (id int, err error) {
+	err = store.DB.Get(&id, "SELECT id FROM artist WHERE name = $1 UNION ALL SELECT artistid FROM artist_alias WHERE name = $1 LIMIT 1", name)
+	if err != nil && err.Error() == "sql: no rows in result set" {
+		err = nil
 	}
-	err = nil
-	return store.createArtist(name)
+	return
 }
 
 // resolveArtistNameFromURI extracts the artist id from a URI and returns the
@@ -404,10 +675,58 @@ func writeArtistRDFByID(store Datastore, w http.ResponseWriter, id int, rdfType
 		writeRDFResponse(w, nil, rdfType, err)
 		return
 	}
-	graph, err := rdfgen.ArtistToRdf([]rdfgen.ArtistData{{ID: artist.ID, Name: artist.Name, PersonURI: artist.PersonURI}})
+	members, err := store.getArtistMembers(id)
+	if err != nil {
+		writeRDFResponse(w, nil, rdfType, err)
+		return
+	}
+	data := artist.rdfData()
+	data.Members = rdfMembers(members)
+	graph, err := rdfgen.ArtistToRdf([]rdfgen.ArtistData{data})
 	writeRDFResponse(w, graph, rdfType, err)
 }
 
+// rdfData converts an artist to the form rdfgen uses to build its triples.
+func (artist ArtistV3) rdfData() rdfgen.ArtistData {
+	return rdfgen.ArtistData{
+		ID:         artist.ID,
+		Name:       artist.Name,
+		PersonURI:  artist.PersonURI,
+		SortName:   artist.SortName,
+		Aliases:    artist.Aliases,
+		MBIDArtist: artist.MBIDArtist,
+		Type:       artist.Type,
+	}
+}
+
+// writeArtistWriteError writes the response for an error creating or updating an artist.
+func writeArtistWriteError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "artist_duplicate_name":
+		writeV3ErrorResponse(w, http.StatusConflict, "An artist with that name already exists", "duplicate_name")
+	case "artist_duplicate_alias":
+		writeV3ErrorResponse(w, http.StatusConflict, "Another artist is already known by that name", "duplicate_alias")
+	case "artist_duplicate_mbid":
+		writeV3ErrorResponse(w, http.StatusConflict, "An artist with that MusicBrainz id already exists", "duplicate_mbid")
+	default:
+		writeV3Error(w, err)
+	}
+}
+
+// writeArtistDeleteError writes the response for an error deleting an artist.
+func writeArtistDeleteError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "artist_in_use":
+		writeV3ErrorResponse(w, http.StatusConflict, "Artist is referenced by one or more tracks", "in_use")
+	case "artist_credited":
+		writeV3ErrorResponse(w, http.StatusConflict, "Artist is credited on one or more albums", "in_use")
+	case "artist_member":
+		writeV3ErrorResponse(w, http.StatusConflict, "Artist is a member of one or more groups", "in_use")
+	default:
+		writeV3Error(w, err)
+	}
+}
+
 // ArtistsV3Controller handles all requests to /v3/artists endpoints.
 func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Request) {
 	normalisedpath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v3/artists"), "/")
@@ -419,7 +738,12 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 		// /v3/artists
 		switch r.Method {
 		case "GET":
-			list, err := store.getAllArtists(r.URL.Query().Get("page"), r.URL.Query().Get("q"))
+			options, err := listOptionsFromQuery(r.URL.Query())
+			if err != nil {
+				writeV3Error(w, err)
+				return
+			}
+			list, err := store.getAllArtists(options)
 			if err != nil {
 				writeV3Error(w, err)
 				return
@@ -431,20 +755,20 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 				writeV3Error(w, err)
 				return
 			}
-			var input struct {
-				Name string `json:"name"`
-			}
+			var input ArtistInputV3
 			if err = json.Unmarshal(body, &input); err != nil || input.Name == "" {
 				writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a non-empty \"name\" field", "bad_request")
 				return
 			}
-			artist, err := store.createArtist(input.Name)
-			if err != nil {
-				if err.Error() == "artist_duplicate_name" {
-					writeV3ErrorResponse(w, http.StatusConflict, "An artist with that name already exists", "duplicate_name")
+			if input.PersonURI != nil && *input.PersonURI != "" {
+				if msg := validateArtistPersonURI(*input.PersonURI); msg != "" {
+					writeV3ErrorResponse(w, http.StatusBadRequest, msg, "invalid_person_uri")
 					return
 				}
-				writeV3Error(w, err)
+			}
+			artist, err := store.createArtist(input)
+			if err != nil {
+				writeArtistWriteError(w, err)
 				return
 			}
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -454,6 +778,24 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 		default:
 			MethodNotAllowed(w, []string{"GET", "POST"})
 		}
+	} else if len(pathparts) >= 2 && pathparts[1] == "merges" {
+		// /v3/artists/merges, /v3/artists/merges/{id} and /v3/artists/merges/{id}/undo
+		store.mergesHandler(w, r, "artist", pathparts[2:])
+	} else if len(pathparts) == 2 && pathparts[1] == "orphans" {
+		// /v3/artists/orphans
+		if r.Method != "DELETE" {
+			MethodNotAllowed(w, []string{"DELETE"})
+			return
+		}
+		deleted, err := store.deleteOrphanedArtists()
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, deleted, nil)
+	} else if len(pathparts) == 2 && pathparts[1] == "duplicates" {
+		// /v3/artists/duplicates
+		duplicatesHandler(w, r, store.getArtistDuplicates)
 	} else if len(pathparts) == 2 && pathparts[1] == "merge" {
 		// /v3/artists/merge
 		if r.Method != "POST" {
@@ -465,10 +807,7 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 			writeV3Error(w, err)
 			return
 		}
-		var input struct {
-			TargetID  int   `json:"targetId"`
-			SourceIDs []int `json:"sourceIds"`
-		}
+		var input MergeRequestV3
 		if err = json.Unmarshal(body, &input); err != nil || input.TargetID <= 0 || len(input.SourceIDs) == 0 {
 			writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a positive \"targetId\" and a non-empty \"sourceIds\" array", "bad_request")
 			return
@@ -509,10 +848,7 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 				writeV3Error(w, err)
 				return
 			}
-			var input struct {
-				Name      string  `json:"name"`
-				PersonURI *string `json:"personUri"`
-			}
+			var input ArtistInputV3
 			if err = json.Unmarshal(body, &input); err != nil || input.Name == "" {
 				writeV3ErrorResponse(w, http.StatusBadRequest, "Request body must include a non-empty \"name\" field", "bad_request")
 				return
@@ -524,30 +860,52 @@ func (store Datastore) ArtistsV3Controller(w http.ResponseWriter, r *http.Reques
 					return
 				}
 			}
-			artist, err := store.updateArtist(id, input.Name, input.PersonURI)
+			artist, err := store.updateArtist(id, input)
 			if err != nil {
-				if err.Error() == "artist_duplicate_name" {
-					writeV3ErrorResponse(w, http.StatusConflict, "An artist with that name already exists", "duplicate_name")
-					return
-				}
-				writeV3Error(w, err)
+				writeArtistWriteError(w, err)
 				return
 			}
 			writeJSONResponse(w, artist, nil)
 		case "DELETE":
-			err := store.deleteArtist(id)
+			strategy, err := deleteStrategyFromQuery(r.URL.Query())
 			if err != nil {
-				if err.Error() == "artist_in_use" {
-					writeV3ErrorResponse(w, http.StatusConflict, "Artist is referenced by one or more tracks", "in_use")
+				writeV3Error(w, err)
+				return
+			}
+			if strategy.Name != "" {
+				deletion, err := store.deleteArtistWithStrategy(id, strategy)
+				if err != nil {
+					writeArtistDeleteError(w, err)
 					return
 				}
-				writeV3Error(w, err)
+				writeJSONResponse(w, deletion, nil)
+				return
+			}
+			err = store.deleteArtist(id)
+			if err != nil {
+				writeArtistDeleteError(w, err)
 				return
 			}
 			w.WriteHeader(http.StatusNoContent)
 		default:
 			MethodNotAllowed(w, []string{"GET", "PUT", "DELETE"})
 		}
+	} else if len(pathparts) == 3 && pathparts[2] == "members" {
+		// /v3/artists/{id}/members
+		id, err := strconv.Atoi(pathparts[1])
+		if err != nil || id <= 0 {
+			writeV3ErrorResponse(w, http.StatusNotFound, "Artist Not Found", "not_found")
+			return
+		}
+		store.artistMembersHandler(w, r, id)
+	} else if len(pathparts) == 3 && pathparts[2] == "split" {
+		// /v3/artists/{id}/split
+		id, err := strconv.Atoi(pathparts[1])
+		if err != nil || id <= 0 {
+			writeV3ErrorResponse(w, http.StatusNotFound, "Artist Not Found", "not_found")
+			return
+		}
+		store.artistSplitHandler(w, r, id)
 	} else {
 		writeV3ErrorResponse(w, http.StatusNotFound, "Artist Endpoint Not Found", "not_found")
 	}
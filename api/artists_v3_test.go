@@ -578,3 +578,80 @@ func TestArtistPersonURIOmittedWhenNull(test *testing.T) {
 		true,
 	)
 }
+
+// TestArtistDetails checks sort name, aliases, MusicBrainz id and type can be set, validated and cleared.
+func TestArtistDetails(test *testing.T) {
+	clearData()
+	makeRequest(test, "POST", "/v3/artists", `{"name":"The Beatles","sortName":"Beatles, The","aliases":["Beatles"," The Fab Four ","Beatles"],"mbidArtist":"B10BBBFC-CF9E-42E0-BE17-E2C3E1D2600D","type":"Group"}`, 201,
+		`{"id":1,"name":"The Beatles","uri":"/artists/1","sortName":"Beatles, The","aliases":["Beatles","The Fab Four"],"mbidArtist":"b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d","type":"group"}`, true)
+
+	makeRequest(test, "PUT", "/v3/artists/1", `{"name":"The Beatles","type":"band"}`, 400, `{"error":"Artist type \"band\", which isn't one of person, group, orchestra, choir, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/artists/1", `{"name":"The Beatles","mbidArtist":"beatles"}`, 400, `{"error":"Artist mbidArtist \"beatles\", which isn't a MusicBrainz id, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", "/v3/artists", `{"name":"Fab Four","mbidArtist":"b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"}`, 409, `{"error":"An artist with that MusicBrainz id already exists","code":"duplicate_mbid"}`, true)
+
+	// Renaming to an alias drops the alias; fields left out are kept
+	makeRequest(test, "PUT", "/v3/artists/1", `{"name":"Beatles","sortName":""}`, 200,
+		`{"id":1,"name":"Beatles","uri":"/artists/1","aliases":["The Fab Four"],"mbidArtist":"b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d","type":"group"}`, true)
+	restartServer()
+	makeRequest(test, "PUT", "/v3/artists/1", `{"name":"Beatles","aliases":[],"mbidArtist":"","type":""}`, 200, `{"id":1,"name":"Beatles","uri":"/artists/1"}`, true)
+}
+
+// TestArtistAliasesUnique checks no two artists can be known by the same name.
+func TestArtistAliasesUnique(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Prince","aliases":["The Artist"]}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Madonna"}`, 201)
+	makeRequest(test, "POST", "/v3/artists", `{"name":"The Artist"}`, 409, `{"error":"Another artist is already known by that name","code":"duplicate_alias"}`, true)
+	makeRequest(test, "PUT", "/v3/artists/2", `{"name":"Madonna","aliases":["The Artist"]}`, 409, `{"error":"Another artist is already known by that name","code":"duplicate_alias"}`, true)
+	makeRequest(test, "PUT", "/v3/artists/2", `{"name":"Madonna","aliases":["Prince"]}`, 409, `{"error":"Another artist is already known by that name","code":"duplicate_alias"}`, true)
+	makeRequest(test, "GET", "/v3/artists/2", "", 200, `{"id":2,"name":"Madonna","uri":"/artists/2"}`, true)
+}
+
+// TestArtistListSortsBySortName checks listings sort by sort name where set, and search matches aliases.
+func TestArtistListSortsBySortName(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles","sortName":"Beatles, The"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Abba"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Carpenters","aliases":["The Carpenters"]}`, 201)
+
+	request := basicRequest(test, "GET", "/v3/artists", "")
+	resp, _ := doRawRequest(test, request)
+	var list ArtistListV3
+	json.NewDecoder(resp.Body).Decode(&list)
+	names := []string{}
+	for _, artist := range list.Artists {
+		names = append(names, artist.Name)
+	}
+	assertEqual(test, "Sort order", "Abba,The Beatles,Carpenters", strings.Join(names, ","))
+
+	request = basicRequest(test, "GET", "/v3/artists?q=the+carp", "")
+	resp, _ = doRawRequest(test, request)
+	list = ArtistListV3{}
+	json.NewDecoder(resp.Body).Decode(&list)
+	assertEqual(test, "Alias search matches", 1, list.TotalItems)
+}
+
+// TestTrackArtistTagResolvesAlias checks an artist tag given by an alias resolves to that artist rather than creating another.
+func TestTrackArtistTagResolvesAlias(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Carpenters","aliases":["The Carpenters"]}`, 201)
+	setupRequest(test, "PUT", "/v3/tracks/1", `{"fingerprint":"alias1","url":"http://example.org/alias/1","duration":200,"tags":{"artist":[{"name":"The Carpenters"}]}}`, 200)
+	request := basicRequest(test, "GET", "/v3/tracks/1", "")
+	resp, _ := doRawRequest(test, request)
+	var track TrackV3
+	json.NewDecoder(resp.Body).Decode(&track)
+	assertEqual(test, "Artist uri", "/artists/1", track.Tags["artist"][0].URI)
+	assertEqual(test, "Artist name as credited", "The Carpenters", track.Tags["artist"][0].Name)
+	makeRequest(test, "GET", "/v3/artists", "", 200, `{"artists":[{"id":1,"name":"Carpenters","uri":"/artists/1","aliases":["The Carpenters"],"usageCount":1}],"totalPages":1,"page":1,"totalItems":1}`, true)
+
+	// Renaming the artist only renames tags which credited it by its old name
+	setupRequest(test, "PUT", "/v3/tracks/2", `{"fingerprint":"alias2","url":"http://example.org/alias/2","duration":200,"tags":{"artist":[{"name":"Carpenters"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/artists/1", `{"name":"The Carpenters (duo)","aliases":["The Carpenters"]}`, 200)
+	for trackID, expected := range map[string]string{"1": "The Carpenters", "2": "The Carpenters (duo)"} {
+		request = basicRequest(test, "GET", "/v3/tracks/"+trackID, "")
+		resp, _ = doRawRequest(test, request)
+		track = TrackV3{}
+		json.NewDecoder(resp.Body).Decode(&track)
+		assertEqual(test, "Artist name on track "+trackID+" after rename", expected, track.Tags["artist"][0].Name)
+	}
+}
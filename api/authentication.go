@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -20,7 +21,7 @@ type AuthentictedServer struct {
  * If the key is valid but the scope doesn't allow this request, serves a 403 Forbidden response.
  */
 func (server AuthentictedServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	authenticated, authorized := server.checkAuth(request)
+	client, authenticated, authorized := server.checkAuth(request)
 	if !authenticated {
 		writer.Header().Set("WWW-Authenticate", "bearer")
 		http.Error(writer, "Authentication Failed", http.StatusUnauthorized)
@@ -30,41 +31,54 @@ func (server AuthentictedServer) ServeHTTP(writer http.ResponseWriter, request *
 		http.Error(writer, "Insufficient Scope", http.StatusForbidden)
 		return
 	}
+	// Make the client available to handlers which record who made a change (e.g. play events).
+	request = request.WithContext(context.WithValue(request.Context(), authenticatedClientKey{}, client))
 	server.unauthenticatedHandler.ServeHTTP(writer, request)
 }
 
-// checkAuth returns (authenticated, authorized).
+// authenticatedClientKey is the context key under which ServeHTTP stores the AuthenticatedClient.
+type authenticatedClientKey struct{}
+
+// authenticatedClientFromRequest returns the client which made the request.
+// Returns a zero-value AuthenticatedClient for paths which don't require authentication.
+func authenticatedClientFromRequest(request *http.Request) AuthenticatedClient {
+	client, _ := request.Context().Value(authenticatedClientKey{}).(AuthenticatedClient)
+	return client
+}
+
+// checkAuth returns (client, authenticated, authorized).
 // authenticated=false means no valid key found (should yield 401).
 // authenticated=true, authorized=false means valid key but the scope doesn't cover this request (should yield 403).
-func (server AuthentictedServer) checkAuth(request *http.Request) (bool, bool) {
+func (server AuthentictedServer) checkAuth(request *http.Request) (AuthenticatedClient, bool, bool) {
 	// Unauthenticated requests to the info and ontology paths are always allowed
 	if request.URL.Path == "/_info" || request.URL.Path == "/ontology" {
-		return true, true
+		return AuthenticatedClient{}, true, true
 	}
 	authHeaderParts := strings.Split(request.Header.Get("Authorization"), " ")
 	scheme := strings.ToLower(authHeaderParts[0])
 	if scheme != "bearer" {
 		slog.Debug("Unsupported authentication scheme", "scheme", scheme)
-		return false, false
+		return AuthenticatedClient{}, false, false
 	}
 	if len(authHeaderParts) < 2 {
 		slog.Debug("Missing token in Authorization header", "scheme", scheme)
-		return false, false
+		return AuthenticatedClient{}, false, false
 	}
 	key := authHeaderParts[1]
 	client, found := server.allowedKeys[key]
 	if !found {
 		slog.Debug("Authentication failed", "key", key)
-		return false, false
+		return AuthenticatedClient{}, false, false
 	}
 	slog.Debug("Request successfully authenticated", "client", client)
-	return true, client.isAuthorized(request)
+	return client, true, client.isAuthorized(request)
 }
 
 // isAuthorized checks whether the client's scopes permit the given request.
 //
 // Estate-vocabulary scope strings:
-//   - "media-metadata:read"  — permits any GET or HEAD request
+//   - "media-metadata:read"  — permits any GET or HEAD request, plus POST /sparql
+//     (SPARQL queries can be POSTed, but are still read-only)
 //   - "media-metadata:write" — permits any POST/PUT/PATCH/DELETE request (excluding /webhooks)
 //   - "webhook"              — permits POST /webhooks only (estate-wide bundled scope)
 //
@@ -80,6 +94,9 @@ func (client AuthenticatedClient) isAuthorized(request *http.Request) bool {
 			if request.Method == http.MethodGet || request.Method == http.MethodHead {
 				return true
 			}
+			if request.Method == http.MethodPost && request.URL.Path == "/sparql" {
+				return true
+			}
 		case "media-metadata:write":
 			isWrite := request.Method == http.MethodPost || request.Method == http.MethodPut ||
 				request.Method == http.MethodPatch || request.Method == http.MethodDelete
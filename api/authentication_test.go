@@ -123,6 +123,12 @@ func TestScopeEnforcement(test *testing.T) {
 	if readClient.isAuthorized(makeTestRequest(http.MethodPost, "/webhooks")) {
 		test.Error("media-metadata:read scope should deny POST /webhooks")
 	}
+	if !readClient.isAuthorized(makeTestRequest(http.MethodPost, "/sparql")) {
+		test.Error("media-metadata:read scope should allow POST /sparql (queries are read-only)")
+	}
+	if readClient.isAuthorized(makeTestRequest(http.MethodPost, "/sparqlish")) {
+		test.Error("media-metadata:read scope should deny POST to paths other than /sparql")
+	}
 
 	// media-metadata:write permits any POST/PUT/PATCH/DELETE except /webhooks
 	if !writeClient.isAuthorized(makeTestRequest(http.MethodPost, "/v3/tracks")) {
@@ -8,9 +8,12 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
 	"slices"
 	"strings"
 	"strconv"
+	"lucos_media_metadata_api/predicateconfig"
 )
 
 type Collection struct {
@@ -21,6 +24,55 @@ type Collection struct {
 	TotalTracks *int `json:"totalTracks,omitempty"`
 	TotalPages *int  `json:"totalPages,omitempty"`
 	IsPlayable *bool `json:"isPlayable,omitempty"` // Whether calling `getRandomTracksInCollection` on this collection will return any results
+	Query *string    `json:"query,omitempty"` // For smart collections, the saved p. filters which define membership.  nil for static collections.
+	Compose *CollectionComposition `json:"compose,omitempty" db:"-"` // For composed collections, the set operation which defines membership.  nil otherwise.
+	Ordered *bool    `json:"ordered,omitempty"` // Whether the collection is a playlist whose running order can be edited by position.  nil when unordered.
+}
+
+/**
+ * Defines a composed collection's membership as a set operation over other collections.
+ * For "difference", tracks in any later collection are removed from those in the first.
+ */
+type CollectionComposition struct {
+	Operation   string   `json:"operation"`
+	Collections []string `json:"collections"`
+}
+
+// compositionOperators maps each supported composition operation to its SQL compound operator
+var compositionOperators = map[string]string{
+	"union":        "UNION",
+	"intersection": "INTERSECT",
+	"difference":   "EXCEPT",
+}
+
+/**
+ * Checks whether two compositions are the same.  An empty operation is treated the same as no composition.
+ */
+func (composition CollectionComposition) equal(other *CollectionComposition) bool {
+	if other == nil {
+		return composition.Operation == ""
+	}
+	return composition.Operation == other.Operation && slices.Equal(composition.Collections, other.Collections)
+}
+
+/**
+ * Describes how a collection's membership is defined: "static", "smart" or "composed"
+ */
+func (collection Collection) membershipType() string {
+	if collection.Compose != nil {
+		return "composed"
+	}
+	if collection.Query != nil {
+		return "smart"
+	}
+	return "static"
+}
+
+/**
+ * Whether a collection is a playlist whose running order can be edited by position
+ */
+func (collection Collection) isOrdered() bool {
+	return collection.Ordered != nil && *collection.Ordered
 }
 
 
@@ -30,13 +82,29 @@ type Collection struct {
  */
 func (store Datastore) getBasicCollection(slug string) (collection Collection, err error) {
 	collection = Collection{}
-	err = store.DB.Get(&collection, "SELECT slug, name, icon FROM collection WHERE slug=$1", slug)
+	err = store.DB.Get(&collection, "SELECT slug, name, icon, query, NULLIF(ordered, 0) AS ordered FROM collection WHERE slug=$1", slug)
 	if err != nil {
+		collection = Collection{} // sqlx allocates pointer fields (eg Query) before finding there are no rows
 		if err.Error() == "sql: no rows in result set" {
 			err = errors.New("Collection Not Found")
 		}
 		return
 	}
+	collection.Compose, err = store.getCollectionComposition(slug)
+	return
+}
+
+/**
+ * Gets the composition of a collection, or nil if it isn't composed
+ */
+func (store Datastore) getCollectionComposition(slug string) (composition *CollectionComposition, err error) {
+	var operation *string
+	err = store.DB.Get(&operation, "SELECT operation FROM collection WHERE slug=$1", slug)
+	if err != nil || operation == nil {
+		return
+	}
+	composition = &CollectionComposition{Operation: *operation, Collections: []string{}}
+	err = store.DB.Select(&composition.Collections, "SELECT operandslug FROM collection_operand WHERE collectionslug=$1 ORDER BY position", slug)
 	return
 }
 
@@ -51,7 +119,7 @@ func (store Datastore) getCollection(slug string, rawpagenumber string) (collect
 	}
 	standardLimit := 20
 	offset, limit := parsePageParam(rawpagenumber, standardLimit)
-	tracks, totalTracks, err := store.getTracksInCollection(collection.Slug, offset, limit)
+	tracks, totalTracks, err := store.getTracksInCollection(collection, offset, limit)
 	collection.Tracks = &tracks
 	totalPages := int(math.Ceil(float64(totalTracks) / float64(standardLimit)))
 	collection.TotalPages = &totalPages
@@ -64,7 +132,7 @@ func (store Datastore) getCollection(slug string, rawpagenumber string) (collect
  */
 func (store Datastore) getAllCollections() (collections []Collection, err error) {
 	collections = []Collection{}
-	err = store.DB.Select(&collections, "SELECT slug, name, icon FROM collection")
+	err = store.DB.Select(&collections, "SELECT slug, name, icon, query, NULLIF(ordered, 0) AS ordered FROM collection")
 	if err != nil {
 		return
 	}
@@ -73,7 +141,11 @@ func (store Datastore) getAllCollections() (collections []Collection, err error)
 	for i := range collections {
 		collection := &collections[i]
 		standardLimit := 20
-		totalTracks, err := store.getTrackCountForCollection(collection.Slug)
+		collection.Compose, err = store.getCollectionComposition(collection.Slug)
+		if err != nil {
+			return collections, err
+		}
+		totalTracks, err := store.getTrackCountForCollection(*collection)
 		if err != nil {
 			return collections, err
 		}
@@ -81,8 +153,12 @@ func (store Datastore) getAllCollections() (collections []Collection, err error)
 		totalPages := int(math.Ceil(float64(totalTracks) / float64(standardLimit)))
 		collection.TotalPages = &totalPages
 
+		membership, values, err := store.membershipQuery(*collection)
+		if err != nil {
+			return collections, err
+		}
 		var playableCount int
-		err = store.DB.Get(&playableCount, "SELECT COUNT(*) FROM collection_track LEFT JOIN track ON collection_track.trackid = track.id WHERE collection_track.collectionslug = $1 AND track.weighting > 0", collection.Slug)
+		err = store.DB.Get(&playableCount, "SELECT COUNT(*) FROM ("+membership+") WHERE weighting > 0", values...)
 		if err != nil {
 			return collections, err
 		}
@@ -92,15 +168,269 @@ func (store Datastore) getAllCollections() (collections []Collection, err error)
 	return
 }
 
+/**
+ * A filter on how a predicate's value compares with a number, eg "p.singalong>=3" in a smart collection's query
+ */
+type predicateComparison struct {
+	Predicate string
+	Operator  string // One of ">=", "<=", ">" or "<"
+	Value     float64
+}
+
+/**
+ * Validates a smart collection's saved query and returns the predicate filters it contains.
+ * The query uses the same p. parameters as /v3/tracks, eg "p.language=cy&p.singalong=3".
+ * As well as exact matches, a query can compare a predicate with a number using >=, <=, > or <, eg "p.singalong>=3".
+ * Comparisons are supported on ordinal predicates (singalong and availability, compared by level) and on literal predicates,
+ * whose values are compared as numbers.
+ */
+func parseCollectionQuery(rawquery string) (predicates map[string]string, uriPredicates map[string]string, comparisons []predicateComparison, err error) {
+	query, err := url.ParseQuery(rawquery)
+	if err != nil {
+		err = errors.New("Malformed collection query \""+rawquery+"\" not allowed")
+		return
+	}
+	for key, values := range query {
+		if !strings.HasPrefix(key, "p.") {
+			err = errors.New("Only p. filters are supported, so collection query parameter \""+key+"\" not allowed")
+			return
+		}
+		if !strings.ContainsAny(key, "<>!") {
+			continue
+		}
+		comparison, comparisonErr := parsePredicateComparison(key, values[0])
+		if comparisonErr != nil {
+			err = comparisonErr
+			return
+		}
+		comparisons = append(comparisons, comparison)
+		query.Del(key)
+	}
+	predicates, uriPredicates, err = parsePredicateFilters(query)
+	if err != nil {
+		err = errors.New("Collection query not allowed: "+err.Error())
+		return
+	}
+	if len(predicates) + len(uriPredicates) + len(comparisons) == 0 {
+		err = errors.New("Collection query without any p. filters not allowed")
+	}
+	return
+}
+
+/**
+ * Parses a comparison from a collection query parameter.
+ * url.ParseQuery splits "p.singalong>=3" into the key "p.singalong>" and the value "3",
+ * whereas "p.singalong>3" has no "=" so is all key.
+ */
+func parsePredicateComparison(key string, value string) (comparison predicateComparison, err error) {
+	operatorIndex := strings.IndexAny(key, "<>")
+	if operatorIndex == -1 || strings.Contains(key, "!") {
+		err = errors.New("Only exact matches and >=, <=, > and < comparisons are supported, so collection query parameter \""+key+"\" not allowed")
+		return
+	}
+	comparison.Predicate = key[2:operatorIndex]
+	number := key[operatorIndex+1:]
+	if operatorIndex == len(key)-1 {
+		comparison.Operator = key[operatorIndex:] + "="
+		number = value
+	} else if value == "" {
+		comparison.Operator = key[operatorIndex:operatorIndex+1]
+	} else {
+		err = errors.New("Only exact matches and >=, <=, > and < comparisons are supported, so collection query parameter \""+key+"\" not allowed")
+		return
+	}
+	if !predicateconfig.IsOrdinal(comparison.Predicate) && predicateconfig.GetConfig(comparison.Predicate).ValueShape != predicateconfig.ValueShapeLiteral {
+		err = errors.New("Comparing predicate \""+comparison.Predicate+"\", which isn't ordinal or literal, not allowed")
+		return
+	}
+	comparison.Value, err = strconv.ParseFloat(number, 64)
+	if err != nil {
+		err = errors.New("Comparing predicate \""+comparison.Predicate+"\" with \""+number+"\", which isn't a number, not allowed")
+	}
+	return
+}
+
+/**
+ * Whether a number satisfies a comparison
+ */
+func (comparison predicateComparison) matches(number float64) bool {
+	switch comparison.Operator {
+	case ">=":
+		return number >= comparison.Value
+	case "<=":
+		return number <= comparison.Value
+	case ">":
+		return number > comparison.Value
+	default:
+		return number < comparison.Value
+	}
+}
+
+/**
+ * Restricts a query selecting tracks to those with a value satisfying each comparison.
+ * Ordinal predicates match the concepts whose level satisfies the comparison, whether a tag refers to the concept by URI,
+ * or (for legacy values) by its slug or label.  Other predicates compare their values as numbers, so values which aren't numbers never match.
+ */
+func addComparisonFilters(dbQuery string, values []interface{}, comparisons []predicateComparison) (string, []interface{}) {
+	if len(comparisons) == 0 {
+		return dbQuery, values
+	}
+	conditions := []string{}
+	for _, comparison := range comparisons {
+		condition := "EXISTS (SELECT 1 FROM tag WHERE tag.trackid = track.id AND tag.predicateid = ? AND "
+		values = append(values, comparison.Predicate)
+		if predicateconfig.IsOrdinal(comparison.Predicate) {
+			appOrigin := strings.TrimSuffix(os.Getenv("APP_ORIGIN"), "/")
+			uris := []interface{}{}
+			names := []interface{}{}
+			for _, concept := range predicateconfig.GetSKOSConcepts(comparison.Predicate) {
+				if comparison.matches(float64(concept.Level)) {
+					uris = append(uris, predicateconfig.ConceptURI(appOrigin, comparison.Predicate, concept.Slug))
+					names = append(names, concept.Slug, concept.PrefLabel)
+				}
+			}
+			if len(uris) == 0 {
+				condition += "0)"
+			} else {
+				condition += "(tag.uri IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(uris)), ", ")+") OR tag.value IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")+")))"
+				values = append(values, uris...)
+				values = append(values, names...)
+			}
+		} else {
+			condition += "tag.value GLOB '*[0-9]*' AND tag.value NOT GLOB '*[^0-9.-]*' AND CAST(tag.value AS REAL) "+comparison.Operator+" ?)"
+			values = append(values, comparison.Value)
+		}
+		conditions = append(conditions, condition)
+	}
+	return "SELECT id, url, fingerprint, duration, weighting FROM ("+dbQuery+") AS track WHERE "+strings.Join(conditions, " AND "), values
+}
+
+/**
+ * Builds a query selecting the tracks in a collection, for use as a subquery.
+ * Smart collections are evaluated against their saved query every time, so stay current as tags change;
+ * composed collections combine the queries of the collections they're built from;
+ * static collections read their membership from collection_track.
+ */
+func (store Datastore) membershipQuery(collection Collection) (dbQuery string, values []interface{}, err error) {
+	return store.nestedMembershipQuery(collection, map[string]bool{})
+}
+
+/**
+ * Builds the membership query for a collection which may itself be part of a composed collection.
+ * `expanding` holds the slugs of composed collections currently being expanded, as a guard against cycles.
+ */
+func (store Datastore) nestedMembershipQuery(collection Collection, expanding map[string]bool) (dbQuery string, values []interface{}, err error) {
+	switch collection.membershipType() {
+	case "composed":
+		if expanding[collection.Slug] {
+			err = errors.New("Collection "+collection.Slug+" is composed from itself")
+			return
+		}
+		expanding[collection.Slug] = true
+		defer delete(expanding, collection.Slug)
+		parts := []string{}
+		for _, operandSlug := range collection.Compose.Collections {
+			operand, operandErr := store.getBasicCollection(operandSlug)
+			if operandErr != nil {
+				err = operandErr
+				return
+			}
+			operandQuery, operandValues, operandErr := store.nestedMembershipQuery(operand, expanding)
+			if operandErr != nil {
+				err = operandErr
+				return
+			}
+			parts = append(parts, "SELECT id, url, fingerprint, duration, weighting FROM ("+operandQuery+")")
+			values = append(values, operandValues...)
+		}
+		dbQuery = strings.Join(parts, " "+compositionOperators[collection.Compose.Operation]+" ")
+	case "smart":
+		predicates, uriPredicates, comparisons, parseErr := parseCollectionQuery(*collection.Query)
+		if parseErr != nil {
+			err = parseErr
+			return
+		}
+		dbQuery, values = buildPredicateSearchQuery(predicates, uriPredicates)
+		dbQuery, values = addComparisonFilters(dbQuery, values, comparisons)
+	default:
+		dbQuery = "SELECT track.id, track.url, track.fingerprint, track.duration, track.weighting, collection_track.position FROM collection_track INNER JOIN track ON collection_track.trackid = track.id WHERE collection_track.collectionslug = ?"
+		values = []interface{}{collection.Slug}
+	}
+	return
+}
+
+/**
+ * Checks a composition is valid for the collection with the given slug.
+ * Every collection it's built from must exist, and none of them may (directly or indirectly) be built from this collection.
+ */
+func (store Datastore) validateComposition(slug string, composition CollectionComposition) (err error) {
+	if _, ok := compositionOperators[composition.Operation]; !ok {
+		return errors.New("Collection operation \""+composition.Operation+"\" not allowed")
+	}
+	if len(composition.Collections) < 2 {
+		return errors.New("Composing collection "+slug+" from fewer than two collections not allowed")
+	}
+	for _, operandSlug := range composition.Collections {
+		if operandSlug == slug {
+			return errors.New("Composing collection "+slug+" from itself not allowed")
+		}
+		found, existsErr := store.collectionExists(operandSlug)
+		if existsErr != nil {
+			return existsErr
+		}
+		if !found {
+			return errors.New("Composing collection "+slug+" from unknown collection "+operandSlug+" not allowed")
+		}
+		cyclic, cycleErr := store.isComposedFrom(operandSlug, slug, map[string]bool{})
+		if cycleErr != nil {
+			return cycleErr
+		}
+		if cyclic {
+			return errors.New("Composing collection "+slug+" from "+operandSlug+" would create a cycle, so not allowed")
+		}
+	}
+	return
+}
 
+/**
+ * Checks whether a collection is built, directly or through nested compositions, from another collection
+ */
+func (store Datastore) isComposedFrom(slug string, targetSlug string, visited map[string]bool) (composed bool, err error) {
+	if visited[slug] {
+		return
+	}
+	visited[slug] = true
+	composition, err := store.getCollectionComposition(slug)
+	if err != nil || composition == nil {
+		return
+	}
+	for _, operandSlug := range composition.Collections {
+		if operandSlug == targetSlug {
+			return true, nil
+		}
+		composed, err = store.isComposedFrom(operandSlug, targetSlug, visited)
+		if composed || err != nil {
+			return
+		}
+	}
+	return
+}
 
 /**
  * Gets all the tracks for a given collection
  *
  */
-func (store Datastore) getTracksInCollection(slug string, offset int, limit int) (tracks []Track, totalTracks int, err error) {
+func (store Datastore) getTracksInCollection(collection Collection, offset int, limit int) (tracks []Track, totalTracks int, err error) {
 	tracks = []Track{}
-	err = store.DB.Select(&tracks, "SELECT id, url, fingerprint, duration, weighting FROM collection_track LEFT JOIN track ON collection_track.trackid = track.id WHERE collection_track.collectionslug = $1 LIMIT $2, $3", slug, offset, limit)
+	membership, values, err := store.membershipQuery(collection)
+	if err != nil {
+		return
+	}
+	order := " ORDER BY position"
+	if collection.membershipType() != "static" {
+		order = " ORDER BY id" // Smart and composed collections have no running order of their own
+	}
+	err = store.DB.Select(&tracks, "SELECT id, url, fingerprint, duration, weighting FROM ("+membership+")"+order+" LIMIT ?, ?", append(values, offset, limit)...)
 	if err != nil {
 		return
 	}
@@ -114,31 +444,128 @@ func (store Datastore) getTracksInCollection(slug string, offset int, limit int)
 		}
 	}
 
-	totalTracks, err = store.getTrackCountForCollection(slug)
+	totalTracks, err = store.getTrackCountForCollection(collection)
 	return
 }
 
 /**
  * Gets a count of how many tracks are in a collection
  */
- func (store Datastore) getTrackCountForCollection(slug string) (totalTracks int, err error) {
-	err = store.DB.Get(&totalTracks, "SELECT COUNT(*) FROM collection_track WHERE collectionslug = $1", slug)
+ func (store Datastore) getTrackCountForCollection(collection Collection) (totalTracks int, err error) {
+	membership, values, err := store.membershipQuery(collection)
+	if err != nil {
+		return
+	}
+	err = store.DB.Get(&totalTracks, "SELECT COUNT(*) FROM ("+membership+")", values...)
 	return
  }
 
-// getAllTrackIDsInCollection returns all track IDs for a collection without pagination.
+/**
+ * Gets the IDs of every track in a collection without pagination, whether its membership is static, smart or composed
+ */
+func (store Datastore) getMemberTrackIDs(collection Collection) (ids []int, err error) {
+	ids = []int{}
+	membership, values, err := store.membershipQuery(collection)
+	if err != nil {
+		return
+	}
+	order := " ORDER BY position"
+	if collection.membershipType() != "static" {
+		order = " ORDER BY id"
+	}
+	err = store.DB.Select(&ids, "SELECT id FROM ("+membership+")"+order, values...)
+	return
+}
+
+// getAllTrackIDsInCollection returns all track IDs listed in a static collection without pagination.
 func (store Datastore) getAllTrackIDsInCollection(slug string) (ids []int, err error) {
 	ids = []int{}
-	err = store.DB.Select(&ids, "SELECT trackid FROM collection_track WHERE collectionslug = $1", slug)
+	err = store.DB.Select(&ids, "SELECT trackid FROM collection_track WHERE collectionslug = $1 ORDER BY position", slug)
 	return
 }
 
 /**
- * Gets all the collections a given track is in
+ * Gets all the collections a given track is in.
+ * Static collections are listed first, then the smart and composed collections whose membership currently includes the track.
  */
 func (store Datastore) getCollectionsByTrack(trackid int) (collections []Collection, err error) {
-	collections = []Collection{}
-	err = store.DB.Select(&collections, "SELECT slug, name, icon FROM collection_track LEFT JOIN collection ON collection_track.collectionslug = collection.slug WHERE collection_track.trackid = $1", trackid)
+	byTrack, err := store.getCollectionsByTracks([]int{trackid})
+	collections = byTrack[trackid]
+	return
+}
+
+/**
+ * Gets the collections each of a set of tracks is in, in the same order as getCollectionsByTrack.
+ * The smart and composed collections' membership queries are built once, and each is run once for all the tracks,
+ * so listing a page of tracks doesn't cost a query per collection per track.
+ */
+func (store Datastore) getCollectionsByTracks(trackids []int) (byTrack map[int][]Collection, err error) {
+	byTrack = make(map[int][]Collection, len(trackids))
+	for _, trackid := range trackids {
+		byTrack[trackid] = []Collection{}
+	}
+	if len(trackids) == 0 {
+		return
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(trackids)), ", ")
+	ids := make([]interface{}, len(trackids))
+	for i, trackid := range trackids {
+		ids[i] = trackid
+	}
+	type trackCollection struct {
+		TrackID int `db:"trackid"`
+		Collection
+	}
+	staticRows := []trackCollection{}
+	err = store.DB.Select(&staticRows, "SELECT collection_track.trackid, slug, name, icon FROM collection_track LEFT JOIN collection ON collection_track.collectionslug = collection.slug WHERE collection_track.trackid IN ("+placeholders+")", ids...)
+	if err != nil {
+		return
+	}
+	for _, row := range staticRows {
+		byTrack[row.TrackID] = append(byTrack[row.TrackID], row.Collection)
+	}
+	dynamicSlugs := []string{}
+	err = store.DB.Select(&dynamicSlugs, "SELECT slug FROM collection WHERE query IS NOT NULL OR operation IS NOT NULL ORDER BY slug")
+	if err != nil {
+		return
+	}
+	for _, slug := range dynamicSlugs {
+		collection, collectionErr := store.getBasicCollection(slug)
+		if collectionErr != nil {
+			return byTrack, collectionErr
+		}
+		membership, values, queryErr := store.membershipQuery(collection)
+		if queryErr != nil {
+			return byTrack, queryErr
+		}
+		members := []int{}
+		err = store.DB.Select(&members, "SELECT id FROM ("+membership+") WHERE id IN ("+placeholders+")", append(values, ids...)...)
+		if err != nil {
+			return
+		}
+		for _, trackid := range members {
+			byTrack[trackid] = append(byTrack[trackid], Collection{Slug: collection.Slug, Name: collection.Name, Icon: collection.Icon})
+		}
+	}
+	return
+}
+
+/**
+ * Sets the collections on each of a list of tracks, using getCollectionsByTracks
+ */
+func (store Datastore) addCollectionsToTracks(tracks []Track) (err error) {
+	trackids := make([]int, len(tracks))
+	for i, track := range tracks {
+		trackids[i] = track.ID
+	}
+	byTrack, err := store.getCollectionsByTracks(trackids)
+	if err != nil {
+		return
+	}
+	for i := range tracks {
+		collections := byTrack[tracks[i].ID]
+		tracks[i].Collections = &collections
+	}
 	return
 }
 func (original Collection) updateNeeded(changeSet Collection) bool {
@@ -148,17 +575,38 @@ func (original Collection) updateNeeded(changeSet Collection) bool {
 	if changeSet.Icon != "" && changeSet.Icon != original.Icon {
 		return true
 	}
+	if changeSet.Query != nil {
+		if original.Query == nil {
+			if *changeSet.Query != "" {
+				return true
+			}
+		} else if *changeSet.Query != *original.Query {
+			return true
+		}
+	}
+	if changeSet.Compose != nil && !changeSet.Compose.equal(original.Compose) {
+		return true
+	}
+	if changeSet.Ordered != nil && *changeSet.Ordered != original.isOrdered() {
+		return true
+	}
 	if changeSet.Tracks != nil {
 		changeIDs := make(map[int]bool, len(*changeSet.Tracks))
 		for _, t := range *changeSet.Tracks {
 			changeIDs[t.ID] = true
 		}
 		origIDs := make(map[int]bool)
+		origTracks := []Track{}
 		if original.Tracks != nil {
-			for _, t := range *original.Tracks {
+			origTracks = *original.Tracks
+			for _, t := range origTracks {
 				origIDs[t.ID] = true
 			}
 		}
+		// For playlists the running order matters as well as membership
+		if (original.isOrdered() || changeSet.isOrdered()) && !slices.EqualFunc(*changeSet.Tracks, origTracks, func(a, b Track) bool { return a.ID == b.ID }) {
+			return true
+		}
 		if len(changeIDs) != len(origIDs) {
 			return true
 		}
@@ -210,6 +658,16 @@ func (store Datastore) deleteCollection(slug string) (err error) {
 	}
 	slog.Info("Delete Collection", "slug", slug)
 
+	// Collections which others are composed from can't be deleted until those compositions change
+	var usageCount int
+	err = store.DB.Get(&usageCount, "SELECT COUNT(*) FROM collection_operand WHERE operandslug=$1", slug)
+	if (err != nil) {
+		return
+	}
+	if usageCount > 0 {
+		return errors.New("collection_in_use")
+	}
+
 	// Get the existing collection data to send to loganne later
 	existingCollection, err := store.getCollection(slug, "")
 	if (err != nil) {
@@ -219,6 +677,10 @@ func (store Datastore) deleteCollection(slug string) (err error) {
 	if (err != nil) {
 		return
 	}
+	_, err = store.DB.Exec("DELETE FROM collection_operand WHERE collectionslug=$1", slug)
+	if (err != nil) {
+		return
+	}
 	_, err = store.DB.Exec("DELETE FROM collection WHERE slug=$1", slug)
 	if (err != nil) {
 		return
@@ -242,6 +704,7 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 
 	action = "noChange"
 	storedCollection = existingCollection
+	tracksListed := newCollection.Tracks != nil
 
 	// Load all existing track IDs (not paginated) into existingCollection for
 	// accurate comparison and sync when the request includes a tracks list.
@@ -269,7 +732,78 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 	}
 	slog.Info("Update/Create collection", "existingCollection", existingCollection, "newCollection", newCollection)
 	action = "Changed"
-	if newCollection.Name != "" || newCollection.Icon != "" {
+
+	// Work out how membership will be defined once updated.  An empty query or composition operation
+	// turns a smart or composed collection back into a static one.
+	queryChanged := newCollection.Query != nil
+	storedQuery := existingCollection.Query
+	if queryChanged {
+		storedQuery = newCollection.Query
+		if *storedQuery == "" {
+			storedQuery = nil
+		}
+	}
+	newCollection.Query = storedQuery
+	composeChanged := newCollection.Compose != nil
+	storedCompose := existingCollection.Compose
+	if composeChanged {
+		storedCompose = newCollection.Compose
+		if storedCompose.Operation == "" {
+			storedCompose = nil
+		}
+	}
+	newCollection.Compose = storedCompose
+	orderedChanged := newCollection.Ordered != nil
+	if !orderedChanged {
+		newCollection.Ordered = existingCollection.Ordered
+	}
+	if !newCollection.isOrdered() {
+		newCollection.Ordered = nil
+	}
+	if storedQuery != nil && storedCompose != nil {
+		err = errors.New("Giving collection "+newCollection.Slug+" both a query and a composition not allowed")
+		return
+	}
+	if storedQuery != nil {
+		_, _, _, err = parseCollectionQuery(*storedQuery)
+		if err != nil {
+			return
+		}
+	}
+	if storedCompose != nil {
+		err = store.validateComposition(newCollection.Slug, *storedCompose)
+		if err != nil {
+			return
+		}
+	}
+	if newCollection.membershipType() != "static" {
+		if newCollection.isOrdered() {
+			err = errors.New("Ordering "+newCollection.membershipType()+" collection "+newCollection.Slug+" not allowed")
+			return
+		}
+		if len(*newCollection.Tracks) > 0 {
+			err = errors.New("Listing tracks for "+newCollection.membershipType()+" collection "+newCollection.Slug+" not allowed")
+			return
+		}
+		// Static tracks must be removed explicitly (with an empty tracks list) before a collection stops being static
+		if !tracksListed && existingCollection.Slug != "" && existingCollection.membershipType() == "static" {
+			var existingIDs []int
+			existingIDs, err = store.getAllTrackIDsInCollection(existingCollection.Slug)
+			if err != nil {
+				return
+			}
+			if len(existingIDs) > 0 {
+				definition := "a query"
+				if storedCompose != nil {
+					definition = "a composition"
+				}
+				err = errors.New("Adding "+definition+" to collection "+newCollection.Slug+" which already lists tracks not allowed")
+				return
+			}
+		}
+	}
+
+	if newCollection.Name != "" || newCollection.Icon != "" || queryChanged || composeChanged || orderedChanged {
 		err = store.checkForDuplicateCollection("name", newCollection.Name, "slug", newCollection.Slug)
 		if err != nil {
 			return
@@ -280,18 +814,31 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 		if newCollection.Icon == "" {
 			newCollection.Icon = existingCollection.Icon
 		}
+		var operation *string
+		if storedCompose != nil {
+			operation = &storedCompose.Operation
+		}
 		if existingCollection.Slug != "" {
-			_, err = store.DB.NamedExec("UPDATE collection SET name = :name, icon = :icon WHERE slug = :slug", newCollection)
+			_, err = store.DB.Exec("UPDATE collection SET name = $1, icon = $2, query = $3, operation = $4, ordered = $5 WHERE slug = $6", newCollection.Name, newCollection.Icon, newCollection.Query, operation, newCollection.isOrdered(), newCollection.Slug)
 			storedCollection.Name = newCollection.Name
 			storedCollection.Icon = newCollection.Icon
+			storedCollection.Query = newCollection.Query
+			storedCollection.Compose = newCollection.Compose
+			storedCollection.Ordered = newCollection.Ordered
 		} else {
-			_, err = store.DB.NamedExec("INSERT INTO collection(slug, name, icon) values(:slug, :name, :icon)", newCollection)
+			_, err = store.DB.Exec("INSERT INTO collection(slug, name, icon, query, operation, ordered) values($1, $2, $3, $4, $5, $6)", newCollection.Slug, newCollection.Name, newCollection.Icon, newCollection.Query, operation, newCollection.isOrdered())
 			storedCollection = newCollection
 		}
 		if err != nil {
 			return
 		}
 	}
+	if composeChanged {
+		err = store.setCollectionOperands(newCollection.Slug, storedCompose)
+		if err != nil {
+			return
+		}
+	}
 
 	// Sync track membership: add tracks not yet in collection, remove tracks no longer wanted.
 	existingIDs := make(map[int]bool)
@@ -304,9 +851,11 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 	for _, t := range *newCollection.Tracks {
 		newIDs[t.ID] = true
 	}
-	for id := range newIDs {
-		if !existingIDs[id] {
-			err = store.addTrackToCollection(storedCollection.Slug, id)
+	// Add in the order listed, so new tracks are appended to the running order in that order
+	for _, t := range *newCollection.Tracks {
+		if !existingIDs[t.ID] {
+			existingIDs[t.ID] = true
+			err = store.addTrackToCollection(storedCollection.Slug, t.ID)
 			if err != nil {
 				return
 			}
@@ -320,10 +869,17 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 			}
 		}
 	}
+	// For playlists, the order tracks are listed in is their running order
+	if tracksListed && storedCollection.isOrdered() {
+		err = store.setCollectionTrackOrder(storedCollection.Slug, *newCollection.Tracks)
+		if err != nil {
+			return
+		}
+	}
 
 	standardLimit := 20
 	offset, limit := parsePageParam(rawpagenumber, standardLimit)
-	tracks, totalTracks, err := store.getTracksInCollection(storedCollection.Slug, offset, limit)
+	tracks, totalTracks, err := store.getTracksInCollection(storedCollection, offset, limit)
 	storedCollection.Tracks = &tracks
 	totalPages := int(math.Ceil(float64(totalTracks) / float64(standardLimit)))
 	storedCollection.TotalPages = &totalPages
@@ -337,31 +893,130 @@ func (store Datastore) updateCreateCollection(existingCollection Collection, new
 	}
 	return
 }
+/**
+ * Replaces the list of collections a composed collection is built from
+ */
+func (store Datastore) setCollectionOperands(slug string, composition *CollectionComposition) (err error) {
+	_, err = store.DB.Exec("DELETE FROM collection_operand WHERE collectionslug = $1", slug)
+	if err != nil || composition == nil {
+		return
+	}
+	for position, operandSlug := range composition.Collections {
+		_, err = store.DB.Exec("INSERT INTO collection_operand (collectionslug, position, operandslug) VALUES ($1, $2, $3)", slug, position, operandSlug)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 /**
  * Checks whether a collection contains a given track
  */
-func (store Datastore) isTrackInCollection(collectionslug string, trackid int) (contains bool, err error) {
-	err = store.DB.Get(&contains, "SELECT TRUE FROM collection_track WHERE collectionslug == $1 AND trackid == $2", collectionslug, trackid)
+func (store Datastore) isTrackInCollection(collection Collection, trackid int) (contains bool, err error) {
+	membership, values, err := store.membershipQuery(collection)
+	if err != nil {
+		return
+	}
+	err = store.DB.Get(&contains, "SELECT TRUE FROM ("+membership+") WHERE id = ?", append(values, trackid)...)
 	if err != nil && err.Error() == "sql: no rows in result set" {
 		err = nil
 		contains = false
 	}
 	return
 }
+/**
+ * Works out which collections a track needs adding to and removing from for its collections to match the requested list.
+ * Membership of smart and composed collections follows their definition, so those the track is already in
+ * are left alone whether or not they're requested, and requesting one it isn't in isn't allowed.
+ */
+func (store Datastore) collectionMembershipChanges(existing *[]Collection, requested []Collection) (add []string, remove []string, err error) {
+	existingSlugs := map[string]bool{}
+	if existing != nil {
+		for _, collection := range *existing {
+			existingSlugs[collection.Slug] = true
+		}
+	}
+	requestedSlugs := map[string]bool{}
+	for _, collection := range requested {
+		requestedSlugs[collection.Slug] = true
+		if existingSlugs[collection.Slug] || slices.Contains(add, collection.Slug) {
+			continue
+		}
+		membershipType, typeErr := store.collectionMembershipType(collection.Slug)
+		if typeErr != nil {
+			return nil, nil, typeErr
+		}
+		if membershipType != "static" {
+			err = errors.New("Changing tracks in "+membershipType+" collection "+collection.Slug+" not allowed")
+			return nil, nil, err
+		}
+		add = append(add, collection.Slug)
+	}
+	if existing != nil {
+		for _, collection := range *existing {
+			if requestedSlugs[collection.Slug] {
+				continue
+			}
+			membershipType, typeErr := store.collectionMembershipType(collection.Slug)
+			if typeErr != nil {
+				return nil, nil, typeErr
+			}
+			if membershipType == "static" {
+				remove = append(remove, collection.Slug)
+			}
+		}
+	}
+	return
+}
+
+/**
+ * Gets whether the collection with the given slug is "static", "smart" or "composed".
+ * An unknown slug is treated as static, so adding a track to it fails on collection_track's foreign key as before.
+ */
+func (store Datastore) collectionMembershipType(slug string) (membershipType string, err error) {
+	collection, err := store.getBasicCollection(slug)
+	if err != nil && err.Error() == "Collection Not Found" {
+		return "static", nil
+	}
+	return collection.membershipType(), err
+}
+
 /**
  * Adds a track to a collection
  */
 func (store Datastore) addTrackToCollection(collectionslug string, trackid int) (err error) {
 	slog.Info("Add track to collection", "collectionslug", collectionslug, "trackid", trackid)
-	_, err = store.DB.Exec("INSERT OR IGNORE INTO collection_track (collectionslug, trackid) VALUES ($1, $2)", collectionslug, trackid)
+	_, err = store.DB.Exec("INSERT OR IGNORE INTO collection_track (collectionslug, trackid, position) VALUES ($1, $2, (SELECT IFNULL(MAX(position), 0) + 1 FROM collection_track WHERE collectionslug = $1))", collectionslug, trackid)
 	return
 }
 /**
- * Removes a track from a collection
+ * Removes a track from a collection, closing the gap it leaves in the running order
  */
 func (store Datastore) removeTrackFromCollection(collectionslug string, trackid int) (err error) {
 	slog.Info("Remove track from collection", "collectionslug", collectionslug, "trackid", trackid)
-	_, err = store.DB.Exec("DELETE FROM collection_track WHERE collectionslug == $1 AND trackid == $2", collectionslug, trackid)
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	var position int
+	err = tx.Get(&position, "SELECT position FROM collection_track WHERE collectionslug == $1 AND trackid == $2", collectionslug, trackid)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			err = nil // Already not in the collection
+		}
+		return
+	}
+	_, err = tx.Exec("DELETE FROM collection_track WHERE collectionslug == $1 AND trackid == $2", collectionslug, trackid)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("UPDATE collection_track SET position = position - 1 WHERE collectionslug == $1 AND position > $2", collectionslug, position)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
 	return
 }
 
@@ -395,8 +1050,12 @@ func (store Datastore) getRandomTracksInCollection(slug string, count int) (coll
 
 	// Pull all tracks with a positive weighting for the collection into memory.
 	// Zero-weight tracks are excluded — they should never be selected.
+	membership, values, err := store.membershipQuery(collection)
+	if err != nil {
+		return
+	}
 	var pool []trackWeightPair
-	err = store.DB.Select(&pool, "SELECT collection_track.trackid, track.weighting FROM collection_track LEFT JOIN track ON collection_track.trackid = track.id WHERE collection_track.collectionslug = $1 AND track.weighting > 0", slug)
+	err = store.DB.Select(&pool, "SELECT id AS trackid, weighting FROM ("+membership+") WHERE weighting > 0", values...)
 	if err != nil {
 		return
 	}
@@ -437,12 +1096,16 @@ func (store Datastore) getRandomTracksInCollection(slug string, count int) (coll
 
 	for _, trackID := range selectedIDs {
 		var track Track
-		track, err = store.getTrackDataByField("id", trackID)
+		track, err = store.getTrackWithTagsByField("id", trackID)
 		if err != nil {
 			return
 		}
 		tracks = append(tracks, track)
 	}
+	err = store.addCollectionsToTracks(tracks)
+	if err != nil {
+		return
+	}
 
 	totalPages := 0
 	if len(tracks) > 0 {
@@ -500,15 +1163,11 @@ func (store Datastore) CollectionsV2Controller(w http.ResponseWriter, r *http.Re
 				MethodNotAllowed(w, []string{"GET", "PUT", "DELETE"})
 			}
 		} else {
-			collectionFound, err := store.collectionExists(slug)
+			collection, err := store.getBasicCollection(slug)
 			if err != nil {
 				writeErrorResponse(w, err)
 				return
 			}
-			if !collectionFound {
-				writeErrorResponse(w, errors.New("Collection Not Found"))
-				return
-			}
 			trackid, err := strconv.Atoi(pathparts[2])
 			if err != nil {
 				switch pathparts[2]{
@@ -530,7 +1189,7 @@ func (store Datastore) CollectionsV2Controller(w http.ResponseWriter, r *http.Re
 				}
 				switch r.Method{
 				case "GET":
-					contains, err := store.isTrackInCollection(slug, trackid)
+					contains, err := store.isTrackInCollection(collection, trackid)
 					if contains {
 						writePlainResponse(w, "Track In Collection\n", err)
 					} else {
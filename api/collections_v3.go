@@ -6,18 +6,23 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+
+	"lucos_media_metadata_api/rdfgen"
 )
 
 // CollectionV3 is the v3 wire representation of a collection.
 // Tracks use TrackV3 (structured tags, "id" instead of "trackid", no debug fields).
 type CollectionV3 struct {
-	Slug        string     `json:"slug"`
-	Name        string     `json:"name"`
-	Icon        string     `json:"icon"`
-	Tracks      *[]TrackV3 `json:"tracks,omitempty"`
-	TotalTracks *int       `json:"totalTracks,omitempty"`
-	TotalPages  *int       `json:"totalPages,omitempty"`
-	IsPlayable  *bool      `json:"isPlayable,omitempty"`
+	Slug        string                 `json:"slug"`
+	Name        string                 `json:"name"`
+	Icon        string                 `json:"icon"`
+	Tracks      *[]TrackV3             `json:"tracks,omitempty"`
+	TotalTracks *int                   `json:"totalTracks,omitempty"`
+	TotalPages  *int                   `json:"totalPages,omitempty"`
+	IsPlayable  *bool                  `json:"isPlayable,omitempty"`
+	Query       *string                `json:"query,omitempty"`
+	Compose     *CollectionComposition `json:"compose,omitempty"`
+	Ordered     *bool                  `json:"ordered,omitempty"`
 }
 
 // CollectionToV3 converts an internal Collection (with v2 tracks) to a CollectionV3.
@@ -29,6 +34,9 @@ func CollectionToV3(c Collection) CollectionV3 {
 		TotalTracks: c.TotalTracks,
 		TotalPages:  c.TotalPages,
 		IsPlayable:  c.IsPlayable,
+		Query:       c.Query,
+		Compose:     c.Compose,
+		Ordered:     c.Ordered,
 	}
 	if c.Tracks != nil {
 		v3Tracks := make([]TrackV3, len(*c.Tracks))
@@ -73,6 +81,29 @@ func (store Datastore) getRandomTracksInCollectionV3(slug string, count int) (co
 	return
 }
 
+// writeCollectionRDFBySlug writes an RDF representation of a single collection, including
+// every track in it, resolved from the definition of a smart or composed collection.
+func writeCollectionRDFBySlug(store Datastore, w http.ResponseWriter, slug string, rdfType string) {
+	collection, err := store.getBasicCollection(slug)
+	if err != nil {
+		writeRDFResponse(w, nil, rdfType, err)
+		return
+	}
+	trackIDs, err := store.getMemberTrackIDs(collection)
+	if err != nil {
+		writeRDFResponse(w, nil, rdfType, err)
+		return
+	}
+	graph, err := rdfgen.CollectionToRdf([]rdfgen.CollectionData{{
+		Slug:           collection.Slug,
+		Name:           collection.Name,
+		Icon:           collection.Icon,
+		MembershipType: collection.membershipType(),
+		TrackIDs:       trackIDs,
+	}})
+	writeRDFResponse(w, graph, rdfType, err)
+}
+
 // CollectionsV3Controller handles all requests to /v3/collections endpoints.
 func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Request) {
 	normalisedpath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v3/collections"), "/")
@@ -101,6 +132,10 @@ func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Re
 			switch r.Method {
 			case "DELETE":
 				err = store.deleteCollection(slug)
+				if err != nil && err.Error() == "collection_in_use" {
+					writeV3ErrorResponse(w, http.StatusConflict, "Collection is used by one or more composed collections", "in_use")
+					return
+				}
 				writeContentlessResponse(w, err)
 			case "PUT":
 				var newCollection Collection
@@ -121,6 +156,10 @@ func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Re
 				}
 				fallthrough
 			case "GET":
+				if isRDF, mime := prefersRDF(r); isRDF && r.Method == "GET" {
+					writeCollectionRDFBySlug(store, w, slug, mime)
+					return
+				}
 				collection, err := store.getCollectionV3(slug, r.URL.Query().Get("page"))
 				if err != nil {
 					writeV3Error(w, err)
@@ -131,15 +170,11 @@ func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Re
 				MethodNotAllowed(w, []string{"GET", "PUT", "DELETE"})
 			}
 		} else {
-			collectionFound, err := store.collectionExists(slug)
+			collection, err := store.getBasicCollection(slug)
 			if err != nil {
 				writeV3Error(w, err)
 				return
 			}
-			if !collectionFound {
-				writeV3Error(w, errors.New("Collection Not Found"))
-				return
-			}
 			trackid, err := strconv.Atoi(pathparts[2])
 			if err != nil {
 				switch pathparts[2] {
@@ -154,6 +189,12 @@ func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Re
 						return
 					}
 					writeJSONResponse(w, result, nil)
+				case "positions":
+					store.collectionPositionsHandler(w, r, collection, pathparts)
+				case "playlist.m3u":
+					store.collectionPlaylistExportHandler(w, r, collection, "m3u")
+				case "playlist.xspf":
+					store.collectionPlaylistExportHandler(w, r, collection, "xspf")
 				default:
 					writeV3ErrorResponse(w, http.StatusNotFound, "Collection Endpoint Not Found", "not_found")
 				}
@@ -167,9 +208,14 @@ func (store Datastore) CollectionsV3Controller(w http.ResponseWriter, r *http.Re
 					writeV3Error(w, errors.New("Track Not Found"))
 					return
 				}
+				if collection.membershipType() != "static" && (r.Method == "PUT" || r.Method == "DELETE") {
+					// Membership of smart and composed collections follows their definition, so can't be edited track by track
+					writeV3Error(w, errors.New("Changing tracks in "+collection.membershipType()+" collection "+slug+" not allowed"))
+					return
+				}
 				switch r.Method {
 				case "GET":
-					contains, err := store.isTrackInCollection(slug, trackid)
+					contains, err := store.isTrackInCollection(collection, trackid)
 					if err != nil {
 						writeV3Error(w, err)
 						return
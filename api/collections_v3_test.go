@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -369,3 +371,351 @@ func TestV3CollectionRandomKGreaterThanN(test *testing.T) {
 		seen[id] = true
 	}
 }
+
+// setupSmartCollectionTracks creates three weighted tracks: two in Welsh and one in English.
+func setupSmartCollectionTracks(test *testing.T) {
+	languages := []string{"cy", "cy", "en"}
+	for i, language := range languages {
+		id := i + 1
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", id),
+			fmt.Sprintf(`{"fingerprint":"smart%d","url":"http://example.org/smart/%d","duration":100,"tags":{"title":[{"name":"Smart %d"}],"language":[{"name":%q,"uri":"https://eolas.l42.eu/metadata/language/%s/"}]}}`, id, id, id, language, language), 200)
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d/weighting", id), "5", 200)
+	}
+}
+
+// getCollectionTrackIDs fetches a v3 collection endpoint and returns the ids of its tracks in order, formatted for comparison.
+func getCollectionTrackIDs(test *testing.T, path string) string {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	var collection CollectionV3
+	json.NewDecoder(resp.Body).Decode(&collection)
+	ids := []int{}
+	if collection.Tracks != nil {
+		for _, track := range *collection.Tracks {
+			ids = append(ids, track.ID)
+		}
+	}
+	return fmt.Sprint(ids)
+}
+
+// TestV3SmartCollectionFollowsTags checks a smart collection's membership is evaluated from its query on every read.
+func TestV3SmartCollectionFollowsTags(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","icon":"🏴","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	assertEqual(test, "Loganne event type", "collectionCreated", lastLoganneType)
+	assertEqual(test, "Tracks matching query", "[1 2]", getCollectionTrackIDs(test, "/v3/collections/welsh"))
+
+	// Retagging a track changes membership without touching the collection
+	setupRequest(test, "PATCH", "/v3/tracks/3", `{"tags":{"language":[{"name":"cy","uri":"https://eolas.l42.eu/metadata/language/cy/"}]}}`, 200)
+	assertEqual(test, "Tracks after retagging", "[1 2 3]", getCollectionTrackIDs(test, "/v3/collections/welsh"))
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"language":[{"name":"en","uri":"https://eolas.l42.eu/metadata/language/en/"}]}}`, 200)
+	assertEqual(test, "Tracks after untagging", "[2 3]", getCollectionTrackIDs(test, "/v3/collections/welsh"))
+
+	random := getCollectionTrackIDs(test, "/v3/collections/welsh/random")
+	if random != "[2 3]" && random != "[3 2]" {
+		test.Errorf("Expected random tracks to be drawn from the query results, got %v", random)
+	}
+	makeRequest(test, "GET", "/v3/collections/welsh/3", "", 200, `{"inCollection":true}`, true)
+	makeRequest(test, "GET", "/v3/collections/welsh/1", "", 404, `{"error":"Track Not In Collection","code":"not_found"}`, true)
+
+	request := basicRequest(test, "GET", "/v3/collections", "")
+	resp, _ := doRawRequest(test, request)
+	var collections []CollectionV3
+	json.NewDecoder(resp.Body).Decode(&collections)
+	assertEqual(test, "Smart collection query", "p.language.uri=https://eolas.l42.eu/metadata/language/cy/", *collections[0].Query)
+	assertEqual(test, "Smart collection count", 2, *collections[0].TotalTracks)
+	assertEqual(test, "Smart collection playable", true, *collections[0].IsPlayable)
+}
+
+// TestV3SmartCollectionComparisons checks a smart collection can compare ordinal predicates by level,
+// and literal predicates as numbers, alongside exact matches.
+func TestV3SmartCollectionComparisons(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"singalong":[{"name":"3"}],"year":[{"name":"1999"}]}}`, 200)
+	setupRequest(test, "PATCH", "/v3/tracks/2", `{"tags":{"singalong":[{"name":"Hum a Bit"}],"year":[{"name":"2005"}]}}`, 200)
+	setupRequest(test, "PATCH", "/v3/tracks/3", `{"tags":{"singalong":[{"name":"5"}],"year":[{"name":"unknown"}]}}`, 200)
+
+	setupRequest(test, "PUT", "/v3/collections/welsh-singalong", `{"name":"Welsh singalong","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/&p.singalong>=3"}`, 200)
+	assertEqual(test, "Welsh tracks with singalong at least 3", "[1]", getCollectionTrackIDs(test, "/v3/collections/welsh-singalong"))
+	setupRequest(test, "PUT", "/v3/collections/quiet", `{"name":"Quiet","query":"p.singalong<3"}`, 200)
+	assertEqual(test, "Tracks with singalong below 3", "[2]", getCollectionTrackIDs(test, "/v3/collections/quiet"))
+	setupRequest(test, "PUT", "/v3/collections/loud", `{"name":"Loud","query":"p.singalong>3"}`, 200)
+	assertEqual(test, "Tracks with singalong above 3", "[3]", getCollectionTrackIDs(test, "/v3/collections/loud"))
+	setupRequest(test, "PUT", "/v3/collections/old", `{"name":"Old","query":"p.year<=2000"}`, 200)
+	assertEqual(test, "Tracks from 2000 or earlier", "[1]", getCollectionTrackIDs(test, "/v3/collections/old"))
+	setupRequest(test, "PUT", "/v3/collections/recent", `{"name":"Recent","query":"p.year>2000"}`, 200)
+	assertEqual(test, "Tracks from after 2000", "[2]", getCollectionTrackIDs(test, "/v3/collections/recent"))
+	makeRequest(test, "GET", "/v3/collections/loud/3", "", 200, `{"inCollection":true}`, true)
+}
+
+// TestV3TrackListsSmartAndComposedCollections checks a track's collections include the smart and
+// composed collections it currently belongs to, as well as static ones.
+func TestV3TrackListsSmartAndComposedCollections(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/favourites", `{"name":"Favourites","icon":"⭐"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/favourites/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","icon":"🏴","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/both", `{"name":"Both","compose":{"operation":"intersection","collections":["favourites","welsh"]}}`, 200)
+
+	trackCollections := func(trackid string) (slugs []string) {
+		request := basicRequest(test, "GET", "/v3/tracks/"+trackid, "")
+		resp, _ := doRawRequest(test, request)
+		var track TrackV3
+		json.NewDecoder(resp.Body).Decode(&track)
+		for _, collection := range *track.Collections {
+			slugs = append(slugs, collection.Slug)
+		}
+		return
+	}
+	assertEqual(test, "Collections of track in all three", "[favourites both welsh]", fmt.Sprint(trackCollections("1")))
+	assertEqual(test, "Collections of track in smart collection", "[welsh]", fmt.Sprint(trackCollections("2")))
+	assertEqual(test, "Collections of track in none", "[]", fmt.Sprint(trackCollections("3")))
+}
+
+// TestV3TrackListingIncludesEachTracksCollections checks a page of tracks gives each track
+// the same collections as fetching it on its own, though they're looked up for the whole page at once.
+func TestV3TrackListingIncludesEachTracksCollections(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/favourites", `{"name":"Favourites","icon":"⭐"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/favourites/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/favourites/3", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","icon":"🏴","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/both", `{"name":"Both","compose":{"operation":"intersection","collections":["favourites","welsh"]}}`, 200)
+
+	request := basicRequest(test, "GET", "/v3/tracks", "")
+	resp, _ := doRawRequest(test, request)
+	var result SearchResultV3
+	json.NewDecoder(resp.Body).Decode(&result)
+	listed := map[int]string{}
+	for _, track := range result.Tracks {
+		slugs := []string{}
+		for _, collection := range *track.Collections {
+			slugs = append(slugs, collection.Slug)
+		}
+		listed[track.ID] = fmt.Sprint(slugs)
+	}
+	assertEqual(test, "Collections of track in all three", "[favourites both welsh]", listed[1])
+	assertEqual(test, "Collections of track in smart collection", "[welsh]", listed[2])
+	assertEqual(test, "Collections of track in static collection", "[favourites]", listed[3])
+}
+
+// TestV3TrackRoundTripInSmartCollection checks a track's collections, smart ones included,
+// can be PUT back as they were fetched, and that doing so doesn't list the track in the smart collection directly.
+func TestV3TrackRoundTripInSmartCollection(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/favourites", `{"name":"Favourites","icon":"⭐"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/favourites/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","icon":"🏴","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/both", `{"name":"Both","compose":{"operation":"intersection","collections":["favourites","welsh"]}}`, 200)
+
+	fetched := getBody(test, "/v3/tracks/1")
+	setupRequest(test, "PUT", "/v3/tracks/1", fetched, 200)
+	store := DBInit("testrouting.sqlite", MockLoganne{})
+	defer store.DB.Close()
+	var listed int
+	err := store.DB.Get(&listed, "SELECT COUNT(*) FROM collection_track WHERE collectionslug IN ('welsh', 'both')")
+	if err != nil {
+		test.Fatal(err)
+	}
+	assertEqual(test, "Tracks listed in smart and composed collections", 0, listed)
+
+	// Leaving out a smart collection the track is in doesn't take it out of that collection,
+	// but static collections still follow the list.
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"collections":[]}`, 200)
+	assertEqual(test, "Smart collection after leaving it out", "[1 2]", getCollectionTrackIDs(test, "/v3/collections/welsh"))
+	assertEqual(test, "Static collection after leaving it out", "[]", getCollectionTrackIDs(test, "/v3/collections/favourites"))
+
+	makeRequest(test, "PATCH", "/v3/tracks/3", `{"collections":[{"slug":"welsh"}]}`, 400, `{"error":"Changing tracks in smart collection welsh not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PATCH", "/v3/tracks/3", `{"collections":[{"slug":"favourites"},{"slug":"both"}]}`, 400, `{"error":"Changing tracks in composed collection both not allowed","code":"bad_request"}`, true)
+	assertEqual(test, "Static collection after rejected update", "[]", getCollectionTrackIDs(test, "/v3/collections/favourites"))
+}
+
+// TestV3SmartCollectionMembershipNotEditable checks tracks can't be added to or removed from a smart collection directly.
+func TestV3SmartCollectionMembershipNotEditable(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	makeRequest(test, "PUT", "/v3/collections/welsh/3", "", 400, `{"error":"Changing tracks in smart collection welsh not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/collections/welsh/1", "", 400, `{"error":"Changing tracks in smart collection welsh not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/welsh", `{"tracks":[{"id":3}]}`, 400, `{"error":"Listing tracks for smart collection welsh not allowed","code":"bad_request"}`, true)
+}
+
+// TestV3SmartCollectionInvalidQuery checks queries are validated when saved.
+func TestV3SmartCollectionInvalidQuery(test *testing.T) {
+	clearData()
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"page=2"}`, 400, `{"error":"Only p. filters are supported, so collection query parameter \"page\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"p.title.uri=http://example.org/"}`, 400, `{"error":"Collection query not allowed: predicate \"title\" does not support URI-based filtering","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"%zz"}`, 400, `{"error":"Malformed collection query \"%zz\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"p.singalong!=3"}`, 400, `{"error":"Only exact matches and >=, <=, > and < comparisons are supported, so collection query parameter \"p.singalong!\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"p.singalong>=lots"}`, 400, `{"error":"Comparing predicate \"singalong\" with \"lots\", which isn't a number, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"p.dance>3"}`, 400, `{"error":"Comparing predicate \"dance\", which isn't ordinal or literal, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "GET", "/v3/collections/bad", "", 404, `{"error":"Collection Not Found","code":"not_found"}`, true)
+}
+
+// TestV3ConvertCollectionBetweenStaticAndSmart checks a static collection must be emptied before it gets a query,
+// and that clearing the query makes it static again.
+func TestV3ConvertCollectionBetweenStaticAndSmart(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/mixed", `{"name":"Mixed"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/mixed/3", "", 200)
+	makeRequest(test, "PUT", "/v3/collections/mixed", `{"query":"p.title=Smart 1"}`, 400, `{"error":"Adding a query to collection mixed which already lists tracks not allowed","code":"bad_request"}`, true)
+
+	setupRequest(test, "PUT", "/v3/collections/mixed", `{"query":"p.title=Smart 1","tracks":[]}`, 200)
+	assertEqual(test, "Tracks once smart", "[1]", getCollectionTrackIDs(test, "/v3/collections/mixed"))
+
+	setupRequest(test, "PUT", "/v3/collections/mixed", `{"query":""}`, 200)
+	assertEqual(test, "Tracks once static again", "[]", getCollectionTrackIDs(test, "/v3/collections/mixed"))
+	makeRequest(test, "PUT", "/v3/collections/mixed/2", "", 200, `{"inCollection":true}`, true)
+}
+
+// setupComposedCollections creates static collections "christmas" (tracks 1-3) and "offensive" (tracks 2 and 4)
+// from four weighted tracks.
+func setupComposedCollections(test *testing.T) {
+	for id := 1; id <= 4; id++ {
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", id), fmt.Sprintf(`{"fingerprint":"compose%d","url":"http://example.org/compose/%d","duration":100}`, id, id), 200)
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d/weighting", id), "5", 200)
+	}
+	setupRequest(test, "PUT", "/v3/collections/christmas", `{"name":"Christmas"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/offensive", `{"name":"Offensive"}`, 200)
+	for _, membership := range []string{"christmas/1", "christmas/2", "christmas/3", "offensive/2", "offensive/4"} {
+		setupRequest(test, "PUT", "/v3/collections/"+membership, "", 200)
+	}
+}
+
+// TestV3ComposedCollectionOperations checks union, intersection and difference are resolved at query time.
+func TestV3ComposedCollectionOperations(test *testing.T) {
+	clearData()
+	setupComposedCollections(test)
+	setupRequest(test, "PUT", "/v3/collections/both", `{"name":"Both","compose":{"operation":"union","collections":["christmas","offensive"]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/overlap", `{"name":"Overlap","compose":{"operation":"intersection","collections":["christmas","offensive"]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/safe-christmas", `{"name":"Safe Christmas","compose":{"operation":"difference","collections":["christmas","offensive"]}}`, 200)
+	assertEqual(test, "Union", "[1 2 3 4]", getCollectionTrackIDs(test, "/v3/collections/both"))
+	assertEqual(test, "Intersection", "[2]", getCollectionTrackIDs(test, "/v3/collections/overlap"))
+	assertEqual(test, "Difference", "[1 3]", getCollectionTrackIDs(test, "/v3/collections/safe-christmas"))
+
+	// Changes to the underlying collections show through straight away
+	setupRequest(test, "PUT", "/v3/collections/offensive/3", "", 200)
+	assertEqual(test, "Difference after change", "[1]", getCollectionTrackIDs(test, "/v3/collections/safe-christmas"))
+	assertEqual(test, "Random from difference", "[1]", getCollectionTrackIDs(test, "/v3/collections/safe-christmas/random"))
+	makeRequest(test, "GET", "/v3/collections/safe-christmas/1", "", 200, `{"inCollection":true}`, true)
+	makeRequest(test, "GET", "/v3/collections/safe-christmas/2", "", 404, `{"error":"Track Not In Collection","code":"not_found"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/safe-christmas/4", "", 400, `{"error":"Changing tracks in composed collection safe-christmas not allowed","code":"bad_request"}`, true)
+
+	request := basicRequest(test, "GET", "/v3/collections/safe-christmas", "")
+	resp, _ := doRawRequest(test, request)
+	var collection CollectionV3
+	json.NewDecoder(resp.Body).Decode(&collection)
+	assertEqual(test, "Composition operation", "difference", collection.Compose.Operation)
+	assertEqual(test, "Composition collections", "[christmas offensive]", fmt.Sprint(collection.Compose.Collections))
+}
+
+// TestV3NestedComposedCollection checks composed collections can be built from other composed and smart collections.
+func TestV3NestedComposedCollection(test *testing.T) {
+	clearData()
+	setupComposedCollections(test)
+	setupRequest(test, "PATCH", "/v3/tracks/4", `{"tags":{"title":[{"name":"Four"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/four", `{"name":"Four","query":"p.title=Four"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/safe-christmas", `{"name":"Safe Christmas","compose":{"operation":"difference","collections":["christmas","offensive"]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/nested", `{"name":"Nested","compose":{"operation":"union","collections":["safe-christmas","four"]}}`, 200)
+	assertEqual(test, "Nested union", "[1 3 4]", getCollectionTrackIDs(test, "/v3/collections/nested"))
+}
+
+// TestV3ComposedCollectionCycles checks compositions which would make a collection contain itself are rejected.
+func TestV3ComposedCollectionCycles(test *testing.T) {
+	clearData()
+	setupComposedCollections(test)
+	setupRequest(test, "PUT", "/v3/collections/a", `{"name":"A","compose":{"operation":"union","collections":["christmas","offensive"]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/b", `{"name":"B","compose":{"operation":"union","collections":["a","christmas"]}}`, 200)
+	makeRequest(test, "PUT", "/v3/collections/a", `{"compose":{"operation":"union","collections":["b","christmas"]}}`, 400, `{"error":"Composing collection a from b would create a cycle, so not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/a", `{"compose":{"operation":"union","collections":["a","christmas"]}}`, 400, `{"error":"Composing collection a from itself not allowed","code":"bad_request"}`, true)
+	assertEqual(test, "Composition unchanged after rejected update", "[1 2 3 4]", getCollectionTrackIDs(test, "/v3/collections/b"))
+}
+
+// TestV3ComposedCollectionValidation checks invalid compositions are rejected.
+func TestV3ComposedCollectionValidation(test *testing.T) {
+	clearData()
+	setupComposedCollections(test)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","compose":{"operation":"xor","collections":["christmas","offensive"]}}`, 400, `{"error":"Collection operation \"xor\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","compose":{"operation":"union","collections":["christmas"]}}`, 400, `{"error":"Composing collection bad from fewer than two collections not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","compose":{"operation":"union","collections":["christmas","easter"]}}`, 400, `{"error":"Composing collection bad from unknown collection easter not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/bad", `{"name":"Bad","query":"p.title=x","compose":{"operation":"union","collections":["christmas","offensive"]}}`, 400, `{"error":"Giving collection bad both a query and a composition not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/christmas", `{"compose":{"operation":"union","collections":["offensive","offensive"]}}`, 400, `{"error":"Adding a composition to collection christmas which already lists tracks not allowed","code":"bad_request"}`, true)
+}
+
+// TestV3DeleteCollectionUsedInComposition checks a collection can't be deleted while another is composed from it.
+func TestV3DeleteCollectionUsedInComposition(test *testing.T) {
+	clearData()
+	setupComposedCollections(test)
+	setupRequest(test, "PUT", "/v3/collections/both", `{"name":"Both","compose":{"operation":"union","collections":["christmas","offensive"]}}`, 200)
+	makeRequest(test, "DELETE", "/v3/collections/offensive", "", 409, `{"error":"Collection is used by one or more composed collections","code":"in_use"}`, true)
+
+	// Clearing the composition makes both collections static again, so they can then be deleted
+	setupRequest(test, "PUT", "/v3/collections/both", `{"compose":{"operation":""}}`, 200)
+	assertEqual(test, "Tracks once static again", "[]", getCollectionTrackIDs(test, "/v3/collections/both"))
+	makeRequest(test, "DELETE", "/v3/collections/offensive", "", 204, "", false)
+	setupRequest(test, "PUT", "/v3/collections/both2", `{"name":"Both2","compose":{"operation":"union","collections":["christmas","both"]}}`, 200)
+	makeRequest(test, "DELETE", "/v3/collections/both2", "", 204, "", false)
+	makeRequest(test, "DELETE", "/v3/collections/both", "", 204, "", false)
+}
+
+// getCollectionRDF fetches a collection as Turtle, returning the status code and body.
+func getCollectionRDF(test *testing.T, slug string) (int, string) {
+	request := basicRequest(test, "GET", "/v3/collections/"+slug, "")
+	request.Header.Set("Accept", "text/turtle")
+	response, err := doRawRequest(test, request)
+	if err != nil {
+		return 0, ""
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response.StatusCode, string(body)
+}
+
+// TestV3CollectionRDF checks GET /v3/collections/{slug} with Accept: text/turtle returns RDF listing the collection's tracks.
+func TestV3CollectionRDF(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/favourites", `{"name":"Favourites","icon":"⭐","tracks":[{"trackid":3},{"trackid":1}]}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	test.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	test.Setenv("APP_ORIGIN", "http://localhost:3002")
+
+	status, body := getCollectionRDF(test, "favourites")
+	assertEqual(test, "Static collection status", 200, status)
+	for _, expected := range []string{
+		"<http://localhost:8020/collections/favourites>",
+		"<http://localhost:3002/ontology#Collection>",
+		`"Favourites"`,
+		`"⭐"`,
+		"<http://localhost:8020/tracks/1>",
+		"<http://localhost:8020/tracks/3>",
+	} {
+		if !strings.Contains(body, expected) {
+			test.Errorf("Expected %s in static collection RDF, got: %s", expected, body)
+		}
+	}
+
+	if strings.Count(body, "ontology#SmartCollection>") != 1 {
+		test.Errorf("Expected static collection not to be typed as a smart one, got: %s", body)
+	}
+
+	// Smart collections list the tracks their query matches
+	status, body = getCollectionRDF(test, "welsh")
+	assertEqual(test, "Smart collection status", 200, status)
+	if !strings.Contains(body, "<http://localhost:8020/tracks/1>") || !strings.Contains(body, "<http://localhost:8020/tracks/2>") || strings.Contains(body, "<http://localhost:8020/tracks/3>") {
+		test.Errorf("Expected tracks 1 and 2 in smart collection RDF, got: %s", body)
+	}
+	// Once for the class, and once for the collection typed with it
+	if strings.Count(body, "<http://localhost:3002/ontology#SmartCollection>") != 2 {
+		test.Errorf("Expected smart collection to be typed as one, got: %s", body)
+	}
+
+	status, _ = getCollectionRDF(test, "nonexistent")
+	assertEqual(test, "Missing collection status", 404, status)
+}
@@ -25,7 +25,14 @@ func FrontController(store Datastore, clientKeys string) http.Handler {
 	router.HandleFunc("/v3/albums/", store.AlbumsV3Controller)
 	router.HandleFunc("/v3/artists", store.ArtistsV3Controller)
 	router.HandleFunc("/v3/artists/", store.ArtistsV3Controller)
+	router.HandleFunc("/v3/plays", store.PlaysV3Controller)
+	router.HandleFunc("/v3/plays/", store.PlaysV3Controller)
+	router.HandleFunc("/v3/stats", store.StatsV3Controller)
+	router.HandleFunc("/v3/stats/", store.StatsV3Controller)
+	router.HandleFunc("/v3/import", store.ImportV3Controller)
 	router.HandleFunc("/v2/export", RDFHandler)
+	router.HandleFunc("/v2/export/", RDFExportFilesHandler)
+	router.HandleFunc("/sparql", store.SparqlController)
 	router.HandleFunc("/ontology", OntologyHandler)
 	router.HandleFunc("/_info", store.InfoController)
 	router.HandleFunc("/webhooks", store.WebhooksController)
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"path/filepath"
 	"sort"
+	"sync"
 	"sync/atomic"
 
 	"github.com/jmoiron/sqlx"
@@ -25,13 +26,22 @@ type Datastore struct {
 	// infoCache holds a pointer to the most recently computed /_info metrics snapshot.
 	// It is a pointer to an atomic so it remains valid when Datastore is copied by value.
 	infoCache *atomic.Pointer[InfoMetricsSnapshot]
+	// statsCache holds a pointer to the most recently computed /v3/stats snapshot.
+	statsCache *atomic.Pointer[StatsSnapshot]
+	// sparqlGraph holds the graph /sparql queries are evaluated against, along with the
+	// data version it was built from.  sparqlGraphBuild holds any rebuild in progress,
+	// and sparqlGraphLock stops concurrent rebuilds.
+	sparqlGraph      *atomic.Pointer[sparqlSnapshot]
+	sparqlGraphBuild *atomic.Pointer[sparqlBuild]
+	sparqlGraphLock  *sync.Mutex
 }
 
 func DBInit(dbpath string, loganne LoganneInterface) (database Datastore) {
-	db := sqlx.MustConnect("sqlite3", dbpath+"?_busy_timeout=10000")
-	database = Datastore{DB: db, Loganne: loganne, infoCache: new(atomic.Pointer[InfoMetricsSnapshot])}
+	// Foreign keys are enabled in the DSN rather than with a PRAGMA, as a PRAGMA only applies
+	// to whichever pooled connection runs it, and deletes rely on ON DELETE CASCADE.
+	db := sqlx.MustConnect("sqlite3", dbpath+"?_busy_timeout=10000&_foreign_keys=1")
+	database = Datastore{DB: db, Loganne: loganne, infoCache: new(atomic.Pointer[InfoMetricsSnapshot]), statsCache: new(atomic.Pointer[StatsSnapshot]), sparqlGraph: new(atomic.Pointer[sparqlSnapshot]), sparqlGraphBuild: new(atomic.Pointer[sparqlBuild]), sparqlGraphLock: new(sync.Mutex)}
 	database.DB.MustExec("PRAGMA journal_mode=WAL;")
-	database.DB.MustExec("PRAGMA foreign_keys = ON;")
 	database.applyMigrations()
 	return
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"regexp"
 	"sync/atomic"
 	"testing"
 	"testing/fstest"
+	"lucos_media_metadata_api/predicateconfig"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -37,6 +41,71 @@ func TestDatabaseSetup(test *testing.T) {
 	os.Remove(dbpath)
 }
 
+// initWithSecondConnection sets up a database, and holds on to the connection it was set up
+// with, so anything done through the returned store has to open another connection.
+func initWithSecondConnection(test *testing.T, dbpath string) Datastore {
+	os.Remove(dbpath)
+	test.Cleanup(func() { os.Remove(dbpath) })
+	store := DBInit(dbpath, MockLoganne{})
+	held, err := store.DB.Conn(context.Background())
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { held.Close() })
+	return store
+}
+
+// TestAlbumDeleteCascadesOnEveryConnection checks an album's credits are removed with it,
+// whichever pooled connection the delete is made through.
+func TestAlbumDeleteCascadesOnEveryConnection(test *testing.T) {
+	store := initWithSecondConnection(test, "testalbumcascade.sqlite")
+	store.DB.MustExec(`INSERT INTO artist (id, name) VALUES (1, 'The Carpenters');
+		INSERT INTO album (id, name) VALUES (1, 'Close to You');
+		INSERT INTO album_artist (albumid, position, artistid) VALUES (1, 0, 1);`)
+	if err := store.deleteAlbum(1); err != nil {
+		test.Fatalf("Failed to delete album: %v", err)
+	}
+	var credits int
+	store.DB.Get(&credits, "SELECT COUNT(*) FROM album_artist")
+	assertEqual(test, "album credits left behind", 0, credits)
+	assertEqual(test, "artist credited error", nil, store.checkArtistUncredited(1))
+}
+
+// TestArtistDeleteCascadesOnEveryConnection checks an artist's aliases are removed with it,
+// whichever pooled connection the delete is made through, so they can be used again.
+func TestArtistDeleteCascadesOnEveryConnection(test *testing.T) {
+	store := initWithSecondConnection(test, "testartistcascade.sqlite")
+	store.DB.MustExec(`INSERT INTO artist (id, name) VALUES (1, 'Carpenters');
+		INSERT INTO artist_alias (artistid, name) VALUES (1, 'The Carpenters');`)
+	if err := store.deleteArtist(1); err != nil {
+		test.Fatalf("Failed to delete artist: %v", err)
+	}
+	var aliases int
+	store.DB.Get(&aliases, "SELECT COUNT(*) FROM artist_alias")
+	assertEqual(test, "aliases left behind", 0, aliases)
+}
+
+// TestArtistDeleteRemovesMembersWithoutCascade checks a group's member rows are deleted
+// with it, even on a connection without foreign keys, as older connections were.
+func TestArtistDeleteRemovesMembersWithoutCascade(test *testing.T) {
+	dbpath := "testartistmembers.sqlite"
+	os.Remove(dbpath)
+	defer os.Remove(dbpath)
+	DBInit(dbpath, MockLoganne{}).DB.Close()
+	db := sqlx.MustConnect("sqlite3", dbpath+"?_busy_timeout=10000")
+	defer db.Close()
+	store := Datastore{DB: db, Loganne: MockLoganne{}}
+	store.DB.MustExec(`INSERT INTO artist (id, name) VALUES (1, 'The Beatles'), (2, 'John Lennon');
+		INSERT INTO artist_member (groupid, position, memberid) VALUES (1, 1, 2);
+		INSERT INTO artist_member (groupid, position, person_uri) VALUES (1, 2, 'https://eolas.l42.eu/metadata/person/1/');`)
+	if err := store.deleteArtist(1); err != nil {
+		test.Fatalf("Failed to delete artist: %v", err)
+	}
+	var members int
+	store.DB.Get(&members, "SELECT COUNT(*) FROM artist_member")
+	assertEqual(test, "member rows left behind", 0, members)
+}
+
 func TestFreshDatabaseAllowsMultipleTagValues(test *testing.T) {
 	dbpath := "testfresh.sqlite"
 	os.Remove(dbpath)
@@ -54,6 +123,105 @@ func TestFreshDatabaseAllowsMultipleTagValues(test *testing.T) {
 	os.Remove(dbpath)
 }
 
+// TestDataVersionBumpedOnWrites checks every write to the library bumps the data version
+// the exporter uses to decide whether anything has changed, but plays don't.
+func TestDataVersionBumpedOnWrites(test *testing.T) {
+	dbpath := "testdataversion.sqlite"
+	os.Remove(dbpath)
+	datastore := DBInit(dbpath, MockLoganne{})
+	defer os.Remove(dbpath)
+
+	dataVersion := func() (version int) {
+		datastore.DB.Get(&version, "SELECT version FROM data_version WHERE id = 1")
+		return
+	}
+	initial := dataVersion()
+	datastore.DB.MustExec(`INSERT INTO track(id, url, fingerprint, duration) VALUES(1, 'http://example.com/t1', 'fp1', 100)`)
+	assertEqual(test, "version after inserting a track", initial+1, dataVersion())
+	datastore.DB.MustExec(`INSERT INTO predicate(id) VALUES('composer')`)
+	datastore.DB.MustExec(`INSERT INTO tag(trackid, predicateid, value) VALUES(1, 'composer', 'Bach')`)
+	assertEqual(test, "version after inserting a tag", initial+3, dataVersion())
+	datastore.DB.MustExec(`UPDATE tag SET value = 'Mozart' WHERE trackid = 1`)
+	assertEqual(test, "version after updating a tag", initial+4, dataVersion())
+	datastore.DB.MustExec(`DELETE FROM tag WHERE trackid = 1`)
+	assertEqual(test, "version after deleting a tag", initial+5, dataVersion())
+	datastore.DB.MustExec(`INSERT INTO play_event(trackid, type, timestamp) VALUES(1, 'play', '2026-01-01T00:00:00Z')`)
+	assertEqual(test, "version after a play", initial+5, dataVersion())
+}
+
+// TestDataVersionIgnoresUnexportedWrites checks writes which don't change the RDF export,
+// such as the tags recorded for each play and the weightings, don't bump the data version.
+func TestDataVersionIgnoresUnexportedWrites(test *testing.T) {
+	dbpath := "testdataversionunexported.sqlite"
+	os.Remove(dbpath)
+	datastore := DBInit(dbpath, MockLoganne{})
+	defer os.Remove(dbpath)
+
+	dataVersion := func() (version int) {
+		datastore.DB.Get(&version, "SELECT version FROM data_version WHERE id = 1")
+		return
+	}
+	datastore.DB.MustExec(`INSERT INTO track(id, url, fingerprint, duration) VALUES(1, 'http://example.com/t1', 'fp1', 100)`)
+	datastore.DB.MustExec(`INSERT INTO track(id, url, fingerprint, duration) VALUES(2, 'http://example.com/t2', 'fp2', 200)`)
+	datastore.DB.MustExec(`INSERT INTO predicate(id) VALUES('added')`)
+	datastore.DB.MustExec(`INSERT INTO tag(trackid, predicateid, value) VALUES(1, 'added', '2026-01-01T00:00:00Z')`)
+	initial := dataVersion()
+
+	for _, eventType := range []string{"play", "skip", "error"} {
+		_, err := datastore.recordPlayEvent(PlayEventV3{TrackID: 1, Type: eventType, Message: "Broken"})
+		if err != nil {
+			test.Fatalf("Failed to record %s event: %s", eventType, err)
+		}
+	}
+	assertEqual(test, "version after recording play events", initial, dataVersion())
+
+	if err := datastore.setTrackWeighting(1, 5); err != nil {
+		test.Fatalf("Failed to set weighting: %s", err)
+	}
+	assertEqual(test, "version after setting a weighting", initial, dataVersion())
+
+	datastore.DB.MustExec(`UPDATE track SET url = url, duration = duration WHERE id = 2`)
+	assertEqual(test, "version after rewriting a track unchanged", initial, dataVersion())
+
+	for id, config := range predicateconfig.All() {
+		if config.ValueShape != predicateconfig.ValueShapeOmit {
+			continue
+		}
+		before := dataVersion()
+		datastore.DB.MustExec(`INSERT OR IGNORE INTO predicate(id) VALUES($1)`, id)
+		datastore.DB.MustExec(`INSERT INTO tag(trackid, predicateid, value) VALUES(2, $1, 'a')`, id)
+		datastore.DB.MustExec(`UPDATE tag SET value = 'b' WHERE trackid = 2 AND predicateid = $1`, id)
+		datastore.DB.MustExec(`DELETE FROM tag WHERE trackid = 2 AND predicateid = $1`, id)
+		assertEqual(test, "version after writing "+id+" tags", before, dataVersion())
+	}
+
+	// And the reverse: every predicate the triggers leave out must still be omitted from RDF,
+	// or writes to it would change the export without the exporter noticing.
+	var triggers []string
+	err := datastore.DB.Select(&triggers, `SELECT sql FROM sqlite_master WHERE type = 'trigger' AND sql LIKE '%NOT IN%'`)
+	if err != nil {
+		test.Fatal(err)
+	}
+	assertEqual(test, "triggers excluding predicates", 6, len(triggers))
+	excludedList := regexp.MustCompile(`NOT IN \(([^)]*)\)`)
+	quoted := regexp.MustCompile(`'([^']*)'`)
+	registry := predicateconfig.All()
+	for _, trigger := range triggers {
+		for _, list := range excludedList.FindAllStringSubmatch(trigger, -1) {
+			for _, id := range quoted.FindAllStringSubmatch(list[1], -1) {
+				config, found := registry[id[1]]
+				if !found || config.ValueShape != predicateconfig.ValueShapeOmit {
+					test.Errorf("Data version triggers ignore writes to %q, which isn't a ValueShapeOmit predicate", id[1])
+				}
+			}
+		}
+	}
+
+	before := dataVersion()
+	datastore.DB.MustExec(`UPDATE track SET duration = 150 WHERE id = 2`)
+	assertEqual(test, "version after changing a duration", before+1, dataVersion())
+}
+
 func TestUpdateTagDeletesAndInserts(test *testing.T) {
 	dbpath := "testupdatetag.sqlite"
 	os.Remove(dbpath)
@@ -217,7 +385,7 @@ func TestMigrationRunnerOrdering(test *testing.T) {
 	db := sqlx.MustConnect("sqlite3", dbpath+"?_busy_timeout=10000")
 	db.MustExec("PRAGMA journal_mode=WAL;")
 	db.MustExec("PRAGMA foreign_keys = ON;")
-	store := Datastore{DB: db, Loganne: MockLoganne{}, infoCache: new(atomic.Pointer[InfoMetricsSnapshot])}
+	store := Datastore{DB: db, Loganne: MockLoganne{}, infoCache: new(atomic.Pointer[InfoMetricsSnapshot]), statsCache: new(atomic.Pointer[StatsSnapshot])}
 
 	// Two migrations: create a table, then add a column — order matters.
 	testFS := fstest.MapFS{
@@ -247,3 +415,49 @@ func TestMigrationRunnerOrdering(test *testing.T) {
 
 	os.Remove(dbpath)
 }
+
+// TestMBIDTagURIMigration checks 0013_mbid_tag_uri.sql gives existing MusicBrainz ID
+// tags the URI the RDF export derived from them.
+func TestMBIDTagURIMigration(test *testing.T) {
+	dbpath := "testmbidtaguri.sqlite"
+	os.Remove(dbpath)
+	db := DBInit(dbpath, MockLoganne{})
+	db.DB.MustExec("DELETE FROM schema_migrations WHERE version = '0013_mbid_tag_uri.sql'")
+	db.DB.MustExec("INSERT INTO track(id, url, fingerprint, duration) VALUES(1, 'http://example.org/mbid', 'mbid', 100)")
+	db.DB.MustExec("INSERT OR IGNORE INTO predicate(id) VALUES('mbid_artist'), ('mbid_recording'), ('mbid_release'), ('title')")
+	db.DB.MustExec(`INSERT INTO tag(trackid, predicateid, value, uri) VALUES
+		(1, 'mbid_artist', 'b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d', ''),
+		(1, 'mbid_recording', '9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b', NULL),
+		(1, 'mbid_release', '0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a', 'https://example.org/ignored'),
+		(1, 'title', 'Untouched', '')`)
+	db.applyMigrations()
+
+	var uris []string
+	db.DB.Select(&uris, "SELECT IFNULL(uri, '') FROM tag WHERE trackid = 1 ORDER BY predicateid")
+	expected := []string{
+		"https://musicbrainz.org/artist/b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d",
+		"https://musicbrainz.org/recording/9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b",
+		"https://musicbrainz.org/release/0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a",
+		"",
+	}
+	assertEqual(test, "tag uris after migration", fmt.Sprint(expected), fmt.Sprint(uris))
+
+	// Legacy values are normalised as new ones would be, and ones which still aren't
+	// a MusicBrainz ID are removed rather than given a URI.
+	db.DB.MustExec("DELETE FROM schema_migrations WHERE version = '0013_mbid_tag_uri.sql'")
+	db.DB.MustExec("INSERT INTO track(id, url, fingerprint, duration) VALUES(2, 'http://example.org/mbid2', 'mbid2', 100)")
+	db.DB.MustExec(`INSERT INTO tag(trackid, predicateid, value, uri) VALUES
+		(2, 'mbid_artist', ' B10BBBFC-CF9E-42E0-BE17-E2C3E1D2600D` + "\t" + `', ''),
+		(2, 'mbid_recording', 'http://www.musicbrainz.org/recording/9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b/', ''),
+		(2, 'mbid_release', 'not an id', '')`)
+	db.applyMigrations()
+	var tags []TagValueV3
+	db.DB.Select(&tags, "SELECT value AS name, IFNULL(uri, '') AS uri FROM tag WHERE trackid = 2 ORDER BY predicateid")
+	expectedTags := []TagValueV3{
+		{Name: "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d", URI: "https://musicbrainz.org/artist/b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"},
+		{Name: "9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b", URI: "https://musicbrainz.org/recording/9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b"},
+	}
+	assertEqual(test, "malformed tags after migration", fmt.Sprint(expectedTags), fmt.Sprint(tags))
+
+	os.Remove(dbpath)
+}
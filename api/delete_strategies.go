@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// deleteStrategy is how references to an album or artist still in use are dealt with
+// when it's deleted, given by the "strategy" query parameter:
+//   - "reassign" merges it into the entity given by "reassignTo", so the merge can be undone
+//   - "strip" removes the tag from every track referencing it
+//   - "freetext" keeps the tag's value on each track but clears its URI, as is done when
+//     an entity is deleted from lucos_eolas.  Such tags are reported by the URI integrity check.
+//
+// Without a strategy, deleting anything still in use is refused.
+type deleteStrategy struct {
+	Name       string
+	ReassignTo int
+}
+
+// deleteStrategyFromQuery reads the delete strategy from a request's query parameters.
+func deleteStrategyFromQuery(query url.Values) (strategy deleteStrategy, err error) {
+	strategy.Name = query.Get("strategy")
+	rawReassignTo := query.Get("reassignTo")
+	switch strategy.Name {
+	case "reassign":
+		strategy.ReassignTo, err = strconv.Atoi(rawReassignTo)
+		if err != nil || strategy.ReassignTo <= 0 {
+			err = errors.New("Reassigning without a \"reassignTo\" id not allowed")
+		}
+	case "", "strip", "freetext":
+		if rawReassignTo != "" {
+			err = errors.New("A \"reassignTo\" id without the reassign strategy not allowed")
+		}
+	default:
+		err = errors.New("Delete strategy \"" + strategy.Name + "\" not allowed")
+	}
+	return
+}
+
+// AlbumDeletionV3 is the outcome of deleting an album using a strategy: the album deleted,
+// the album it was reassigned to (if any) and the tracks which referenced it.
+// MergeID identifies the merge recorded when reassigning, so it can be undone.
+type AlbumDeletionV3 struct {
+	Strategy     string   `json:"strategy"`
+	Album        AlbumV3  `json:"album"`
+	ReassignedTo *AlbumV3 `json:"reassignedTo,omitempty"`
+	MergeID      int      `json:"mergeId,omitempty"`
+	TrackIDs     []int    `json:"trackIds"`
+}
+
+// ArtistDeletionV3 is the outcome of deleting an artist using a strategy, as for albums.
+type ArtistDeletionV3 struct {
+	Strategy     string    `json:"strategy"`
+	Artist       ArtistV3  `json:"artist"`
+	ReassignedTo *ArtistV3 `json:"reassignedTo,omitempty"`
+	MergeID      int       `json:"mergeId,omitempty"`
+	TrackIDs     []int     `json:"trackIds"`
+}
+
+// detachTags strips or clears the URI of the tags referencing an entity, depending on
+// the strategy, returning the tracks they were on.
+func detachTags(tx *sqlx.Tx, predicate string, uri string, strategy string) (trackIDs []int, err error) {
+	trackIDs = []int{}
+	err = tx.Select(&trackIDs, "SELECT DISTINCT trackid FROM tag WHERE predicateid = $1 AND uri = $2 ORDER BY trackid", predicate, uri)
+	if err != nil {
+		return
+	}
+	if strategy == "strip" {
+		_, err = tx.Exec("DELETE FROM tag WHERE predicateid = $1 AND uri = $2", predicate, uri)
+	} else {
+		_, err = tx.Exec("UPDATE tag SET uri = '' WHERE predicateid = $1 AND uri = $2", predicate, uri)
+	}
+	return
+}
+
+// latestMerge returns the id of the most recent merge of an entity, along with the tracks it repointed.
+func (store Datastore) latestMerge(kind string, sourceID int) (mergeID int, trackIDs []int, err error) {
+	err = store.DB.Get(&mergeID, "SELECT id FROM entity_merge WHERE kind = $1 AND sourceid = $2 ORDER BY id DESC LIMIT 1", kind, sourceID)
+	if err != nil {
+		return
+	}
+	merged, err := store.getMergeTrackIDs([]int{mergeID})
+	if err != nil {
+		return
+	}
+	trackIDs = merged[mergeID]
+	if trackIDs == nil {
+		trackIDs = []int{}
+	}
+	return
+}
+
+// deleteAlbumWithStrategy deletes an album along with any references to it, as given by the strategy.
+// Reassigning emits an albumMerged Loganne event; otherwise an albumDeleted event is emitted.
+func (store Datastore) deleteAlbumWithStrategy(id int, strategy deleteStrategy) (deletion AlbumDeletionV3, err error) {
+	slog.Info("Delete Album", "id", id, "strategy", strategy.Name)
+	deletion.Strategy = strategy.Name
+	deletion.Album, err = store.getAlbumByID(id)
+	if err != nil {
+		return
+	}
+
+	if strategy.Name == "reassign" {
+		if strategy.ReassignTo == id {
+			err = errors.New("Album " + strconv.Itoa(id) + " being reassigned to itself not allowed")
+			return
+		}
+		var target AlbumV3
+		target, err = store.getAlbumByID(strategy.ReassignTo)
+		if err != nil {
+			if err.Error() == "Album Not Found" {
+				err = errors.New("Reassigning to missing album " + strconv.Itoa(strategy.ReassignTo) + " not allowed")
+			}
+			return
+		}
+		_, err = store.mergeAlbums(target.ID, []int{id})
+		if err != nil {
+			return
+		}
+		deletion.ReassignedTo = &target
+		deletion.MergeID, deletion.TrackIDs, err = store.latestMerge("album", id)
+		return
+	}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	deletion.TrackIDs, err = detachTags(tx, "album", deletion.Album.URI, strategy.Name)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("DELETE FROM album WHERE id = $1", id)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	store.Loganne.albumPost("albumDeleted", "Album \""+deletion.Album.Name+"\" deleted", deletion.Album, false)
+	return
+}
+
+// deleteArtistWithStrategy deletes an artist along with any references to it, as given by the strategy.
+// Reassigning moves the artist's album credits and group memberships too, but otherwise it returns
+// the same errors as deleteArtist if it's credited on an album or is a member of a group.
+func (store Datastore) deleteArtistWithStrategy(id int, strategy deleteStrategy) (deletion ArtistDeletionV3, err error) {
+	slog.Info("Delete Artist", "id", id, "strategy", strategy.Name)
+	deletion.Strategy = strategy.Name
+	deletion.Artist, err = store.getArtistByID(id)
+	if err != nil {
+		return
+	}
+
+	if strategy.Name == "reassign" {
+		if strategy.ReassignTo == id {
+			err = errors.New("Artist " + strconv.Itoa(id) + " being reassigned to itself not allowed")
+			return
+		}
+		var target ArtistV3
+		target, err = store.getArtistByID(strategy.ReassignTo)
+		if err != nil {
+			if err.Error() == "Artist Not Found" {
+				err = errors.New("Reassigning to missing artist " + strconv.Itoa(strategy.ReassignTo) + " not allowed")
+			}
+			return
+		}
+		_, err = store.mergeArtists(target.ID, []int{id})
+		if err != nil {
+			return
+		}
+		deletion.ReassignedTo = &target
+		deletion.MergeID, deletion.TrackIDs, err = store.latestMerge("artist", id)
+		return
+	}
+
+	err = store.checkArtistUncredited(id)
+	if err != nil {
+		return
+	}
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	deletion.TrackIDs, err = detachTags(tx, "artist", deletion.Artist.URI, strategy.Name)
+	if err != nil {
+		return
+	}
+	err = deleteArtistMemberships(tx, id)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("DELETE FROM artist WHERE id = $1", id)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	store.Loganne.artistPost("artistDeleted", "Artist \""+deletion.Artist.Name+"\" deleted", deletion.Artist, false)
+	return
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestAlbumDeleteStrategies checks an album still in use can be deleted by reassigning,
+// stripping or converting to freetext the tags referencing it.
+func TestAlbumDeleteStrategies(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road (Remastered)"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Revolver"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Help!"}`, 201)
+	first := setupMergeTrack(test, 1, `"album":[{"uri":"/albums/2"}]`)
+	second := setupMergeTrack(test, 2, `"album":[{"uri":"/albums/3"}]`)
+	third := setupMergeTrack(test, 3, `"album":[{"uri":"/albums/4"}]`)
+	makeRequest(test, "DELETE", "/v3/albums/2", "", 409, `{"error":"Album is referenced by one or more tracks","code":"in_use"}`, true)
+
+	makeRequest(test, "DELETE", "/v3/albums/2?strategy=reassign&reassignTo=1", "", 200,
+		`{"strategy":"reassign","album":{"id":2,"name":"Abbey Road (Remastered)","uri":"/albums/2"},"reassignedTo":{"id":1,"name":"Abbey Road","uri":"/albums/1"},"mergeId":1,"trackIds":[1]}`, true)
+	assertEqual(test, "loganne event type", "albumMerged", lastLoganneType)
+	assertEqual(test, "Reassigned tag", TagValueV3{Name: "Abbey Road", URI: "/albums/1"}, getTagsForTrack(test, first)["album"][0])
+	assertEqual(test, "Reassignment recorded as a merge", 1, getMergeList(test, "/v3/albums/merges").TotalItems)
+
+	makeRequest(test, "DELETE", "/v3/albums/3?strategy=strip", "", 200,
+		`{"strategy":"strip","album":{"id":3,"name":"Revolver","uri":"/albums/3"},"trackIds":[2]}`, true)
+	assertEqual(test, "loganne event type", "albumDeleted", lastLoganneType)
+	assertEqual(test, "Stripped tag", 0, len(getTagsForTrack(test, second)["album"]))
+
+	makeRequest(test, "DELETE", "/v3/albums/4?strategy=freetext", "", 200,
+		`{"strategy":"freetext","album":{"id":4,"name":"Help!","uri":"/albums/4"},"trackIds":[3]}`, true)
+	assertEqual(test, "loganne event type", "albumDeleted", lastLoganneType)
+	assertEqual(test, "Freetext tag", TagValueV3{Name: "Help!"}, getTagsForTrack(test, third)["album"][0])
+
+	makeRequest(test, "GET", "/v3/albums", "", 200, `{"albums":[{"id":1,"name":"Abbey Road","uri":"/albums/1","usageCount":1}],"totalPages":1,"page":1,"totalItems":1}`, true)
+}
+
+// TestArtistDeleteStrategies checks an artist still in use can be deleted using a strategy,
+// and that only reassigning is allowed while it's credited on an album.
+func TestArtistDeleteStrategies(test *testing.T) {
+	clearData()
+	first := setupMergeTrack(test, 1, `"artist":[{"name":"Wings"}]`)
+	second := setupMergeTrack(test, 2, `"artist":[{"name":"Paul McCartney & Wings"}]`)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Band on the Run","artists":[{"uri":"/artists/2"}]}`, 201)
+
+	makeRequest(test, "DELETE", "/v3/artists/2?strategy=strip", "", 409, `{"error":"Artist is credited on one or more albums","code":"in_use"}`, true)
+	makeRequest(test, "DELETE", "/v3/artists/2?strategy=freetext", "", 409, `{"error":"Artist is credited on one or more albums","code":"in_use"}`, true)
+	assertEqual(test, "Track unchanged", fmt.Sprint([]TagValueV3{{Name: "Paul McCartney & Wings", URI: "/artists/2"}}), fmt.Sprint(getTagsForTrack(test, second)["artist"]))
+
+	makeRequest(test, "DELETE", "/v3/artists/2?strategy=reassign&reassignTo=1", "", 200,
+		`{"strategy":"reassign","artist":{"id":2,"name":"Paul McCartney & Wings","uri":"/artists/2"},"reassignedTo":{"id":1,"name":"Wings","uri":"/artists/1"},"mergeId":1,"trackIds":[2]}`, true)
+	assertEqual(test, "loganne event type", "artistMerged", lastLoganneType)
+	assertEqual(test, "Reassigned tag", fmt.Sprint([]TagValueV3{{Name: "Wings", URI: "/artists/1"}}), fmt.Sprint(getTagsForTrack(test, second)["artist"]))
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Band on the Run","uri":"/albums/1","artists":[{"name":"Wings","uri":"/artists/1"}]}`, true)
+
+	setupRequest(test, "PUT", "/v3/albums/1", `{"name":"Band on the Run","artists":[]}`, 200)
+	makeRequest(test, "DELETE", "/v3/artists/1?strategy=freetext", "", 200,
+		`{"strategy":"freetext","artist":{"id":1,"name":"Wings","uri":"/artists/1"},"trackIds":[1,2]}`, true)
+	assertEqual(test, "loganne event type", "artistDeleted", lastLoganneType)
+	assertEqual(test, "Freetext tag", fmt.Sprint([]TagValueV3{{Name: "Wings"}}), fmt.Sprint(getTagsForTrack(test, first)["artist"]))
+}
+
+// TestDeleteStrategyErrors checks invalid strategies are rejected without deleting anything.
+func TestDeleteStrategyErrors(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Rubber Soul"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles"}`, 201)
+
+	makeRequest(test, "DELETE", "/v3/albums/1?strategy=cascade", "", 400, `{"error":"Delete strategy \"cascade\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/albums/1?strategy=reassign", "", 400, `{"error":"Reassigning without a \"reassignTo\" id not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/albums/1?strategy=strip&reassignTo=2", "", 400, `{"error":"A \"reassignTo\" id without the reassign strategy not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/albums/1?strategy=reassign&reassignTo=1", "", 400, `{"error":"Album 1 being reassigned to itself not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/albums/1?strategy=reassign&reassignTo=99", "", 400, `{"error":"Reassigning to missing album 99 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/artists/1?strategy=reassign&reassignTo=99", "", 400, `{"error":"Reassigning to missing artist 99 not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "DELETE", "/v3/albums/99?strategy=strip", "", 404, `{"error":"Album Not Found","code":"not_found"}`, true)
+	makeRequest(test, "DELETE", "/v3/artists/99?strategy=strip", "", 404, `{"error":"Artist Not Found","code":"not_found"}`, true)
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Rubber Soul","uri":"/albums/1"}`, true)
+
+	// A strategy isn't needed for something not in use, but is harmless
+	makeRequest(test, "DELETE", "/v3/artists/1?strategy=strip", "", 200,
+		`{"strategy":"strip","artist":{"id":1,"name":"The Beatles","uri":"/artists/1"},"trackIds":[]}`, true)
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DuplicateMemberV3 is one of the albums or artists in a cluster of likely duplicates.
+type DuplicateMemberV3 struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	URI        string `json:"uri"`
+	TrackCount int    `json:"trackCount"` // the number of tracks tagged with it
+}
+
+// MergeRequestV3 is the request body for merging albums or artists.
+type MergeRequestV3 struct {
+	TargetID  int   `json:"targetId"`
+	SourceIDs []int `json:"sourceIds"`
+}
+
+// DuplicateClusterV3 is a group of albums or artists which are likely to be the same.
+// Match is "exact" where all their names normalise the same, or "fuzzy" where some are only close.
+// SharedTitles are track titles found under more than one member, which make a duplicate more likely.
+// Merge suggests merging into the member with the most tracks, and can be posted as is to the merge endpoint.
+type DuplicateClusterV3 struct {
+	Match        string              `json:"match"`
+	Members      []DuplicateMemberV3 `json:"members"`
+	SharedTitles []string            `json:"sharedTitles"`
+	Merge        MergeRequestV3      `json:"merge"`
+}
+
+// DuplicatesV3 lists clusters of likely duplicates, strongest evidence first.
+type DuplicatesV3 struct {
+	Clusters []DuplicateClusterV3 `json:"clusters"`
+}
+
+// duplicateCandidate is an album or artist considered for duplicate detection, with
+// the normalised forms of the names it's known by.
+type duplicateCandidate struct {
+	member DuplicateMemberV3
+	keys   []string
+}
+
+// featuringPattern matches a featured artist credit and everything after it, eg " (feat. Someone)".
+var featuringPattern = regexp.MustCompile(`\s*[\(\[]?\b(feat\.?|ft\.?|featuring)\s.*$`)
+
+// diacriticFolds maps accented Latin letters to their unaccented forms.
+var diacriticFolds = map[rune]string{}
+
+func init() {
+	for plain, accented := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđ", "e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥħ",
+		"i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő",
+		"r": "ŕŗř", "s": "śŝşšș", "t": "ţťŧț", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+		"ae": "æ", "oe": "œ", "ss": "ß", "th": "þ", "dh": "ð",
+	} {
+		for _, letter := range accented {
+			diacriticFolds[letter] = plain
+		}
+	}
+}
+
+// normaliseName reduces a name to a form in which trivially different spellings match:
+// lowercased, without diacritics, punctuation, a leading or trailing "the", "a" or "an"
+// (as in "Beatles, The"), or a featured artist credit.  "&" is treated as "and".
+func normaliseName(name string) string {
+	name = featuringPattern.ReplaceAllString(strings.ToLower(name), "")
+	var folded strings.Builder
+	for _, letter := range strings.ReplaceAll(name, "&", " and ") {
+		if plain, ok := diacriticFolds[letter]; ok {
+			folded.WriteString(plain)
+		} else if unicode.IsLetter(letter) || unicode.IsDigit(letter) {
+			folded.WriteRune(letter)
+		} else if letter != '\'' && letter != '’' && letter != '.' {
+			folded.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(folded.String())
+	isArticle := func(word string) bool { return word == "the" || word == "a" || word == "an" }
+	if len(words) > 1 && isArticle(words[0]) {
+		words = words[1:]
+	} else if len(words) > 1 && isArticle(words[len(words)-1]) {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// editDistance returns the Levenshtein distance between two strings, counted in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// namesClose reports whether two normalised names are within the edit distance allowed
+// for their length: one edit for every five letters, so short names must match exactly.
+func namesClose(a, b string) bool {
+	allowed := min(len([]rune(a)), len([]rune(b))) / 5
+	if allowed == 0 {
+		return false
+	}
+	lengthDifference := len([]rune(a)) - len([]rune(b))
+	if lengthDifference > allowed || -lengthDifference > allowed {
+		return false
+	}
+	return editDistance(a, b) <= allowed
+}
+
+// duplicatePair is a pair of candidates, i before j, with a name in common (match) or
+// only with names close to each other.
+type duplicatePair struct {
+	i, j  int
+	match bool
+}
+
+// duplicatePairs returns the pairs of candidates with names which normalise the same or
+// are close, ordered by i then j.  Rather than comparing every pair of names, identical
+// names are looked up in a map, and only names which share enough bigrams (pairs of
+// adjacent letters) to be close are compared: each edit changes at most two of a name's
+// bigrams, so names within k edits of each other share at least max(length)-1-2k.
+func duplicatePairs(candidates []duplicateCandidate) (pairs []duplicatePair) {
+	type posting struct {
+		name, count int
+	}
+	var owners []int
+	var names []string
+	byName := map[string][]int{}
+	byBigram := map[string][]posting{}
+	found := map[[2]int]int{}
+	add := func(i, j int, match bool) {
+		if i == j {
+			return
+		}
+		if i > j {
+			i, j = j, i
+		}
+		if index, ok := found[[2]int{i, j}]; ok {
+			pairs[index].match = pairs[index].match || match
+			return
+		}
+		found[[2]int{i, j}] = len(pairs)
+		pairs = append(pairs, duplicatePair{i: i, j: j, match: match})
+	}
+	for i, candidate := range candidates {
+		for _, key := range candidate.keys {
+			if key == "" {
+				continue
+			}
+			for _, other := range byName[key] {
+				add(other, i, true)
+			}
+			byName[key] = append(byName[key], i)
+
+			letters := []rune(key)
+			bigrams := map[string]int{}
+			for b := 0; b+1 < len(letters); b++ {
+				bigrams[string(letters[b:b+2])]++
+			}
+			shared := map[int]int{}
+			for bigram, count := range bigrams {
+				for _, earlier := range byBigram[bigram] {
+					shared[earlier.name] += min(count, earlier.count)
+				}
+			}
+			for name, count := range shared {
+				other := []rune(names[name])
+				allowed := min(len(letters), len(other)) / 5
+				if owners[name] != i && names[name] != key && count >= max(len(letters), len(other))-1-2*allowed && namesClose(key, names[name]) {
+					add(owners[name], i, false)
+				}
+			}
+			for bigram, count := range bigrams {
+				byBigram[bigram] = append(byBigram[bigram], posting{name: len(names), count: count})
+			}
+			owners = append(owners, i)
+			names = append(names, key)
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a].i != pairs[b].i {
+			return pairs[a].i < pairs[b].i
+		}
+		return pairs[a].j < pairs[b].j
+	})
+	return
+}
+
+// clusterDuplicates groups candidates whose names normalise the same or are close,
+// so long as compatible says every pair in a cluster could be the same thing.
+// Returns the clusters of more than one candidate, as indexes into candidates, along with
+// whether each was matched exactly.
+func clusterDuplicates(candidates []duplicateCandidate, compatible func(a, b int) bool) (clusters [][]int, exact []bool) {
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	members := make([][]int, len(candidates))
+	for i := range members {
+		members[i] = []int{i}
+	}
+	fuzzy := map[int]bool{}
+	for _, pair := range duplicatePairs(candidates) {
+		root, other := find(pair.j), find(pair.i)
+		if root == other || !compatibleClusters(members[root], members[other], compatible) {
+			continue
+		}
+		parent[other] = root
+		members[root] = append(members[root], members[other]...)
+		fuzzy[root] = fuzzy[root] || fuzzy[other] || !pair.match
+	}
+	byRoot := map[int][]int{}
+	roots := []int{}
+	for i := range candidates {
+		root := find(i)
+		if _, ok := byRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], i)
+	}
+	for _, root := range roots {
+		if len(byRoot[root]) > 1 {
+			clusters = append(clusters, byRoot[root])
+			exact = append(exact, !fuzzy[root])
+		}
+	}
+	return
+}
+
+// compatibleClusters reports whether every candidate in one cluster is compatible with every candidate in another.
+func compatibleClusters(a, b []int, compatible func(a, b int) bool) bool {
+	for _, i := range a {
+		for _, j := range b {
+			if !compatible(i, j) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// findDuplicates clusters candidates, tagged on tracks with the given predicate, and
+// gathers the evidence for each cluster from the tracks tagged with its members.
+func (store Datastore) findDuplicates(predicate string, candidates []duplicateCandidate, compatible func(a, b int) bool) (duplicates DuplicatesV3, err error) {
+	duplicates.Clusters = []DuplicateClusterV3{}
+	clusters, exact := clusterDuplicates(candidates, compatible)
+	if len(clusters) == 0 {
+		return
+	}
+	uris := []string{}
+	for _, cluster := range clusters {
+		for _, i := range cluster {
+			uris = append(uris, candidates[i].member.URI)
+		}
+	}
+	query, args, err := sqlx.In(`SELECT tag.uri, tag.trackid, IFNULL(title.value, '') AS title
+		FROM tag LEFT JOIN tag AS title ON title.trackid = tag.trackid AND title.predicateid = 'title'
+		WHERE tag.predicateid = ? AND tag.uri IN (?)`, predicate, uris)
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		URI     string `db:"uri"`
+		TrackID int    `db:"trackid"`
+		Title   string `db:"title"`
+	}
+	err = store.DB.Select(&rows, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	tracks := map[string]map[int]bool{}
+	titles := map[string]map[string]string{}
+	for _, row := range rows {
+		if tracks[row.URI] == nil {
+			tracks[row.URI] = map[int]bool{}
+			titles[row.URI] = map[string]string{}
+		}
+		tracks[row.URI][row.TrackID] = true
+		if key := normaliseName(row.Title); key != "" {
+			titles[row.URI][key] = row.Title
+		}
+	}
+
+	for c, cluster := range clusters {
+		result := DuplicateClusterV3{Match: "fuzzy", SharedTitles: []string{}}
+		if exact[c] {
+			result.Match = "exact"
+		}
+		seen := map[string]int{}
+		examples := map[string]string{}
+		for _, i := range cluster {
+			member := candidates[i].member
+			member.TrackCount = len(tracks[member.URI])
+			result.Members = append(result.Members, member)
+			for key, title := range titles[member.URI] {
+				seen[key]++
+				if _, ok := examples[key]; !ok {
+					examples[key] = title
+				}
+			}
+		}
+		for key, count := range seen {
+			if count > 1 {
+				result.SharedTitles = append(result.SharedTitles, examples[key])
+			}
+		}
+		sort.Strings(result.SharedTitles)
+		sort.SliceStable(result.Members, func(i, j int) bool {
+			return result.Members[i].TrackCount > result.Members[j].TrackCount
+		})
+		result.Merge.TargetID = result.Members[0].ID
+		result.Merge.SourceIDs = []int{}
+		for _, member := range result.Members[1:] {
+			result.Merge.SourceIDs = append(result.Merge.SourceIDs, member.ID)
+		}
+		duplicates.Clusters = append(duplicates.Clusters, result)
+	}
+	sort.SliceStable(duplicates.Clusters, func(i, j int) bool {
+		a, b := duplicates.Clusters[i], duplicates.Clusters[j]
+		if len(a.SharedTitles) != len(b.SharedTitles) {
+			return len(a.SharedTitles) > len(b.SharedTitles)
+		}
+		return a.Match == "exact" && b.Match != "exact"
+	})
+	return
+}
+
+// getAlbumDuplicates finds albums which are likely to be the same.
+// Albums with different MusicBrainz releases or years, or with no credited artist
+// in common, are told apart, so aren't taken to be duplicates however alike their names.
+func (store Datastore) getAlbumDuplicates() (duplicates DuplicatesV3, err error) {
+	var rows []albumRow
+	err = store.DB.Select(&rows, "SELECT "+albumColumns+" FROM album ORDER BY id")
+	if err != nil {
+		return
+	}
+	albums, err := store.albumsFromRows(rows)
+	if err != nil {
+		return
+	}
+	candidates := make([]duplicateCandidate, len(albums))
+	for i, album := range albums {
+		candidates[i] = duplicateCandidate{
+			member: DuplicateMemberV3{ID: album.ID, Name: album.Name, URI: album.URI},
+			keys:   []string{normaliseName(album.Name)},
+		}
+	}
+	compatible := func(i, j int) bool {
+		a, b := albums[i], albums[j]
+		if a.MBIDRelease != "" && b.MBIDRelease != "" && a.MBIDRelease != b.MBIDRelease {
+			return false
+		}
+		if a.Year != nil && b.Year != nil && *a.Year != *b.Year {
+			return false
+		}
+		if len(a.Artists) == 0 || len(b.Artists) == 0 {
+			return true
+		}
+		for _, artistA := range a.Artists {
+			for _, artistB := range b.Artists {
+				if artistA.URI == artistB.URI {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return store.findDuplicates("album", candidates, compatible)
+}
+
+// getArtistDuplicates finds artists which are likely to be the same, matching on their aliases
+// as well as their names.  Artists with different MusicBrainz ids are told apart.
+func (store Datastore) getArtistDuplicates() (duplicates DuplicatesV3, err error) {
+	var rows []artistRow
+	err = store.DB.Select(&rows, "SELECT "+artistColumns+" FROM artist ORDER BY id")
+	if err != nil {
+		return
+	}
+	artists, err := store.artistsFromRows(rows)
+	if err != nil {
+		return
+	}
+	candidates := make([]duplicateCandidate, len(artists))
+	for i, artist := range artists {
+		candidates[i] = duplicateCandidate{
+			member: DuplicateMemberV3{ID: artist.ID, Name: artist.Name, URI: artist.URI},
+			keys:   []string{normaliseName(artist.Name)},
+		}
+		for _, alias := range artist.Aliases {
+			candidates[i].keys = append(candidates[i].keys, normaliseName(alias))
+		}
+	}
+	compatible := func(i, j int) bool {
+		a, b := artists[i], artists[j]
+		return a.MBIDArtist == "" || b.MBIDArtist == "" || a.MBIDArtist == b.MBIDArtist
+	}
+	return store.findDuplicates("artist", candidates, compatible)
+}
+
+// duplicatesHandler handles requests to /v3/albums/duplicates and /v3/artists/duplicates.
+func duplicatesHandler(w http.ResponseWriter, r *http.Request, find func() (DuplicatesV3, error)) {
+	if r.Method != "GET" {
+		MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	duplicates, err := find()
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	writeJSONResponse(w, duplicates, nil)
+}
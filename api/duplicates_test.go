@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// getDuplicates fetches the clusters of likely duplicates from a duplicates endpoint.
+func getDuplicates(test *testing.T, path string) (duplicates DuplicatesV3) {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	assertEqual(test, "Duplicates status", 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&duplicates)
+	return
+}
+
+// TestNormaliseName checks trivially different spellings of a name normalise the same.
+func TestNormaliseName(test *testing.T) {
+	for input, expected := range map[string]string{
+		"The Beatles":                   "beatles",
+		"Beatles, The":                  "beatles",
+		"the beatles":                   "beatles",
+		"Björk":                         "bjork",
+		"Sigur Rós":                     "sigur ros",
+		"Simon & Garfunkel":             "simon and garfunkel",
+		"Guns N' Roses":                 "guns n roses",
+		"R.E.M.":                        "rem",
+		"Santana feat. Rob Thomas":      "santana",
+		"Smooth (ft. Rob Thomas)":       "smooth",
+		"Soft Cell":                     "soft cell",
+		"The The":                       "the",
+		"A Tribe Called Quest":          "tribe called quest",
+		"  Sinéad   O’Connor ":          "sinead oconnor",
+		"Mötley Crüe featuring Someone": "motley crue",
+	} {
+		assertEqual(test, "Normalised "+input, expected, normaliseName(input))
+	}
+}
+
+// TestEditDistance checks the Levenshtein distance between names, and which names count as close.
+func TestEditDistance(test *testing.T) {
+	assertEqual(test, "Identical", 0, editDistance("abba", "abba"))
+	assertEqual(test, "Substitution", 1, editDistance("beatles", "beetles"))
+	assertEqual(test, "Substitutions and insertion", 3, editDistance("kitten", "sitting"))
+	assertEqual(test, "Empty", 3, editDistance("", "abc"))
+	assertEqual(test, "Counts runes", 1, editDistance("ä", "a"))
+	assertEqual(test, "Long names close", true, namesClose("rolling stones", "rolling stone"))
+	assertEqual(test, "Short names not close", false, namesClose("abba", "abbe"))
+	assertEqual(test, "Different names not close", false, namesClose("beatles", "byrds"))
+}
+
+// TestDuplicatePairsFindsEveryClosePair checks only comparing names which share enough bigrams
+// finds the same pairs as comparing every pair of names would.
+func TestDuplicatePairsFindsEveryClosePair(test *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	bases := []string{"rolling stones", "beatles", "abba", "fleetwood mac", "sigur ros", "the who", "björk", "massive attack"}
+	letters := []rune("abcdefghijklmnopqrstuvwxyz ö")
+	candidates := []duplicateCandidate{}
+	for i := 0; i < 300; i++ {
+		name := []rune(bases[random.Intn(len(bases))])
+		for edits := random.Intn(4); edits > 0; edits-- {
+			position := random.Intn(len(name))
+			switch random.Intn(3) {
+			case 0:
+				name[position] = letters[random.Intn(len(letters))]
+			case 1:
+				name = append(name[:position], name[position+1:]...)
+			default:
+				name = append(name[:position], append([]rune{letters[random.Intn(len(letters))]}, name[position:]...)...)
+			}
+		}
+		keys := []string{string(name)}
+		if random.Intn(5) == 0 {
+			keys = append(keys, bases[random.Intn(len(bases))])
+		}
+		candidates = append(candidates, duplicateCandidate{keys: keys})
+	}
+
+	expected := []duplicatePair{}
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			match, close := false, false
+			for _, a := range candidates[i].keys {
+				for _, b := range candidates[j].keys {
+					if a == b {
+						match = true
+					} else if namesClose(a, b) {
+						close = true
+					}
+				}
+			}
+			if match || close {
+				expected = append(expected, duplicatePair{i: i, j: j, match: match})
+			}
+		}
+	}
+	pairs := duplicatePairs(candidates)
+	if !reflect.DeepEqual(pairs, expected) {
+		test.Errorf("Expected %d pairs, found %d which differ", len(expected), len(pairs))
+	}
+}
+
+// TestArtistDuplicates checks artists are clustered by normalised name, alias and edit distance,
+// with their shared tracks as evidence, and that the suggested merge can be posted as is.
+func TestArtistDuplicates(test *testing.T) {
+	clearData()
+	for i, artist := range []string{"The Beatles", "Beatles", "the beatles", "Rolling Stones", "The Rolling Stone", "Abba", "Abbe", "Prince"} {
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", i+1), fmt.Sprintf(`{"fingerprint":"dup%d","url":"http://example.org/dup/%d","duration":100,"tags":{"title":[{"name":"Help!"}],"artist":[{"name":"%s"}]}}`, i+1, i+1, artist), 200)
+	}
+	setupRequest(test, "PUT", "/v3/tracks/9", `{"fingerprint":"dup9","url":"http://example.org/dup/9","duration":100,"tags":{"title":[{"name":"Yesterday"}],"artist":[{"name":"Beatles"}]}}`, 200)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Artist Formerly Known As Prince","aliases":["The Prince"]}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Artist","mbidArtist":"11111111-1111-1111-1111-111111111111"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Artist","mbidArtist":"22222222-2222-2222-2222-222222222222"}`, 201)
+
+	duplicates := getDuplicates(test, "/v3/artists/duplicates")
+	clusters, _ := json.Marshal(duplicates.Clusters)
+	assertEqual(test, "Clusters", `[`+
+		`{"match":"exact","members":[{"id":2,"name":"Beatles","uri":"/artists/2","trackCount":2},{"id":1,"name":"The Beatles","uri":"/artists/1","trackCount":1},{"id":3,"name":"the beatles","uri":"/artists/3","trackCount":1}],"sharedTitles":["Help!"],"merge":{"targetId":2,"sourceIds":[1,3]}},`+
+		`{"match":"fuzzy","members":[{"id":4,"name":"Rolling Stones","uri":"/artists/4","trackCount":1},{"id":5,"name":"The Rolling Stone","uri":"/artists/5","trackCount":1}],"sharedTitles":["Help!"],"merge":{"targetId":4,"sourceIds":[5]}},`+
+		`{"match":"exact","members":[{"id":8,"name":"Prince","uri":"/artists/8","trackCount":1},{"id":9,"name":"The Artist Formerly Known As Prince","uri":"/artists/9","trackCount":0}],"sharedTitles":[],"merge":{"targetId":8,"sourceIds":[9]}}]`, string(clusters))
+
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":2,"sourceIds":[1,3]}`, 200)
+	duplicates = getDuplicates(test, "/v3/artists/duplicates")
+	assertEqual(test, "Clusters after merge", 2, len(duplicates.Clusters))
+	makeRequestWithUnallowedMethod(test, "/v3/artists/duplicates", "POST", []string{"GET"})
+}
+
+// TestAlbumDuplicates checks albums are clustered by normalised name, except where their
+// artist, year or MusicBrainz release tells them apart.
+func TestAlbumDuplicates(test *testing.T) {
+	clearData()
+	makeRequest(test, "GET", "/v3/albums/duplicates", "", 200, `{"clusters":[]}`, true)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road","artists":[{"name":"The Beatles"}],"year":1969}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road.","artists":[{"name":"The Beatles"}]}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"abbey road","year":1969}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"Queen"}]}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Greatest Hits","artists":[{"name":"ABBA"}]}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road","artists":[{"name":"The Beatles"}],"year":2019}`, 201)
+	setupRequest(test, "PUT", "/v3/tracks/1", `{"fingerprint":"dup1","url":"http://example.org/dup/1","duration":100,"tags":{"title":[{"name":"Something"}],"album":[{"uri":"/albums/2"}]}}`, 200)
+
+	duplicates := getDuplicates(test, "/v3/albums/duplicates")
+	clusters, _ := json.Marshal(duplicates.Clusters)
+	assertEqual(test, "Clusters", `[{"match":"exact","members":[{"id":2,"name":"Abbey Road.","uri":"/albums/2","trackCount":1},{"id":1,"name":"Abbey Road","uri":"/albums/1","trackCount":0},{"id":3,"name":"abbey road","uri":"/albums/3","trackCount":0}],"sharedTitles":[],"merge":{"targetId":2,"sourceIds":[1,3]}}]`, string(clusters))
+	makeRequestWithUnallowedMethod(test, "/v3/albums/duplicates", "DELETE", []string{"GET"})
+}
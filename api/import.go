@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+	"github.com/jmoiron/sqlx"
+
+	"lucos_media_metadata_api/predicateconfig"
+	"lucos_media_metadata_api/rdfgen"
+)
+
+// ImportReportV3 is the result of importing an RDF export: how many of each kind of
+// entity it held, and the triples about them which couldn't be imported.
+type ImportReportV3 struct {
+	Tracks      int                     `json:"tracks"`
+	Albums      int                     `json:"albums"`
+	Artists     int                     `json:"artists"`
+	Collections int                     `json:"collections"`
+	Unmapped    []rdfgen.UnmappedTriple `json:"unmapped"`
+}
+
+// ImportV3Controller upserts the library described by an RDF export, as published at
+// /v2/export, so a database can be seeded or restored from one.
+//
+//	POST /v3/import — the export as the body, in Turtle or N-Triples
+//
+// URIs in the export are taken to have been minted with this environment's origins,
+// unless the mediaManagerOrigin and appOrigin parameters give the ones it was exported
+// from.  Triples which can't be mapped back to the library are listed in the response,
+// rather than failing the import.
+func (store Datastore) ImportV3Controller(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/turtle" && mediaType != "application/n-triples" {
+		writeV3ErrorResponse(w, http.StatusUnsupportedMediaType, "Imports must be posted as text/turtle or application/n-triples", "unsupported_media_type")
+		return
+	}
+	source := rdfgen.ImportOrigins{
+		MediaMetadataManager: r.URL.Query().Get("mediaManagerOrigin"),
+		App:                  r.URL.Query().Get("appOrigin"),
+	}
+	if source.MediaMetadataManager == "" {
+		source.MediaMetadataManager = os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	}
+	if source.App == "" {
+		source.App = os.Getenv("APP_ORIGIN")
+	}
+
+	// N-Triples is a subset of Turtle, so both are parsed as Turtle
+	graph := rdf2go.NewGraph("")
+	if err := graph.Parse(r.Body, "text/turtle"); err != nil {
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Failed to parse RDF: "+err.Error(), "bad_request")
+		return
+	}
+	library, unmapped := rdfgen.ImportRdf(graph, source)
+	report, err := store.importLibrary(library)
+	if err != nil {
+		if strings.Contains(err.Error(), "constraint failed") {
+			writeV3ErrorResponse(w, http.StatusConflict, "Import conflicts with existing data: "+err.Error(), "import_conflict")
+			return
+		}
+		writeV3Error(w, err)
+		return
+	}
+	report.Unmapped = append(unmapped, report.Unmapped...)
+	if report.Unmapped == nil {
+		report.Unmapped = []rdfgen.UnmappedTriple{}
+	}
+	slog.Info("Imported library", "tracks", report.Tracks, "albums", report.Albums, "artists", report.Artists, "collections", report.Collections, "unmapped", len(report.Unmapped))
+	store.Loganne.post("libraryImported", fmt.Sprintf("%d tracks, %d albums, %d artists and %d collections imported", report.Tracks, report.Albums, report.Artists, report.Collections), Track{}, Track{}, "routine")
+	writeJSONResponse(w, report, nil)
+}
+
+// importLibrary upserts a library read from an RDF export in a single transaction,
+// keeping the ids (and so the URIs) it was exported with.
+//
+// Each track's values are replaced for the predicates it has in the import; its other
+// tags, which may not be exported at all, are left alone.  Tracks which don't exist yet
+// are only created if the import has their url and duration.  Tag values which fail the
+// checks the write path makes are skipped and listed in the report.  Album credits,
+// group members and collection tracks which were already listed keep their place, and
+// any details the export doesn't include, such as a member's role.
+//
+// Only static collections have their tracks set, as the export doesn't say which
+// collections are smart or composed, or how.
+func (store Datastore) importLibrary(library rdfgen.Library) (report ImportReportV3, err error) {
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, artist := range library.Artists {
+		var personURI *string
+		if artist.PersonURI != nil {
+			personURI = nullIfEmpty(*artist.PersonURI)
+		}
+		// The export has no classes for orchestras or choirs, so exports them as groups
+		_, err = tx.Exec(`INSERT INTO artist(id, name, person_uri, sort_name, mbid_artist, type) VALUES($1, $2, $3, $4, $5, $6)
+			ON CONFLICT(id) DO UPDATE SET name = excluded.name, person_uri = excluded.person_uri, sort_name = excluded.sort_name, mbid_artist = excluded.mbid_artist,
+			type = CASE WHEN excluded.type = 'group' AND artist.type IN ('orchestra', 'choir') THEN artist.type ELSE excluded.type END`,
+			artist.ID, artist.Name, personURI, nullIfEmpty(artist.SortName), nullIfEmpty(artist.MBIDArtist), nullIfEmpty(artist.Type))
+		if err != nil {
+			return
+		}
+		if _, err = tx.Exec("DELETE FROM artist_alias WHERE artistid = $1", artist.ID); err != nil {
+			return
+		}
+		for _, alias := range artist.Aliases {
+			if _, err = tx.Exec("INSERT INTO artist_alias(artistid, name) VALUES($1, $2)", artist.ID, alias); err != nil {
+				return
+			}
+		}
+	}
+	// Members are set once every artist exists, as they can be in either order
+	for _, artist := range library.Artists {
+		members := make([]string, len(artist.Members))
+		for i, member := range artist.Members {
+			members[i] = member.PersonURI
+			if member.ArtistID != 0 {
+				members[i] = strconv.Itoa(member.ArtistID)
+			}
+		}
+		err = syncPositioned(tx, "artist_member", "groupid", artist.ID, "IFNULL(CAST(memberid AS TEXT), person_uri)", members, func(member string, position int) error {
+			memberID, err := strconv.Atoi(member)
+			if err != nil {
+				_, err = tx.Exec("INSERT INTO artist_member(groupid, position, person_uri) VALUES($1, $2, $3)", artist.ID, position, member)
+			} else {
+				_, err = tx.Exec("INSERT INTO artist_member(groupid, position, memberid) VALUES($1, $2, $3)", artist.ID, position, memberID)
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+	report.Artists = len(library.Artists)
+
+	for _, album := range library.Albums {
+		_, err = tx.Exec(`INSERT INTO album(id, name, year, mbid_release, track_count, disc_count, artwork) VALUES($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT(id) DO UPDATE SET name = excluded.name, year = excluded.year, mbid_release = excluded.mbid_release,
+			track_count = excluded.track_count, disc_count = excluded.disc_count, artwork = excluded.artwork`,
+			album.ID, album.Name, album.Year, nullIfEmpty(album.MBIDRelease), album.TrackCount, album.DiscCount, nullIfEmpty(album.Artwork))
+		if err != nil {
+			err = albumWriteError(err)
+			return
+		}
+		artists := make([]string, len(album.ArtistIDs))
+		for i, artistID := range album.ArtistIDs {
+			artists[i] = strconv.Itoa(artistID)
+		}
+		err = syncPositioned(tx, "album_artist", "albumid", album.ID, "CAST(artistid AS TEXT)", artists, func(artist string, position int) error {
+			_, err := tx.Exec("INSERT INTO album_artist(albumid, position, artistid) VALUES($1, $2, $3)", album.ID, position, artist)
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+	report.Albums = len(library.Albums)
+
+	skipped := map[int]bool{}
+	for _, track := range library.Tracks {
+		subject := store.ManagerOrigin + "/tracks/" + strconv.Itoa(track.ID)
+		var exists bool
+		if err = tx.Get(&exists, "SELECT COUNT(*) > 0 FROM track WHERE id = $1", track.ID); err != nil {
+			return
+		}
+		if !exists && (track.URL == "" || track.Duration == nil) {
+			report.Unmapped = append(report.Unmapped, rdfgen.UnmappedTriple{
+				Subject: subject,
+				Reason:  "new track without both a dc:identifier and an mo:duration",
+			})
+			skipped[track.ID] = true
+			continue
+		}
+		// The export has no fingerprints, so new tracks get a placeholder until the
+		// media importer next updates them by url
+		_, err = tx.Exec(`INSERT INTO track(id, url, duration, fingerprint) VALUES($1, $2, $3, $4)
+			ON CONFLICT(id) DO UPDATE SET url = IFNULL(excluded.url, url), duration = IFNULL(excluded.duration, duration)`,
+			track.ID, nullIfEmpty(track.URL), track.Duration, "import:"+strconv.Itoa(track.ID))
+		if err != nil {
+			return
+		}
+		report.Tracks++
+		tags := map[string][]rdfgen.TagData{}
+		for _, tag := range track.Tags {
+			config := predicateconfig.GetConfig(tag.PredicateID)
+			reason := ""
+			if config.ValidateValue != nil {
+				reason = config.ValidateValue(tag.Value)
+			}
+			if reason == "" && config.RequiresURI() {
+				reason = config.ValidateURIOrigin(tag.URI)
+			}
+			if reason != "" {
+				predicateURI := config.PredicateURI
+				if strings.HasPrefix(predicateURI, "/") {
+					predicateURI = os.Getenv("APP_ORIGIN") + predicateURI
+				}
+				object := strconv.Quote(tag.Value)
+				if tag.URI != "" {
+					object = "<" + tag.URI + ">"
+				}
+				report.Unmapped = append(report.Unmapped, rdfgen.UnmappedTriple{
+					Subject:   subject,
+					Predicate: predicateURI,
+					Object:    object,
+					Reason:    reason,
+				})
+				continue
+			}
+			tags[tag.PredicateID] = append(tags[tag.PredicateID], tag)
+		}
+		for predicate, values := range tags {
+			if _, err = tx.Exec("INSERT OR IGNORE INTO predicate(id) VALUES($1)", predicate); err != nil {
+				return
+			}
+			if _, err = tx.Exec("DELETE FROM tag WHERE trackid = $1 AND predicateid = $2", track.ID, predicate); err != nil {
+				return
+			}
+			for _, tag := range values {
+				if _, err = tx.Exec("INSERT INTO tag(trackid, predicateid, value, uri) VALUES($1, $2, $3, $4)", track.ID, predicate, tag.Value, tag.URI); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	for _, collection := range library.Collections {
+		// The export doesn't hold the definitions of smart and composed collections, so
+		// they can't be created, only have their names and icons updated
+		if collection.MembershipType != "" && collection.MembershipType != "static" {
+			var exists bool
+			if err = tx.Get(&exists, "SELECT COUNT(*) > 0 FROM collection WHERE slug = $1", collection.Slug); err != nil {
+				return
+			}
+			if !exists {
+				report.Unmapped = append(report.Unmapped, rdfgen.UnmappedTriple{
+					Subject: store.ManagerOrigin + "/collections/" + url.PathEscape(collection.Slug),
+					Reason:  "new " + collection.MembershipType + " collection, whose definition isn't in the export",
+				})
+				continue
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO collection(slug, name, icon) VALUES($1, $2, $3)
+			ON CONFLICT(slug) DO UPDATE SET name = excluded.name, icon = excluded.icon`,
+			collection.Slug, collection.Name, collection.Icon)
+		if err != nil {
+			return
+		}
+		report.Collections++
+		var static bool
+		if err = tx.Get(&static, "SELECT query IS NULL AND operation IS NULL FROM collection WHERE slug = $1", collection.Slug); err != nil {
+			return
+		}
+		if !static {
+			continue
+		}
+		tracks := []string{}
+		for _, trackID := range collection.TrackIDs {
+			if !skipped[trackID] {
+				tracks = append(tracks, strconv.Itoa(trackID))
+			}
+		}
+		err = syncPositioned(tx, "collection_track", "collectionslug", collection.Slug, "CAST(trackid AS TEXT)", tracks, func(track string, position int) error {
+			_, err := tx.Exec("INSERT INTO collection_track(collectionslug, trackid, position) VALUES($1, $2, $3)", collection.Slug, track, position)
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// syncPositioned makes the rows of a numbered list (album credits, group members or a
+// collection's tracks) in table for owner match members, which are identified by
+// keyExpression.  Rows already listed keep their order, and any columns the caller
+// doesn't know about; new members are added after them, in order, by insert.
+// Positions are renumbered from 1 without gaps.
+func syncPositioned(tx *sqlx.Tx, table string, ownerColumn string, owner interface{}, keyExpression string, members []string, insert func(member string, position int) error) (err error) {
+	var current []struct {
+		RowID    int64  `db:"rowid"`
+		Key      string `db:"member"`
+		Position int    `db:"position"`
+	}
+	err = tx.Select(&current, "SELECT rowid, "+keyExpression+" AS member, IFNULL(position, 0) AS position FROM "+table+" WHERE "+ownerColumn+" = $1 ORDER BY position, rowid", owner)
+	if err != nil {
+		return
+	}
+	wanted := make(map[string]bool, len(members))
+	for _, member := range members {
+		wanted[member] = true
+	}
+	listed := make(map[string]bool, len(current))
+	position := 0
+	for _, row := range current {
+		if !wanted[row.Key] || listed[row.Key] {
+			if _, err = tx.Exec("DELETE FROM "+table+" WHERE rowid = $1", row.RowID); err != nil {
+				return
+			}
+			continue
+		}
+		listed[row.Key] = true
+		position++
+		if row.Position != position {
+			if _, err = tx.Exec("UPDATE "+table+" SET position = $1 WHERE rowid = $2", position, row.RowID); err != nil {
+				return
+			}
+		}
+	}
+	for _, member := range members {
+		if listed[member] {
+			continue
+		}
+		listed[member] = true
+		position++
+		if err = insert(member, position); err != nil {
+			return
+		}
+	}
+	return
+}
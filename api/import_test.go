@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"lucos_media_metadata_api/rdfgen"
+)
+
+// exportLibrary serialises the test database as Turtle, the way the RDF export would
+// for an environment with the given origins.
+func exportLibrary(test *testing.T, managerOrigin string, appOrigin string) string {
+	test.Helper()
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", managerOrigin)
+	os.Setenv("APP_ORIGIN", appOrigin)
+	defer os.Unsetenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	defer os.Unsetenv("APP_ORIGIN")
+	db, err := sql.Open("sqlite3", "testrouting.sqlite")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+	var serialised bytes.Buffer
+	writer, _ := rdfgen.NewTripleWriter(&serialised, "text/turtle")
+	if err := rdfgen.WriteGraph(db, writer.AddTriple); err != nil {
+		test.Fatalf("Failed to export library: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		test.Fatal(err)
+	}
+	return serialised.String()
+}
+
+// getBody fetches a path from the test server and returns its body.
+func getBody(test *testing.T, path string) string {
+	response, _ := doRawRequest(test, basicRequest(test, "GET", path, ""))
+	body, _ := ioutil.ReadAll(response.Body)
+	return string(body)
+}
+
+// TestImportRoundTripsExport checks a library exported from another environment can be
+// imported into an empty database, and comes back as it was.
+func TestImportRoundTripsExport(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Beatles","type":"group","sortName":"Beatles, The","aliases":["Fab Four"]}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"John Lennon","type":"person"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"uri":"/artists/2"}}]}`, 200)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Revolver","artists":[{"uri":"/artists/1"}],"year":1966}`, 201)
+	setupRequest(test, "PUT", "/v3/tracks/1", `{"fingerprint":"import1","url":"http://example.org/import/1","duration":150,"tags":{
+		"title":[{"name":"Taxman"}],
+		"artist":[{"name":"The Beatles","uri":"/artists/1"}],
+		"album":[{"name":"Revolver","uri":"/albums/1"}],
+		"track_number":[{"name":"1"}],
+		"comment":[{"name":"A \"protest\" song"}]
+	}}`, 200)
+	setupRequest(test, "PUT", "/v3/tracks/2", `{"fingerprint":"import2","url":"http://example.org/import/2","duration":180,"tags":{"title":[{"name":"Eleanor Rigby"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/sixties", `{"name":"Sixties","icon":"🕺"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/sixties/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/sixties/2", "", 200)
+
+	paths := []string{"/v3/tracks/1", "/v3/tracks/2", "/v3/albums/1", "/v3/artists/1", "/v3/artists/2", "/v3/artists/1/members", "/v3/collections/sixties"}
+	expected := map[string]string{}
+	for _, path := range paths {
+		// The export has no fingerprints, so imported tracks are given placeholders
+		expected[path] = strings.ReplaceAll(getBody(test, path), `"fingerprint":"import`, `"fingerprint":"import:`)
+	}
+	// Tags in the test database have relative URIs, as MEDIA_METADATA_MANAGER_ORIGIN is unset
+	turtle := exportLibrary(test, "", "https://api.example")
+
+	clearData()
+	request := basicRequest(test, "POST", "/v3/import?appOrigin="+url.QueryEscape("https://api.example"), turtle)
+	request.Header.Set("Content-Type", "text/turtle; charset=utf-8")
+	makeRawRequest(test, request, 200, `{"tracks":2,"albums":1,"artists":2,"collections":1,"unmapped":[]}`, true)
+	assertEqual(test, "Loganne event type", "libraryImported", lastLoganneType)
+	assertEqual(test, "Loganne message", "2 tracks, 1 albums, 2 artists and 1 collections imported", lastLoganneMessage)
+	for _, path := range paths {
+		isEqual, err := AreEqualJSON(getBody(test, path), expected[path])
+		if err != nil || !isEqual {
+			test.Errorf("Unexpected %s after import: %s, expected: %s", path, getBody(test, path), expected[path])
+		}
+	}
+
+	// Importing again changes nothing, including the order of tracks in a collection,
+	// which isn't exported
+	setupRequest(test, "DELETE", "/v3/collections/sixties/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/sixties/1", "", 200)
+	expected["/v3/collections/sixties"] = getBody(test, "/v3/collections/sixties")
+	request = basicRequest(test, "POST", "/v3/import?appOrigin="+url.QueryEscape("https://api.example"), turtle)
+	request.Header.Set("Content-Type", "text/turtle")
+	makeRawRequest(test, request, 200, `{"tracks":2,"albums":1,"artists":2,"collections":1,"unmapped":[]}`, true)
+	for _, path := range paths {
+		isEqual, err := AreEqualJSON(getBody(test, path), expected[path])
+		if err != nil || !isEqual {
+			test.Errorf("Unexpected %s after second import: %s, expected: %s", path, getBody(test, path), expected[path])
+		}
+	}
+}
+
+// TestImportSmartAndComposedCollections checks smart and composed collections, whose
+// definitions aren't exported, keep them when imported, and aren't created as empty
+// static collections where they don't exist.
+func TestImportSmartAndComposedCollections(test *testing.T) {
+	clearData()
+	setupSmartCollectionTracks(test)
+	setupRequest(test, "PUT", "/v3/collections/favourites", `{"name":"Favourites","tracks":[{"trackid":3}]}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Welsh","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/everything", `{"name":"Everything","compose":{"operation":"union","collections":["favourites","welsh"]}}`, 200)
+	turtle := exportLibrary(test, "", "https://api.example")
+	importTurtle := func(expectedResponse string) {
+		request := basicRequest(test, "POST", "/v3/import?appOrigin="+url.QueryEscape("https://api.example"), turtle)
+		request.Header.Set("Content-Type", "text/turtle")
+		makeRawRequest(test, request, 200, expectedResponse, true)
+	}
+
+	setupRequest(test, "PUT", "/v3/collections/welsh", `{"name":"Cymraeg","query":"p.language.uri=https://eolas.l42.eu/metadata/language/cy/"}`, 200)
+	importTurtle(`{"tracks":3,"albums":0,"artists":0,"collections":3,"unmapped":[]}`)
+	assertEqual(test, "Smart collection tracks after import", "[1 2]", getCollectionTrackIDs(test, "/v3/collections/welsh"))
+	assertEqual(test, "Composed collection tracks after import", "[1 2 3]", getCollectionTrackIDs(test, "/v3/collections/everything"))
+	if body := getBody(test, "/v3/collections/welsh"); !strings.Contains(body, `"name":"Welsh"`) || !strings.Contains(body, `"query":"p.language.uri=`) {
+		test.Errorf("Expected smart collection to be renamed, keeping its query, got: %s", body)
+	}
+
+	clearData()
+	importTurtle(`{"tracks":3,"albums":0,"artists":0,"collections":1,"unmapped":[{
+		"subject":"/collections/everything",
+		"predicate":"",
+		"object":"",
+		"reason":"new composed collection, whose definition isn't in the export"
+	},{
+		"subject":"/collections/welsh",
+		"predicate":"",
+		"object":"",
+		"reason":"new smart collection, whose definition isn't in the export"
+	}]}`)
+	makeRequest(test, "GET", "/v3/collections/welsh", "", 404, `{"error":"Collection Not Found","code":"not_found"}`, true)
+	assertEqual(test, "Static collection tracks after import", "[3]", getCollectionTrackIDs(test, "/v3/collections/favourites"))
+}
+
+// TestImportReportsInvalidTags checks tag values the write path would reject are left
+// out of an import and reported, without stopping the rest of the track being imported.
+func TestImportReportsInvalidTags(test *testing.T) {
+	clearData()
+	request := basicRequest(test, "POST", "/v3/import", `
+		<https://manager.example/tracks/3> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://purl.org/ontology/mo/Track> .
+		<https://manager.example/tracks/3> <http://purl.org/dc/terms/identifier> "http://example.org/import/3" .
+		<https://manager.example/tracks/3> <http://www.w3.org/2004/02/skos/core#prefLabel> "Tomorrow Never Knows" .
+		<https://manager.example/tracks/3> <http://purl.org/ontology/mo/duration> "PT120S"^^<http://www.w3.org/2001/XMLSchema#duration> .
+		<https://manager.example/tracks/3> <http://purl.org/ontology/mo/track_number> "fourteen" .
+		<https://manager.example/tracks/4> <http://www.w3.org/2004/02/skos/core#prefLabel> "She Said She Said" .
+	`)
+	request.URL.RawQuery = "mediaManagerOrigin=" + url.QueryEscape("https://manager.example")
+	request.Header.Set("Content-Type", "application/n-triples")
+	makeRawRequest(test, request, 200, `{"tracks":1,"albums":0,"artists":0,"collections":0,"unmapped":[{
+		"subject":"/tracks/3",
+		"predicate":"http://purl.org/ontology/mo/track_number",
+		"object":"\"fourteen\"",
+		"reason":"value \"fourteen\" is not a positive integer"
+	},{
+		"subject":"/tracks/4",
+		"predicate":"",
+		"object":"",
+		"reason":"new track without both a dc:identifier and an mo:duration"
+	}]}`, true)
+	makeRequest(test, "GET", "/v3/tracks/3", "", 200, `{"fingerprint":"import:3","duration":120,"url":"http://example.org/import/3","id":3,"tags":{"title":[{"name":"Tomorrow Never Knows"}]},"weighting":0,"collections":[]}`, true)
+}
+
+// TestImportErrors checks imports which aren't RDF are rejected.
+func TestImportErrors(test *testing.T) {
+	clearData()
+	request := basicRequest(test, "POST", "/v3/import", `{"tracks":[]}`)
+	request.Header.Set("Content-Type", "application/json")
+	makeRawRequest(test, request, 415, `{"error":"Imports must be posted as text/turtle or application/n-triples","code":"unsupported_media_type"}`, true)
+
+	request = basicRequest(test, "POST", "/v3/import", `<https://manager.example/tracks/1> "not a predicate" .`)
+	request.Header.Set("Content-Type", "text/turtle")
+	response, _ := doRawRequest(test, request)
+	assertEqual(test, "Unparseable import status", 400, response.StatusCode)
+
+	makeRequestWithUnallowedMethod(test, "/v3/import", "GET", []string{"POST"})
+	makeRequestWithUnallowedMethod(test, "/v3/import", "PUT", []string{"POST"})
+}
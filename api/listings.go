@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+)
+
+// listOptions are the query parameters accepted by the album and artist listings.
+// Sort is "name" (the default), "count" for the most used first, or "created" for the
+// most recently created first.  Orphans limits the listing to those nothing refers to.
+type listOptions struct {
+	Page    string
+	Query   string
+	Sort    string
+	Orphans bool
+}
+
+// listOptionsFromQuery reads the listing options from a request's query parameters.
+func listOptionsFromQuery(query url.Values) (options listOptions, err error) {
+	options = listOptions{
+		Page:  query.Get("page"),
+		Query: query.Get("q"),
+		Sort:  query.Get("sort"),
+	}
+	switch options.Sort {
+	case "":
+		options.Sort = "name"
+	case "name", "count", "created":
+	default:
+		err = errors.New("Sort \"" + options.Sort + "\" not allowed")
+		return
+	}
+	if rawOrphans := query.Get("orphans"); rawOrphans != "" {
+		options.Orphans, err = strconv.ParseBool(rawOrphans)
+		if err != nil {
+			err = errors.New("Orphans value \"" + rawOrphans + "\" not allowed")
+		}
+	}
+	return
+}
+
+// orderBy returns the ORDER BY clause for a listing, given the order to list by name.
+// The usage count must be selected as usage_count.
+func (options listOptions) orderBy(byName string) string {
+	switch options.Sort {
+	case "count":
+		return "usage_count DESC, " + byName
+	case "created":
+		return "id DESC"
+	}
+	return byName
+}
+
+// tagUsageJoin joins a count of the tracks tagged with each entity of a kind, matching tag
+// URIs to the entity's URI (the given origin, followed by the path and the entity's id).
+func tagUsageJoin(predicate string, table string) string {
+	return "LEFT JOIN (SELECT uri, COUNT(DISTINCT trackid) AS count FROM tag WHERE predicateid = '" + predicate + "' GROUP BY uri) AS usage" +
+		" ON usage.uri = ? || '/" + table + "s/' || " + table + ".id"
+}
+
+// orphanedAlbum is the condition for an album being orphaned, given the tagUsageJoin for albums.
+const orphanedAlbum = "usage.count IS NULL"
+
+// orphanedArtist is the condition for an artist being orphaned, given the tagUsageJoin for artists.
+// Artists credited on albums, or with or in groups, aren't orphaned even if no tracks are tagged with them.
+const orphanedArtist = "usage.count IS NULL AND id NOT IN (SELECT artistid FROM album_artist)" +
+	" AND id NOT IN (SELECT memberid FROM artist_member WHERE memberid IS NOT NULL) AND id NOT IN (SELECT groupid FROM artist_member)"
+
+// DeletedAlbumsV3 lists the albums removed by a cleanup.
+type DeletedAlbumsV3 struct {
+	Deleted []AlbumV3 `json:"deleted"`
+}
+
+// DeletedArtistsV3 lists the artists removed by a cleanup.
+type DeletedArtistsV3 struct {
+	Deleted []ArtistV3 `json:"deleted"`
+}
+
+// deleteOrphanedAlbums removes every orphaned album, emitting an albumDeleted event for each.
+func (store Datastore) deleteOrphanedAlbums() (deleted DeletedAlbumsV3, err error) {
+	slog.Info("Delete Orphaned Albums")
+	from := "FROM album " + tagUsageJoin("album", "album") + " WHERE " + orphanedAlbum
+	var rows []albumRow
+	err = store.DB.Select(&rows, "SELECT "+albumColumns+" "+from+" ORDER BY name, id", store.ManagerOrigin)
+	if err != nil {
+		return
+	}
+	albums, err := store.albumsFromRows(rows)
+	if err != nil {
+		return
+	}
+	deleted.Deleted = []AlbumV3{}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	// Check each album is still orphaned, in case it's been tagged since it was listed.
+	for _, album := range albums {
+		var result sql.Result
+		result, err = tx.Exec("DELETE FROM album WHERE id IN (SELECT id "+from+" AND id = ?)", store.ManagerOrigin, album.ID)
+		if err != nil {
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			deleted.Deleted = append(deleted.Deleted, album)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	for _, album := range deleted.Deleted {
+		store.Loganne.albumPost("albumDeleted", "Album \""+album.Name+"\" deleted", album, false)
+	}
+	return
+}
+
+// deleteOrphanedArtists removes every orphaned artist, emitting an artistDeleted event for each.
+func (store Datastore) deleteOrphanedArtists() (deleted DeletedArtistsV3, err error) {
+	slog.Info("Delete Orphaned Artists")
+	from := "FROM artist " + tagUsageJoin("artist", "artist") + " WHERE " + orphanedArtist
+	var rows []artistRow
+	err = store.DB.Select(&rows, "SELECT "+artistColumns+" "+from+" ORDER BY IFNULL(sort_name, name), name", store.ManagerOrigin)
+	if err != nil {
+		return
+	}
+	artists, err := store.artistsFromRows(rows)
+	if err != nil {
+		return
+	}
+	deleted.Deleted = []ArtistV3{}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	// Check each artist is still orphaned, in case it's been used since it was listed.
+	for _, artist := range artists {
+		var result sql.Result
+		result, err = tx.Exec("DELETE FROM artist WHERE id IN (SELECT id "+from+" AND id = ?)", store.ManagerOrigin, artist.ID)
+		if err != nil {
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			deleted.Deleted = append(deleted.Deleted, artist)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	for _, artist := range deleted.Deleted {
+		store.Loganne.artistPost("artistDeleted", "Artist \""+artist.Name+"\" deleted", artist, false)
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// listingSummary fetches an album or artist listing and summarises it as "name:usageCount" pairs.
+func listingSummary(test *testing.T, path string) string {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	assertEqual(test, "Listing status for "+path, 200, resp.StatusCode)
+	var list struct {
+		Albums  []AlbumV3  `json:"albums"`
+		Artists []ArtistV3 `json:"artists"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	summary := []string{}
+	for _, album := range list.Albums {
+		summary = append(summary, fmt.Sprintf("%s:%d", album.Name, *album.UsageCount))
+	}
+	for _, artist := range list.Artists {
+		summary = append(summary, fmt.Sprintf("%s:%d", artist.Name, *artist.UsageCount))
+	}
+	return strings.Join(summary, ",")
+}
+
+// TestAlbumListingUsage checks album listings include how many tracks use each album,
+// and can be sorted by that or by creation, or limited to orphaned albums.
+func TestAlbumListingUsage(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Revolver"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Help!"}`, 201)
+	setupMergeTrack(test, 1, `"album":[{"uri":"/albums/2"}]`)
+	setupMergeTrack(test, 2, `"album":[{"uri":"/albums/2"}]`)
+	setupMergeTrack(test, 3, `"album":[{"uri":"/albums/3"}]`)
+
+	assertEqual(test, "By name", "Abbey Road:0,Help!:1,Revolver:2", listingSummary(test, "/v3/albums"))
+	assertEqual(test, "By count", "Revolver:2,Help!:1,Abbey Road:0", listingSummary(test, "/v3/albums?sort=count"))
+	assertEqual(test, "By creation", "Help!:1,Revolver:2,Abbey Road:0", listingSummary(test, "/v3/albums?sort=created"))
+	assertEqual(test, "Orphans", "Abbey Road:0", listingSummary(test, "/v3/albums?orphans=true"))
+	assertEqual(test, "Search with count sort", "Revolver:2", listingSummary(test, "/v3/albums?q=volv&sort=count"))
+	makeRequest(test, "GET", "/v3/albums?orphans=true", "", 200, `{"albums":[{"id":1,"name":"Abbey Road","uri":"/albums/1","usageCount":0}],"totalPages":1,"page":1,"totalItems":1}`, true)
+	makeRequest(test, "GET", "/v3/albums?sort=popularity", "", 400, `{"error":"Sort \"popularity\" not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "GET", "/v3/albums?orphans=maybe", "", 400, `{"error":"Orphans value \"maybe\" not allowed","code":"bad_request"}`, true)
+
+	// Usage counts are only given in listings
+	makeRequest(test, "GET", "/v3/albums/2", "", 200, `{"id":2,"name":"Revolver","uri":"/albums/2"}`, true)
+}
+
+// TestArtistListingUsage checks artists credited on albums or in groups aren't listed as orphans.
+func TestArtistListingUsage(test *testing.T) {
+	clearData()
+	setupMergeTrack(test, 1, `"artist":[{"name":"Blur"},{"name":"Gorillaz"}]`)
+	setupMergeTrack(test, 2, `"artist":[{"name":"Blur"}]`)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Damon Albarn"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Graham Coxon"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Fat Les"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Good, the Bad & the Queen"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"uri":"/artists/3"}}]}`, 200)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"The Sky Is Too High","artists":[{"uri":"/artists/4"}]}`, 201)
+
+	assertEqual(test, "By count", "Blur:2,Gorillaz:1,Damon Albarn:0,Fat Les:0,Graham Coxon:0,The Good, the Bad & the Queen:0", listingSummary(test, "/v3/artists?sort=count"))
+	assertEqual(test, "Orphans", "Fat Les:0,The Good, the Bad & the Queen:0", listingSummary(test, "/v3/artists?orphans=1"))
+	assertEqual(test, "Not orphans", "Blur:2,Damon Albarn:0,Fat Les:0,Gorillaz:1,Graham Coxon:0,The Good, the Bad & the Queen:0", listingSummary(test, "/v3/artists?orphans=false"))
+}
+
+// TestDeleteOrphans checks orphaned albums and artists can be deleted in bulk, leaving those still in use.
+func TestDeleteOrphans(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road","artists":[{"name":"The Beatles"}]}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Revolver"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Wings"}`, 201)
+	setupMergeTrack(test, 1, `"album":[{"uri":"/albums/2"}]`)
+
+	makeRequest(test, "DELETE", "/v3/albums/orphans", "", 200, `{"deleted":[{"id":1,"name":"Abbey Road","uri":"/albums/1","artists":[{"name":"The Beatles","uri":"/artists/1"}]}]}`, true)
+	assertEqual(test, "loganne event type", "albumDeleted", lastLoganneType)
+	assertEqual(test, "Albums left", "Revolver:1", listingSummary(test, "/v3/albums"))
+
+	// The Beatles is no longer credited on an album, so is now an orphan too
+	makeRequest(test, "DELETE", "/v3/artists/orphans", "", 200, `{"deleted":[{"id":1,"name":"The Beatles","uri":"/artists/1"},{"id":2,"name":"Wings","uri":"/artists/2"}]}`, true)
+	assertEqual(test, "loganne event type", "artistDeleted", lastLoganneType)
+	makeRequest(test, "DELETE", "/v3/artists/orphans", "", 200, `{"deleted":[]}`, true)
+	makeRequestWithUnallowedMethod(test, "/v3/albums/orphans", "GET", []string{"DELETE"})
+	makeRequestWithUnallowedMethod(test, "/v3/artists/orphans", "POST", []string{"DELETE"})
+}
@@ -76,6 +76,18 @@ func main() {
 		}
 	}()
 
+	// Compute /v3/stats in the background and refresh every 10 minutes.
+	// The aggregates scan the whole tag table, so are refreshed less often than /_info;
+	// until the first run completes, requests compute them on demand.
+	go func() {
+		store.refreshStats()
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			store.refreshStats()
+		}
+	}()
+
 	// Reconcile denormalised tag names daily. Catches any drift the webhooks missed
 	// (transient failures, lost deliveries, ordering issues).
 	go func() {
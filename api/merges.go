@@ -0,0 +1,464 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MergeV3 is the record of an album or artist merged away into another.
+// Source is the album or artist as it was before the merge; TrackIDs lists the tracks
+// whose tags were repointed from it to the target.
+type MergeV3 struct {
+	ID       int         `json:"id"`
+	Source   interface{} `json:"source"`
+	TargetID int         `json:"targetId"`
+	TrackIDs []int       `json:"trackIds"`
+	MergedAt string      `json:"mergedAt"`
+	UndoneAt string      `json:"undoneAt,omitempty"`
+}
+
+// MergeListV3 wraps a paginated list of merges, most recent first.
+type MergeListV3 struct {
+	Merges     []MergeV3 `json:"merges"`
+	TotalPages int       `json:"totalPages"`
+	Page       int       `json:"page"`
+	TotalItems int       `json:"totalItems"`
+}
+
+// mergeSnapshot is what's recorded of a merge's source, to recreate it should the merge be undone.
+type mergeSnapshot struct {
+	Album       *AlbumV3           `json:"album,omitempty"`
+	Artist      *ArtistV3          `json:"artist,omitempty"`
+	Credits     []mergedCredit     `json:"credits,omitempty"`
+	Memberships []mergedMembership `json:"memberships,omitempty"`
+	// MemberOffset is how far the source's members were moved down the target's member list.
+	MemberOffset int `json:"memberOffset,omitempty"`
+}
+
+// mergedCredit is a credit of a merged artist on an album.  Moved is set where the
+// credit was handed to the target, rather than dropped because the target was already credited.
+type mergedCredit struct {
+	AlbumID  int  `json:"albumId" db:"albumid"`
+	Position int  `json:"position" db:"position"`
+	Moved    bool `json:"moved" db:"moved"`
+}
+
+// mergedMembership is an artist_member row involving a merged artist, as it was before the merge.
+type mergedMembership struct {
+	GroupID   int     `json:"groupId" db:"groupid"`
+	Position  int     `json:"position" db:"position"`
+	MemberID  *int    `json:"memberId,omitempty" db:"memberid"`
+	PersonURI *string `json:"personUri,omitempty" db:"person_uri"`
+	Role      *string `json:"role,omitempty" db:"role"`
+	StartDate *string `json:"startDate,omitempty" db:"start_date"`
+	EndDate   *string `json:"endDate,omitempty" db:"end_date"`
+}
+
+// mergeRow is a row of the entity_merge table.
+type mergeRow struct {
+	ID       int            `db:"id"`
+	Kind     string         `db:"kind"`
+	SourceID int            `db:"sourceid"`
+	TargetID int            `db:"targetid"`
+	Snapshot string         `db:"snapshot"`
+	MergedAt string         `db:"merged_at"`
+	UndoneAt sql.NullString `db:"undone_at"`
+}
+
+// recordMerge records, within a merge's transaction, that the source of the given kind is
+// being merged into the target, along with the tags about to be repointed from sourceURI.
+// It must be called before the tags are repointed.
+func recordMerge(tx *sqlx.Tx, kind string, sourceID int, targetID int, sourceURI string, snapshot mergeSnapshot) (err error) {
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	result, err := tx.Exec("INSERT INTO entity_merge(kind, sourceid, targetid, snapshot, merged_at) VALUES($1, $2, $3, $4, $5)",
+		kind, sourceID, targetID, string(encoded), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return
+	}
+	mergeID, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("INSERT INTO entity_merge_tag(mergeid, trackid, value) SELECT $1, trackid, value FROM tag WHERE predicateid = $2 AND uri = $3",
+		mergeID, kind, sourceURI)
+	return
+}
+
+// artistMergeSnapshot captures, within a merge's transaction, the album credits and group
+// memberships of an artist about to be merged into the target.
+func artistMergeSnapshot(tx *sqlx.Tx, source ArtistV3, targetID int) (snapshot mergeSnapshot, err error) {
+	snapshot.Artist = &source
+	err = tx.Select(&snapshot.Credits, `SELECT albumid, position,
+		NOT EXISTS (SELECT 1 FROM album_artist AS target WHERE target.albumid = album_artist.albumid AND target.artistid = $1) AS moved
+		FROM album_artist WHERE artistid = $2`, targetID, source.ID)
+	if err != nil {
+		return
+	}
+	err = tx.Select(&snapshot.Memberships, "SELECT groupid, position, memberid, person_uri, role, start_date, end_date FROM artist_member WHERE groupid = $1 OR memberid = $1", source.ID)
+	if err != nil {
+		return
+	}
+	err = tx.Get(&snapshot.MemberOffset, "SELECT IFNULL(MAX(position), 0) FROM artist_member WHERE groupid = $1", targetID)
+	return
+}
+
+// mergeToV3 converts an entity_merge row to a MergeV3, given the tracks it repointed.
+func mergeToV3(row mergeRow, trackIDs []int) (merge MergeV3, err error) {
+	var snapshot mergeSnapshot
+	err = json.Unmarshal([]byte(row.Snapshot), &snapshot)
+	if err != nil {
+		return
+	}
+	merge = MergeV3{
+		ID:       row.ID,
+		TargetID: row.TargetID,
+		TrackIDs: trackIDs,
+		MergedAt: row.MergedAt,
+		UndoneAt: row.UndoneAt.String,
+	}
+	if snapshot.Album != nil {
+		merge.Source = snapshot.Album
+	} else {
+		merge.Source = snapshot.Artist
+	}
+	if merge.TrackIDs == nil {
+		merge.TrackIDs = []int{}
+	}
+	return
+}
+
+// getMergeTrackIDs returns the tracks repointed by each of the given merges, keyed by merge id.
+func (store Datastore) getMergeTrackIDs(mergeIDs []int) (trackIDs map[int][]int, err error) {
+	trackIDs = make(map[int][]int, len(mergeIDs))
+	if len(mergeIDs) == 0 {
+		return
+	}
+	query, args, err := sqlx.In("SELECT DISTINCT mergeid, trackid FROM entity_merge_tag WHERE mergeid IN (?) ORDER BY mergeid, trackid", mergeIDs)
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		MergeID int `db:"mergeid"`
+		TrackID int `db:"trackid"`
+	}
+	err = store.DB.Select(&rows, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		trackIDs[row.MergeID] = append(trackIDs[row.MergeID], row.TrackID)
+	}
+	return
+}
+
+// getMerges returns a paginated list of the merges of the given kind, most recent first.
+func (store Datastore) getMerges(kind string, rawpage string) (list MergeListV3, err error) {
+	const standardLimit = 20
+
+	offset, limit := parsePageParam(rawpage, standardLimit)
+
+	page, parseErr := strconv.Atoi(rawpage)
+	if parseErr != nil || page < 1 {
+		page = 1
+	}
+
+	var total int
+	err = store.DB.Get(&total, "SELECT COUNT(*) FROM entity_merge WHERE kind = $1", kind)
+	if err != nil {
+		return
+	}
+	var rows []mergeRow
+	err = store.DB.Select(&rows, "SELECT * FROM entity_merge WHERE kind = $1 ORDER BY id DESC LIMIT $2 OFFSET $3", kind, limit, offset)
+	if err != nil {
+		return
+	}
+	ids := make([]int, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	trackIDs, err := store.getMergeTrackIDs(ids)
+	if err != nil {
+		return
+	}
+	list = MergeListV3{
+		Merges:     make([]MergeV3, len(rows)),
+		TotalPages: int(math.Ceil(float64(total) / float64(standardLimit))),
+		Page:       page,
+		TotalItems: total,
+	}
+	for i, row := range rows {
+		list.Merges[i], err = mergeToV3(row, trackIDs[row.ID])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getMergeRow returns the entity_merge row of the given kind with the given id.
+func (store Datastore) getMergeRow(kind string, id int) (row mergeRow, err error) {
+	err = store.DB.Get(&row, "SELECT * FROM entity_merge WHERE kind = $1 AND id = $2", kind, id)
+	if err != nil && err.Error() == "sql: no rows in result set" {
+		err = errors.New("Merge Not Found")
+	}
+	return
+}
+
+// getMerge returns a single merge of the given kind.
+func (store Datastore) getMerge(kind string, id int) (merge MergeV3, err error) {
+	row, err := store.getMergeRow(kind, id)
+	if err != nil {
+		return
+	}
+	trackIDs, err := store.getMergeTrackIDs([]int{id})
+	if err != nil {
+		return
+	}
+	return mergeToV3(row, trackIDs[id])
+}
+
+// undoMerge recreates the source of a merge with its original id, and points the tags
+// the merge repointed back at it.  Tags which have since been changed to no longer point
+// at the target are left alone, as are tracks which have been deleted.
+// For artists, the album credits and group memberships the merge moved are moved back.
+// Returns "merge_undone" if the merge has already been undone, a mergeTargetMergedError if
+// the target has since been merged into another itself (so its tags and credits are now
+// the other's, and that merge needs undoing first), or the same errors as creating the
+// album or artist would if it now clashes with another.
+func (store Datastore) undoMerge(kind string, id int) (merge MergeV3, err error) {
+	slog.Info("Undo Merge", "kind", kind, "id", id)
+	row, err := store.getMergeRow(kind, id)
+	if err != nil {
+		return
+	}
+	if row.UndoneAt.Valid {
+		err = errors.New("merge_undone")
+		return
+	}
+	var laterMergeIDs []int
+	err = store.DB.Select(&laterMergeIDs, "SELECT id FROM entity_merge WHERE kind = $1 AND sourceid = $2 AND id > $3 AND undone_at IS NULL ORDER BY id DESC LIMIT 1", kind, row.TargetID, id)
+	if err != nil {
+		return
+	}
+	if len(laterMergeIDs) > 0 {
+		err = mergeTargetMergedError{MergeID: laterMergeIDs[0]}
+		return
+	}
+	var snapshot mergeSnapshot
+	err = json.Unmarshal([]byte(row.Snapshot), &snapshot)
+	if err != nil {
+		return
+	}
+	var sourceURI, targetURI string
+	if kind == "album" {
+		sourceURI, targetURI = store.albumURI(row.SourceID), store.albumURI(row.TargetID)
+		err = store.checkAlbumDistinct(*snapshot.Album)
+	} else {
+		sourceURI, targetURI = store.artistURI(row.SourceID), store.artistURI(row.TargetID)
+		err = store.checkArtistNamesFree(*snapshot.Artist)
+	}
+	if err != nil {
+		return
+	}
+
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if kind == "album" {
+		err = restoreMergedAlbum(tx, *snapshot.Album)
+	} else {
+		err = restoreMergedArtist(tx, snapshot, row.TargetID)
+	}
+	if err != nil {
+		return
+	}
+
+	// Point each repointed tag back at the source, with the value it had.  Where a track
+	// had more than one tag for the target, which one is restored doesn't matter, as they're alike.
+	var tags []struct {
+		TrackID int            `db:"trackid"`
+		Value   sql.NullString `db:"value"`
+	}
+	err = tx.Select(&tags, "SELECT trackid, value FROM entity_merge_tag WHERE mergeid = $1", id)
+	if err != nil {
+		return
+	}
+	for _, tag := range tags {
+		_, err = tx.Exec(`UPDATE tag SET uri = $1, value = $2 WHERE rowid IN
+			(SELECT rowid FROM tag WHERE trackid = $3 AND predicateid = $4 AND uri = $5 LIMIT 1)`,
+			sourceURI, tag.Value, tag.TrackID, kind, targetURI)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec("UPDATE entity_merge SET undone_at = $1 WHERE id = $2", time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	merge, err = store.getMerge(kind, id)
+	if err != nil {
+		return
+	}
+	if kind == "album" {
+		album, _ := store.getAlbumByID(row.SourceID)
+		store.Loganne.albumPost("albumMergeUndone", "Merge of album \""+album.Name+"\" undone", album, true)
+	} else {
+		artist, _ := store.getArtistByID(row.SourceID)
+		store.Loganne.artistPost("artistMergeUndone", "Merge of artist \""+artist.Name+"\" undone", artist, true)
+	}
+	return
+}
+
+// mergeTargetMergedError is returned by undoMerge when the merge's target has since been
+// merged into another album or artist by the merge with id MergeID.
+type mergeTargetMergedError struct {
+	MergeID int
+}
+
+func (err mergeTargetMergedError) Error() string {
+	return "merge_target_merged"
+}
+
+// restoreMergedAlbum recreates a merged album with its original id, credited to whichever
+// of its artists still exist.
+func restoreMergedAlbum(tx *sqlx.Tx, album AlbumV3) (err error) {
+	_, err = tx.Exec("INSERT INTO album(id, name, year, mbid_release, track_count, disc_count, artwork) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		album.ID, album.Name, album.Year, nullIfEmpty(album.MBIDRelease), album.TrackCount, album.DiscCount, nullIfEmpty(album.Artwork))
+	if err != nil {
+		return albumWriteError(err)
+	}
+	for i, artist := range album.Artists {
+		var artistID int
+		artistID, err = ParseArtistIDFromURI(artist.URI)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec("INSERT INTO album_artist(albumid, position, artistid) SELECT $1, $2, id FROM artist WHERE id = $3", album.ID, i+1, artistID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// restoreMergedArtist recreates a merged artist with its original id, and moves the album
+// credits and group memberships the merge gave the target back to it.
+func restoreMergedArtist(tx *sqlx.Tx, snapshot mergeSnapshot, targetID int) (err error) {
+	artist := *snapshot.Artist
+	_, err = tx.Exec("INSERT INTO artist(id, name, person_uri, sort_name, mbid_artist, type) VALUES($1, $2, $3, $4, $5, $6)",
+		artist.ID, artist.Name, artist.PersonURI, nullIfEmpty(artist.SortName), nullIfEmpty(artist.MBIDArtist), nullIfEmpty(artist.Type))
+	if err != nil {
+		return artistWriteError(err)
+	}
+	err = setArtistAliases(tx, artist.ID, artist.Aliases)
+	if err != nil {
+		return artistWriteError(err)
+	}
+	for _, credit := range snapshot.Credits {
+		if credit.Moved {
+			_, err = tx.Exec("DELETE FROM album_artist WHERE albumid = $1 AND artistid = $2 AND position = $3", credit.AlbumID, targetID, credit.Position)
+			if err != nil {
+				return
+			}
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO album_artist(albumid, position, artistid) SELECT id, $1, $2 FROM album WHERE id = $3", credit.Position, artist.ID, credit.AlbumID)
+		if err != nil {
+			return
+		}
+	}
+	for _, membership := range snapshot.Memberships {
+		// Remove the row the merge moved to the target, if it's still there, then put back the original.
+		if membership.GroupID == artist.ID {
+			_, err = tx.Exec("DELETE FROM artist_member WHERE groupid = $1 AND position = $2 AND memberid IS $3 AND person_uri IS $4",
+				targetID, membership.Position+snapshot.MemberOffset, membership.MemberID, membership.PersonURI)
+		} else {
+			_, err = tx.Exec("DELETE FROM artist_member WHERE groupid = $1 AND position = $2 AND memberid = $3",
+				membership.GroupID, membership.Position, targetID)
+		}
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(`INSERT INTO artist_member(groupid, position, memberid, person_uri, role, start_date, end_date)
+			SELECT $1, $2, $3, $4, $5, $6, $7 WHERE EXISTS (SELECT 1 FROM artist WHERE id = $1)
+			AND ($3 IS NULL OR EXISTS (SELECT 1 FROM artist WHERE id = $3))`,
+			membership.GroupID, membership.Position, membership.MemberID, membership.PersonURI, membership.Role, membership.StartDate, membership.EndDate)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// mergesHandler handles requests to /v3/albums/merges and /v3/artists/merges, given the
+// path parts after "merges".
+func (store Datastore) mergesHandler(w http.ResponseWriter, r *http.Request, kind string, pathparts []string) {
+	if len(pathparts) == 0 {
+		if r.Method != "GET" {
+			MethodNotAllowed(w, []string{"GET"})
+			return
+		}
+		list, err := store.getMerges(kind, r.URL.Query().Get("page"))
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, list, nil)
+		return
+	}
+	id, err := strconv.Atoi(pathparts[0])
+	if err != nil || len(pathparts) > 2 || (len(pathparts) == 2 && pathparts[1] != "undo") {
+		writeV3ErrorResponse(w, http.StatusNotFound, "Merge Not Found", "not_found")
+		return
+	}
+	if len(pathparts) == 1 {
+		if r.Method != "GET" {
+			MethodNotAllowed(w, []string{"GET"})
+			return
+		}
+		merge, err := store.getMerge(kind, id)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, merge, nil)
+		return
+	}
+	if r.Method != "POST" {
+		MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+	merge, err := store.undoMerge(kind, id)
+	if err != nil {
+		var targetMerged mergeTargetMergedError
+		if err.Error() == "merge_undone" {
+			writeV3ErrorResponse(w, http.StatusConflict, "Merge has already been undone", "already_undone")
+		} else if errors.As(err, &targetMerged) {
+			writeV3ErrorResponse(w, http.StatusConflict, "The "+kind+" merged into has since been merged into another, so merge "+strconv.Itoa(targetMerged.MergeID)+" must be undone first", "target_merged")
+		} else if kind == "album" {
+			writeAlbumWriteError(w, err)
+		} else {
+			writeArtistWriteError(w, err)
+		}
+		return
+	}
+	writeJSONResponse(w, merge, nil)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// setupMergeTrack creates a track tagged with the given tags, returning its URL.
+func setupMergeTrack(test *testing.T, id int, tags string) string {
+	trackURL := fmt.Sprintf("http://example.org/merge/%d", id)
+	setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", id), fmt.Sprintf(`{"fingerprint":"merge%d","url":"%s","duration":100,"tags":{%s}}`, id, trackURL, tags), 200)
+	return trackURL
+}
+
+// getMergeList fetches a list of merges.
+func getMergeList(test *testing.T, path string) (list MergeListV3) {
+	request := basicRequest(test, "GET", path, "")
+	resp, _ := doRawRequest(test, request)
+	assertEqual(test, "Merges status", 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&list)
+	return
+}
+
+// TestAlbumMergeUndo checks a merged album is recorded, and undoing the merge recreates it
+// with its original id and points its tracks back at it.
+func TestAlbumMergeUndo(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road","year":1969}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Abbey Road.","artists":[{"name":"The Beatles"}],"mbidRelease":"11111111-1111-1111-1111-111111111111"}`, 201)
+	first := setupMergeTrack(test, 1, `"album":[{"uri":"/albums/1"}]`)
+	second := setupMergeTrack(test, 2, `"album":[{"uri":"/albums/2"}]`)
+	makeRequest(test, "GET", "/v3/albums/merges", "", 200, `{"merges":[],"totalPages":0,"page":1,"totalItems":0}`, true)
+
+	setupRequest(test, "POST", "/v3/albums/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	list := getMergeList(test, "/v3/albums/merges")
+	assertEqual(test, "Merge count", 1, list.TotalItems)
+	merge := list.Merges[0]
+	source, _ := json.Marshal(merge.Source)
+	sameSource, _ := AreEqualJSON(`{"id":2,"name":"Abbey Road.","uri":"/albums/2","artists":[{"name":"The Beatles","uri":"/artists/1"}],"mbidRelease":"11111111-1111-1111-1111-111111111111"}`, string(source))
+	assertEqual(test, "Merged source "+string(source), true, sameSource)
+	assertEqual(test, "Merge target", 1, merge.TargetID)
+	assertEqual(test, "Merged tracks", "[2]", fmt.Sprint(merge.TrackIDs))
+	assertEqual(test, "Not undone", "", merge.UndoneAt)
+	assertEqual(test, "Tag merged", "/albums/1", getTagsForTrack(test, second)["album"][0].URI)
+
+	request := basicRequest(test, "POST", fmt.Sprintf("/v3/albums/merges/%d/undo", merge.ID), "")
+	resp, _ := doRawRequest(test, request)
+	assertEqual(test, "Undo status", 200, resp.StatusCode)
+	var undone MergeV3
+	json.NewDecoder(resp.Body).Decode(&undone)
+	if undone.UndoneAt == "" {
+		test.Errorf("Expected undoneAt to be set once the merge is undone")
+	}
+	assertEqual(test, "loganne event type", "albumMergeUndone", lastLoganneType)
+	assertEqual(test, "loganne album uri", "/albums/2", lastLoganneAlbum.URI)
+
+	makeRequest(test, "GET", "/v3/albums/2", "", 200, `{"id":2,"name":"Abbey Road.","uri":"/albums/2","artists":[{"name":"The Beatles","uri":"/artists/1"}],"mbidRelease":"11111111-1111-1111-1111-111111111111"}`, true)
+	assertEqual(test, "Tag restored", TagValueV3{Name: "Abbey Road.", URI: "/albums/2"}, getTagsForTrack(test, second)["album"][0])
+	assertEqual(test, "Target's own tag untouched", "/albums/1", getTagsForTrack(test, first)["album"][0].URI)
+	makeRequest(test, "POST", fmt.Sprintf("/v3/albums/merges/%d/undo", merge.ID), "", 409, `{"error":"Merge has already been undone","code":"already_undone"}`, true)
+}
+
+// TestArtistMergeUndo checks undoing an artist merge restores the artist's aliases, the names
+// its tracks credited it by, its album credits and its group memberships.
+func TestArtistMergeUndo(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Prince","type":"person"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Artist Formerly Known As Prince","aliases":["TAFKAP"],"type":"person"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"The Revolution","type":"group"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Sheila E."}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/3/members", `{"members":[{"artist":{"uri":"/artists/4"}},{"artist":{"uri":"/artists/2"},"role":"vocals"}]}`, 200)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Emancipation","artists":[{"uri":"/artists/2"}]}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Purple Rain","artists":[{"uri":"/artists/1"},{"uri":"/artists/3"},{"uri":"/artists/2"}]}`, 201)
+	trackURL := setupMergeTrack(test, 1, `"artist":[{"name":"TAFKAP"}]`)
+
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	makeRequest(test, "GET", "/v3/artists/3/members", "", 200, `{"artist":{"id":3,"name":"The Revolution","uri":"/artists/3","type":"group"},"members":[{"artist":{"name":"Sheila E.","uri":"/artists/4"}},{"artist":{"name":"Prince","uri":"/artists/1"},"role":"vocals"}]}`, true)
+	list := getMergeList(test, "/v3/artists/merges")
+	setupRequest(test, "POST", fmt.Sprintf("/v3/artists/merges/%d/undo", list.Merges[0].ID), "", 200)
+	assertEqual(test, "loganne event type", "artistMergeUndone", lastLoganneType)
+
+	makeRequest(test, "GET", "/v3/artists/2", "", 200, `{"id":2,"name":"The Artist Formerly Known As Prince","uri":"/artists/2","aliases":["TAFKAP"],"type":"person"}`, true)
+	assertEqual(test, "Tag restored", TagValueV3{Name: "TAFKAP", URI: "/artists/2"}, getTagsForTrack(test, trackURL)["artist"][0])
+	makeRequest(test, "GET", "/v3/artists/3/members", "", 200, `{"artist":{"id":3,"name":"The Revolution","uri":"/artists/3","type":"group"},"members":[{"artist":{"name":"Sheila E.","uri":"/artists/4"}},{"artist":{"name":"The Artist Formerly Known As Prince","uri":"/artists/2"},"role":"vocals"}]}`, true)
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Emancipation","uri":"/albums/1","artists":[{"name":"The Artist Formerly Known As Prince","uri":"/artists/2"}]}`, true)
+	makeRequest(test, "GET", "/v3/albums/2", "", 200, `{"id":2,"name":"Purple Rain","uri":"/albums/2","artists":[{"name":"Prince","uri":"/artists/1"},{"name":"The Revolution","uri":"/artists/3"},{"name":"The Artist Formerly Known As Prince","uri":"/artists/2"}]}`, true)
+}
+
+// TestArtistMergeUndoGroup checks undoing the merge of a group gives it back its members.
+func TestArtistMergeUndoGroup(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Wings"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Paul McCartney & Wings"}`, 201)
+	setupRequest(test, "PUT", "/v3/artists/1/members", `{"members":[{"artist":{"name":"Paul McCartney"}}]}`, 200)
+	setupRequest(test, "PUT", "/v3/artists/2/members", `{"members":[{"artist":{"name":"Denny Laine"}},{"artist":{"uri":"/artists/1"}}]}`, 200)
+
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	setupRequest(test, "POST", "/v3/artists/merges/1/undo", "", 200)
+	makeRequest(test, "GET", "/v3/artists/1/members", "", 200, `{"artist":{"id":1,"name":"Wings","uri":"/artists/1"},"members":[{"artist":{"name":"Paul McCartney","uri":"/artists/3"}}]}`, true)
+	makeRequest(test, "GET", "/v3/artists/2/members", "", 200, `{"artist":{"id":2,"name":"Paul McCartney & Wings","uri":"/artists/2"},"members":[{"artist":{"name":"Denny Laine","uri":"/artists/4"}},{"artist":{"name":"Wings","uri":"/artists/1"}}]}`, true)
+}
+
+// TestMergeUndoAfterChainedMerge checks a merge can't be undone while its target has itself
+// been merged into another, and can be once that later merge is undone.
+func TestMergeUndoAfterChainedMerge(test *testing.T) {
+	clearData()
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Prince"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"TAFKAP"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Prince Rogers Nelson"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Emancipation","artists":[{"uri":"/artists/1"}]}`, 201)
+	trackURL := setupMergeTrack(test, 1, `"artist":[{"uri":"/artists/1"}]`)
+
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":2,"sourceIds":[1]}`, 200)
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":3,"sourceIds":[2]}`, 200)
+	makeRequest(test, "POST", "/v3/artists/merges/1/undo", "", 409, `{"error":"The artist merged into has since been merged into another, so merge 2 must be undone first","code":"target_merged"}`, true)
+	makeRequest(test, "GET", "/v3/artists/1", "", 404, `{"error":"Artist Not Found","code":"not_found"}`, true)
+
+	setupRequest(test, "POST", "/v3/artists/merges/2/undo", "", 200)
+	setupRequest(test, "POST", "/v3/artists/merges/1/undo", "", 200)
+	assertEqual(test, "Track credited to the first artist again", "/artists/1", getTagsForTrack(test, trackURL)["artist"][0].URI)
+	makeRequest(test, "GET", "/v3/albums/1", "", 200, `{"id":1,"name":"Emancipation","uri":"/albums/1","artists":[{"name":"Prince","uri":"/artists/1"}]}`, true)
+}
+
+// TestMergeUndoErrors checks merges which can't be found or undone.
+func TestMergeUndoErrors(test *testing.T) {
+	clearData()
+	makeRequest(test, "GET", "/v3/albums/merges/1", "", 404, `{"error":"Merge Not Found","code":"not_found"}`, true)
+	makeRequest(test, "POST", "/v3/albums/merges/1/undo", "", 404, `{"error":"Merge Not Found","code":"not_found"}`, true)
+	makeRequest(test, "POST", "/v3/albums/merges/one/undo", "", 404, `{"error":"Merge Not Found","code":"not_found"}`, true)
+	makeRequest(test, "POST", "/v3/albums/merges/1/redo", "", 404, `{"error":"Merge Not Found","code":"not_found"}`, true)
+	makeRequestWithUnallowedMethod(test, "/v3/albums/merges", "POST", []string{"GET"})
+	makeRequestWithUnallowedMethod(test, "/v3/albums/merges/1", "DELETE", []string{"GET"})
+	makeRequestWithUnallowedMethod(test, "/v3/artists/merges/1/undo", "GET", []string{"POST"})
+
+	// An artist merge isn't an album merge
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Enya"}`, 201)
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Eithne Ní Bhraonáin"}`, 201)
+	setupRequest(test, "POST", "/v3/artists/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	makeRequest(test, "GET", "/v3/albums/merges/1", "", 404, `{"error":"Merge Not Found","code":"not_found"}`, true)
+
+	// Undoing fails if another artist has since taken the merged artist's name
+	setupRequest(test, "POST", "/v3/artists", `{"name":"Eithne Ní Bhraonáin"}`, 201)
+	makeRequest(test, "POST", "/v3/artists/merges/1/undo", "", 409, `{"error":"An artist with that name already exists","code":"duplicate_name"}`, true)
+
+	// Or if another album has since taken the merged album's MusicBrainz release
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Watermark"}`, 201)
+	setupRequest(test, "POST", "/v3/albums", `{"name":"Watermark (Remastered)","mbidRelease":"22222222-2222-2222-2222-222222222222"}`, 201)
+	setupRequest(test, "POST", "/v3/albums/merge", `{"targetId":1,"sourceIds":[2]}`, 200)
+	setupRequest(test, "PUT", "/v3/albums/1", `{"name":"Watermark","mbidRelease":"22222222-2222-2222-2222-222222222222"}`, 200)
+	makeRequest(test, "POST", "/v3/albums/merges/2/undo", "", 409, `{"error":"An album for that MusicBrainz release already exists","code":"duplicate_release"}`, true)
+	makeRequest(test, "GET", "/v3/albums/merges/2", "", 200, `{"id":2,"source":{"id":2,"name":"Watermark (Remastered)","uri":"/albums/2","mbidRelease":"22222222-2222-2222-2222-222222222222"},"targetId":1,"trackIds":[],"mergedAt":"`+getMergeList(test, "/v3/albums/merges").Merges[0].MergedAt+`"}`, true)
+}
@@ -0,0 +1,16 @@
+-- Append-only log of playback events reported by players.
+-- The lastSuccessfulPlay, lastSkip and lastError tags are maintained as derived
+-- "latest" values alongside this log, so existing consumers keep working.
+-- Timestamps are stored as UTC RFC3339 strings so lexical order matches time order.
+CREATE TABLE "play_event" (
+	"id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	"trackid" INTEGER NOT NULL,
+	"type" TEXT NOT NULL,
+	"message" TEXT NOT NULL DEFAULT '',
+	"client" TEXT NOT NULL DEFAULT '',
+	"timestamp" TEXT NOT NULL,
+	FOREIGN KEY (trackid) REFERENCES track(id)
+);
+
+CREATE INDEX play_event_trackid ON play_event(trackid, timestamp);
+CREATE INDEX play_event_timestamp ON play_event(timestamp, type);
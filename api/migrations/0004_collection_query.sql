@@ -0,0 +1,4 @@
+-- Smart collections: a saved predicate filter (in the same p. query-string form
+-- /v3/tracks accepts) which defines the collection's membership.
+-- NULL means a static collection, whose membership is listed in collection_track.
+ALTER TABLE collection ADD COLUMN query TEXT;
@@ -0,0 +1,17 @@
+-- Composed collections: membership is a set operation (union, intersection or difference)
+-- over other collections, resolved at query time.
+-- NULL operation means the collection isn't composed.
+ALTER TABLE collection ADD COLUMN operation TEXT;
+
+-- The collections a composed collection is built from.  Position matters for
+-- difference, where later operands are subtracted from the first.
+CREATE TABLE "collection_operand" (
+	"collectionslug" TEXT NOT NULL,
+	"position" INTEGER NOT NULL,
+	"operandslug" TEXT NOT NULL,
+	FOREIGN KEY (collectionslug) REFERENCES collection(slug),
+	FOREIGN KEY (operandslug) REFERENCES collection(slug),
+	CONSTRAINT collection_operand_position_unique UNIQUE (collectionslug, position)
+);
+
+CREATE INDEX "collection_operand_operandslug" ON "collection_operand" ("operandslug");
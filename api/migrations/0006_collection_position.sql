@@ -0,0 +1,13 @@
+-- Ordered playlists.  Every static collection keeps a running order in collection_track.position,
+-- numbered from 1 without gaps.  Collections flagged as ordered expose that order for editing
+-- by position; unordered ones just use it as a stable listing order.
+ALTER TABLE collection ADD COLUMN ordered BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE collection_track ADD COLUMN position INTEGER;
+
+-- Existing tracks keep the order they were added in.
+UPDATE collection_track SET position = (
+	SELECT COUNT(*) FROM collection_track AS earlier
+	WHERE earlier.collectionslug = collection_track.collectionslug AND earlier.rowid <= collection_track.rowid
+);
+
+CREATE INDEX "collection_track_position" ON "collection_track" ("collectionslug", "position");
@@ -0,0 +1,31 @@
+-- Album names are no longer unique: distinct releases which share a name (eg "Greatest Hits")
+-- are told apart by album artist, year and MusicBrainz release id.
+-- SQLite can't drop a UNIQUE constraint, so the album table is rebuilt, keeping existing ids
+-- (which appear in album URIs) and the AUTOINCREMENT counter, so deleted ids aren't reused.
+CREATE TABLE "album_new" (
+	"id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	"name" TEXT NOT NULL,
+	"year" INTEGER,
+	"mbid_release" TEXT
+);
+INSERT INTO album_new (id, name) SELECT id, name FROM album;
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'album') WHERE name = 'album_new';
+DROP TABLE album;
+ALTER TABLE album_new RENAME TO album;
+
+CREATE INDEX "album_name" ON "album" ("name");
+
+-- A MusicBrainz release is a single album.  NULLs don't conflict, so albums without one are unaffected.
+CREATE UNIQUE INDEX "album_mbid_release" ON "album" ("mbid_release");
+
+-- The artist(s) an album is credited to, in credit order.
+CREATE TABLE "album_artist" (
+	"albumid" INTEGER NOT NULL,
+	"position" INTEGER NOT NULL,
+	"artistid" INTEGER NOT NULL,
+	FOREIGN KEY (albumid) REFERENCES album(id) ON DELETE CASCADE,
+	FOREIGN KEY (artistid) REFERENCES artist(id),
+	CONSTRAINT album_artist_unique UNIQUE (albumid, artistid)
+);
+
+CREATE INDEX "album_artist_artistid" ON "album_artist" ("artistid");
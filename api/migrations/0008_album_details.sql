@@ -0,0 +1,5 @@
+-- Album details which previously had to be derived from the album's tracks.
+-- NULL means unknown.
+ALTER TABLE album ADD COLUMN track_count INTEGER;
+ALTER TABLE album ADD COLUMN disc_count INTEGER;
+ALTER TABLE album ADD COLUMN artwork TEXT;
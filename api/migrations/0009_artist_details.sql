@@ -0,0 +1,18 @@
+-- Artist details: a name to sort by (eg "Beatles, The"), MusicBrainz artist id and
+-- type (person, group, orchestra or choir).  NULL means unknown.
+ALTER TABLE artist ADD COLUMN sort_name TEXT;
+ALTER TABLE artist ADD COLUMN mbid_artist TEXT;
+ALTER TABLE artist ADD COLUMN type TEXT;
+
+-- A MusicBrainz artist is a single artist.  NULLs don't conflict, so artists without one are unaffected.
+CREATE UNIQUE INDEX "artist_mbid_artist" ON "artist" ("mbid_artist");
+
+-- Other names an artist is known by, matched when resolving artist tags by name.
+-- Like artist names, each alias belongs to a single artist.
+CREATE TABLE "artist_alias" (
+	"artistid" INTEGER NOT NULL,
+	"name" TEXT NOT NULL UNIQUE,
+	FOREIGN KEY (artistid) REFERENCES artist(id) ON DELETE CASCADE
+);
+
+CREATE INDEX "artist_alias_artistid" ON "artist_alias" ("artistid");
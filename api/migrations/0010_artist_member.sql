@@ -0,0 +1,18 @@
+-- Members of a group: each is either another artist or an eolas Person
+-- (for people who aren't credited as artists in their own right).
+-- start_date and end_date are ISO 8601 dates, to whatever precision is known (eg "1960" or "1962-08").
+CREATE TABLE "artist_member" (
+	"groupid" INTEGER NOT NULL,
+	"position" INTEGER NOT NULL,
+	"memberid" INTEGER,
+	"person_uri" TEXT,
+	"role" TEXT,
+	"start_date" TEXT,
+	"end_date" TEXT,
+	FOREIGN KEY (groupid) REFERENCES artist(id) ON DELETE CASCADE,
+	FOREIGN KEY (memberid) REFERENCES artist(id),
+	CHECK ((memberid IS NULL) != (person_uri IS NULL))
+);
+
+CREATE INDEX "artist_member_groupid" ON "artist_member" ("groupid");
+CREATE INDEX "artist_member_memberid" ON "artist_member" ("memberid");
@@ -0,0 +1,26 @@
+-- Each album or artist merged away into another, so the merge can be undone.
+-- kind is "album" or "artist".  snapshot is a JSON copy of the source as it was, along
+-- with any album credits and group memberships the merge moved to the target.
+-- Timestamps are stored as UTC RFC3339 strings so lexical order matches time order.
+CREATE TABLE "entity_merge" (
+	"id" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	"kind" TEXT NOT NULL,
+	"sourceid" INTEGER NOT NULL,
+	"targetid" INTEGER NOT NULL,
+	"snapshot" TEXT NOT NULL,
+	"merged_at" TEXT NOT NULL,
+	"undone_at" TEXT
+);
+
+CREATE INDEX "entity_merge_kind" ON "entity_merge" ("kind", "id");
+
+-- The tag rows a merge repointed from the source to the target, with the value each had
+-- beforehand (which may be an alias the track was credited under, rather than the source's name).
+CREATE TABLE "entity_merge_tag" (
+	"mergeid" INTEGER NOT NULL,
+	"trackid" INTEGER NOT NULL,
+	"value" TEXT,
+	FOREIGN KEY (mergeid) REFERENCES entity_merge(id) ON DELETE CASCADE
+);
+
+CREATE INDEX "entity_merge_tag_mergeid" ON "entity_merge_tag" ("mergeid");
@@ -0,0 +1,144 @@
+-- A counter bumped by every write to the library, so the RDF exporter can tell whether
+-- anything has changed since it last ran.  There's only ever one row.
+-- The plays log and the record of merges aren't counted, as they don't change the library
+-- themselves (a merge's changes to tags, albums and artists are counted as usual).
+-- Any new table holding library data needs triggers adding here too.
+CREATE TABLE "data_version" (
+	"id" INTEGER PRIMARY KEY CHECK ("id" = 1),
+	"version" INTEGER NOT NULL,
+	"updated_at" TEXT NOT NULL
+);
+
+INSERT INTO "data_version" ("id", "version", "updated_at") VALUES (1, 1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+
+CREATE TRIGGER "track_insert_data_version" AFTER INSERT ON "track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "track_update_data_version" AFTER UPDATE ON "track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "track_delete_data_version" AFTER DELETE ON "track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_insert_data_version" AFTER INSERT ON "predicate" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_update_data_version" AFTER UPDATE ON "predicate" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_delete_data_version" AFTER DELETE ON "predicate" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_insert_data_version" AFTER INSERT ON "tag" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_update_data_version" AFTER UPDATE ON "tag" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_delete_data_version" AFTER DELETE ON "tag" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_insert_data_version" AFTER INSERT ON "collection" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_update_data_version" AFTER UPDATE ON "collection" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_delete_data_version" AFTER DELETE ON "collection" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_track_insert_data_version" AFTER INSERT ON "collection_track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_track_update_data_version" AFTER UPDATE ON "collection_track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_track_delete_data_version" AFTER DELETE ON "collection_track" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_operand_insert_data_version" AFTER INSERT ON "collection_operand" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_operand_update_data_version" AFTER UPDATE ON "collection_operand" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "collection_operand_delete_data_version" AFTER DELETE ON "collection_operand" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_insert_data_version" AFTER INSERT ON "album" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_update_data_version" AFTER UPDATE ON "album" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_delete_data_version" AFTER DELETE ON "album" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_artist_insert_data_version" AFTER INSERT ON "album_artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_artist_update_data_version" AFTER UPDATE ON "album_artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "album_artist_delete_data_version" AFTER DELETE ON "album_artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_insert_data_version" AFTER INSERT ON "artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_update_data_version" AFTER UPDATE ON "artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_delete_data_version" AFTER DELETE ON "artist" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_alias_insert_data_version" AFTER INSERT ON "artist_alias" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_alias_update_data_version" AFTER UPDATE ON "artist_alias" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_alias_delete_data_version" AFTER DELETE ON "artist_alias" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_member_insert_data_version" AFTER INSERT ON "artist_member" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_member_update_data_version" AFTER UPDATE ON "artist_member" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "artist_member_delete_data_version" AFTER DELETE ON "artist_member" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
@@ -0,0 +1,18 @@
+-- MusicBrainz ID tags keep the bare ID as their value, and now also store the
+-- MusicBrainz URI the RDF export has always derived from it in uri, like other
+-- URI-object predicates.  Any uri already set was ignored until now, so is replaced.
+-- Values are normalised the way NormaliseIdentifier normalises new ones: trimmed,
+-- lower-cased, and reduced to the ID when they're a MusicBrainz URI.  Values which
+-- still aren't a MusicBrainz ID were never exported, and would fail validation when the
+-- track is next saved, so are removed.
+UPDATE tag SET value = lower(trim(value, ' ' || char(9, 10, 13))) WHERE predicateid = 'mbid_artist';
+UPDATE tag SET value = substr(value, instr(value, 'musicbrainz.org/artist/') + 23, 36) WHERE predicateid = 'mbid_artist' AND instr(value, 'musicbrainz.org/artist/') > 0;
+UPDATE tag SET value = lower(trim(value, ' ' || char(9, 10, 13))) WHERE predicateid = 'mbid_recording';
+UPDATE tag SET value = substr(value, instr(value, 'musicbrainz.org/recording/') + 26, 36) WHERE predicateid = 'mbid_recording' AND instr(value, 'musicbrainz.org/recording/') > 0;
+UPDATE tag SET value = lower(trim(value, ' ' || char(9, 10, 13))) WHERE predicateid = 'mbid_release';
+UPDATE tag SET value = substr(value, instr(value, 'musicbrainz.org/release/') + 24, 36) WHERE predicateid = 'mbid_release' AND instr(value, 'musicbrainz.org/release/') > 0;
+DELETE FROM tag WHERE predicateid IN ('mbid_artist', 'mbid_recording', 'mbid_release')
+	AND (value IS NULL OR value NOT GLOB '[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]-[0-9a-f][0-9a-f][0-9a-f][0-9a-f]-[0-9a-f][0-9a-f][0-9a-f][0-9a-f]-[0-9a-f][0-9a-f][0-9a-f][0-9a-f]-[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]');
+UPDATE tag SET uri = 'https://musicbrainz.org/artist/' || value WHERE predicateid = 'mbid_artist';
+UPDATE tag SET uri = 'https://musicbrainz.org/recording/' || value WHERE predicateid = 'mbid_recording';
+UPDATE tag SET uri = 'https://musicbrainz.org/release/' || value WHERE predicateid = 'mbid_release';
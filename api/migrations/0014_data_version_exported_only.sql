@@ -0,0 +1,50 @@
+-- Only bump the data version for writes which change what the RDF exporter outputs.
+-- A track's weightings aren't exported, and are rewritten on many tracks whenever one
+-- track's weighting changes, so only its url and duration are counted.
+-- Tags and predicates which are omitted from RDF (the last play, skip and error recorded
+-- for every play event, and genre) aren't counted either.  Any new predicate which is
+-- omitted from RDF needs adding to the lists below too.
+DROP TRIGGER "track_update_data_version";
+DROP TRIGGER "predicate_insert_data_version";
+DROP TRIGGER "predicate_update_data_version";
+DROP TRIGGER "predicate_delete_data_version";
+DROP TRIGGER "tag_insert_data_version";
+DROP TRIGGER "tag_update_data_version";
+DROP TRIGGER "tag_delete_data_version";
+
+CREATE TRIGGER "track_update_data_version" AFTER UPDATE OF "url", "duration" ON "track"
+WHEN OLD."url" IS NOT NEW."url" OR OLD."duration" IS NOT NEW."duration" BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_insert_data_version" AFTER INSERT ON "predicate"
+WHEN NEW."id" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_update_data_version" AFTER UPDATE ON "predicate"
+WHEN OLD."id" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay')
+	OR NEW."id" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "predicate_delete_data_version" AFTER DELETE ON "predicate"
+WHEN OLD."id" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_insert_data_version" AFTER INSERT ON "tag"
+WHEN NEW."predicateid" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_update_data_version" AFTER UPDATE ON "tag"
+WHEN OLD."predicateid" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay')
+	OR NEW."predicateid" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
+
+CREATE TRIGGER "tag_delete_data_version" AFTER DELETE ON "tag"
+WHEN OLD."predicateid" NOT IN ('genre', 'lastError', 'lastErrorMessage', 'lastSkip', 'lastSuccessfulPlay') BEGIN
+	UPDATE "data_version" SET "version" = "version" + 1, "updated_at" = strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+END;
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PlaylistEditV3 is the request body for editing an ordered collection by position.
+// TrackID is used when inserting a track; Position when moving one.
+type PlaylistEditV3 struct {
+	TrackID  *int `json:"trackId"`
+	Position *int `json:"position"`
+}
+
+// PlaylistEntryV3 is a track at a given position in an ordered collection.
+type PlaylistEntryV3 struct {
+	Position int     `json:"position"`
+	Track    TrackV3 `json:"track"`
+}
+
+// queryer is the subset of sqlx shared by *sqlx.DB and *sqlx.Tx which position edits need.
+type queryer interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+}
+
+// countListedTracks returns how many tracks are listed in a static collection.
+func countListedTracks(db queryer, slug string) (count int, err error) {
+	err = db.Get(&count, "SELECT COUNT(*) FROM collection_track WHERE collectionslug = $1", slug)
+	return
+}
+
+// getTrackAtPosition returns the track at a 1-based position in a collection's running order.
+func (store Datastore) getTrackAtPosition(slug string, position int) (track Track, err error) {
+	var trackid int
+	err = store.DB.Get(&trackid, "SELECT trackid FROM collection_track WHERE collectionslug = $1 AND position = $2", slug, position)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			err = errors.New("Position " + strconv.Itoa(position) + " Not Found")
+		}
+		return
+	}
+	return store.getTrackDataByField("id", trackid)
+}
+
+// insertTrackInCollection adds a track at a 1-based position, moving the track already there
+// (and everything after it) one place later.  Position may be one past the end, to append.
+func (store Datastore) insertTrackInCollection(slug string, trackid int, position int) (err error) {
+	slog.Info("Insert track in collection", "collectionslug", slug, "trackid", trackid, "position", position)
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	var present int
+	err = tx.Get(&present, "SELECT COUNT(*) FROM collection_track WHERE collectionslug = $1 AND trackid = $2", slug, trackid)
+	if err != nil {
+		return
+	}
+	if present > 0 {
+		return errors.New("Adding track " + strconv.Itoa(trackid) + " to collection " + slug + " twice not allowed")
+	}
+	count, err := countListedTracks(tx, slug)
+	if err != nil {
+		return
+	}
+	if position < 1 || position > count+1 {
+		return errors.New("Inserting at position " + strconv.Itoa(position) + " of collection " + slug + ", which has " + strconv.Itoa(count) + " tracks, not allowed")
+	}
+	_, err = tx.Exec("UPDATE collection_track SET position = position + 1 WHERE collectionslug = $1 AND position >= $2", slug, position)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("INSERT INTO collection_track (collectionslug, trackid, position) VALUES ($1, $2, $3)", slug, trackid, position)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// moveTrackInCollection moves the track at one 1-based position to another,
+// shifting the tracks in between to close the gap.
+func (store Datastore) moveTrackInCollection(slug string, from int, to int) (err error) {
+	slog.Info("Move track in collection", "collectionslug", slug, "from", from, "to", to)
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	var trackid int
+	err = tx.Get(&trackid, "SELECT trackid FROM collection_track WHERE collectionslug = $1 AND position = $2", slug, from)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			err = errors.New("Position " + strconv.Itoa(from) + " Not Found")
+		}
+		return
+	}
+	count, err := countListedTracks(tx, slug)
+	if err != nil {
+		return
+	}
+	if to < 1 || to > count {
+		return errors.New("Moving to position " + strconv.Itoa(to) + " of collection " + slug + ", which has " + strconv.Itoa(count) + " tracks, not allowed")
+	}
+	if from < to {
+		_, err = tx.Exec("UPDATE collection_track SET position = position - 1 WHERE collectionslug = $1 AND position > $2 AND position <= $3", slug, from, to)
+	} else {
+		_, err = tx.Exec("UPDATE collection_track SET position = position + 1 WHERE collectionslug = $1 AND position >= $2 AND position < $3", slug, to, from)
+	}
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("UPDATE collection_track SET position = $1 WHERE collectionslug = $2 AND trackid = $3", to, slug, trackid)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// setCollectionTrackOrder renumbers a collection's running order to match a list of its tracks.
+func (store Datastore) setCollectionTrackOrder(slug string, tracks []Track) (err error) {
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	seen := make(map[int]bool, len(tracks))
+	position := 0
+	for _, track := range tracks {
+		if seen[track.ID] {
+			continue
+		}
+		seen[track.ID] = true
+		position++
+		_, err = tx.Exec("UPDATE collection_track SET position = $1 WHERE collectionslug = $2 AND trackid = $3", position, slug, track.ID)
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	return
+}
+
+// collectionPositionsHandler handles requests to /v3/collections/{slug}/positions and /v3/collections/{slug}/positions/{n}.
+//
+//	POST   /positions      — append the track given by {"trackId": …}
+//	GET    /positions/{n}  — the track at position n
+//	POST   /positions/{n}  — insert the track given by {"trackId": …} at position n
+//	PATCH  /positions/{n}  — move the track at position n to {"position": …}
+//	DELETE /positions/{n}  — remove the track at position n
+//
+// Positions start at 1.  Edits respond with the collection in its new running order.
+func (store Datastore) collectionPositionsHandler(w http.ResponseWriter, r *http.Request, collection Collection, pathparts []string) {
+	if !collection.isOrdered() {
+		writeV3Error(w, errors.New("Addressing tracks by position in unordered collection "+collection.Slug+" not allowed"))
+		return
+	}
+	if len(pathparts) > 4 {
+		writeV3ErrorResponse(w, http.StatusNotFound, "Collection Endpoint Not Found", "not_found")
+		return
+	}
+	position := 0
+	if len(pathparts) == 4 {
+		var err error
+		position, err = strconv.Atoi(pathparts[3])
+		if err != nil || position < 1 {
+			writeV3ErrorResponse(w, http.StatusBadRequest, "Position must be a positive integer", "bad_request")
+			return
+		}
+	} else if r.Method != "POST" {
+		MethodNotAllowed(w, []string{"POST"})
+		return
+	}
+
+	var edit PlaylistEditV3
+	if r.Method == "POST" || r.Method == "PATCH" {
+		err := json.NewDecoder(r.Body).Decode(&edit)
+		if err != nil {
+			if err.Error() == "EOF" {
+				writeV3ErrorResponse(w, http.StatusBadRequest, "No Data Sent", "bad_request")
+			} else {
+				writeV3ErrorResponse(w, http.StatusBadRequest, err.Error(), "bad_request")
+			}
+			return
+		}
+	}
+
+	var err error
+	switch r.Method {
+	case "GET":
+		track, err := store.getTrackAtPosition(collection.Slug, position)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, PlaylistEntryV3{Position: position, Track: TrackToV3(track)}, nil)
+		return
+	case "POST":
+		if edit.TrackID == nil {
+			writeV3ErrorResponse(w, http.StatusBadRequest, "trackId is required", "bad_request")
+			return
+		}
+		trackFound, err := store.trackExists("id", *edit.TrackID)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		if !trackFound {
+			writeV3Error(w, errors.New("Track Not Found"))
+			return
+		}
+		if position == 0 {
+			position, err = countListedTracks(store.DB, collection.Slug)
+			if err != nil {
+				writeV3Error(w, err)
+				return
+			}
+			position++
+		}
+		err = store.insertTrackInCollection(collection.Slug, *edit.TrackID, position)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+	case "PATCH":
+		if edit.Position == nil {
+			writeV3ErrorResponse(w, http.StatusBadRequest, "position is required", "bad_request")
+			return
+		}
+		err = store.moveTrackInCollection(collection.Slug, position, *edit.Position)
+	case "DELETE":
+		var track Track
+		track, err = store.getTrackAtPosition(collection.Slug, position)
+		if err == nil {
+			err = store.removeTrackFromCollection(collection.Slug, track.ID)
+		}
+	default:
+		MethodNotAllowed(w, []string{"GET", "POST", "PATCH", "DELETE"})
+		return
+	}
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	updated, err := store.getCollectionV3(collection.Slug, r.URL.Query().Get("page"))
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	writeJSONResponse(w, updated, nil)
+}
+
+// playlistLabel gives a one-line description of a track for playlist files, eg "Artist - Title".
+func playlistLabel(track Track) string {
+	title := track.Tags.GetValue("title")
+	artists := strings.Join(track.Tags.GetValues("artist"), ", ")
+	label := title
+	if artists != "" && title != "" {
+		label = artists + " - " + title
+	} else if artists != "" {
+		label = artists
+	}
+	return strings.Join(strings.Fields(label), " ") // Newlines would break the M3U format
+}
+
+// writeM3UPlaylist writes a collection's tracks as an extended M3U playlist.
+func writeM3UPlaylist(w http.ResponseWriter, collection Collection, tracks []Track) {
+	var body strings.Builder
+	body.WriteString("#EXTM3U\n")
+	body.WriteString("#PLAYLIST:" + strings.Join(strings.Fields(collection.Name), " ") + "\n")
+	for _, track := range tracks {
+		body.WriteString("#EXTINF:" + strconv.Itoa(track.Duration) + "," + playlistLabel(track) + "\n")
+		body.WriteString(track.URL + "\n")
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, no-store, must-revalidate")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body.String()))
+}
+
+// xspfPlaylist is the root of an XSPF playlist document (https://xspf.org/spec).
+type xspfPlaylist struct {
+	XMLName   xml.Name      `xml:"playlist"`
+	Version   string        `xml:"version,attr"`
+	Namespace string        `xml:"xmlns,attr"`
+	Title     string        `xml:"title,omitempty"`
+	TrackList xspfTrackList `xml:"trackList"`
+}
+
+type xspfTrackList struct {
+	Tracks []xspfTrack `xml:"track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"` // In milliseconds
+}
+
+// writeXSPFPlaylist writes a collection's tracks as an XSPF playlist.
+func writeXSPFPlaylist(w http.ResponseWriter, collection Collection, tracks []Track) {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     collection.Name,
+		TrackList: xspfTrackList{Tracks: []xspfTrack{}},
+	}
+	for _, track := range tracks {
+		playlist.TrackList.Tracks = append(playlist.TrackList.Tracks, xspfTrack{
+			Location: track.URL,
+			Title:    track.Tags.GetValue("title"),
+			Creator:  strings.Join(track.Tags.GetValues("artist"), ", "),
+			Album:    track.Tags.GetValue("album"),
+			Duration: track.Duration * 1000,
+		})
+	}
+	output, err := xml.MarshalIndent(playlist, "", "\t")
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xspf+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, no-store, must-revalidate")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(output)
+}
+
+// collectionPlaylistExportHandler handles /v3/collections/{slug}/playlist.m3u and /playlist.xspf,
+// exporting every track in the collection in its listing order.
+func (store Datastore) collectionPlaylistExportHandler(w http.ResponseWriter, r *http.Request, collection Collection, format string) {
+	if r.Method != "GET" {
+		MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	offset, limit := parsePageParam("all", 20)
+	tracks, _, err := store.getTracksInCollection(collection, offset, limit)
+	if err != nil {
+		writeV3Error(w, err)
+		return
+	}
+	if format == "xspf" {
+		writeXSPFPlaylist(w, collection, tracks)
+	} else {
+		writeM3UPlaylist(w, collection, tracks)
+	}
+}
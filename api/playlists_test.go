@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// setupPlaylist creates four tracks and an ordered collection listing tracks 3, 1 and 2 in that order.
+func setupPlaylist(test *testing.T) {
+	for id := 1; id <= 4; id++ {
+		setupRequest(test, "PUT", fmt.Sprintf("/v3/tracks/%d", id), fmt.Sprintf(`{"fingerprint":"playlist%d","url":"http://example.org/playlist/%d","duration":%d0,"tags":{"title":[{"name":"Song %d"}],"artist":[{"name":"Band"}]}}`, id, id, id, id), 200)
+	}
+	setupRequest(test, "PUT", "/v3/collections/mix", `{"name":"Mix Tape","ordered":true}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/mix/3", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/mix/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/mix/2", "", 200)
+}
+
+// TestPlaylistKeepsRunningOrder checks ordered collections list tracks in the order they were added, not by id.
+func TestPlaylistKeepsRunningOrder(test *testing.T) {
+	clearData()
+	setupPlaylist(test)
+	assertEqual(test, "Running order", "[3 1 2]", getCollectionTrackIDs(test, "/v3/collections/mix"))
+	restartServer()
+	assertEqual(test, "Running order after restart", "[3 1 2]", getCollectionTrackIDs(test, "/v3/collections/mix"))
+
+	// Removing a track closes the gap it leaves
+	setupRequest(test, "DELETE", "/v3/collections/mix/1", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/mix/4", "", 200)
+	assertEqual(test, "Running order after remove and add", "[3 2 4]", getCollectionTrackIDs(test, "/v3/collections/mix"))
+	request := basicRequest(test, "GET", "/v3/collections/mix/positions/3", "")
+	resp, _ := doRawRequest(test, request)
+	var entry PlaylistEntryV3
+	json.NewDecoder(resp.Body).Decode(&entry)
+	assertEqual(test, "Entry position", 3, entry.Position)
+	assertEqual(test, "Entry track", 4, entry.Track.ID)
+}
+
+// TestPlaylistEditByPosition checks inserting, moving and removing tracks by position.
+func TestPlaylistEditByPosition(test *testing.T) {
+	clearData()
+	setupPlaylist(test)
+	path := "/v3/collections/mix"
+
+	setupRequest(test, "POST", path+"/positions/2", `{"trackId":4}`, 200)
+	assertEqual(test, "Order after insert", "[3 4 1 2]", getCollectionTrackIDs(test, path))
+
+	setupRequest(test, "PATCH", path+"/positions/1", `{"position":4}`, 200)
+	assertEqual(test, "Order after moving later", "[4 1 2 3]", getCollectionTrackIDs(test, path))
+
+	setupRequest(test, "PATCH", path+"/positions/3", `{"position":1}`, 200)
+	assertEqual(test, "Order after moving earlier", "[2 4 1 3]", getCollectionTrackIDs(test, path))
+
+	setupRequest(test, "DELETE", path+"/positions/2", "", 200)
+	assertEqual(test, "Order after delete", "[2 1 3]", getCollectionTrackIDs(test, path))
+
+	setupRequest(test, "POST", path+"/positions", `{"trackId":4}`, 200)
+	assertEqual(test, "Order after append", "[2 1 3 4]", getCollectionTrackIDs(test, path))
+}
+
+// TestPlaylistPositionErrors checks invalid position edits are rejected without changing the running order.
+func TestPlaylistPositionErrors(test *testing.T) {
+	clearData()
+	setupPlaylist(test)
+	path := "/v3/collections/mix"
+
+	makeRequest(test, "GET", path+"/positions/7", "", 404, `{"error":"Position 7 Not Found","code":"not_found"}`, true)
+	makeRequest(test, "GET", path+"/positions/zero", "", 400, `{"error":"Position must be a positive integer","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path+"/positions/1", `{"trackId":1}`, 400, `{"error":"Adding track 1 to collection mix twice not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path+"/positions/5", `{"trackId":4}`, 400, `{"error":"Inserting at position 5 of collection mix, which has 3 tracks, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "POST", path+"/positions/1", `{"trackId":99}`, 404, `{"error":"Track Not Found","code":"not_found"}`, true)
+	makeRequest(test, "POST", path+"/positions/1", `{}`, 400, `{"error":"trackId is required","code":"bad_request"}`, true)
+	makeRequest(test, "PATCH", path+"/positions/1", `{"position":4}`, 400, `{"error":"Moving to position 4 of collection mix, which has 3 tracks, not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PATCH", path+"/positions/4", `{"position":1}`, 404, `{"error":"Position 4 Not Found","code":"not_found"}`, true)
+	makeRequest(test, "DELETE", path+"/positions/4", "", 404, `{"error":"Position 4 Not Found","code":"not_found"}`, true)
+	makeRequestWithUnallowedMethod(test, path+"/positions", "GET", []string{"POST"})
+	makeRequestWithUnallowedMethod(test, path+"/positions/1", "PUT", []string{"GET", "POST", "PATCH", "DELETE"})
+	assertEqual(test, "Order unchanged", "[3 1 2]", getCollectionTrackIDs(test, path))
+
+	setupRequest(test, "PUT", "/v3/collections/bag", `{"name":"Unordered"}`, 200)
+	makeRequest(test, "GET", "/v3/collections/bag/positions/1", "", 400, `{"error":"Addressing tracks by position in unordered collection bag not allowed","code":"bad_request"}`, true)
+	makeRequest(test, "PUT", "/v3/collections/smart", `{"name":"Smart","query":"p.artist=Band","ordered":true}`, 400, `{"error":"Ordering smart collection smart not allowed","code":"bad_request"}`, true)
+}
+
+// TestPlaylistReorderByTrackList checks PUTting an ordered collection's track list sets its running order.
+func TestPlaylistReorderByTrackList(test *testing.T) {
+	clearData()
+	setupPlaylist(test)
+	path := "/v3/collections/mix"
+	setupRequest(test, "PUT", path, `{"name":"Mix Tape","ordered":true,"tracks":[{"trackid":2},{"trackid":4},{"trackid":3}]}`, 200)
+	assertEqual(test, "Order after PUT", "[2 4 3]", getCollectionTrackIDs(test, path))
+
+	// Turning ordering off keeps the listing order, but positions can no longer be edited
+	setupRequest(test, "PUT", path, `{"name":"Mix Tape","ordered":false}`, 200)
+	assertEqual(test, "Order when unordered", "[2 4 3]", getCollectionTrackIDs(test, path))
+	makeRequest(test, "DELETE", path+"/positions/1", "", 400, `{"error":"Addressing tracks by position in unordered collection mix not allowed","code":"bad_request"}`, true)
+}
+
+// TestPlaylistExport checks the M3U and XSPF exports list tracks in running order.
+func TestPlaylistExport(test *testing.T) {
+	clearData()
+	setupPlaylist(test)
+
+	request := basicRequest(test, "GET", "/v3/collections/mix/playlist.m3u", "")
+	resp, _ := doRawRequest(test, request)
+	body, _ := io.ReadAll(resp.Body)
+	assertEqual(test, "M3U status", 200, resp.StatusCode)
+	assertEqual(test, "M3U content type", "audio/x-mpegurl; charset=utf-8", resp.Header.Get("Content-Type"))
+	assertEqual(test, "M3U body", `#EXTM3U
+#PLAYLIST:Mix Tape
+#EXTINF:30,Band - Song 3
+http://example.org/playlist/3
+#EXTINF:10,Band - Song 1
+http://example.org/playlist/1
+#EXTINF:20,Band - Song 2
+http://example.org/playlist/2
+`, string(body))
+
+	request = basicRequest(test, "GET", "/v3/collections/mix/playlist.xspf", "")
+	resp, _ = doRawRequest(test, request)
+	body, _ = io.ReadAll(resp.Body)
+	assertEqual(test, "XSPF status", 200, resp.StatusCode)
+	assertEqual(test, "XSPF content type", "application/xspf+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	xspf := string(body)
+	if !strings.Contains(xspf, `<playlist version="1" xmlns="http://xspf.org/ns/0/">`) {
+		test.Errorf("XSPF missing playlist root: %s", xspf)
+	}
+	first := strings.Index(xspf, "<location>http://example.org/playlist/3</location>")
+	second := strings.Index(xspf, "<location>http://example.org/playlist/1</location>")
+	if first < 0 || second < first {
+		test.Errorf("XSPF tracks not in running order: %s", xspf)
+	}
+	if !strings.Contains(xspf, "<duration>30000</duration>") {
+		test.Errorf("XSPF durations should be in milliseconds: %s", xspf)
+	}
+
+	makeRequestWithUnallowedMethod(test, "/v3/collections/mix/playlist.m3u", "POST", []string{"GET"})
+	makeRequest(test, "GET", "/v3/collections/missing/playlist.m3u", "", 404, `{"error":"Collection Not Found","code":"not_found"}`, true)
+}
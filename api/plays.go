@@ -0,0 +1,467 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// playEventTags maps each play event type to the tag which holds the timestamp
+// of the most recent event of that type. These tags predate the play_event log and
+// are kept up to date as derived "latest" values so existing consumers keep working.
+var playEventTags = map[string]string{
+	"play":  "lastSuccessfulPlay",
+	"skip":  "lastSkip",
+	"error": "lastError",
+}
+
+// PlayEventV3 is the v3 wire representation of a single playback event.
+type PlayEventV3 struct {
+	ID        int    `json:"id" db:"id"`
+	TrackID   int    `json:"trackId" db:"trackid"`
+	Type      string `json:"type" db:"type"`
+	Message   string `json:"message,omitempty" db:"message"`
+	Client    string `json:"client,omitempty" db:"client"`
+	Timestamp string `json:"timestamp" db:"timestamp"`
+}
+
+// PlayEventListV3 wraps a paginated list of play events for a track, along with
+// the track's play statistics over the same time window.
+type PlayEventListV3 struct {
+	Events      []PlayEventV3 `json:"events"`
+	Stats       PlayStatsV3   `json:"stats"`
+	TotalPages  int           `json:"totalPages"`
+	Page        int           `json:"page"`
+	TotalEvents int           `json:"totalEvents"`
+}
+
+// PlayStatsV3 holds counts of each event type over a time window.
+// SkipRate is the proportion of plays and skips which were skips (0 when there are neither).
+type PlayStatsV3 struct {
+	Plays    int     `json:"plays" db:"plays"`
+	Skips    int     `json:"skips" db:"skips"`
+	Errors   int     `json:"errors" db:"errors"`
+	SkipRate float64 `json:"skipRate"`
+}
+
+// TopTrackV3 is a single entry in the most-played tracks listing.
+type TopTrackV3 struct {
+	Track TrackV3     `json:"track"`
+	Stats PlayStatsV3 `json:"stats"`
+}
+
+// TopTracksV3 wraps the most-played tracks listing for a time window.
+type TopTracksV3 struct {
+	Tracks []TopTrackV3 `json:"tracks"`
+	Since  string       `json:"since,omitempty"`
+	Until  string       `json:"until,omitempty"`
+}
+
+// playWindow is an optional [since, until) time window, as normalised UTC RFC3339 strings.
+// An empty bound means the window is open at that end.
+type playWindow struct {
+	Since string
+	Until string
+}
+
+// normalisePlayTimestamp parses an RFC3339 timestamp and re-formats it in UTC at
+// second precision, so that stored timestamps sort lexically in time order.
+func normalisePlayTimestamp(raw string) (string, error) {
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return "", err
+	}
+	return parsed.UTC().Format(time.RFC3339), nil
+}
+
+// parsePlayWindow reads the since and until query parameters from a request.
+func parsePlayWindow(r *http.Request) (window playWindow, err error) {
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		window.Since, err = normalisePlayTimestamp(raw)
+		if err != nil {
+			err = errors.New("play_window_invalid")
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("until"); raw != "" {
+		window.Until, err = normalisePlayTimestamp(raw)
+		if err != nil {
+			err = errors.New("play_window_invalid")
+			return
+		}
+	}
+	return
+}
+
+// whereClause builds the SQL conditions restricting play_event rows to the window.
+func (window playWindow) whereClause() (clauses []string, args []interface{}) {
+	if window.Since != "" {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, window.Since)
+	}
+	if window.Until != "" {
+		clauses = append(clauses, "timestamp < ?")
+		args = append(args, window.Until)
+	}
+	return
+}
+
+// recordPlayEvent appends an event to the play_event log and updates the derived
+// "latest" tag for its type. The tag is only moved forwards in time, so events
+// reported out of order don't overwrite a more recent value.
+// The event and its derived tags are written in one transaction, so a failure leaves
+// neither behind and a client retrying the request doesn't log the event twice.
+// Returns "Track Not Found" if the track doesn't exist, or "play_event_invalid_type" /
+// "play_event_invalid_timestamp" for malformed input.
+func (store Datastore) recordPlayEvent(event PlayEventV3) (stored PlayEventV3, err error) {
+	tagPredicate, ok := playEventTags[event.Type]
+	if !ok {
+		err = errors.New("play_event_invalid_type")
+		return
+	}
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		event.Timestamp, err = normalisePlayTimestamp(event.Timestamp)
+		if err != nil {
+			err = errors.New("play_event_invalid_timestamp")
+			return
+		}
+	}
+	existingTrack, err := store.getTrackDataByField("id", event.TrackID)
+	if err != nil {
+		return
+	}
+	slog.Info("Record play event", "trackid", event.TrackID, "type", event.Type, "client", event.Client)
+	tx, err := store.DB.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	result, err := tx.Exec(
+		"INSERT INTO play_event(trackid, type, message, client, timestamp) VALUES($1, $2, $3, $4, $5)",
+		event.TrackID, event.Type, event.Message, event.Client, event.Timestamp,
+	)
+	if err != nil {
+		return
+	}
+	id64, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	// Leave the derived tag alone if it already records a later event.
+	// Unparseable legacy values are treated as older than any logged event.
+	changeSet := TrackV3{
+		ID:   event.TrackID,
+		Tags: map[string][]TagValueV3{tagPredicate: {{Name: event.Timestamp}}},
+	}
+	if current := existingTrack.Tags.GetValue(tagPredicate); current != "" {
+		if currentTime, parseErr := time.Parse(time.RFC3339, current); parseErr == nil {
+			eventTime, _ := time.Parse(time.RFC3339, event.Timestamp)
+			if currentTime.After(eventTime) {
+				changeSet.Tags = nil
+			}
+		}
+	}
+	if changeSet.Tags != nil && event.Type == "error" {
+		changeSet.Tags["lastErrorMessage"] = []TagValueV3{}
+		if event.Message != "" {
+			changeSet.Tags["lastErrorMessage"] = []TagValueV3{{Name: event.Message}}
+		}
+	}
+	if changeSet.Tags != nil && !existingTrack.updateNeeded(changeSet, false) {
+		changeSet.Tags = nil
+	}
+	for predicate, values := range changeSet.Tags {
+		err = setPlayEventTag(tx, event.TrackID, predicate, values)
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	stored = event
+	stored.ID = int(id64)
+	if changeSet.Tags == nil {
+		return
+	}
+
+	// Loganne is told about the derived tags once they're stored, as for any other track update.
+	storedTrack, fetchErr := store.getTrackDataByField("id", event.TrackID)
+	if fetchErr != nil {
+		slog.Warn("Couldn't fetch track after recording play event", "trackid", event.TrackID, slog.Any("error", fetchErr))
+		return
+	}
+	humanReadable, level := getBespokeLoganneMessage(changeSet, existingTrack, storedTrack.getName())
+	if humanReadable == "" {
+		humanReadable = "Track " + storedTrack.getName() + " updated"
+		level = "routine"
+	}
+	store.Loganne.post("trackUpdated", humanReadable, storedTrack, existingTrack, level)
+	return
+}
+
+// setPlayEventTag replaces a track's values for one of the tags derived from play events.
+// These predicates take plain values, so none of the name/URI resolution done by
+// updateTagsV3 applies, which lets them be written in the event's own transaction.
+func setPlayEventTag(tx *sqlx.Tx, trackid int, predicate string, values []TagValueV3) (err error) {
+	_, err = tx.Exec("INSERT OR IGNORE INTO predicate(id) VALUES($1)", predicate)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("DELETE FROM tag WHERE trackid = $1 AND predicateid = $2", trackid, predicate)
+	if err != nil {
+		return
+	}
+	for _, value := range values {
+		_, err = tx.Exec("INSERT INTO tag(trackid, predicateid, value, uri) VALUES($1, $2, $3, '')", trackid, predicate, value.Name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getPlayEventsForTrack returns a page of a track's play events, most recent first.
+func (store Datastore) getPlayEventsForTrack(trackid int, window playWindow, rawpage string) (list PlayEventListV3, err error) {
+	const standardLimit = 20
+	found, err := store.trackExists("id", trackid)
+	if err != nil {
+		return
+	}
+	if !found {
+		err = errors.New("Track Not Found")
+		return
+	}
+	offset, limit := parsePageParam(rawpage, standardLimit)
+	page, parseErr := strconv.Atoi(rawpage)
+	if parseErr != nil || page < 1 {
+		page = 1
+	}
+
+	clauses, args := window.whereClause()
+	clauses = append([]string{"trackid = ?"}, clauses...)
+	args = append([]interface{}{trackid}, args...)
+	where := " WHERE " + strings.Join(clauses, " AND ")
+
+	var total int
+	err = store.DB.Get(&total, "SELECT COUNT(*) FROM play_event"+where, args...)
+	if err != nil {
+		return
+	}
+	events := []PlayEventV3{}
+	err = store.DB.Select(&events, "SELECT id, trackid, type, message, client, timestamp FROM play_event"+where+" ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return
+	}
+	stats, err := store.getPlayStats(&trackid, window)
+	if err != nil {
+		return
+	}
+	list = PlayEventListV3{
+		Events:      events,
+		Stats:       stats,
+		TotalPages:  int(math.Ceil(float64(total) / float64(standardLimit))),
+		Page:        page,
+		TotalEvents: total,
+	}
+	return
+}
+
+// getPlayStats counts events of each type within the window, either for a single
+// track or (when trackid is nil) across the whole library.
+func (store Datastore) getPlayStats(trackid *int, window playWindow) (stats PlayStatsV3, err error) {
+	clauses, args := window.whereClause()
+	if trackid != nil {
+		clauses = append(clauses, "trackid = ?")
+		args = append(args, *trackid)
+	}
+	query := `SELECT
+		COUNT(CASE WHEN type = 'play' THEN 1 END) AS plays,
+		COUNT(CASE WHEN type = 'skip' THEN 1 END) AS skips,
+		COUNT(CASE WHEN type = 'error' THEN 1 END) AS errors
+		FROM play_event`
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	err = store.DB.Get(&stats, query, args...)
+	stats.SkipRate = skipRate(stats.Plays, stats.Skips)
+	return
+}
+
+// skipRate returns the proportion of plays and skips which were skips.
+func skipRate(plays, skips int) float64 {
+	if plays+skips == 0 {
+		return 0
+	}
+	return float64(skips) / float64(plays+skips)
+}
+
+// getMostPlayedTracks returns the tracks with the most successful plays in the window,
+// ordered by play count (ties broken by track id).
+func (store Datastore) getMostPlayedTracks(window playWindow, limit int) (top TopTracksV3, err error) {
+	clauses, args := window.whereClause()
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+	type trackCounts struct {
+		TrackID int `db:"trackid"`
+		Plays   int `db:"plays"`
+		Skips   int `db:"skips"`
+		Errors  int `db:"errors"`
+	}
+	var rows []trackCounts
+	err = store.DB.Select(&rows, `SELECT trackid,
+		COUNT(CASE WHEN type = 'play' THEN 1 END) AS plays,
+		COUNT(CASE WHEN type = 'skip' THEN 1 END) AS skips,
+		COUNT(CASE WHEN type = 'error' THEN 1 END) AS errors
+		FROM play_event`+where+`
+		GROUP BY trackid
+		HAVING plays > 0
+		ORDER BY plays DESC, trackid
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return
+	}
+	top = TopTracksV3{Tracks: make([]TopTrackV3, 0, len(rows)), Since: window.Since, Until: window.Until}
+	tracks := make([]Track, len(rows))
+	for i, row := range rows {
+		tracks[i], err = store.getTrackWithTagsByField("id", row.TrackID)
+		if err != nil {
+			return
+		}
+	}
+	err = store.addCollectionsToTracks(tracks)
+	if err != nil {
+		return
+	}
+	for i, row := range rows {
+		top.Tracks = append(top.Tracks, TopTrackV3{
+			Track: TrackToV3(tracks[i]),
+			Stats: PlayStatsV3{Plays: row.Plays, Skips: row.Skips, Errors: row.Errors, SkipRate: skipRate(row.Plays, row.Skips)},
+		})
+	}
+	return
+}
+
+// writePlayError maps play-specific errors to structured JSON responses,
+// falling back to writeV3Error for everything else.
+func writePlayError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "play_event_invalid_type":
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Play event \"type\" must be one of \"play\", \"skip\" or \"error\"", "bad_request")
+	case "play_event_invalid_timestamp":
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Play event \"timestamp\" must be in RFC3339 format", "bad_request")
+	case "play_window_invalid":
+		writeV3ErrorResponse(w, http.StatusBadRequest, "The since and until parameters must be in RFC3339 format", "bad_request")
+	default:
+		writeV3Error(w, err)
+	}
+}
+
+// trackPlaysHandler handles requests to /v3/tracks/{id}/plays.
+func (store Datastore) trackPlaysHandler(w http.ResponseWriter, r *http.Request, trackid int) {
+	switch r.Method {
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		var event PlayEventV3
+		if err = json.Unmarshal(body, &event); err != nil {
+			writeV3ErrorResponse(w, http.StatusBadRequest, err.Error(), "bad_request")
+			return
+		}
+		event.ID = 0
+		event.TrackID = trackid
+		// Clients may identify the specific device or player; otherwise fall back
+		// to the system the API key was issued to.
+		if event.Client == "" {
+			event.Client = authenticatedClientFromRequest(r).System
+		}
+		stored, err := store.recordPlayEvent(event)
+		if err != nil {
+			writePlayError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache, max-age=0, no-store, must-revalidate")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(stored)
+	case "GET":
+		window, err := parsePlayWindow(r)
+		if err != nil {
+			writePlayError(w, err)
+			return
+		}
+		list, err := store.getPlayEventsForTrack(trackid, window, r.URL.Query().Get("page"))
+		if err != nil {
+			writePlayError(w, err)
+			return
+		}
+		writeJSONResponse(w, list, nil)
+	default:
+		MethodNotAllowed(w, []string{"GET", "POST"})
+	}
+}
+
+// PlaysV3Controller handles library-wide play reporting under /v3/plays.
+//
+//	GET /v3/plays       — play, skip and error counts (and skip rate) over a time window
+//	GET /v3/plays/top   — most-played tracks over a time window
+//
+// Both accept optional since and until parameters (RFC3339); /top also accepts limit (default 20, max 100).
+func (store Datastore) PlaysV3Controller(w http.ResponseWriter, r *http.Request) {
+	normalisedpath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v3/plays"), "/")
+	pathparts := strings.Split(normalisedpath, "/")
+
+	slog.Debug("Plays v3 controller", "method", r.Method, "pathparts", pathparts)
+
+	if r.Method != "GET" {
+		MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	window, err := parsePlayWindow(r)
+	if err != nil {
+		writePlayError(w, err)
+		return
+	}
+	if len(pathparts) <= 1 {
+		stats, err := store.getPlayStats(nil, window)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, stats, nil)
+	} else if len(pathparts) == 2 && pathparts[1] == "top" {
+		limit := 20
+		if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+			limit, err = strconv.Atoi(rawLimit)
+			if err != nil || limit < 1 || limit > 100 {
+				writeV3ErrorResponse(w, http.StatusBadRequest, "The limit parameter must be a number between 1 and 100", "bad_request")
+				return
+			}
+		}
+		top, err := store.getMostPlayedTracks(window, limit)
+		if err != nil {
+			writeV3Error(w, err)
+			return
+		}
+		writeJSONResponse(w, top, nil)
+	} else {
+		writeV3ErrorResponse(w, http.StatusNotFound, "Plays Endpoint Not Found", "not_found")
+	}
+}
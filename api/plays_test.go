@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// createPlayTestTrack creates a track with the given id-derived url/fingerprint.
+func createPlayTestTrack(test *testing.T, id string) {
+	setupRequest(test, "PUT", "/v3/tracks/"+id, `{"fingerprint":"playtest`+id+`","url":"http://example.org/play/`+id+`","duration":180,"tags":{"title":[{"name":"Song `+id+`"}]}}`, 200)
+}
+
+// TestPlayEventRecorded checks POST /v3/tracks/{id}/plays stores the event and updates the derived tag.
+func TestPlayEventRecorded(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	makeRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-01T10:00:00+01:00","client":"kitchen"}`, 201, `{"id":1,"trackId":1,"type":"play","client":"kitchen","timestamp":"2026-03-01T09:00:00Z"}`, true)
+	assertEqual(test, "Derived tag not updated", "2026-03-01T09:00:00Z", getTagValueByID(test, "1", "lastSuccessfulPlay"))
+	assertEqual(test, "Unexpected loganne event type", "trackUpdated", lastLoganneType)
+	assertEqual(test, "Unexpected loganne message", "Track \"Song 1\" finished playing", lastLoganneMessage)
+}
+
+// TestPlayEventClientDefaultsToAuthenticatedSystem checks the client falls back to the API key's system.
+func TestPlayEventClientDefaultsToAuthenticatedSystem(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	makeRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"skip","timestamp":"2026-03-01T09:00:00Z"}`, 201, `{"id":1,"trackId":1,"type":"skip","client":"test_app1","timestamp":"2026-03-01T09:00:00Z"}`, true)
+	assertEqual(test, "Derived tag not updated", "2026-03-01T09:00:00Z", getTagValueByID(test, "1", "lastSkip"))
+}
+
+// TestPlayEventErrorSetsMessage checks error events maintain both lastError and lastErrorMessage.
+func TestPlayEventErrorSetsMessage(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"error","message":"404 fetching audio","timestamp":"2026-03-01T09:00:00Z"}`, 201)
+	assertEqual(test, "lastError not updated", "2026-03-01T09:00:00Z", getTagValueByID(test, "1", "lastError"))
+	assertEqual(test, "lastErrorMessage not updated", "404 fetching audio", getTagValueByID(test, "1", "lastErrorMessage"))
+	assertEqual(test, "Unexpected loganne message", "Track \"Song 1\" errored", lastLoganneMessage)
+}
+
+// TestPlayEventOutOfOrderKeepsLatest checks an older event doesn't overwrite a more recent derived tag.
+func TestPlayEventOutOfOrderKeepsLatest(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-02T09:00:00Z"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-01T09:00:00Z"}`, 201)
+	assertEqual(test, "Derived tag went backwards", "2026-03-02T09:00:00Z", getTagValueByID(test, "1", "lastSuccessfulPlay"))
+}
+
+// TestPlayEventNotStoredWhenTagUpdateFails checks a failed derived tag write doesn't leave
+// the event logged, so a client retrying the request doesn't count it twice.
+func TestPlayEventNotStoredWhenTagUpdateFails(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	store := DBInit("testrouting.sqlite", MockLoganne{})
+	defer store.DB.Close()
+	_, err := store.DB.Exec(`CREATE TRIGGER "fail_last_play" BEFORE INSERT ON "tag" WHEN NEW."predicateid" = 'lastSuccessfulPlay' BEGIN
+		SELECT RAISE(ABORT, 'tag write failed');
+	END`)
+	if err != nil {
+		test.Fatal(err)
+	}
+	_, err = store.recordPlayEvent(PlayEventV3{TrackID: 1, Type: "play", Timestamp: "2026-03-01T09:00:00Z"})
+	if err == nil {
+		test.Fatal("Expected the failed tag write to fail the play event")
+	}
+	makeRequest(test, "GET", "/v3/plays", "", 200, `{"plays":0,"skips":0,"errors":0,"skipRate":0}`, true)
+
+	_, err = store.DB.Exec(`DROP TRIGGER "fail_last_play"`)
+	if err != nil {
+		test.Fatal(err)
+	}
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-01T09:00:00Z"}`, 201)
+	makeRequest(test, "GET", "/v3/plays", "", 200, `{"plays":1,"skips":0,"errors":0,"skipRate":0}`, true)
+	assertEqual(test, "Derived tag not updated", "2026-03-01T09:00:00Z", getTagValueByID(test, "1", "lastSuccessfulPlay"))
+}
+
+// TestPlayEventValidation checks invalid event types, timestamps and tracks are rejected.
+func TestPlayEventValidation(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	makeRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"pause"}`, 400, `{"error":"Play event \"type\" must be one of \"play\", \"skip\" or \"error\"","code":"bad_request"}`, true)
+	makeRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"yesterday"}`, 400, `{"error":"Play event \"timestamp\" must be in RFC3339 format","code":"bad_request"}`, true)
+	makeRequest(test, "POST", "/v3/tracks/2/plays", `{"type":"play"}`, 404, `{"error":"Track Not Found","code":"not_found"}`, true)
+	makeRequestWithUnallowedMethod(test, "/v3/tracks/1/plays", "PUT", []string{"GET", "POST"})
+}
+
+// TestPlayEventHistoryAndStats checks GET /v3/tracks/{id}/plays lists events most recent first with windowed stats.
+func TestPlayEventHistoryAndStats(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-01T09:00:00Z","client":"a"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"skip","timestamp":"2026-03-02T09:00:00Z","client":"a"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-03T09:00:00Z","client":"a"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-04T09:00:00Z","client":"a"}`, 201)
+
+	makeRequest(test, "GET", "/v3/tracks/1/plays?since=2026-03-02T00:00:00Z&until=2026-03-04T00:00:00Z", "", 200, `{
+		"events":[
+			{"id":3,"trackId":1,"type":"play","client":"a","timestamp":"2026-03-03T09:00:00Z"},
+			{"id":2,"trackId":1,"type":"skip","client":"a","timestamp":"2026-03-02T09:00:00Z"}
+		],
+		"stats":{"plays":1,"skips":1,"errors":0,"skipRate":0.5},
+		"totalPages":1,"page":1,"totalEvents":2
+	}`, true)
+	makeRequest(test, "GET", "/v3/tracks/1/plays?since=notadate", "", 400, `{"error":"The since and until parameters must be in RFC3339 format","code":"bad_request"}`, true)
+	makeRequest(test, "GET", "/v3/tracks/2/plays", "", 404, `{"error":"Track Not Found","code":"not_found"}`, true)
+}
+
+// TestPlaysLibraryStatsAndTop checks the library-wide /v3/plays and /v3/plays/top endpoints.
+func TestPlaysLibraryStatsAndTop(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	createPlayTestTrack(test, "2")
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play","timestamp":"2026-03-01T09:00:00Z"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/2/plays", `{"type":"play","timestamp":"2026-03-01T10:00:00Z"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/2/plays", `{"type":"play","timestamp":"2026-03-01T11:00:00Z"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/2/plays", `{"type":"skip","timestamp":"2026-03-01T12:00:00Z"}`, 201)
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"error","timestamp":"2026-03-01T13:00:00Z"}`, 201)
+
+	makeRequest(test, "GET", "/v3/plays", "", 200, `{"plays":3,"skips":1,"errors":1,"skipRate":0.25}`, true)
+	makeRequest(test, "GET", "/v3/plays?until=2026-03-01T10:30:00Z", "", 200, `{"plays":2,"skips":0,"errors":0,"skipRate":0}`, true)
+
+	request := basicRequest(test, "GET", "/v3/plays/top", "")
+	resp, _ := doRawRequest(test, request)
+	var top TopTracksV3
+	json.NewDecoder(resp.Body).Decode(&top)
+	if len(top.Tracks) != 2 {
+		test.Fatalf("Expected 2 top tracks, got %d", len(top.Tracks))
+	}
+	assertEqual(test, "Most played track", 2, top.Tracks[0].Track.ID)
+	assertEqual(test, "Most played count", 2, top.Tracks[0].Stats.Plays)
+	assertEqual(test, "Second most played track", 1, top.Tracks[1].Track.ID)
+
+	makeRequest(test, "GET", "/v3/plays/top?limit=0", "", 400, `{"error":"The limit parameter must be a number between 1 and 100","code":"bad_request"}`, true)
+	makeRequestWithUnallowedMethod(test, "/v3/plays", "POST", []string{"GET"})
+}
+
+// TestDeleteTrackWithPlayEvents checks a track with logged plays can still be deleted.
+func TestDeleteTrackWithPlayEvents(test *testing.T) {
+	clearData()
+	createPlayTestTrack(test, "1")
+	setupRequest(test, "POST", "/v3/tracks/1/plays", `{"type":"play"}`, 201)
+	makeRequest(test, "DELETE", "/v3/tracks/1", "", 204, "", false)
+	makeRequest(test, "GET", "/v3/plays", "", 200, `{"plays":0,"skips":0,"errors":0,"skipRate":0}`, true)
+}
+
+// getTagValueByID returns the first value of a predicate on a track, fetched via the v3 API.
+func getTagValueByID(test *testing.T, trackid string, predicate string) string {
+	request := basicRequest(test, "GET", "/v3/tracks/"+trackid, "")
+	resp, _ := doRawRequest(test, request)
+	var track TrackV3
+	json.NewDecoder(resp.Body).Decode(&track)
+	if len(track.Tags[predicate]) == 0 {
+		return ""
+	}
+	return track.Tags[predicate][0].Name
+}
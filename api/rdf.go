@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -9,7 +10,10 @@ import (
 	"lucos_media_metadata_api/rdfgen"
 )
 
-// RDFHandler serves the RDF file specified by RDF_OUTPUT_PATH.
+// RDFHandler serves the bulk export published alongside RDF_OUTPUT_PATH,
+// in whichever of its formats the Accept header prefers.
+// The ETag is taken from the data version the export was made from, and Last-Modified
+// from when the file was published, so http.ServeFile can answer conditional requests.
 func RDFHandler(w http.ResponseWriter, r *http.Request) {
 	rdfPath := os.Getenv("RDF_OUTPUT_PATH")
 	if rdfPath == "" {
@@ -17,22 +21,63 @@ func RDFHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Pick content type based on extension
-	ext := filepath.Ext(rdfPath)
-	var contentType string
-	switch ext {
-	case ".ttl":
-		contentType = "text/turtle"
-	case ".rdf", ".xml":
-		contentType = "application/rdf+xml"
-	case ".jsonld":
-		contentType = "application/ld+json"
-	default:
-		contentType = "application/octet-stream"
+	format := preferredExportFormat(r)
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", format.MIME+"; charset=utf-8")
+	if manifest, err := rdfgen.ReadManifest(rdfPath); err == nil && manifest.Version > 0 {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d%s"`, manifest.Version, format.Extension))
 	}
+	http.ServeFile(w, r, rdfgen.ExportPath(rdfPath, format))
+}
 
-	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
-	http.ServeFile(w, r, rdfPath)
+// RDFExportFilesHandler serves the files published alongside the bulk export:
+// its manifest at /v2/export/manifest, its dataset description at /v2/export/dataset
+// in whichever format the Accept header prefers, and each delta file listed in the
+// manifest under /v2/export/deltas/.
+func RDFExportFilesHandler(w http.ResponseWriter, r *http.Request) {
+	rdfPath := os.Getenv("RDF_OUTPUT_PATH")
+	if rdfPath == "" {
+		http.Error(w, "RDF_OUTPUT_PATH not set", http.StatusInternalServerError)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/v2/export/")
+	if name == "manifest" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		http.ServeFile(w, r, rdfgen.ManifestPath(rdfPath))
+		return
+	}
+	if name == "dataset" {
+		format := preferredExportFormat(r)
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("Content-Type", format.MIME+"; charset=utf-8")
+		http.ServeFile(w, r, rdfgen.DatasetPath(rdfPath, format))
+		return
+	}
+	if delta, found := strings.CutPrefix(name, "deltas/"); found {
+		manifest, _ := rdfgen.ReadManifest(rdfPath)
+		for _, listed := range manifest.Deltas {
+			if delta == listed.Added || delta == listed.Removed {
+				w.Header().Set("Content-Type", "application/n-triples; charset=utf-8")
+				http.ServeFile(w, r, filepath.Join(filepath.Dir(rdfPath), delta))
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// preferredExportFormat returns the first of the bulk export's formats listed in the
+// Accept header, in the same way as prefersRDF.  Defaults to Turtle if none are listed.
+func preferredExportFormat(r *http.Request) rdfgen.ExportFormat {
+	for _, p := range strings.Split(r.Header.Get("Accept"), ",") {
+		mime := strings.TrimSpace(strings.Split(p, ";")[0]) // ignore any ;q=
+		for _, format := range rdfgen.ExportFormats {
+			if format.MIME == mime {
+				return format
+			}
+		}
+	}
+	return rdfgen.ExportFormats[0]
 }
 
 func OntologyHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,6 +38,158 @@ func TestRDFHandler_ServesFile(t *testing.T) {
 	}
 }
 
+// TestRDFHandler_NegotiatesFormat checks the export is served in the first of its formats
+// listed in the Accept header, from the file published for that format.
+func TestRDFHandler_NegotiatesFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	for extension, content := range map[string]string{
+		".ttl":    "turtle",
+		".nt":     "ntriples",
+		".jsonld": "jsonld",
+		".rdf":    "rdfxml",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, "export"+extension), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write temp RDF file: %v", err)
+		}
+	}
+	os.Setenv("RDF_OUTPUT_PATH", filepath.Join(tempDir, "export.ttl"))
+	defer os.Unsetenv("RDF_OUTPUT_PATH")
+
+	tests := []struct {
+		acceptHeader string
+		wantMime     string
+		wantBody     string
+	}{
+		{"", "text/turtle", "turtle"},
+		{"application/n-triples", "application/n-triples", "ntriples"},
+		{"application/json, application/ld+json;q=0.9", "application/ld+json", "jsonld"},
+		{"application/rdf+xml, text/turtle", "application/rdf+xml", "rdfxml"},
+		{"text/html", "text/turtle", "turtle"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v2/export", nil)
+		if tc.acceptHeader != "" {
+			req.Header.Set("Accept", tc.acceptHeader)
+		}
+		rr := httptest.NewRecorder()
+
+		RDFHandler(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Accept %q: expected status 200, got %d", tc.acceptHeader, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.wantMime) {
+			t.Errorf("Accept %q: expected Content-Type %s, got %s", tc.acceptHeader, tc.wantMime, ct)
+		}
+		if rr.Body.String() != tc.wantBody {
+			t.Errorf("Accept %q: expected body %q, got %q", tc.acceptHeader, tc.wantBody, rr.Body.String())
+		}
+		if vary := rr.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Accept %q: expected Vary: Accept, got %q", tc.acceptHeader, vary)
+		}
+	}
+}
+
+// TestRDFHandler_ConditionalRequests checks the export's ETag comes from the data version in
+// its manifest, and a request with a matching If-None-Match gets a 304 Not Modified.
+func TestRDFHandler_ConditionalRequests(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "export.ttl"), []byte("turtle"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.nt"), []byte("ntriples"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.manifest.json"), []byte(`{"version": 7, "deltas": []}`), 0644)
+	os.Setenv("RDF_OUTPUT_PATH", filepath.Join(tempDir, "export.ttl"))
+	defer os.Unsetenv("RDF_OUTPUT_PATH")
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/export", nil)
+	rr := httptest.NewRecorder()
+	RDFHandler(rr, req)
+	if etag := rr.Header().Get("ETag"); etag != `"7.ttl"` {
+		t.Errorf("expected ETag \"7.ttl\", got %q", etag)
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("expected a Last-Modified header")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/export", nil)
+	req.Header.Set("Accept", "application/n-triples")
+	rr = httptest.NewRecorder()
+	RDFHandler(rr, req)
+	if etag := rr.Header().Get("ETag"); etag != `"7.nt"` {
+		t.Errorf("expected ETag \"7.nt\" for N-Triples, got %q", etag)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/export", nil)
+	req.Header.Set("If-None-Match", `"7.ttl"`)
+	rr = httptest.NewRecorder()
+	RDFHandler(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching If-None-Match, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/export", nil)
+	req.Header.Set("If-None-Match", `"6.ttl"`)
+	rr = httptest.NewRecorder()
+	RDFHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for a stale If-None-Match, got %d", rr.Code)
+	}
+}
+
+// TestRDFExportFilesHandler checks the manifest and the delta files it lists are served,
+// but not other files alongside the export.
+func TestRDFExportFilesHandler(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "export.ttl"), []byte("turtle"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.delta-1-2.added.nt"), []byte("added"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.dataset.ttl"), []byte("dataset turtle"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.dataset.nt"), []byte("dataset n-triples"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "export.manifest.json"), []byte(`{"version": 2, "deltas": [{"from": 1, "to": 2, "added": "export.delta-1-2.added.nt", "removed": "export.delta-1-2.removed.nt"}]}`), 0644)
+	os.Setenv("RDF_OUTPUT_PATH", filepath.Join(tempDir, "export.ttl"))
+	defer os.Unsetenv("RDF_OUTPUT_PATH")
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantMime string
+		wantBody string
+	}{
+		{"/v2/export/manifest", http.StatusOK, "application/json", `"version": 2`},
+		{"/v2/export/deltas/export.delta-1-2.added.nt", http.StatusOK, "application/n-triples", "added"},
+		{"/v2/export/deltas/export.ttl", http.StatusNotFound, "", ""},
+		{"/v2/export/deltas/../export.ttl", http.StatusNotFound, "", ""},
+		{"/v2/export/other", http.StatusNotFound, "", ""},
+		{"/v2/export/dataset", http.StatusOK, "text/turtle", "dataset turtle"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		rr := httptest.NewRecorder()
+
+		RDFExportFilesHandler(rr, req)
+
+		if rr.Code != tc.wantCode {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.wantCode, rr.Code)
+			continue
+		}
+		if ct := rr.Header().Get("Content-Type"); tc.wantMime != "" && !strings.HasPrefix(ct, tc.wantMime) {
+			t.Errorf("%s: expected Content-Type %s, got %s", tc.path, tc.wantMime, ct)
+		}
+		if !strings.Contains(rr.Body.String(), tc.wantBody) {
+			t.Errorf("%s: expected body containing %q, got %q", tc.path, tc.wantBody, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/export/dataset", nil)
+	req.Header.Set("Accept", "application/n-triples")
+	rr := httptest.NewRecorder()
+	RDFExportFilesHandler(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "dataset n-triples" {
+		t.Errorf("expected the N-Triples dataset description, got %d %q", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/n-triples") {
+		t.Errorf("expected Content-Type application/n-triples, got %s", ct)
+	}
+}
+
 func TestRDFHandler_NoEnvSet(t *testing.T) {
 	os.Unsetenv("RDF_OUTPUT_PATH")
 	req := httptest.NewRequest(http.MethodGet, "/rdf", nil)
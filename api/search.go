@@ -14,13 +14,11 @@ type SearchResult struct {
 }
 
 /**
- * Searches for tracks based on a map of predicates and their values, and/or a map of predicates and their URIs.
- *
+ * Builds a query selecting the tracks which match a map of predicates and their values, and/or a map of predicates and their URIs.
+ * The query uses ? placeholders and can be used as a subquery (it has no ORDER BY or LIMIT).
  */
-func (store Datastore) searchByPredicates(predicates map[string]string, uriPredicates map[string]string, offset int, limit int) (tracks []Track, totalTracks int, err error) {
-	tracks = []Track{}
-	dbQuery := "SELECT id, url, fingerprint, duration, weighting FROM track"
-	var values []interface{}
+func buildPredicateSearchQuery(predicates map[string]string, uriPredicates map[string]string) (dbQuery string, values []interface{}) {
+	dbQuery = "SELECT id, url, fingerprint, duration, weighting FROM track"
 	var whereClauses []string
 	tagCount := 0
 	for key, value := range predicates {
@@ -45,11 +43,17 @@ func (store Datastore) searchByPredicates(predicates map[string]string, uriPredi
 	if len(whereClauses) > 0 {
 		dbQuery += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
-	countQuery := dbQuery
-	dbQuery += " ORDER BY id LIMIT ?, ?"
-	values = append(values, offset, limit)
+	return
+}
 
-	err = store.DB.Select(&tracks, dbQuery, values...)
+/**
+ * Searches for tracks based on a map of predicates and their values, and/or a map of predicates and their URIs.
+ *
+ */
+func (store Datastore) searchByPredicates(predicates map[string]string, uriPredicates map[string]string, offset int, limit int) (tracks []Track, totalTracks int, err error) {
+	tracks = []Track{}
+	dbQuery, values := buildPredicateSearchQuery(predicates, uriPredicates)
+	err = store.DB.Select(&tracks, dbQuery+" ORDER BY id LIMIT ?, ?", append(values, offset, limit)...)
 	if err != nil {
 		return
 	}
@@ -61,12 +65,11 @@ func (store Datastore) searchByPredicates(predicates map[string]string, uriPredi
 		if err != nil {
 			return
 		}
-		collections, err := store.getCollectionsByTrack(track.ID)
-		if err != nil {
-			return tracks, totalTracks, err
-		}
-		track.Collections = &collections
 	}
-	err = store.DB.Get(&totalTracks, "SELECT COUNT(*) FROM ("+countQuery+")", values...)
+	err = store.addCollectionsToTracks(tracks)
+	if err != nil {
+		return
+	}
+	err = store.DB.Get(&totalTracks, "SELECT COUNT(*) FROM ("+dbQuery+")", values...)
 	return
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"lucos_media_metadata_api/rdfgen"
+	"lucos_media_metadata_api/sparql"
+)
+
+// sparqlTimeout is how long a /sparql query may run before it's abandoned.
+var sparqlTimeout = 30 * time.Second
+
+// sparqlMaxQueryLength is the largest query accepted in a POST body, in bytes.
+const sparqlMaxQueryLength = 1 << 20
+
+// sparqlSnapshot is the graph /sparql queries are evaluated against, and the data
+// version it was built from.
+type sparqlSnapshot struct {
+	version int64
+	graph   *sparql.Graph
+}
+
+// sparqlBuild is a rebuild of the graph, which queries needing it wait on.  graph and err
+// are set once done is closed.
+type sparqlBuild struct {
+	version int64
+	done    chan struct{}
+	graph   *sparql.Graph
+	err     error
+}
+
+// currentSparqlGraph returns the library as a graph of the triples rdfgen exports,
+// rebuilding it if anything has been written since it was last built.
+// The rebuild happens in the background, so if the context is done before it finishes,
+// the context's error is returned but the rebuild carries on for later queries to use.
+func (store Datastore) currentSparqlGraph(ctx context.Context) (*sparql.Graph, error) {
+	var version int64
+	if err := store.DB.GetContext(ctx, &version, "SELECT version FROM data_version WHERE id = 1"); err != nil {
+		return nil, err
+	}
+	for {
+		if snapshot := store.sparqlGraph.Load(); snapshot != nil && snapshot.version >= version {
+			return snapshot.graph, nil
+		}
+		build := store.startSparqlGraphBuild(version)
+		select {
+		case <-build.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A rebuild already in progress may be of an older version, so go round again
+		if build.err != nil {
+			return nil, build.err
+		}
+	}
+}
+
+// startSparqlGraphBuild returns the rebuild of the graph in progress, or starts one of the
+// given version if there isn't one.
+func (store Datastore) startSparqlGraphBuild(version int64) *sparqlBuild {
+	store.sparqlGraphLock.Lock()
+	defer store.sparqlGraphLock.Unlock()
+	if build := store.sparqlGraphBuild.Load(); build != nil {
+		return build
+	}
+	build := &sparqlBuild{version: version, done: make(chan struct{})}
+	store.sparqlGraphBuild.Store(build)
+	go func() {
+		start := time.Now()
+		graph := sparql.NewGraph()
+		if build.err = rdfgen.WriteGraph(store.DB.DB, graph.AddTriple); build.err == nil {
+			build.graph = graph
+			// A query which read the version before the last rebuild finished may have asked for an older one
+			if snapshot := store.sparqlGraph.Load(); snapshot == nil || snapshot.version < build.version {
+				store.sparqlGraph.Store(&sparqlSnapshot{version: build.version, graph: graph})
+			}
+			slog.Info("Built SPARQL graph", "version", build.version, "triples", graph.Len(), "duration", time.Since(start))
+		}
+		store.sparqlGraphBuild.Store(nil)
+		close(build.done)
+	}()
+	return build
+}
+
+// SparqlController evaluates read-only SPARQL queries against the library, as exported
+// by rdfgen, following the SPARQL 1.1 Protocol.
+//
+//	GET  /sparql?query=…  — the query in the query string
+//	POST /sparql          — the query as a form-encoded query parameter, or as the
+//	                        body with Content-Type application/sparql-query
+//
+// SELECT and ASK results are returned as SPARQL JSON, or SELECT results as CSV if the
+// Accept header prefers text/csv.  CONSTRUCT results are returned in whichever of the
+// bulk export's formats the Accept header prefers.
+func (store Datastore) SparqlController(w http.ResponseWriter, r *http.Request) {
+	var query string
+	switch r.Method {
+	case "GET":
+		query = r.URL.Query().Get("query")
+	case "POST":
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		r.Body = http.MaxBytesReader(w, r.Body, sparqlMaxQueryLength)
+		switch mediaType {
+		case "application/sparql-query":
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeV3ErrorResponse(w, http.StatusBadRequest, "Failed to read query: "+err.Error(), "bad_request")
+				return
+			}
+			query = string(body)
+		case "application/x-www-form-urlencoded":
+			if err := r.ParseForm(); err != nil {
+				writeV3ErrorResponse(w, http.StatusBadRequest, "Failed to read query: "+err.Error(), "bad_request")
+				return
+			}
+			query = r.PostForm.Get("query")
+		default:
+			writeV3ErrorResponse(w, http.StatusUnsupportedMediaType, "Queries must be posted as application/sparql-query or application/x-www-form-urlencoded", "unsupported_media_type")
+			return
+		}
+	default:
+		MethodNotAllowed(w, []string{"GET", "POST"})
+		return
+	}
+	if strings.TrimSpace(query) == "" {
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Missing query", "bad_request")
+		return
+	}
+
+	parsed, err := sparql.Parse(query)
+	if err != nil {
+		writeV3ErrorResponse(w, http.StatusBadRequest, err.Error(), "malformed_query")
+		return
+	}
+	// The timeout covers waiting for the graph to be rebuilt, as well as evaluation
+	ctx, cancel := context.WithTimeout(r.Context(), sparqlTimeout)
+	defer cancel()
+	graph, err := store.currentSparqlGraph(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeV3ErrorResponse(w, http.StatusServiceUnavailable, fmt.Sprintf("Graph wasn't rebuilt within %s", sparqlTimeout), "query_timeout")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to build SPARQL graph", slog.Any("error", err))
+		writeV3ErrorResponse(w, http.StatusInternalServerError, "Failed to build graph: "+err.Error(), "internal_error")
+		return
+	}
+	results, err := parsed.Evaluate(ctx, graph)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeV3ErrorResponse(w, http.StatusServiceUnavailable, fmt.Sprintf("Query didn't finish within %s", sparqlTimeout), "query_timeout")
+		return
+	}
+	if errors.Is(err, sparql.ErrTooManySolutions) {
+		writeV3ErrorResponse(w, http.StatusBadRequest, "Query matches too much of the library: "+err.Error(), "too_many_solutions")
+		return
+	}
+	if err != nil {
+		writeV3ErrorResponse(w, http.StatusInternalServerError, err.Error(), "internal_error")
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, no-store, must-revalidate")
+	switch {
+	case results.Form == sparql.ConstructQuery:
+		format := preferredExportFormat(r)
+		w.Header().Set("Content-Type", format.MIME+"; charset=utf-8")
+		err = rdfgen.SerializeGraph(results.Graph(), w, format.MIME)
+	case results.Form == sparql.SelectQuery && prefersCSV(r):
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = results.WriteCSV(w)
+	default:
+		w.Header().Set("Content-Type", "application/sparql-results+json; charset=utf-8")
+		err = results.WriteJSON(w)
+	}
+	if err != nil {
+		slog.Error("Failed to write SPARQL results", slog.Any("error", err))
+	}
+}
+
+// prefersCSV reports whether the Accept header lists CSV before any JSON type, in the
+// same way as prefersRDF.
+func prefersCSV(r *http.Request) bool {
+	for _, p := range strings.Split(r.Header.Get("Accept"), ",") {
+		switch strings.TrimSpace(strings.Split(p, ";")[0]) { // ignore any ;q=
+		case "text/csv":
+			return true
+		case "application/sparql-results+json", "application/json":
+			return false
+		}
+	}
+	return false
+}
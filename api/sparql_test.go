@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"lucos_media_metadata_api/sparql"
+)
+
+const sparqlPrefixes = "PREFIX mo: <http://purl.org/ontology/mo/> PREFIX skos: <http://www.w3.org/2004/02/skos/core#> "
+
+// sparqlRequest makes a request to /sparql, returning the response and its body.
+func sparqlRequest(test *testing.T, request *http.Request) (*http.Response, string) {
+	test.Helper()
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response, string(body)
+}
+
+// sparqlGet makes a GET request to /sparql with the given query and Accept header.
+func sparqlGet(test *testing.T, query string, accept string) (*http.Response, string) {
+	test.Helper()
+	request := basicRequest(test, "GET", "/sparql?query="+url.QueryEscape(query), "")
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	return sparqlRequest(test, request)
+}
+
+// setupSparqlTracks creates tracks with the given titles.  APP_ORIGIN is set as the
+// graph is built by rdfgen, which needs it for ontology URIs.
+func setupSparqlTracks(test *testing.T, titles ...string) {
+	test.Setenv("APP_ORIGIN", "http://localhost:3002")
+	for i, title := range titles {
+		setupMergeTrack(test, i+1, `"title":[{"name":"`+title+`"}]`)
+	}
+}
+
+func TestSparqlSelect(test *testing.T) {
+	clearData()
+	setupSparqlTracks(test, "Yesterday", "Help!")
+	response, body := sparqlGet(test, sparqlPrefixes+`SELECT ?track ?title WHERE { ?track a mo:Track ; skos:prefLabel ?title } ORDER BY ?title`, "")
+	assertEqual(test, "Status", 200, response.StatusCode)
+	assertEqual(test, "Content-Type", "application/sparql-results+json; charset=utf-8", response.Header.Get("Content-Type"))
+	expected := `{"head": {"vars": ["track", "title"]}, "results": {"bindings": [
+		{"track": {"type": "uri", "value": "/tracks/2"}, "title": {"type": "literal", "value": "Help!"}},
+		{"track": {"type": "uri", "value": "/tracks/1"}, "title": {"type": "literal", "value": "Yesterday"}}
+	]}}`
+	if equal, err := AreEqualJSON(expected, body); err != nil || !equal {
+		test.Errorf("Unexpected SPARQL results %s, expected %s", body, expected)
+	}
+}
+
+func TestSparqlPostedQueries(test *testing.T) {
+	clearData()
+	setupSparqlTracks(test, "Yesterday", "Help!")
+	query := sparqlPrefixes + `SELECT ?title WHERE { ?track a mo:Track ; skos:prefLabel ?title FILTER(regex(?title, "^h", "i")) }`
+
+	request := basicRequest(test, "POST", "/sparql", query)
+	request.Header.Set("Content-Type", "application/sparql-query")
+	request.Header.Set("Accept", "text/csv, application/sparql-results+json;q=0.9")
+	response, body := sparqlRequest(test, request)
+	assertEqual(test, "Direct POST status", 200, response.StatusCode)
+	assertEqual(test, "Direct POST Content-Type", "text/csv; charset=utf-8", response.Header.Get("Content-Type"))
+	assertEqual(test, "Direct POST CSV", "title\r\nHelp!\r\n", body)
+
+	request = basicRequest(test, "POST", "/sparql", url.Values{"query": {query}}.Encode())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, body = sparqlRequest(test, request)
+	assertEqual(test, "Form POST status", 200, response.StatusCode)
+	if !strings.Contains(body, `"value":"Help!"`) || strings.Contains(body, "Yesterday") {
+		test.Errorf("Unexpected results for form POST: %s", body)
+	}
+
+	request = basicRequest(test, "POST", "/sparql", query)
+	request.Header.Set("Content-Type", "text/plain")
+	response, _ = sparqlRequest(test, request)
+	assertEqual(test, "Unsupported Content-Type status", 415, response.StatusCode)
+}
+
+func TestSparqlAskAndConstruct(test *testing.T) {
+	clearData()
+	setupSparqlTracks(test, "Yesterday")
+	response, body := sparqlGet(test, sparqlPrefixes+`ASK { ?track skos:prefLabel "Yesterday" }`, "text/csv")
+	assertEqual(test, "ASK status", 200, response.StatusCode)
+	assertEqual(test, "ASK Content-Type", "application/sparql-results+json; charset=utf-8", response.Header.Get("Content-Type"))
+	var ask struct{ Boolean bool }
+	json.Unmarshal([]byte(body), &ask)
+	assertEqual(test, "ASK result", true, ask.Boolean)
+
+	response, body = sparqlGet(test, sparqlPrefixes+`CONSTRUCT { ?track <http://purl.org/dc/terms/title> ?title } WHERE { ?track a mo:Track ; skos:prefLabel ?title }`, "application/n-triples")
+	assertEqual(test, "CONSTRUCT status", 200, response.StatusCode)
+	assertEqual(test, "CONSTRUCT Content-Type", "application/n-triples; charset=utf-8", response.Header.Get("Content-Type"))
+	assertEqual(test, "CONSTRUCT N-Triples", "</tracks/1> <http://purl.org/dc/terms/title> \"Yesterday\" .\n", body)
+}
+
+// TestSparqlSeesWrites checks the graph queries run against is rebuilt after a write.
+func TestSparqlSeesWrites(test *testing.T) {
+	clearData()
+	setupSparqlTracks(test, "Yesterday")
+	query := sparqlPrefixes + `SELECT ?title WHERE { ?track a mo:Track ; skos:prefLabel ?title }`
+	_, body := sparqlGet(test, query, "text/csv")
+	assertEqual(test, "Results before write", "title\r\nYesterday\r\n", body)
+
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"title":[{"name":"Tomorrow"}]}}`, 200)
+	_, body = sparqlGet(test, query, "text/csv")
+	assertEqual(test, "Results after write", "title\r\nTomorrow\r\n", body)
+}
+
+func TestSparqlErrors(test *testing.T) {
+	clearData()
+	setupSparqlTracks(test, "Yesterday", "Help!")
+	makeRequest(test, "GET", "/sparql", "", 400, `{"error":"Missing query","code":"bad_request"}`, true)
+	makeRequestWithUnallowedMethod(test, "/sparql", "PUT", []string{"GET", "POST"})
+
+	response, body := sparqlGet(test, `SELECT ?s WHERE { ?s ?p ?o`, "")
+	assertEqual(test, "Malformed query status", 400, response.StatusCode)
+	if !strings.Contains(body, `"code":"malformed_query"`) || !strings.Contains(body, "syntax error") {
+		test.Errorf("Unexpected body for malformed query: %s", body)
+	}
+
+	defer func(max int) { sparql.MaxSolutions = max }(sparql.MaxSolutions)
+	sparql.MaxSolutions = 10
+	response, body = sparqlGet(test, `SELECT * WHERE { ?s ?p ?o } LIMIT 1`, "")
+	assertEqual(test, "Too many solutions status", 400, response.StatusCode)
+	if !strings.Contains(body, `"code":"too_many_solutions"`) {
+		test.Errorf("Unexpected body for query with too many solutions: %s", body)
+	}
+
+	defer func(timeout time.Duration) { sparqlTimeout = timeout }(sparqlTimeout)
+	sparqlTimeout = time.Nanosecond
+	response, body = sparqlGet(test, `SELECT * WHERE { ?a ?b ?c . ?d ?e ?f . ?g ?h ?i }`, "")
+	assertEqual(test, "Timed out query status", 503, response.StatusCode)
+	if !strings.Contains(body, `"code":"query_timeout"`) {
+		test.Errorf("Unexpected body for timed out query: %s", body)
+	}
+}
+
+// TestSparqlGraphRebuildDoesntBlockTimeout checks a query waiting for the graph to be
+// rebuilt gives up when its context is done, and later queries get the rebuilt graph.
+func TestSparqlGraphRebuildDoesntBlockTimeout(test *testing.T) {
+	test.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbpath := "testsparqlrebuild.sqlite"
+	os.Remove(dbpath)
+	datastore := DBInit(dbpath, MockLoganne{})
+	defer os.Remove(dbpath)
+	datastore.DB.MustExec(`INSERT INTO track(id, url, fingerprint, duration) VALUES(1, 'http://example.com/t1', 'fp1', 100)`)
+
+	// Stands in for a slow rebuild already in progress
+	slow := &sparqlBuild{done: make(chan struct{})}
+	datastore.sparqlGraphBuild.Store(slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := datastore.currentSparqlGraph(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		test.Errorf("Expected waiting for the rebuild to time out, got %v", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		test.Errorf("Waited %s for the rebuild, despite the timeout", waited)
+	}
+
+	// Once the slow rebuild is done, it's rebuilt again, as it was of an older version
+	datastore.sparqlGraphBuild.Store(nil)
+	close(slow.done)
+	graph, err := datastore.currentSparqlGraph(context.Background())
+	if err != nil || graph.Len() == 0 {
+		test.Errorf("Expected the rebuilt graph, got %v, %v", graph, err)
+	}
+}
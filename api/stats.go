@@ -0,0 +1,266 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"lucos_media_metadata_api/predicateconfig"
+)
+
+// statsValuePredicates lists the predicates for which /v3/stats/values breaks down
+// track counts by value. Limited to controlled-vocabulary and entity predicates,
+// where grouping by value is meaningful (freetext predicates like title would just
+// produce one row per track).
+var statsValuePredicates = []string{"language", "provenance", "availability", "album", "artist"}
+
+// StatsSnapshot holds a point-in-time snapshot of all /v3/stats figures.
+// It is computed by refreshStats and served from StatsV3Controller.
+type StatsSnapshot struct {
+	GeneratedAt   string                    `json:"generatedAt"`
+	TotalTracks   int                       `json:"totalTracks"`
+	TotalDuration int                       `json:"totalDuration"`
+	Values        map[string][]ValueCountV3 `json:"values"`
+	Coverage      []PredicateCoverageV3     `json:"coverage"`
+	Collections   []CollectionStatsV3       `json:"collections"`
+	Weighting     WeightingStatsV3          `json:"weighting"`
+}
+
+// ValueCountV3 is the number of tracks carrying a given value of a predicate.
+type ValueCountV3 struct {
+	Name   string `json:"name" db:"value"`
+	URI    string `json:"uri,omitempty" db:"uri"`
+	Tracks int    `json:"tracks" db:"tracks"`
+}
+
+// PredicateCoverageV3 is the number (and proportion) of tracks with at least one value for a predicate.
+type PredicateCoverageV3 struct {
+	Predicate  string  `json:"predicate" db:"predicateid"`
+	Tracks     int     `json:"tracks" db:"tracks"`
+	Proportion float64 `json:"proportion"`
+}
+
+// CollectionStatsV3 is the size and total duration (in seconds) of a collection.
+type CollectionStatsV3 struct {
+	Slug     string `json:"slug" db:"slug"`
+	Name     string `json:"name" db:"name"`
+	Tracks   int    `json:"tracks" db:"tracks"`
+	Duration int    `json:"duration" db:"duration"`
+}
+
+// WeightingStatsV3 describes the distribution of track weightings.
+// Buckets group non-zero weightings by their integer part; zero-weighted tracks
+// (which are never picked at random) are counted separately.
+type WeightingStatsV3 struct {
+	Zero    int                 `json:"zero"`
+	Min     float64             `json:"min"`
+	Max     float64             `json:"max"`
+	Mean    float64             `json:"mean"`
+	Buckets []WeightingBucketV3 `json:"buckets"`
+}
+
+// WeightingBucketV3 counts tracks whose weighting is in [From, To).
+type WeightingBucketV3 struct {
+	From   int `json:"from" db:"bucket"`
+	To     int `json:"to"`
+	Tracks int `json:"tracks" db:"tracks"`
+}
+
+// refreshStats recomputes all /v3/stats figures and stores the result in the statsCache.
+// On failure the previous cached values are preserved and a warning is logged.
+func (store Datastore) refreshStats() {
+	snapshot, err := store.computeStats()
+	if err != nil {
+		slog.Warn("/v3/stats refresh failed — keeping previous cached values", slog.Any("error", err))
+		return
+	}
+	store.statsCache.Store(&snapshot)
+}
+
+// computeStats runs the aggregate queries behind /v3/stats.
+// Each figure is a single GROUP BY over the tag, track or collection tables.
+func (store Datastore) computeStats() (snapshot StatsSnapshot, err error) {
+	snapshot.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	err = store.DB.Get(&snapshot.TotalTracks, "SELECT COUNT(*) FROM track")
+	if err != nil {
+		return
+	}
+	err = store.DB.Get(&snapshot.TotalDuration, "SELECT IFNULL(SUM(duration), 0) FROM track")
+	if err != nil {
+		return
+	}
+
+	// Track counts by value for each of the breakdown predicates.
+	type valueRow struct {
+		PredicateID string `db:"predicateid"`
+		ValueCountV3
+	}
+	query, args, err := sqlx.In(`SELECT predicateid, value, IFNULL(uri, '') AS uri, COUNT(DISTINCT trackid) AS tracks
+		FROM tag WHERE predicateid IN (?)
+		GROUP BY predicateid, value, uri
+		ORDER BY predicateid, tracks DESC, value`, statsValuePredicates)
+	if err != nil {
+		return
+	}
+	var valueRows []valueRow
+	err = store.DB.Select(&valueRows, store.DB.Rebind(query), args...)
+	if err != nil {
+		return
+	}
+	snapshot.Values = make(map[string][]ValueCountV3, len(statsValuePredicates))
+	for _, predicate := range statsValuePredicates {
+		snapshot.Values[predicate] = []ValueCountV3{}
+	}
+	for _, row := range valueRows {
+		snapshot.Values[row.PredicateID] = append(snapshot.Values[row.PredicateID], row.ValueCountV3)
+	}
+
+	// Coverage for every predicate in use, plus registered predicates with no tags at all.
+	var coverage []PredicateCoverageV3
+	err = store.DB.Select(&coverage, "SELECT predicateid, COUNT(DISTINCT trackid) AS tracks FROM tag GROUP BY predicateid")
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool, len(coverage))
+	for _, c := range coverage {
+		seen[c.Predicate] = true
+	}
+	for predicate := range predicateconfig.All() {
+		if !seen[predicate] {
+			coverage = append(coverage, PredicateCoverageV3{Predicate: predicate})
+		}
+	}
+	for i := range coverage {
+		if snapshot.TotalTracks > 0 {
+			coverage[i].Proportion = float64(coverage[i].Tracks) / float64(snapshot.TotalTracks)
+		}
+	}
+	sort.Slice(coverage, func(i, j int) bool { return coverage[i].Predicate < coverage[j].Predicate })
+	snapshot.Coverage = coverage
+
+	// Static collections are counted in one grouped query.  Smart and composed collections
+	// don't use collection_track, so only their membership is evaluated separately.
+	var collectionRows []struct {
+		CollectionStatsV3
+		Dynamic bool `db:"dynamic"`
+	}
+	err = store.DB.Select(&collectionRows, `SELECT collection.slug, collection.name,
+		COUNT(track.id) AS tracks, IFNULL(SUM(track.duration), 0) AS duration,
+		(collection.query IS NOT NULL OR collection.operation IS NOT NULL) AS dynamic
+		FROM collection
+		LEFT JOIN collection_track ON collection_track.collectionslug = collection.slug
+		LEFT JOIN track ON collection_track.trackid = track.id
+		GROUP BY collection.slug
+		ORDER BY collection.name`)
+	if err != nil {
+		return
+	}
+	snapshot.Collections = make([]CollectionStatsV3, 0, len(collectionRows))
+	for _, row := range collectionRows {
+		stats := row.CollectionStatsV3
+		if row.Dynamic {
+			var collection Collection
+			collection, err = store.getBasicCollection(stats.Slug)
+			if err != nil {
+				return
+			}
+			membership, values, queryErr := store.membershipQuery(collection)
+			if queryErr != nil {
+				err = queryErr
+				return
+			}
+			err = store.DB.QueryRow("SELECT COUNT(*), IFNULL(SUM(duration), 0) FROM ("+membership+")", values...).Scan(&stats.Tracks, &stats.Duration)
+			if err != nil {
+				return
+			}
+		}
+		snapshot.Collections = append(snapshot.Collections, stats)
+	}
+
+	snapshot.Weighting, err = store.computeWeightingStats()
+	return
+}
+
+// computeWeightingStats summarises the distribution of track weightings.
+func (store Datastore) computeWeightingStats() (stats WeightingStatsV3, err error) {
+	err = store.DB.Get(&stats.Zero, "SELECT COUNT(*) FROM track WHERE weighting <= 0")
+	if err != nil {
+		return
+	}
+	summary := struct {
+		Min  float64 `db:"min"`
+		Max  float64 `db:"max"`
+		Mean float64 `db:"mean"`
+	}{}
+	err = store.DB.Get(&summary, "SELECT IFNULL(MIN(weighting), 0) AS min, IFNULL(MAX(weighting), 0) AS max, IFNULL(AVG(weighting), 0) AS mean FROM track")
+	if err != nil {
+		return
+	}
+	stats.Min, stats.Max, stats.Mean = summary.Min, summary.Max, summary.Mean
+	stats.Buckets = []WeightingBucketV3{}
+	err = store.DB.Select(&stats.Buckets, "SELECT CAST(weighting AS INTEGER) AS bucket, COUNT(*) AS tracks FROM track WHERE weighting > 0 GROUP BY bucket ORDER BY bucket")
+	for i := range stats.Buckets {
+		stats.Buckets[i].To = stats.Buckets[i].From + 1
+	}
+	return
+}
+
+// StatsV3Controller handles all requests to /v3/stats endpoints.
+//
+//	GET /v3/stats              — the full snapshot
+//	GET /v3/stats/values       — track counts by value for language, provenance, availability, album and artist
+//	GET /v3/stats/values/{p}   — track counts by value for a single one of those predicates
+//	GET /v3/stats/coverage     — how many tracks have each predicate
+//	GET /v3/stats/collections  — collection sizes and total durations
+//	GET /v3/stats/weighting    — weighting distribution
+//
+// Figures are served from a cache refreshed in the background, so may be a few minutes old;
+// generatedAt in the full snapshot records when they were computed.
+func (store Datastore) StatsV3Controller(w http.ResponseWriter, r *http.Request) {
+	normalisedpath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v3/stats"), "/")
+	pathparts := strings.Split(normalisedpath, "/")
+
+	slog.Debug("Stats v3 controller", "method", r.Method, "pathparts", pathparts)
+
+	if r.Method != "GET" {
+		MethodNotAllowed(w, []string{"GET"})
+		return
+	}
+	snapshot := store.statsCache.Load()
+	if snapshot == nil {
+		// Cache not yet populated (first request or test environment) — compute synchronously.
+		store.refreshStats()
+		snapshot = store.statsCache.Load()
+	}
+	if snapshot == nil {
+		writeV3ErrorResponse(w, http.StatusServiceUnavailable, "Statistics unavailable", "unavailable")
+		return
+	}
+
+	if len(pathparts) <= 1 {
+		writeJSONResponse(w, snapshot, nil)
+		return
+	}
+	switch pathparts[1] {
+	case "values":
+		if len(pathparts) == 2 {
+			writeJSONResponse(w, snapshot.Values, nil)
+		} else if values, ok := snapshot.Values[pathparts[2]]; ok && len(pathparts) == 3 {
+			writeJSONResponse(w, values, nil)
+		} else {
+			writeV3ErrorResponse(w, http.StatusNotFound, "Statistics are only available for predicates "+strings.Join(statsValuePredicates, ", "), "not_found")
+		}
+	case "coverage":
+		writeJSONResponse(w, snapshot.Coverage, nil)
+	case "collections":
+		writeJSONResponse(w, snapshot.Collections, nil)
+	case "weighting":
+		writeJSONResponse(w, snapshot.Weighting, nil)
+	default:
+		writeV3ErrorResponse(w, http.StatusNotFound, "Stats Endpoint Not Found", "not_found")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// setupStatsData creates three tracks with a mix of languages, weightings and collection membership.
+func setupStatsData(test *testing.T) {
+	setupRequest(test, "PUT", "/v3/tracks/1", `{"fingerprint":"stats1","url":"http://example.org/stats/1","duration":100,"tags":{"title":[{"name":"One"}],"language":[{"name":"English","uri":"https://eolas.l42.eu/metadata/language/en/"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/tracks/2", `{"fingerprint":"stats2","url":"http://example.org/stats/2","duration":200,"tags":{"title":[{"name":"Two"}],"language":[{"name":"English","uri":"https://eolas.l42.eu/metadata/language/en/"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/tracks/3", `{"fingerprint":"stats3","url":"http://example.org/stats/3","duration":300,"tags":{"title":[{"name":"Three"}],"language":[{"name":"French","uri":"https://eolas.l42.eu/metadata/language/fr/"}]}}`, 200)
+	setupRequest(test, "PUT", "/v3/tracks/1/weighting", "0.5", 200)
+	setupRequest(test, "PUT", "/v3/tracks/2/weighting", "4.3", 200)
+	setupRequest(test, "PUT", "/v3/tracks/3/weighting", "0", 200)
+	setupRequest(test, "PUT", "/v3/collections/long", `{"name":"Long Ones"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/long/2", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/long/3", "", 200)
+	setupRequest(test, "PUT", "/v3/collections/empty", `{"name":"Empty"}`, 200)
+}
+
+// TestStatsValues checks track counts grouped by predicate value.
+func TestStatsValues(test *testing.T) {
+	clearData()
+	setupStatsData(test)
+	makeRequest(test, "GET", "/v3/stats/values/language", "", 200, `[
+		{"name":"English","uri":"https://eolas.l42.eu/metadata/language/en/","tracks":2},
+		{"name":"French","uri":"https://eolas.l42.eu/metadata/language/fr/","tracks":1}
+	]`, true)
+	makeRequest(test, "GET", "/v3/stats/values/provenance", "", 200, `[]`, true)
+	makeRequest(test, "GET", "/v3/stats/values/title", "", 404, `{"error":"Statistics are only available for predicates language, provenance, availability, album, artist","code":"not_found"}`, true)
+}
+
+// TestStatsCollections checks collection sizes and total durations, including empty,
+// smart and composed collections.
+func TestStatsCollections(test *testing.T) {
+	clearData()
+	setupStatsData(test)
+	setupRequest(test, "PUT", "/v3/collections/english", `{"name":"English","query":"p.language.uri=https://eolas.l42.eu/metadata/language/en/"}`, 200)
+	setupRequest(test, "PUT", "/v3/collections/everything", `{"name":"Everything","compose":{"operation":"union","collections":["english","long"]}}`, 200)
+	makeRequest(test, "GET", "/v3/stats/collections", "", 200, `[
+		{"slug":"empty","name":"Empty","tracks":0,"duration":0},
+		{"slug":"english","name":"English","tracks":2,"duration":300},
+		{"slug":"everything","name":"Everything","tracks":3,"duration":600},
+		{"slug":"long","name":"Long Ones","tracks":2,"duration":500}
+	]`, true)
+}
+
+// TestStatsWeighting checks the weighting distribution buckets and summary.
+func TestStatsWeighting(test *testing.T) {
+	clearData()
+	setupStatsData(test)
+	request := basicRequest(test, "GET", "/v3/stats/weighting", "")
+	resp, _ := doRawRequest(test, request)
+	var weighting WeightingStatsV3
+	json.NewDecoder(resp.Body).Decode(&weighting)
+	assertEqual(test, "Zero-weighted tracks", 1, weighting.Zero)
+	assertEqual(test, "Max weighting", 4.3, weighting.Max)
+	assertEqual(test, "Bucket count", 2, len(weighting.Buckets))
+	assertEqual(test, "First bucket", WeightingBucketV3{From: 0, To: 1, Tracks: 1}, weighting.Buckets[0])
+	assertEqual(test, "Second bucket", WeightingBucketV3{From: 4, To: 5, Tracks: 1}, weighting.Buckets[1])
+}
+
+// TestStatsSnapshot checks the full snapshot totals and per-predicate coverage.
+func TestStatsSnapshot(test *testing.T) {
+	clearData()
+	setupStatsData(test)
+	setupRequest(test, "PATCH", "/v3/tracks/1", `{"tags":{"composer":[{"name":"Someone"}]}}`, 200)
+	request := basicRequest(test, "GET", "/v3/stats", "")
+	resp, _ := doRawRequest(test, request)
+	var snapshot StatsSnapshot
+	json.NewDecoder(resp.Body).Decode(&snapshot)
+	assertEqual(test, "Total tracks", 3, snapshot.TotalTracks)
+	assertEqual(test, "Total duration", 600, snapshot.TotalDuration)
+	coverage := map[string]PredicateCoverageV3{}
+	for _, c := range snapshot.Coverage {
+		coverage[c.Predicate] = c
+	}
+	assertEqual(test, "Title coverage", 3, coverage["title"].Tracks)
+	assertEqual(test, "Composer coverage", 1, coverage["composer"].Tracks)
+	assertEqual(test, "Composer proportion", 1.0/3.0, coverage["composer"].Proportion)
+	if _, ok := coverage["mbid_recording"]; !ok {
+		test.Error("Expected registered predicates without any tags to appear in coverage")
+	}
+	makeRequestWithUnallowedMethod(test, "/v3/stats", "POST", []string{"GET"})
+	makeRequest(test, "GET", "/v3/stats/unknown", "", 404, `{"error":"Stats Endpoint Not Found","code":"not_found"}`, true)
+}
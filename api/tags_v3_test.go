@@ -196,3 +196,53 @@ func TestTagValueV3IncludesURI(t *testing.T) {
 	assertEqual(t, "name", "English", raw["name"].(string))
 	assertEqual(t, "uri", "https://eolas.l42.eu/metadata/language/en/", raw["uri"].(string))
 }
+
+// TestV3MBIDTagsStoreMusicBrainzURI checks MusicBrainz ID tags are stored with their
+// MusicBrainz URI, whether written as a bare ID, a URI or a MusicBrainz URL.
+func TestV3MBIDTagsStoreMusicBrainzURI(t *testing.T) {
+	clearData()
+	mbid := "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"
+	makeRequest(t, "PUT", "/v3/tracks/1", `{"fingerprint":"v3mbid1","url":"http://example.org/v3tag/mbid/1","duration":200,"tags":{
+		"added":[{"name":"2024-01-01"}],
+		"mbid_artist":[{"name":"`+mbid+`"}],
+		"mbid_recording":[{"uri":"https://musicbrainz.org/recording/`+mbid+`"}],
+		"mbid_release":[{"name":"http://www.musicbrainz.org/release/`+mbid+`/"}]
+	}}`, 200, `{"fingerprint":"v3mbid1","duration":200,"url":"http://example.org/v3tag/mbid/1","id":1,"tags":{
+		"added":[{"name":"2024-01-01"}],
+		"mbid_artist":[{"name":"`+mbid+`","uri":"https://musicbrainz.org/artist/`+mbid+`"}],
+		"mbid_recording":[{"name":"`+mbid+`","uri":"https://musicbrainz.org/recording/`+mbid+`"}],
+		"mbid_release":[{"name":"`+mbid+`","uri":"https://musicbrainz.org/release/`+mbid+`"}]
+	},"weighting":0,"collections":[]}`, true)
+
+	request := basicRequest(t, "GET", "/v3/tracks?p.mbid_release.uri="+url.QueryEscape("https://musicbrainz.org/release/"+mbid), "")
+	resp, _ := doRawRequest(t, request)
+	var result SearchResultV3
+	json.NewDecoder(resp.Body).Decode(&result)
+	if len(result.Tracks) != 1 || result.Tracks[0].ID != 1 {
+		t.Errorf("Expected track 1 for p.mbid_release.uri, got %+v", result.Tracks)
+	}
+}
+
+// TestV3RejectsInvalidMBIDTags checks MusicBrainz ID tags must be a MusicBrainz ID, with
+// a matching URI on musicbrainz.org.
+func TestV3RejectsInvalidMBIDTags(t *testing.T) {
+	mbid := "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"
+	for _, tags := range []string{
+		`{"mbid_artist":[{"name":"The Beatles"}]}`,
+		`{"mbid_artist":[{"uri":"https://example.org/artist/` + mbid + `"}]}`,
+		`{"mbid_artist":[{"uri":"https://musicbrainz.org/release/` + mbid + `"}]}`,
+		`{"mbid_artist":[{"name":"` + mbid + `","uri":"https://musicbrainz.org/artist/0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a"}]}`,
+	} {
+		clearData()
+		req := basicRequest(t, "PUT", "/v3/tracks/1", `{"fingerprint":"v3mbid2","url":"http://example.org/v3tag/mbid/2","duration":200,"tags":`+tags+`}`)
+		resp, _ := doRawRequest(t, req)
+		if resp.StatusCode != 400 {
+			t.Errorf("Expected 400 for %s, got %d", tags, resp.StatusCode)
+		}
+		var errResp V3Error
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		if errResp.Code != "invalid_tag_value" || errResp.Predicate != "mbid_artist" {
+			t.Errorf("Expected invalid_tag_value for mbid_artist, got %+v", errResp)
+		}
+	}
+}
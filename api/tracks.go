@@ -221,6 +221,16 @@ func (store Datastore) updateCreateTrackDataByField(filterField string, value in
 	slog.Info("update/create track", "filterField", filterField, "value", value)
 	storedTrack = existingTrack
 
+	// Work out collection changes before writing anything, so adding the track to a smart or
+	// composed collection is rejected without leaving the rest of the update half done.
+	var addSlugs, removeSlugs []string
+	if track.Collections != nil {
+		addSlugs, removeSlugs, err = store.collectionMembershipChanges(existingTrack.Collections, *track.Collections)
+		if err != nil {
+			return
+		}
+	}
+
 	// Apply scalar field updates.
 	updateFields := []string{}
 	if track.Duration != 0 {
@@ -265,43 +275,16 @@ func (store Datastore) updateCreateTrackDataByField(filterField string, value in
 	}
 
 	// Sync collection membership to match the requested list.
-	if track.Collections != nil {
-		if existingTrack.Collections != nil {
-			for _, existingCollection := range *existingTrack.Collections {
-				remove := true
-				for _, newCollection := range *track.Collections {
-					if existingCollection.Slug == newCollection.Slug {
-						remove = false
-					}
-				}
-				if remove {
-					err = store.removeTrackFromCollection(existingCollection.Slug, storedTrack.ID)
-					if err != nil {
-						return
-					}
-				}
-			}
-			for _, newCollection := range *track.Collections {
-				add := true
-				for _, existingCollection := range *existingTrack.Collections {
-					if existingCollection.Slug == newCollection.Slug {
-						add = false
-					}
-				}
-				if add {
-					err = store.addTrackToCollection(newCollection.Slug, storedTrack.ID)
-					if err != nil {
-						return
-					}
-				}
-			}
-		} else {
-			for _, newCollection := range *track.Collections {
-				err = store.addTrackToCollection(newCollection.Slug, storedTrack.ID)
-				if err != nil {
-					return
-				}
-			}
+	for _, slug := range removeSlugs {
+		err = store.removeTrackFromCollection(slug, storedTrack.ID)
+		if err != nil {
+			return
+		}
+	}
+	for _, slug := range addSlugs {
+		err = store.addTrackToCollection(slug, storedTrack.ID)
+		if err != nil {
+			return
 		}
 	}
 
@@ -342,6 +325,20 @@ func (store Datastore) updateCreateTrackDataByField(filterField string, value in
  *
  */
 func (store Datastore) getTrackDataByField(field string, value interface{}) (track Track, err error) {
+	track, err = store.getTrackWithTagsByField(field, value)
+	if err != nil {
+		return
+	}
+	collections, err := store.getCollectionsByTrack(track.ID)
+	track.Collections = &collections
+	return
+}
+
+/**
+ * Gets data about a track and its tags, without its collections.
+ * For listing several tracks, whose collections can then be added together by addCollectionsToTracks.
+ */
+func (store Datastore) getTrackWithTagsByField(field string, value interface{}) (track Track, err error) {
 	track = Track{}
 	err = store.DB.Get(&track, "SELECT id, url, fingerprint, duration, weighting FROM track WHERE "+field+"=$1", value)
 	if err != nil {
@@ -351,11 +348,6 @@ func (store Datastore) getTrackDataByField(field string, value interface{}) (tra
 		return
 	}
 	track.Tags, err = store.getAllTagsForTrack(track.ID)
-	if err != nil {
-		return
-	}
-	collections, err := store.getCollectionsByTrack(track.ID)
-	track.Collections = &collections
 	return
 }
 
@@ -538,6 +530,10 @@ func (store Datastore) deleteTrack(trackid int) (err error) {
 	if (err != nil) {
 		return
 	}
+	_, err = store.DB.Exec("DELETE FROM play_event WHERE trackid=$1", trackid)
+	if (err != nil) {
+		return
+	}
 
 	// Loop through each collection and remove separately, so that cum_weightings get updated appropriately
 	collections, err := store.getCollectionsByTrack(trackid)
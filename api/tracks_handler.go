@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -28,6 +29,29 @@ func (e *URIOriginValidationError) Error() string {
 	return e.Reason
 }
 
+// TagValueValidationError is returned when a tag value fails its predicate's
+// ValidateValue check (e.g. a track_number which isn't a positive integer).
+type TagValueValidationError struct {
+	Predicate string
+	Reason    string
+}
+
+func (e *TagValueValidationError) Error() string {
+	return e.Reason
+}
+
+// AmbiguousNameError is returned when a tag value's name matches more than one
+// entity and nothing else about the track picks between them.
+type AmbiguousNameError struct {
+	Predicate string
+	Name      string
+	URIs      []string
+}
+
+func (e *AmbiguousNameError) Error() string {
+	return fmt.Sprintf("%q matches more than one %s (%s); give a uri to pick one", e.Name, e.Predicate, strings.Join(e.URIs, ", "))
+}
+
 // TrackV3 is the v3 wire representation of a track.
 // Tags use the structured format: each predicate maps to an array of {name, uri} objects.
 // Uses "id" instead of "trackid" per ADR §7.
@@ -104,6 +128,16 @@ func writeV3Error(w http.ResponseWriter, err error) {
 		writeV3TagValidationError(w, uriOriginErr.Predicate, uriOriginErr.Reason)
 		return
 	}
+	var valueErr *TagValueValidationError
+	if errors.As(err, &valueErr) {
+		writeV3TagValidationError(w, valueErr.Predicate, valueErr.Reason)
+		return
+	}
+	var ambiguousErr *AmbiguousNameError
+	if errors.As(err, &ambiguousErr) {
+		writeV3TagValidationError(w, ambiguousErr.Predicate, ambiguousErr.Error())
+		return
+	}
 	msg := err.Error()
 	if strings.HasSuffix(msg, " Not Found") {
 		writeV3ErrorResponse(w, http.StatusNotFound, msg, "not_found")
@@ -152,22 +186,39 @@ func DecodeTrackV3(r io.Reader) (TrackV3, error) {
 
 // resolveTagValue applies the full per-value normalisation pipeline for a single
 // v3 tag value before it is written to the database:
-//  1. name→URI resolution (ResolveNameToURI) — fills v.URI from v.Name when configured.
-//  2. URI→name backfill (ResolveURIToName) — fills v.Name from v.URI when configured.
+//  0. identifier normalisation (NormaliseIdentifier) — for predicates with a URIPrefix
+//     (MusicBrainz IDs), derives the name and URI from each other, accepting a full URI
+//     as the name, and rejects a URI which doesn't match the name.
+//  1. value validation (ValidateValue) — rejects names the predicate doesn't allow,
+//     such as a track_number which isn't a positive integer.
+//  2. name→URI resolution (ResolveNameToURI) — fills v.URI from v.Name when configured,
+//     given hints from the track's other tags (see tagHints).
+//  3. URI→name backfill (ResolveURIToName) — fills v.Name from v.URI when configured.
 //     Failures are non-fatal when BestEffortURIToName is set; the name is left empty
 //     and the daily reconcileTagNames job will backfill it later.
-//  3. URI validation (RequiresURI, ValidateURIOrigin) — rejects values that lack a
+//  4. URI validation (RequiresURI, ValidateURIOrigin) — rejects values that lack a
 //     required URI or whose URI doesn't start with an allowed origin.
-func resolveTagValue(store Datastore, predicate string, config predicateconfig.Config, v TagValueV3) (TagValueV3, error) {
-	// 1. Resolve name to URI if URI is absent.
+func resolveTagValue(store Datastore, predicate string, config predicateconfig.Config, v TagValueV3, hints predicateconfig.TagHints) (TagValueV3, error) {
+	// 0. Normalise identifiers, such as MusicBrainz IDs.
+	var reason string
+	if v.Name, v.URI, reason = config.NormaliseIdentifier(v.Name, v.URI); reason != "" {
+		return v, &URIOriginValidationError{Predicate: predicate, Reason: reason}
+	}
+	// 1. Validate the value itself.
+	if config.ValidateValue != nil {
+		if reason := config.ValidateValue(v.Name); reason != "" {
+			return v, &TagValueValidationError{Predicate: predicate, Reason: reason}
+		}
+	}
+	// 2. Resolve name to URI if URI is absent.
 	if config.ResolveNameToURI != nil && v.URI == "" && v.Name != "" {
-		uri, err := config.ResolveNameToURI(store, v.Name)
+		uri, err := config.ResolveNameToURI(store, v.Name, hints)
 		if err != nil {
 			return v, fmt.Errorf("could not resolve %q for predicate %q: %w", v.Name, predicate, err)
 		}
 		v.URI = uri
 	}
-	// 2. Backfill name from URI if name is absent.
+	// 3. Backfill name from URI if name is absent.
 	// For predicates with BestEffortURIToName (e.g. composer, producer), failures
 	// are non-fatal: the URI is stored and the daily reconcileTagNames job backfills
 	// the name once the upstream service (eolas) recovers. The URI is already present
@@ -187,7 +238,7 @@ func resolveTagValue(store Datastore, predicate string, config predicateconfig.C
 			v.Name = name
 		}
 	}
-	// 3. Validate URI constraints.
+	// 4. Validate URI constraints.
 	if config.RequiresURI() {
 		if v.URI == "" {
 			return v, fmt.Errorf("predicate %q requires a URI", predicate)
@@ -199,6 +250,28 @@ func resolveTagValue(store Datastore, predicate string, config predicateconfig.C
 	return v, nil
 }
 
+// tagHints gathers a track's values for the predicates in config.HintPredicates,
+// which ResolveNameToURI uses to tell apart entities sharing a name. Values in
+// the write request take precedence over those already stored.
+func (store Datastore) tagHints(trackid int, tags map[string][]TagValueV3, config predicateconfig.Config) (hints predicateconfig.TagHints, err error) {
+	hints = make(predicateconfig.TagHints, len(config.HintPredicates))
+	for _, predicate := range config.HintPredicates {
+		values, requested := tags[predicate]
+		if !requested {
+			err = store.DB.Select(&values, "SELECT value AS name, IFNULL(uri, '') AS uri FROM tag WHERE trackid = $1 AND predicateid = $2", trackid, predicate)
+			if err != nil {
+				return
+			}
+		}
+		hintConfig := predicateconfig.GetConfig(predicate)
+		for _, v := range values {
+			name, uri, _ := hintConfig.NormaliseIdentifier(v.Name, v.URI)
+			hints[predicate] = append(hints[predicate], predicateconfig.TagHint{Name: name, URI: uri})
+		}
+	}
+	return
+}
+
 // updateTagsV3 updates tags for a track using the v3 multi-value semantics.
 // For each predicate in the map, all existing values are replaced with the
 // provided array. Empty arrays delete the predicate's tags.
@@ -228,9 +301,13 @@ func (store Datastore) updateTagsV3(trackid int, tags map[string][]TagValueV3) (
 			return
 		}
 		config := predicateconfig.GetConfig(predicate)
+		var hints predicateconfig.TagHints
+		if hints, err = store.tagHints(trackid, tags, config); err != nil {
+			return
+		}
 		resolved := make([]TagValueV3, 0, len(nonEmpty))
 		for _, v := range nonEmpty {
-			v, err = resolveTagValue(store, predicate, config, v)
+			v, err = resolveTagValue(store, predicate, config, v, hints)
 			if err != nil {
 				return
 			}
@@ -348,9 +425,13 @@ func (store Datastore) updateTagsV3IfMissing(trackid int, tags map[string][]TagV
 				continue
 			}
 			config := predicateconfig.GetConfig(predicate)
+			var hints predicateconfig.TagHints
+			if hints, err = store.tagHints(trackid, tags, config); err != nil {
+				return
+			}
 			resolved := make([]TagValueV3, 0, len(nonEmpty))
 			for _, v := range nonEmpty {
-				v, err = resolveTagValue(store, predicate, config, v)
+				v, err = resolveTagValue(store, predicate, config, v, hints)
 				if err != nil {
 					return
 				}
@@ -475,6 +556,8 @@ func (store Datastore) TracksV3Controller(w http.ResponseWriter, r *http.Request
 			default:
 				MethodNotAllowed(w, []string{"GET", "PUT"})
 			}
+		case "plays":
+			store.trackPlaysHandler(w, r, trackid)
 		default:
 			writeV3ErrorResponse(w, http.StatusNotFound, "Track Endpoint Not Found", "not_found")
 		}
@@ -707,21 +790,13 @@ func trackV3ToInternal(v3 TrackV3) Track {
 	}
 }
 
-// queryMultipleTracksV3 parses predicate filters from request query parameters and returns matching tracks with pagination data.
-func queryMultipleTracksV3(store Datastore, r *http.Request) (tracks []Track, totalPages int, totalTracks int, page int, err error) {
-	standardLimit := 20
-	rawPage := r.URL.Query().Get("page")
-	page, parseErr := strconv.Atoi(rawPage)
-	if parseErr != nil || page < 1 {
-		page = 1
-	}
-	if rawPage == "all" {
-		page = 1
-	}
-
-	predicates := make(map[string]string)
-	uriPredicates := make(map[string]string)
-	for key, value := range r.URL.Query() {
+// parsePredicateFilters extracts p. filters from a set of query parameters.
+// "p.{predicate}=value" matches on tag value and "p.{predicate}.uri=uri" on tag URI;
+// other parameters are ignored.
+func parsePredicateFilters(query url.Values) (predicates map[string]string, uriPredicates map[string]string, err error) {
+	predicates = make(map[string]string)
+	uriPredicates = make(map[string]string)
+	for key, value := range query {
 		if strings.HasPrefix(key, "p.") {
 			predicateName := key[2:]
 			if strings.HasSuffix(predicateName, ".uri") {
@@ -736,6 +811,25 @@ func queryMultipleTracksV3(store Datastore, r *http.Request) (tracks []Track, to
 			}
 		}
 	}
+	return
+}
+
+// queryMultipleTracksV3 parses predicate filters from request query parameters and returns matching tracks with pagination data.
+func queryMultipleTracksV3(store Datastore, r *http.Request) (tracks []Track, totalPages int, totalTracks int, page int, err error) {
+	standardLimit := 20
+	rawPage := r.URL.Query().Get("page")
+	page, parseErr := strconv.Atoi(rawPage)
+	if parseErr != nil || page < 1 {
+		page = 1
+	}
+	if rawPage == "all" {
+		page = 1
+	}
+
+	predicates, uriPredicates, err := parsePredicateFilters(r.URL.Query())
+	if err != nil {
+		return
+	}
 	offset, limit := parsePageParam(rawPage, standardLimit)
 	tracks, totalTracks, err = store.searchByPredicates(predicates, uriPredicates, offset, limit)
 	totalPages = int(math.Ceil(float64(totalTracks) / float64(standardLimit)))
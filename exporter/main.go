@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -25,7 +26,10 @@ func main() {
 		log.Fatal("SCHEDULE_TRACKER_ENDPOINT must be set")
 	}
 
-	if err := rdfgen.ExportRDF(dbPath, outFile); err != nil {
+	err := rdfgen.ExportRDF(dbPath, outFile)
+	if errors.Is(err, rdfgen.ErrUnchanged) {
+		log.Printf("RDF export skipped: %v", err)
+	} else if err != nil {
 		scheduleTrackerData, _ := json.Marshal(map[string]interface{}{
 			"system":    "lucos_media_metadata_api",
 			"job_name":  "exporter",
@@ -35,9 +39,9 @@ func main() {
 		})
 		postToScheduleTracker(scheduleTracker, scheduleTrackerData)
 		log.Fatalf("failed to export RDF: %v", err)
+	} else {
+		log.Printf("RDF export written to %s", outFile)
 	}
-
-	log.Printf("RDF export written to %s", outFile)
 	scheduleTrackerData, _ := json.Marshal(map[string]interface{}{
 		"system":    "lucos_media_metadata_api",
 		"job_name":  "exporter",
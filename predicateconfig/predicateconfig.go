@@ -5,7 +5,10 @@ package predicateconfig
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -21,13 +24,6 @@ const (
 	// resource. Tags with an empty or nil URI are silently skipped in RDF output.
 	// Write validation rejects tags without a URI for these predicates.
 	ValueShapeURIObject
-	// ValueShapeMBIDPrefix — the tag's value column is appended to Config.URIPrefix
-	// to produce a full IRI resource (e.g. "https://musicbrainz.org/artist/" + value).
-	// Used for MusicBrainz ID predicates where the value is a bare UUID and the
-	// full URI is mechanically derivable. See per-predicate migration notes in #252
-	// for the possible long-term trajectory (D2: materialise the URI into tag.uri
-	// at write time and fold into ValueShapeURIObject).
-	ValueShapeMBIDPrefix
 )
 
 // NameURIResolver resolves names to URIs and vice versa for URI-object predicates
@@ -36,8 +32,9 @@ const (
 // call back into the database and external services without importing the api package.
 type NameURIResolver interface {
 	// ResolveOrCreateAlbumByName looks up or creates an album by name, returning
-	// its URI. Used exclusively by the album predicate.
-	ResolveOrCreateAlbumByName(name string) (string, error)
+	// its URI. Hints carry the track's artist, year and mbid_release tags, which
+	// pick between albums sharing a name. Used exclusively by the album predicate.
+	ResolveOrCreateAlbumByName(name string, hints TagHints) (string, error)
 	// ResolveAlbumNameFromURI looks up an album name from its URI.
 	// Used exclusively by the album predicate.
 	ResolveAlbumNameFromURI(uri string) (string, error)
@@ -55,6 +52,25 @@ type NameURIResolver interface {
 	ResolveEolasEntityName(uri string) (string, error)
 }
 
+// TagHint is one value of another tag on the track being written.
+type TagHint struct {
+	Name string
+	URI  string
+}
+
+// TagHints holds the values of a track's other tags, keyed by predicate, as given
+// to ResolveNameToURI. Only the predicates listed in Config.HintPredicates are included.
+type TagHints map[string][]TagHint
+
+// Values returns the names of all hints for a predicate.
+func (hints TagHints) Values(predicate string) []string {
+	values := make([]string, 0, len(hints[predicate]))
+	for _, hint := range hints[predicate] {
+		values = append(values, hint.Name)
+	}
+	return values
+}
+
 // Symbolic origin identifiers for use in Config.AllowedOrigins.
 // ValidateURIOrigin resolves these to actual base URLs at call time via os.Getenv.
 const (
@@ -63,8 +79,17 @@ const (
 	// OriginMediaMetadataAPI is used for predicates whose concept URIs are served by this service
 	// (e.g. SKOS concept schemes at {APP_ORIGIN}/vocab/{predicate}/{slug}).
 	OriginMediaMetadataAPI = "media_metadata_api"
+	// OriginMusicBrainz is used for MusicBrainz ID predicates.  Unlike the others, it's
+	// the same in every environment, so isn't read from an env var.
+	OriginMusicBrainz = "musicbrainz"
 )
 
+// musicBrainzOrigin is the base URL OriginMusicBrainz resolves to.
+const musicBrainzOrigin = "https://musicbrainz.org"
+
+// mbidPattern matches a MusicBrainz identifier, which is a lowercase UUID.
+var mbidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
 // Config holds the full configuration for a predicate, covering both its RDF shape
 // (used by rdfgen) and its runtime behaviour (used by the api write path, Loganne
 // event generation, and URI validation).
@@ -76,9 +101,10 @@ type Config struct {
 	// PredicateURI is the full RDF predicate IRI, or a "/" prefix relative to APP_ORIGIN.
 	PredicateURI string
 
-	// URIPrefix, when non-empty, is prepended to the tag's value column to produce the
-	// full object IRI. Only used by ValueShapeMBIDPrefix predicates.
-	// Example: URIPrefix="https://musicbrainz.org/artist/" + value="abc123" → IRI.
+	// URIPrefix, when non-empty, is what every URI of this predicate starts with; the
+	// rest of the URI is an identifier, which is stored as the tag's value (e.g. the
+	// MusicBrainz ID in "https://musicbrainz.org/artist/" + ID).  The write path derives
+	// each from the other with NormaliseIdentifier.  Only used by ValueShapeURIObject predicates.
 	URIPrefix string
 
 	// ValueShape indicates the RDF shape of this predicate's value.
@@ -86,6 +112,14 @@ type Config struct {
 	// tags without a URI are rejected by write validation. This drives RequiresURI().
 	ValueShape ValueShape
 
+	// Datatype, when non-empty, is the XSD datatype IRI given to this predicate's
+	// literals in RDF output (e.g. xsd:integer).  Only used by ValueShapeLiteral predicates.
+	Datatype string
+
+	// ValidateValue, if non-nil, checks a tag value before it is written.  Returns an
+	// empty string if the value is valid, otherwise a human-readable reason it isn't.
+	ValidateValue func(value string) string
+
 	// MultiValue indicates this predicate can have multiple values per track.
 	// When true, the database allows multiple tag rows for the same (trackid,
 	// predicateid) pair, and the v3 API serialises/deserialises the values as a
@@ -96,7 +130,12 @@ type Config struct {
 	// When a tag value has a name but no URI, the write path calls this to resolve
 	// (or create) the entity and populate the URI. Resolution happens before
 	// RequiresURI validation.
-	ResolveNameToURI func(NameURIResolver, string) (string, error)
+	ResolveNameToURI func(NameURIResolver, string, TagHints) (string, error)
+
+	// HintPredicates lists the other predicates whose values on the same track are
+	// passed to ResolveNameToURI, for entities which can share a name (e.g. albums
+	// called "Greatest Hits", told apart by artist, year or mbid_release).
+	HintPredicates []string
 
 	// ResolveURIToName, if non-nil, enables URI-to-name resolution. When a tag value
 	// has a URI but no name, the write path calls this to populate the name field
@@ -132,6 +171,41 @@ type Config struct {
 	// this predicate. Resolved to real URLs at validation time by ValidateURIOrigin.
 	// If all identifiers resolve to empty strings (env var unset), validation is skipped.
 	AllowedOrigins []string
+
+	// The remaining fields describe the predicate in the /ontology document, and are
+	// required for predicates defined there (those whose PredicateURI starts with
+	// "/ontology#").  Predicates from external vocabularies are described by those.
+
+	// Label is the property's English label, e.g. "Track Language".
+	Label string
+
+	// Comment is an English sentence or two explaining what the property means.
+	Comment string
+
+	// Range, when non-empty, is the IRI of the property's rdfs:range.  Required for
+	// URIObject predicates, except those with SKOS concepts, whose range is their
+	// concept scheme.  Literal predicates default to their Datatype, or xsd:string.
+	Range string
+
+	// Inverse, when non-empty, is the property declared owl:inverseOf this one: a local
+	// name in the ontology (e.g. "trackInLanguage"), or the IRI of an external property.
+	// InverseLabel is the inverse's English label, which consumers show on the object's page.
+	Inverse      string
+	InverseLabel string
+
+	// SubPropertyOf, when non-empty, is the ID of another predicate in the ontology which
+	// this one is a specialisation of (e.g. about is a stronger form of mentions).
+	SubPropertyOf string
+}
+
+// OntologyLocalName returns the name of a predicate within the /ontology document
+// (e.g. "trackLanguage"), or "" if it's from an external vocabulary.
+func (c Config) OntologyLocalName() string {
+	localName, _ := strings.CutPrefix(c.PredicateURI, "/ontology#")
+	if localName == c.PredicateURI {
+		return ""
+	}
+	return localName
 }
 
 // RequiresURI reports whether this predicate produces an IRI object in RDF output
@@ -140,6 +214,72 @@ func (c Config) RequiresURI() bool {
 	return c.ValueShape == ValueShapeURIObject
 }
 
+// ValidatePositiveInteger is a ValidateValue function accepting whole numbers of 1 or more
+// (e.g. track and disc numbers).
+func ValidatePositiveInteger(value string) string {
+	if number, err := strconv.Atoi(value); err != nil || number < 1 {
+		return fmt.Sprintf("value %q is not a positive integer", value)
+	}
+	return ""
+}
+
+// ValidateMBID is a ValidateValue function accepting MusicBrainz identifiers.
+func ValidateMBID(value string) string {
+	if !mbidPattern.MatchString(value) {
+		return fmt.Sprintf("value %q is not a MusicBrainz ID", value)
+	}
+	return ""
+}
+
+// NormaliseIdentifier fills in whichever of a tag value's name and URI is missing, for
+// predicates with a URIPrefix.  A URI given as the name is reduced to its identifier,
+// and URIs are made canonical, so "http://www.musicbrainz.org/artist/{id}/" is accepted
+// as either.  Returns a human-readable reason if the URI isn't one of this predicate's,
+// or doesn't match the name.  Other predicates' values are returned unchanged.
+func (c Config) NormaliseIdentifier(name string, uri string) (string, string, string) {
+	if c.URIPrefix == "" {
+		return name, uri, ""
+	}
+	name = strings.TrimSpace(name)
+	if identifier, ok := c.identifierInURI(name); ok {
+		name = identifier
+	}
+	if uri != "" {
+		identifier, ok := c.identifierInURI(uri)
+		if !ok {
+			return name, uri, fmt.Sprintf("uri %q does not start with %q", uri, c.URIPrefix)
+		}
+		if name == "" {
+			name = identifier
+		} else if !strings.EqualFold(name, identifier) {
+			return name, uri, fmt.Sprintf("uri %q does not match value %q", uri, name)
+		}
+	}
+	name = strings.ToLower(name)
+	if name != "" {
+		uri = c.URIPrefix + name
+	}
+	return name, uri, ""
+}
+
+// identifierInURI returns the identifier in a URI under URIPrefix, allowing for http
+// rather than https, a "www." host, a trailing slash, and a query or fragment.
+func (c Config) identifierInURI(uri string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", false
+	}
+	prefix, err := url.Parse(c.URIPrefix)
+	if err != nil || strings.TrimPrefix(strings.ToLower(parsed.Host), "www.") != prefix.Host {
+		return "", false
+	}
+	identifier, ok := strings.CutPrefix(strings.TrimSuffix(parsed.Path, "/"), prefix.Path)
+	if !ok || identifier == "" || strings.Contains(identifier, "/") {
+		return "", false
+	}
+	return identifier, true
+}
+
 // ValidateURIOrigin checks whether the given URI starts with one of the predicate's
 // AllowedOrigins. Returns an empty string if the URI is valid (or if no allowlist is
 // configured). Returns a human-readable error message if validation fails.
@@ -155,6 +295,7 @@ func (c Config) ValidateURIOrigin(uri string) string {
 		OriginEolas:                os.Getenv("EOLAS_ORIGIN"),
 		OriginMediaMetadataManager: os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN"),
 		OriginMediaMetadataAPI:     os.Getenv("APP_ORIGIN"),
+		OriginMusicBrainz:          musicBrainzOrigin,
 	}
 	validOrigins := make([]string, 0, len(c.AllowedOrigins))
 	for _, key := range c.AllowedOrigins {
@@ -76,3 +76,59 @@ func TestRequiresURIFalseForZeroValue(t *testing.T) {
 		t.Error("expected RequiresURI() false for zero-value Config (ValueShapeOmit is zero)")
 	}
 }
+
+func TestValidatePositiveInteger(t *testing.T) {
+	for _, value := range []string{"1", "12", "007"} {
+		if msg := ValidatePositiveInteger(value); msg != "" {
+			t.Errorf("expected %q to be valid, got: %q", value, msg)
+		}
+	}
+	for _, value := range []string{"", "0", "-3", "2/12", "A1", "1.5"} {
+		if msg := ValidatePositiveInteger(value); msg == "" {
+			t.Errorf("expected %q to be rejected, got empty string", value)
+		}
+	}
+}
+
+func TestValidateMBID(t *testing.T) {
+	if msg := ValidateMBID("b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"); msg != "" {
+		t.Errorf("expected a MusicBrainz ID to be valid, got: %q", msg)
+	}
+	for _, value := range []string{"", "b10bbbfc", "B10BBBFC-CF9E-42E0-BE17-E2C3E1D2600D", "https://musicbrainz.org/artist/b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"} {
+		if msg := ValidateMBID(value); msg == "" {
+			t.Errorf("expected %q to be rejected, got empty string", value)
+		}
+	}
+}
+
+func TestNormaliseIdentifier(t *testing.T) {
+	c := Config{URIPrefix: "https://musicbrainz.org/artist/"}
+	id := "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"
+	uri := "https://musicbrainz.org/artist/" + id
+	for _, input := range [][2]string{
+		{id, ""},
+		{"", uri},
+		{id, uri},
+		{" B10BBBFC-CF9E-42E0-BE17-E2C3E1D2600D ", ""},
+		{uri, ""},
+		{"http://www.musicbrainz.org/artist/" + id + "/?tab=releases", ""},
+		{"", "https://musicbrainz.org/artist/" + id + "#top"},
+	} {
+		name, normalisedURI, reason := c.NormaliseIdentifier(input[0], input[1])
+		if name != id || normalisedURI != uri || reason != "" {
+			t.Errorf("NormaliseIdentifier(%q, %q) = (%q, %q, %q), expected (%q, %q, \"\")", input[0], input[1], name, normalisedURI, reason, id, uri)
+		}
+	}
+	for _, input := range [][2]string{
+		{"", "https://musicbrainz.org/release/" + id},
+		{"", "https://example.org/artist/" + id},
+		{id, "https://musicbrainz.org/artist/0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a"},
+	} {
+		if _, _, reason := c.NormaliseIdentifier(input[0], input[1]); reason == "" {
+			t.Errorf("expected NormaliseIdentifier(%q, %q) to be rejected", input[0], input[1])
+		}
+	}
+	if name, uri, reason := (Config{}).NormaliseIdentifier(" Help! ", ""); name != " Help! " || uri != "" || reason != "" {
+		t.Errorf("expected a predicate without a URIPrefix to be left alone, got (%q, %q, %q)", name, uri, reason)
+	}
+}
@@ -3,21 +3,28 @@ package predicateconfig
 // registry holds the configuration for all known predicates.
 // Predicates not listed here use zero-value Config (single-value, Omit shape, default behaviour).
 var registry = map[string]Config{
-	// MBIDPrefix predicates — MusicBrainz IDs; full IRI = URIPrefix + value.
+	// MusicBrainz IDs — the value is the bare ID, and the uri the MusicBrainz URI,
+	// URIPrefix + value.  Either may be written, or a MusicBrainz URL given as the value.
 	"mbid_artist": {
-		ValueShape:   ValueShapeMBIDPrefix,
-		PredicateURI: "http://purl.org/dc/terms/creator",
-		URIPrefix:    "https://musicbrainz.org/artist/",
+		ValueShape:     ValueShapeURIObject,
+		PredicateURI:   "http://purl.org/dc/terms/creator",
+		URIPrefix:      "https://musicbrainz.org/artist/",
+		AllowedOrigins: []string{OriginMusicBrainz},
+		ValidateValue:  ValidateMBID,
 	},
 	"mbid_recording": {
-		ValueShape:   ValueShapeMBIDPrefix,
-		PredicateURI: "http://purl.org/dc/terms/identifier",
-		URIPrefix:    "https://musicbrainz.org/recording/",
+		ValueShape:     ValueShapeURIObject,
+		PredicateURI:   "http://purl.org/dc/terms/identifier",
+		URIPrefix:      "https://musicbrainz.org/recording/",
+		AllowedOrigins: []string{OriginMusicBrainz},
+		ValidateValue:  ValidateMBID,
 	},
 	"mbid_release": {
-		ValueShape:   ValueShapeMBIDPrefix,
-		PredicateURI: "http://purl.org/dc/terms/isPartOf",
-		URIPrefix:    "https://musicbrainz.org/release/",
+		ValueShape:     ValueShapeURIObject,
+		PredicateURI:   "http://purl.org/dc/terms/isPartOf",
+		URIPrefix:      "https://musicbrainz.org/release/",
+		AllowedOrigins: []string{OriginMusicBrainz},
+		ValidateValue:  ValidateMBID,
 	},
 
 	"artist": {
@@ -25,7 +32,7 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "http://xmlns.com/foaf/0.1/maker",
 		AllowedOrigins: []string{OriginMediaMetadataManager},
-		ResolveNameToURI: func(r NameURIResolver, name string) (string, error) {
+		ResolveNameToURI: func(r NameURIResolver, name string, _ TagHints) (string, error) {
 			return r.ResolveOrCreateArtistByName(name)
 		},
 		ResolveURIToName: func(r NameURIResolver, uri string) (string, error) {
@@ -38,7 +45,7 @@ var registry = map[string]Config{
 		PredicateURI:        "http://purl.org/ontology/mo/composer",
 		AllowedOrigins:      []string{OriginEolas},
 		BestEffortURIToName: true, // eolas may be temporarily unavailable; reconcile fills the name later
-		ResolveNameToURI: func(r NameURIResolver, name string) (string, error) {
+		ResolveNameToURI: func(r NameURIResolver, name string, _ TagHints) (string, error) {
 			return r.ResolveOrCreateEolasEntityByName("person", name)
 		},
 		ResolveURIToName: func(r NameURIResolver, uri string) (string, error) {
@@ -51,7 +58,7 @@ var registry = map[string]Config{
 		PredicateURI:        "http://purl.org/ontology/mo/producer",
 		AllowedOrigins:      []string{OriginEolas},
 		BestEffortURIToName: true, // eolas may be temporarily unavailable; reconcile fills the name later
-		ResolveNameToURI: func(r NameURIResolver, name string) (string, error) {
+		ResolveNameToURI: func(r NameURIResolver, name string, _ TagHints) (string, error) {
 			return r.ResolveOrCreateEolasEntityByName("person", name)
 		},
 		ResolveURIToName: func(r NameURIResolver, uri string) (string, error) {
@@ -61,41 +68,69 @@ var registry = map[string]Config{
 	// genre: no consumers, no vocabulary; dormant data left in place.
 	// When a genuine use case arrives, file a fresh design ticket.
 	"genre": {ValueShape: ValueShapeOmit},
+	// The range is eolas' language collection, as individual languages are its
+	// sub-resources (e.g. https://eolas.l42.eu/metadata/language/gd/).  The inverse is
+	// materialised by arachne, for "Tracks in this language" sections on Language pages.
 	"language": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#trackLanguage",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Track Language",
+		Comment:        "The language a track is performed in.",
+		Range:          "https://eolas.l42.eu/metadata/language/",
+		Inverse:        "trackInLanguage",
+		InverseLabel:   "Tracks in this language",
 	},
 	"offence": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#trigger",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Trigger (offence)",
+		Comment:        "Any potential triggers or offence covered by the track's subject matter.",
+		Range:          "https://eolas.l42.eu/ontology/Offence",
 	},
 	"about": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#about",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "About",
+		Comment:        "Concepts which are the primary topic of this track.",
+		Range:          "http://www.w3.org/2000/01/rdf-schema#Resource",
+		Inverse:        "subjectOf",
+		InverseLabel:   "Subject Of",
+		SubPropertyOf:  "mentions",
 	},
 	"mentions": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#mentions",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Mentions",
+		Comment:        "Concepts which are mentioned or alluded to by this track.",
+		Range:          "http://www.w3.org/2000/01/rdf-schema#Resource",
+		Inverse:        "mentionedBy",
+		InverseLabel:   "Mentioned By",
 	},
 	"theme_tune": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#theme_tune",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Theme tune",
+		Comment:        "Creative Work this track is the primary theme tune of.",
+		Range:          "https://eolas.l42.eu/ontology/CreativeWork",
 	},
 	"soundtrack": {
 		MultiValue:     true,
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#soundtrack",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Soundtrack",
+		Comment:        "Creative Work whose soundtrack this track appears in.",
+		Range:          "https://eolas.l42.eu/ontology/CreativeWork",
 	},
 	"provenance": {
 		ValueShape:     ValueShapeURIObject,
@@ -108,6 +143,8 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#availability",
 		AllowedOrigins: []string{OriginMediaMetadataAPI},
+		Label:          "Availability",
+		Comment:        "How easy it would be to replace this track if something happened to my collection.",
 		ResolveNameToURI: SKOSResolveNameToURI("availability"),
 		ResolveURIToName: SKOSResolveURIToName("availability"),
 	},
@@ -116,8 +153,14 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#onAlbum",
 		AllowedOrigins: []string{OriginMediaMetadataManager},
-		ResolveNameToURI: func(r NameURIResolver, name string) (string, error) {
-			return r.ResolveOrCreateAlbumByName(name)
+		HintPredicates: []string{"artist", "year", "mbid_release"},
+		Label:          "On Album",
+		Comment:        "The album the track appears on.",
+		Range:          "http://purl.org/ontology/mo/Record",
+		Inverse:        "http://purl.org/ontology/mo/track",
+		InverseLabel:   "Track",
+		ResolveNameToURI: func(r NameURIResolver, name string, hints TagHints) (string, error) {
+			return r.ResolveOrCreateAlbumByName(name, hints)
 		},
 		ResolveURIToName: func(r NameURIResolver, uri string) (string, error) {
 			return r.ResolveAlbumNameFromURI(uri)
@@ -129,6 +172,9 @@ var registry = map[string]Config{
 	"added": {
 		ValueShape:   ValueShapeLiteral,
 		PredicateURI: "/ontology#dateAdded",
+		Label:        "Date added",
+		Comment:      "The date the track was added to the collection.",
+		Range:        "http://www.w3.org/2001/XMLSchema#dateTime",
 	},
 	// Uses skos:prefLabel for consistency with other items in the triplestore.
 	// Might be useful to also add a dc:title predicate in future.
@@ -157,11 +203,30 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#memory",
 		AllowedOrigins: []string{OriginEolas},
+		Label:          "Memory",
+		Comment:        "What this song reminds Luke of.",
+		Range:          "https://eolas.l42.eu/ontology/Memory",
 	},
 	"year": {
 		ValueShape:   ValueShapeLiteral,
 		PredicateURI: "http://purl.org/dc/terms/date",
 	},
+	// Position of the track on its album: disc_number counts from 1 for multi-disc
+	// albums, track_number counts from 1 on each disc.
+	"track_number": {
+		ValueShape:    ValueShapeLiteral,
+		PredicateURI:  "http://purl.org/ontology/mo/track_number",
+		Datatype:      "http://www.w3.org/2001/XMLSchema#integer",
+		ValidateValue: ValidatePositiveInteger,
+	},
+	"disc_number": {
+		ValueShape:    ValueShapeLiteral,
+		PredicateURI:  "/ontology#discNumber",
+		Datatype:      "http://www.w3.org/2001/XMLSchema#integer",
+		ValidateValue: ValidatePositiveInteger,
+		Label:         "Disc number",
+		Comment:       "Which disc of its album the track is on, counting from 1.  Complements mo:track_number, which counts from 1 on each disc.",
+	},
 
 	// Omit predicates — behavioural only, not emitted in RDF output.
 	"lastSuccessfulPlay": {
@@ -188,6 +253,8 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#singalong",
 		AllowedOrigins: []string{OriginMediaMetadataAPI},
+		Label:          "Singalong",
+		Comment:        "How well Luke can sing along to this track — an ordinal scale from 0 (no chance) to 5 (can do it a cappella without a lyric sheet).",
 		ResolveNameToURI: SKOSResolveNameToURI("singalong"),
 		ResolveURIToName: SKOSResolveURIToName("singalong"),
 	},
@@ -195,6 +262,8 @@ var registry = map[string]Config{
 		ValueShape:     ValueShapeURIObject,
 		PredicateURI:   "/ontology#dance",
 		AllowedOrigins: []string{OriginMediaMetadataAPI},
+		Label:          "Dance",
+		Comment:        "The style of dance which goes with this track.",
 		ResolveNameToURI: SKOSResolveNameToURI("dance"),
 		ResolveURIToName: SKOSResolveURIToName("dance"),
 	},
@@ -17,23 +17,27 @@ func TestRegistryValidity(t *testing.T) {
 		if c.ValueShape != ValueShapeURIObject && c.AllowedOrigins != nil {
 			t.Errorf("predicate %q: non-URIObject predicate must not have AllowedOrigins set", id)
 		}
-		// Literal, URIObject, and MBIDPrefix predicates must have a PredicateURI.
-		if (c.ValueShape == ValueShapeLiteral || c.ValueShape == ValueShapeURIObject || c.ValueShape == ValueShapeMBIDPrefix) && c.PredicateURI == "" {
-			t.Errorf("predicate %q: Literal/URIObject/MBIDPrefix predicate must have a PredicateURI", id)
+		// Literal and URIObject predicates must have a PredicateURI.
+		if (c.ValueShape == ValueShapeLiteral || c.ValueShape == ValueShapeURIObject) && c.PredicateURI == "" {
+			t.Errorf("predicate %q: Literal/URIObject predicate must have a PredicateURI", id)
 		}
-		// MBIDPrefix predicates must have a URIPrefix.
-		if c.ValueShape == ValueShapeMBIDPrefix && c.URIPrefix == "" {
-			t.Errorf("predicate %q: MBIDPrefix predicate must have a URIPrefix", id)
+		// Only URIObject predicates may have a URIPrefix.
+		if c.ValueShape != ValueShapeURIObject && c.URIPrefix != "" {
+			t.Errorf("predicate %q: non-URIObject predicate must not have a URIPrefix", id)
 		}
-		// Only MBIDPrefix predicates may have a URIPrefix.
-		if c.ValueShape != ValueShapeMBIDPrefix && c.URIPrefix != "" {
-			t.Errorf("predicate %q: non-MBIDPrefix predicate must not have a URIPrefix", id)
+		// A URIPrefix must be under one of the predicate's allowed origins, or every write would be rejected.
+		if c.URIPrefix != "" && c.ValidateURIOrigin(c.URIPrefix) != "" {
+			t.Errorf("predicate %q: URIPrefix %q is not under an allowed origin", id, c.URIPrefix)
 		}
 		// ValueShapeOmit predicates must not have a PredicateURI — they are explicitly
 		// suppressed from RDF output (e.g. lastSuccessfulPlay, lastError, lastSkip).
 		if c.ValueShape == ValueShapeOmit && c.PredicateURI != "" {
 			t.Errorf("predicate %q: Omit predicate must not have a PredicateURI", id)
 		}
+		// Only Literal predicates may have a Datatype.
+		if c.ValueShape != ValueShapeLiteral && c.Datatype != "" {
+			t.Errorf("predicate %q: non-Literal predicate must not have a Datatype", id)
+		}
 		// ResolveNameToURI and ResolveURIToName must be set together or both nil.
 		if (c.ResolveNameToURI == nil) != (c.ResolveURIToName == nil) {
 			t.Errorf("predicate %q: ResolveNameToURI and ResolveURIToName must both be set or both nil", id)
@@ -69,21 +73,54 @@ func TestMultiValueCount(t *testing.T) {
 // TestURIObjectCount checks the expected number of URIObject predicates.
 func TestURIObjectCount(t *testing.T) {
 	count := len(URIObjectPredicates())
-	if count != 15 {
-		t.Errorf("expected 15 URIObject predicates, got %d", count)
+	if count != 18 {
+		t.Errorf("expected 18 URIObject predicates, got %d", count)
 	}
 }
 
-// TestMBIDPrefixPredicateCount checks the expected number of MBIDPrefix predicates.
-func TestMBIDPrefixPredicateCount(t *testing.T) {
+// TestURIPrefixPredicateCount checks the expected number of predicates with a URIPrefix.
+func TestURIPrefixPredicateCount(t *testing.T) {
 	count := 0
 	for _, c := range registry {
-		if c.ValueShape == ValueShapeMBIDPrefix {
+		if c.URIPrefix != "" {
 			count++
 		}
 	}
 	if count != 3 {
-		t.Errorf("expected 3 MBIDPrefix predicates, got %d", count)
+		t.Errorf("expected 3 predicates with a URIPrefix, got %d", count)
+	}
+}
+
+// TestOntologyMetadata checks every predicate defined in the /ontology document has
+// what's needed to describe it there, and that no other predicate claims any.
+func TestOntologyMetadata(t *testing.T) {
+	defined := 0
+	for id, c := range registry {
+		if c.OntologyLocalName() == "" {
+			if c.Label != "" || c.Comment != "" || c.Range != "" || c.Inverse != "" || c.SubPropertyOf != "" {
+				t.Errorf("predicate %q: only predicates in the ontology may have ontology metadata", id)
+			}
+			continue
+		}
+		defined++
+		if c.Label == "" {
+			t.Errorf("predicate %q: ontology predicate must have a Label", id)
+		}
+		if c.Comment == "" {
+			t.Errorf("predicate %q: ontology predicate must have a Comment", id)
+		}
+		if c.ValueShape == ValueShapeURIObject && c.Range == "" && GetSKOSConcepts(id) == nil {
+			t.Errorf("predicate %q: URIObject predicate in the ontology must have a Range, or SKOS concepts", id)
+		}
+		if (c.Inverse == "") != (c.InverseLabel == "") {
+			t.Errorf("predicate %q: Inverse and InverseLabel must both be set or both empty", id)
+		}
+		if c.SubPropertyOf != "" && registry[c.SubPropertyOf].OntologyLocalName() == "" {
+			t.Errorf("predicate %q: SubPropertyOf %q is not a predicate in the ontology", id, c.SubPropertyOf)
+		}
+	}
+	if defined != 13 {
+		t.Errorf("expected 13 predicates in the ontology, got %d", defined)
 	}
 }
 
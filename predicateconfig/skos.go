@@ -104,6 +104,18 @@ var conceptsByPredicate = map[string][]SKOSConcept{
 	"dance":        danceConcepts,
 }
 
+// ordinalPredicates are the SKOS predicates whose concepts are ordered by their Level.
+var ordinalPredicates = map[string]bool{
+	"availability": true,
+	"singalong":    true,
+}
+
+// IsOrdinal reports whether a predicate's SKOS concepts are ordered by their Level,
+// so its values can be compared with one another.
+func IsOrdinal(predicate string) bool {
+	return ordinalPredicates[predicate]
+}
+
 // GetSKOSConcepts returns the concept list for the given predicate, or nil if not a SKOS predicate.
 func GetSKOSConcepts(predicate string) []SKOSConcept {
 	return conceptsByPredicate[predicate]
@@ -166,10 +178,10 @@ func ResolveConceptURIToName(predicate, appOrigin, uri string) (string, error) {
 }
 
 // SKOSResolveNameToURI is a ResolveNameToURI implementation for SKOS concept scheme predicates.
-// It ignores the NameURIResolver (no DB lookup needed) and resolves the name via the in-memory
+// It ignores the NameURIResolver (no DB lookup needed) and any hints, and resolves the name via the in-memory
 // concept map, reading APP_ORIGIN from the environment at call time.
-func SKOSResolveNameToURI(predicate string) func(NameURIResolver, string) (string, error) {
-	return func(_ NameURIResolver, name string) (string, error) {
+func SKOSResolveNameToURI(predicate string) func(NameURIResolver, string, TagHints) (string, error) {
+	return func(_ NameURIResolver, name string, _ TagHints) (string, error) {
 		appOrigin := os.Getenv("APP_ORIGIN")
 		return ResolveSlugToConceptURI(predicate, appOrigin, name)
 	}
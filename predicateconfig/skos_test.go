@@ -178,7 +178,7 @@ func TestSKOSResolveNameToURIViaEnv(t *testing.T) {
 	t.Cleanup(func() { os.Unsetenv("APP_ORIGIN") })
 
 	resolver := SKOSResolveNameToURI("provenance")
-	uri, err := resolver(nil, "bandcamp")
+	uri, err := resolver(nil, "bandcamp", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -0,0 +1,196 @@
+package rdfgen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deiu/rdf2go"
+)
+
+// Vocabularies used to describe the export as a dataset.
+const (
+	voidNamespace    = "http://rdfs.org/ns/void#"
+	dcatNamespace    = "http://www.w3.org/ns/dcat#"
+	dctermsNamespace = "http://purl.org/dc/terms/"
+	provNamespace    = "http://www.w3.org/ns/prov#"
+	xsdDateTime      = "http://www.w3.org/2001/XMLSchema#dateTime"
+	sourceCodeURI    = "https://github.com/lucas42/lucos_media_metadata_api"
+	datasetSuffix    = ".dataset"
+	exportEndpoint   = "/v2/export"
+)
+
+// DatasetPath returns where the dataset description of the export at outFile is
+// published in a given format.
+func DatasetPath(outFile string, format ExportFormat) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + datasetSuffix + format.Extension
+}
+
+// DatasetURI returns the URI of the dataset the bulk export is a dump of.
+func DatasetURI() string {
+	return datasetNode("dataset").RawValue()
+}
+
+// datasetNode returns a node in the dataset description.  They're given URIs within the
+// description rather than being blank nodes, so they're the same from one export to the
+// next and only appear in deltas when what's said about them changes.
+func datasetNode(fragment string) rdf2go.Term {
+	return rdf2go.NewResource(os.Getenv("APP_ORIGIN") + exportEndpoint + "/dataset#" + fragment)
+}
+
+// datasetStats counts what's in an export as its triples are added, for describing it.
+// The triples about each subject are added together, so only those about the current
+// subject are remembered, by hash, to count each triple, entity and class once however
+// many times it's repeated.
+type datasetStats struct {
+	triples        int
+	entities       int
+	classes        map[string]int
+	vocabularies   map[string]bool
+	subject        string
+	subjectTriples map[uint64]bool
+	subjectTyped   bool
+}
+
+func newDatasetStats() *datasetStats {
+	return &datasetStats{
+		classes:      map[string]int{},
+		vocabularies: map[string]bool{},
+	}
+}
+
+// counting returns an adder which counts each triple before passing it on to add.
+// A triple repeated among those about the same subject isn't counted or passed on.
+func (stats *datasetStats) counting(add tripleAdder) tripleAdder {
+	return func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+		if subject.String() != stats.subject {
+			stats.subject = subject.String()
+			stats.subjectTriples = map[uint64]bool{}
+			stats.subjectTyped = false
+		}
+		key := tripleHash(predicate.String() + " " + object.String())
+		if stats.subjectTriples[key] {
+			return
+		}
+		stats.subjectTriples[key] = true
+		stats.triples++
+		stats.vocabularies[vocabularyOf(predicate.RawValue())] = true
+		if predicate.RawValue() == rdfType {
+			stats.vocabularies[vocabularyOf(object.RawValue())] = true
+			if !stats.subjectTyped {
+				stats.subjectTyped = true
+				stats.entities++
+			}
+			stats.classes[object.RawValue()]++
+		}
+		add(subject, predicate, object)
+	}
+}
+
+// vocabularyOf returns the namespace of a term, up to its last '#' or '/'.
+func vocabularyOf(uri string) string {
+	return uri[:strings.LastIndexAny(uri, "#/")+1]
+}
+
+// sortedKeys returns a map's keys in order, so descriptions come out the same every time.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeDatasetDescription adds a VoID and DCAT description of an export: when it was
+// generated and from which version of the library, by which version of this service,
+// how many triples and entities of each class it holds, the vocabularies it uses,
+// its licence (from DATASET_LICENCE, if set) and where it can be downloaded.
+// Triple counts are of the triples written out for the library, not including this description.
+func writeDatasetDescription(stats *datasetStats, version int64, generatedAt time.Time, add tripleAdder) {
+	appOrigin := os.Getenv("APP_ORIGIN")
+	dataset := datasetNode("dataset")
+	integer := func(value int) rdf2go.Term {
+		return rdf2go.NewLiteralWithDatatype(strconv.Itoa(value), rdf2go.NewResource(xsdInteger))
+	}
+	generated := rdf2go.NewLiteralWithDatatype(generatedAt.UTC().Format(time.RFC3339), rdf2go.NewResource(xsdDateTime))
+
+	add(dataset, rdf2go.NewResource(rdfType), rdf2go.NewResource(voidNamespace+"Dataset"))
+	add(dataset, rdf2go.NewResource(rdfType), rdf2go.NewResource(dcatNamespace+"Dataset"))
+	add(dataset, rdf2go.NewResource(dctermsNamespace+"title"), rdf2go.NewLiteralWithLanguage("Media Metadata Library", "en"))
+	add(dataset, rdf2go.NewResource(dctermsNamespace+"description"),
+		rdf2go.NewLiteralWithLanguage("The tracks, albums, artists and collections in the media library, with the ontology describing them.", "en"))
+	add(dataset, rdf2go.NewResource(dctermsNamespace+"modified"), generated)
+	if licence := os.Getenv("DATASET_LICENCE"); licence != "" {
+		add(dataset, rdf2go.NewResource(dctermsNamespace+"license"), rdf2go.NewResource(licence))
+	}
+	if version != 0 {
+		add(dataset, rdf2go.NewResource(appOrigin+"/ontology#dataVersion"), integer(int(version)))
+	}
+
+	// Provenance: the export run which generated the dataset, and the software which ran it
+	activity := datasetNode("export")
+	software := datasetNode("software")
+	add(dataset, rdf2go.NewResource(provNamespace+"generatedAtTime"), generated)
+	add(dataset, rdf2go.NewResource(provNamespace+"wasGeneratedBy"), activity)
+	add(activity, rdf2go.NewResource(rdfType), rdf2go.NewResource(provNamespace+"Activity"))
+	add(activity, rdf2go.NewResource(provNamespace+"endedAtTime"), generated)
+	add(activity, rdf2go.NewResource(provNamespace+"wasAssociatedWith"), software)
+	add(software, rdf2go.NewResource(rdfType), rdf2go.NewResource(provNamespace+"SoftwareAgent"))
+	add(software, rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteralWithLanguage("Media Metadata API", "en"))
+	add(software, rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#seeAlso"), rdf2go.NewResource(sourceCodeURI))
+	if serviceVersion := os.Getenv("VERSION"); serviceVersion != "" {
+		add(software, rdf2go.NewResource("http://www.w3.org/2002/07/owl#versionInfo"), rdf2go.NewLiteral(serviceVersion))
+	}
+
+	// Statistics
+	add(dataset, rdf2go.NewResource(voidNamespace+"triples"), integer(stats.triples))
+	add(dataset, rdf2go.NewResource(voidNamespace+"entities"), integer(stats.entities))
+	add(dataset, rdf2go.NewResource(voidNamespace+"classes"), integer(len(stats.classes)))
+	for _, class := range sortedKeys(stats.classes) {
+		partition := datasetNode(fmt.Sprintf("class-%x", tripleHash(class)))
+		add(dataset, rdf2go.NewResource(voidNamespace+"classPartition"), partition)
+		add(partition, rdf2go.NewResource(voidNamespace+"class"), rdf2go.NewResource(class))
+		add(partition, rdf2go.NewResource(voidNamespace+"entities"), integer(stats.classes[class]))
+	}
+	for _, vocabulary := range sortedKeys(stats.vocabularies) {
+		add(dataset, rdf2go.NewResource(voidNamespace+"vocabulary"), rdf2go.NewResource(vocabulary))
+	}
+
+	// Distributions: the same dump in each of the export's formats, chosen by content negotiation
+	dump := rdf2go.NewResource(appOrigin + exportEndpoint)
+	add(dataset, rdf2go.NewResource(voidNamespace+"dataDump"), dump)
+	for _, format := range ExportFormats {
+		distribution := datasetNode("distribution-" + strings.TrimPrefix(format.Extension, "."))
+		add(dataset, rdf2go.NewResource(dcatNamespace+"distribution"), distribution)
+		add(distribution, rdf2go.NewResource(rdfType), rdf2go.NewResource(dcatNamespace+"Distribution"))
+		add(distribution, rdf2go.NewResource(dcatNamespace+"downloadURL"), dump)
+		add(distribution, rdf2go.NewResource(dcatNamespace+"mediaType"), rdf2go.NewLiteral(format.MIME))
+	}
+}
+
+// publishDataset atomically publishes a dataset description in each of the export's formats.
+func publishDataset(outFile string, description *rdf2go.Graph) error {
+	for _, format := range ExportFormats {
+		tmp, err := os.CreateTemp(filepath.Dir(outFile), "*"+datasetSuffix+format.Extension+".tmp")
+		if err != nil {
+			return fmt.Errorf("failed to create temp dataset file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		if err := SerializeGraph(description, tmp, format.MIME); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to serialize dataset description as %s: %w", format.MIME, err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("failed to close temp dataset file: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), DatasetPath(outFile, format)); err != nil {
+			return fmt.Errorf("failed to atomically publish dataset description: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package rdfgen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/deiu/rdf2go"
+)
+
+// TestExportPublishesDatasetDescription checks the export describes itself, both at its
+// end and in the dataset files published alongside it.
+func TestExportPublishesDatasetDescription(t *testing.T) {
+	dbPath, _ := createVersionedExportDB(t, 6)
+	t.Setenv("VERSION", "1.2.3")
+	t.Setenv("DATASET_LICENCE", "https://creativecommons.org/licenses/by/4.0/")
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("ExportRDF failed: %v", err)
+	}
+
+	description := readLines(t, DatasetPath(outFile, ExportFormats[1]))
+	export := readLines(t, ExportPath(outFile, ExportFormats[1]))
+	library := withoutDatasetDescription(export)
+	if len(export)-len(library) != len(description) {
+		t.Errorf("expected the export to end with the %d triples of its description, got %d", len(description), len(export)-len(library))
+	}
+	for _, line := range description {
+		if !slices.Contains(export, line) {
+			t.Errorf("expected the export to include %s", line)
+		}
+	}
+
+	// Each triple is written, and counted, once
+	distinct := map[string]bool{}
+	typed := map[string]bool{}
+	for _, line := range library {
+		distinct[line] = true
+		if fields := strings.Fields(line); fields[1] == "<"+rdfType+">" {
+			typed[fields[0]] = true
+		}
+	}
+	if len(distinct) != len(library) {
+		t.Errorf("expected no repeated triples, got %d of %d distinct", len(distinct), len(library))
+	}
+
+	dataset := "<http://localhost:3002/v2/export/dataset#dataset> "
+	classPartition := func(class string) string {
+		return fmt.Sprintf("<http://localhost:3002/v2/export/dataset#class-%x> ", tripleHash(class))
+	}
+	for _, expected := range []string{
+		dataset + "<http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://rdfs.org/ns/void#Dataset> .",
+		dataset + "<http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://www.w3.org/ns/dcat#Dataset> .",
+		dataset + fmt.Sprintf(`<http://rdfs.org/ns/void#triples> "%d"^^<http://www.w3.org/2001/XMLSchema#integer> .`, len(library)),
+		dataset + fmt.Sprintf(`<http://rdfs.org/ns/void#entities> "%d"^^<http://www.w3.org/2001/XMLSchema#integer> .`, len(typed)),
+		dataset + `<http://localhost:3002/ontology#dataVersion> "1"^^<http://www.w3.org/2001/XMLSchema#integer> .`,
+		dataset + "<http://purl.org/dc/terms/license> <https://creativecommons.org/licenses/by/4.0/> .",
+		dataset + "<http://rdfs.org/ns/void#vocabulary> <http://purl.org/ontology/mo/> .",
+		dataset + "<http://rdfs.org/ns/void#dataDump> <http://localhost:3002/v2/export> .",
+		classPartition("http://purl.org/ontology/mo/Track") + `<http://rdfs.org/ns/void#entities> "6"^^<http://www.w3.org/2001/XMLSchema#integer> .`,
+		classPartition("http://localhost:3002/ontology#Collection") + `<http://rdfs.org/ns/void#entities> "2"^^<http://www.w3.org/2001/XMLSchema#integer> .`,
+		"<http://localhost:3002/v2/export/dataset#software> <http://www.w3.org/2002/07/owl#versionInfo> \"1.2.3\" .",
+		"<http://localhost:3002/v2/export/dataset#distribution-jsonld> <http://www.w3.org/ns/dcat#mediaType> \"application/ld+json\" .",
+	} {
+		if !slices.Contains(description, expected) {
+			t.Errorf("expected %s in the dataset description, got:\n%s", expected, strings.Join(description, "\n"))
+		}
+	}
+	for _, format := range ExportFormats {
+		if _, err := os.Stat(DatasetPath(outFile, format)); err != nil {
+			t.Errorf("expected the dataset description to be published as %s: %v", format.MIME, err)
+		}
+	}
+}
+
+// TestDatasetStatsCountsRepeatsOnce checks a triple repeated among those about a subject,
+// such as from a tag stored twice, is only counted and written once.
+func TestDatasetStatsCountsRepeatsOnce(t *testing.T) {
+	stats := newDatasetStats()
+	written := 0
+	add := stats.counting(func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) { written++ })
+	track := rdf2go.NewResource("http://localhost:8020/tracks/1")
+	typeOf := rdf2go.NewResource(rdfType)
+	title := rdf2go.NewResource(skosPrefLabel)
+	add(track, typeOf, rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	add(track, title, rdf2go.NewLiteral("Yesterday"))
+	add(track, title, rdf2go.NewLiteral("Yesterday"))
+	add(track, typeOf, rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	add(rdf2go.NewResource("http://localhost:8020/tracks/2"), typeOf, rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	if stats.triples != 3 || written != 3 {
+		t.Errorf("expected 3 triples counted and written, got %d and %d", stats.triples, written)
+	}
+	if stats.entities != 2 || stats.classes["http://purl.org/ontology/mo/Track"] != 2 {
+		t.Errorf("expected 2 tracks, got %d entities and classes %v", stats.entities, stats.classes)
+	}
+}
+
+// TestDatasetDescriptionRepublishedWhenMissing checks an unchanged library is still
+// exported if its dataset description hasn't been published.
+func TestDatasetDescriptionRepublishedWhenMissing(t *testing.T) {
+	dbPath, _ := createVersionedExportDB(t, 2)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("first export failed: %v", err)
+	}
+	os.Remove(DatasetPath(outFile, ExportFormats[0]))
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("expected the export to be redone, got %v", err)
+	}
+	if _, err := os.Stat(DatasetPath(outFile, ExportFormats[0])); err != nil {
+		t.Errorf("expected the dataset description to be republished: %v", err)
+	}
+}
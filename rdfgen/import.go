@@ -0,0 +1,493 @@
+package rdfgen
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+
+	"lucos_media_metadata_api/predicateconfig"
+)
+
+// Predicates ImportRdf reads back which don't come from predicateconfig.
+const (
+	dcIdentifier      = "http://purl.org/dc/terms/identifier"
+	moDuration        = "http://purl.org/ontology/mo/duration"
+	moMusicBrainz     = "http://purl.org/ontology/mo/musicbrainz"
+	foafMaker         = "http://xmlns.com/foaf/0.1/maker"
+	skosAltLabel      = "http://www.w3.org/2004/02/skos/core#altLabel"
+	owlSameAs         = "http://www.w3.org/2002/07/owl#sameAs"
+	eolasPreferred    = "https://eolas.l42.eu/ontology/preferredIdentifier"
+	moMusicGroup      = "http://purl.org/ontology/mo/MusicGroup"
+	moSoloMusicArtist = "http://purl.org/ontology/mo/SoloMusicArtist"
+)
+
+// Library is the tracks, albums, artists and collections read back from an export by
+// ImportRdf, each in order of id or slug.  A collection's TrackIDs are in order of
+// track id, as the export doesn't record running order.
+type Library struct {
+	Tracks      []TrackData
+	Albums      []AlbumData
+	Artists     []ArtistData
+	Collections []CollectionData
+}
+
+// TrackData is a track read back from an export.  Tags holds the track's values for
+// each predicate which was exported, in predicate order.
+type TrackData struct {
+	ID       int
+	URL      string
+	Duration *int
+	Tags     []TagData
+}
+
+// TagData is a tag value read back from an export.
+type TagData struct {
+	PredicateID string
+	Value       string
+	URI         string
+}
+
+// UnmappedTriple is a triple about a track, album, artist or collection which couldn't
+// be mapped back to the library, and why.
+type UnmappedTriple struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+	Reason    string `json:"reason"`
+}
+
+// ImportOrigins are the origins the URIs in an export were minted with, which may not
+// be this environment's when moving metadata between environments.
+type ImportOrigins struct {
+	MediaMetadataManager string
+	App                  string
+}
+
+// importer holds the state of a single ImportRdf call.
+type importer struct {
+	source     ImportOrigins
+	entityURI  *regexp.Regexp
+	predicates map[string][]string // predicate URIs in the export → registered predicate IDs
+	labels     map[string]string   // skos:prefLabel of every node which has one
+	unmapped   []UnmappedTriple
+}
+
+// ImportRdf reads the library back out of an export, reversing mapPredicate and the
+// other write functions.  Triples are about a track, album, artist or collection if
+// their subject is one of its URIs under source.MediaMetadataManager; any others (the
+// ontology, SKOS concept schemes and dataset description) are skipped.
+//
+// Predicates are mapped back to predicate IDs via the registry: IRIs under a predicate's
+// URIPrefix (MusicBrainz IDs) have the identifier after it as their name, and other
+// URIObject tags' names are taken from the prefLabel of their URI in the export where
+// there is one (such as for artists, albums and SKOS concepts).  Tag URIs under either source origin are rewritten to this environment's.
+//
+// Triples about the library which can't be mapped are returned, rather than failing
+// the import.
+func ImportRdf(graph *rdf2go.Graph, source ImportOrigins) (Library, []UnmappedTriple) {
+	imp := &importer{
+		source:     source,
+		entityURI:  regexp.MustCompile("^" + regexp.QuoteMeta(source.MediaMetadataManager) + "/(tracks|albums|artists|collections)/([^/]+)$"),
+		predicates: map[string][]string{},
+		labels:     map[string]string{},
+	}
+	for predicateID, config := range predicateconfig.All() {
+		if config.ValueShape == predicateconfig.ValueShapeOmit || config.PredicateURI == "" {
+			continue
+		}
+		predicateURI := resolvePredicateURI(config.PredicateURI, source.App)
+		imp.predicates[predicateURI] = append(imp.predicates[predicateURI], predicateID)
+	}
+	for _, predicateIDs := range imp.predicates {
+		sort.Strings(predicateIDs)
+	}
+
+	subjects := map[string][]*rdf2go.Triple{}
+	for triple := range graph.IterTriples() {
+		subjects[triple.Subject.RawValue()] = append(subjects[triple.Subject.RawValue()], triple)
+		if literal, ok := triple.Object.(*rdf2go.Literal); ok && triple.Predicate.RawValue() == skosPrefLabel && literal.Value != "" {
+			imp.labels[triple.Subject.RawValue()] = literal.Value
+		}
+	}
+
+	var library Library
+	collections := map[string]*CollectionData{}
+	collection := func(slug string) *CollectionData {
+		if collections[slug] == nil {
+			collections[slug] = &CollectionData{Slug: slug}
+		}
+		return collections[slug]
+	}
+	for _, subject := range sortedKeys(subjects) {
+		kind, id, ok := imp.parseEntityURI(subject)
+		if !ok {
+			continue
+		}
+		triples := subjects[subject]
+		sort.Slice(triples, func(i, j int) bool { return triples[i].String() < triples[j].String() })
+		switch kind {
+		case "tracks":
+			if trackID, err := strconv.Atoi(id); err == nil {
+				library.Tracks = append(library.Tracks, imp.readTrack(trackID, triples, collection))
+				continue
+			}
+		case "albums":
+			if albumID, err := strconv.Atoi(id); err == nil {
+				if album, ok := imp.readAlbum(albumID, triples); ok {
+					library.Albums = append(library.Albums, album)
+				}
+				continue
+			}
+		case "artists":
+			if artistID, err := strconv.Atoi(id); err == nil {
+				if artist, ok := imp.readArtist(artistID, triples); ok {
+					library.Artists = append(library.Artists, artist)
+				}
+				continue
+			}
+		case "collections":
+			imp.readCollection(collection(id), triples)
+			continue
+		}
+		for _, triple := range triples {
+			imp.unmap(triple, "not a valid "+strings.TrimSuffix(kind, "s")+" URI")
+		}
+	}
+	for _, slug := range sortedKeys(collections) {
+		if collections[slug].Name == "" {
+			imp.unmapped = append(imp.unmapped, UnmappedTriple{Subject: imp.source.MediaMetadataManager + "/collections/" + url.PathEscape(slug), Reason: "collection has no prefLabel"})
+			continue
+		}
+		slices.Sort(collections[slug].TrackIDs)
+		library.Collections = append(library.Collections, *collections[slug])
+	}
+	sort.Slice(library.Tracks, func(i, j int) bool { return library.Tracks[i].ID < library.Tracks[j].ID })
+	sort.Slice(library.Albums, func(i, j int) bool { return library.Albums[i].ID < library.Albums[j].ID })
+	sort.Slice(library.Artists, func(i, j int) bool { return library.Artists[i].ID < library.Artists[j].ID })
+	return library, imp.unmapped
+}
+
+// parseEntityURI splits a URI under the source's media metadata manager origin into
+// the kind of entity it's for and its id or slug.
+func (imp *importer) parseEntityURI(uri string) (kind string, id string, ok bool) {
+	match := imp.entityURI.FindStringSubmatch(uri)
+	if match == nil {
+		return "", "", false
+	}
+	id, err := url.PathUnescape(match[2])
+	return match[1], id, err == nil
+}
+
+// entityID returns the id of the entity of the given kind with the given URI.
+func (imp *importer) entityID(kind string, uri string) (int, bool) {
+	uriKind, id, ok := imp.parseEntityURI(uri)
+	if !ok || uriKind != kind {
+		return 0, false
+	}
+	entityID, err := strconv.Atoi(id)
+	return entityID, err == nil
+}
+
+// localise rewrites a URI under either of the source's origins to this environment's.
+func (imp *importer) localise(uri string) string {
+	for source, local := range map[string]string{
+		imp.source.MediaMetadataManager: os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN"),
+		imp.source.App:                  os.Getenv("APP_ORIGIN"),
+	} {
+		if source != "" && strings.HasPrefix(uri, source+"/") {
+			return local + strings.TrimPrefix(uri, source)
+		}
+	}
+	return uri
+}
+
+func (imp *importer) unmap(triple *rdf2go.Triple, reason string) {
+	imp.unmapped = append(imp.unmapped, UnmappedTriple{
+		Subject:   triple.Subject.RawValue(),
+		Predicate: triple.Predicate.RawValue(),
+		Object:    triple.Object.String(),
+		Reason:    reason,
+	})
+}
+
+// literalValue returns the lexical value of a literal object.
+func literalValue(object rdf2go.Term) (string, bool) {
+	literal, ok := object.(*rdf2go.Literal)
+	if !ok {
+		return "", false
+	}
+	return literal.Value, true
+}
+
+// iriValue returns the IRI of an IRI object.
+func iriValue(object rdf2go.Term) (string, bool) {
+	resource, ok := object.(*rdf2go.Resource)
+	if !ok {
+		return "", false
+	}
+	return resource.URI, true
+}
+
+// integerValue returns the value of a literal object holding an integer.
+func integerValue(object rdf2go.Term) (int, bool) {
+	value, ok := literalValue(object)
+	if !ok {
+		return 0, false
+	}
+	integer, err := strconv.Atoi(value)
+	return integer, err == nil
+}
+
+// readTrack reads a track's scalar fields, tags and collection memberships.
+func (imp *importer) readTrack(id int, triples []*rdf2go.Triple, collection func(slug string) *CollectionData) TrackData {
+	track := TrackData{ID: id}
+	appOrigin := imp.source.App
+	for _, triple := range triples {
+		predicate := triple.Predicate.RawValue()
+		switch {
+		case predicate == rdfType:
+			if triple.Object.RawValue() != "http://purl.org/ontology/mo/Track" {
+				imp.unmap(triple, "tracks can only be typed mo:Track")
+			}
+			continue
+		case predicate == dcIdentifier:
+			if value, ok := literalValue(triple.Object); ok {
+				track.URL = value
+				continue
+			}
+		case predicate == moDuration:
+			var seconds int
+			if value, ok := literalValue(triple.Object); ok {
+				if _, err := fmt.Sscanf(value, "PT%dS", &seconds); err == nil {
+					track.Duration = &seconds
+				} else {
+					imp.unmap(triple, "duration isn't a whole number of seconds")
+				}
+				continue
+			}
+		case predicate == appOrigin+"/ontology#inCollection":
+			if kind, slug, ok := imp.parseEntityURI(triple.Object.RawValue()); ok && kind == "collections" {
+				members := collection(slug)
+				members.TrackIDs = append(members.TrackIDs, id)
+			} else {
+				imp.unmap(triple, "not a collection URI")
+			}
+			continue
+		}
+		if tag, reason := imp.mapTag(predicate, triple.Object); reason == "" {
+			track.Tags = append(track.Tags, tag)
+		} else {
+			imp.unmap(triple, reason)
+		}
+	}
+	sort.SliceStable(track.Tags, func(i, j int) bool { return track.Tags[i].PredicateID < track.Tags[j].PredicateID })
+	for i := 1; i < len(track.Tags); i++ {
+		if track.Tags[i].PredicateID == track.Tags[i-1].PredicateID && !predicateconfig.IsMultiValue(track.Tags[i].PredicateID) {
+			imp.unmapped = append(imp.unmapped, UnmappedTriple{
+				Subject:   imp.source.MediaMetadataManager + "/tracks/" + strconv.Itoa(id),
+				Predicate: resolvePredicateURI(predicateconfig.GetConfig(track.Tags[i].PredicateID).PredicateURI, appOrigin),
+				Object:    track.Tags[i].Value + track.Tags[i].URI,
+				Reason:    "more than one value for single-value predicate " + strconv.Quote(track.Tags[i].PredicateID),
+			})
+			track.Tags = slices.Delete(track.Tags, i, i+1)
+			i--
+		}
+	}
+	return track
+}
+
+// mapTag maps a predicate and object on a track back to a tag, the reverse of
+// mapPredicate.  Where several registered predicates share a URI, the first (by
+// predicate ID) whose shape the object fits is used.  Returns why it couldn't be mapped
+// if none fit.
+func (imp *importer) mapTag(predicateURI string, object rdf2go.Term) (TagData, string) {
+	predicateIDs, ok := imp.predicates[predicateURI]
+	if !ok {
+		return TagData{}, "no predicate maps to this URI"
+	}
+	literal, isLiteral := literalValue(object)
+	iri, isIRI := iriValue(object)
+	for _, predicateID := range predicateIDs {
+		config := predicateconfig.GetConfig(predicateID)
+		switch config.ValueShape {
+		case predicateconfig.ValueShapeLiteral:
+			if isLiteral {
+				return TagData{PredicateID: predicateID, Value: literal}, ""
+			}
+		case predicateconfig.ValueShapeURIObject:
+			if !isIRI {
+				continue
+			}
+			if config.URIPrefix == "" {
+				return TagData{PredicateID: predicateID, Value: imp.labels[iri], URI: imp.localise(iri)}, ""
+			}
+			if identifier, found := strings.CutPrefix(iri, config.URIPrefix); found {
+				return TagData{PredicateID: predicateID, Value: identifier, URI: iri}, ""
+			}
+		}
+	}
+	return TagData{}, fmt.Sprintf("object doesn't fit predicate %s", strings.Join(predicateIDs, " or "))
+}
+
+// readAlbum reads an album, reporting it as unmapped if it has no name.
+func (imp *importer) readAlbum(id int, triples []*rdf2go.Triple) (AlbumData, bool) {
+	album := AlbumData{ID: id}
+	for _, triple := range triples {
+		predicate := triple.Predicate.RawValue()
+		iri, isIRI := iriValue(triple.Object)
+		switch {
+		case predicate == rdfType && iri == "http://purl.org/ontology/mo/Record":
+			continue
+		case predicate == skosPrefLabel:
+			if value, ok := literalValue(triple.Object); ok {
+				album.Name = value
+				continue
+			}
+		case predicate == foafMaker:
+			if artistID, ok := imp.entityID("artists", iri); ok {
+				album.ArtistIDs = append(album.ArtistIDs, artistID)
+				continue
+			}
+		case predicate == "http://purl.org/dc/terms/date":
+			if year, ok := integerValue(triple.Object); ok {
+				album.Year = &year
+				continue
+			}
+		case predicate == moMusicBrainz:
+			if mbid, found := strings.CutPrefix(iri, predicateconfig.GetConfig("mbid_release").URIPrefix); isIRI && found {
+				album.MBIDRelease = mbid
+				continue
+			}
+		case predicate == "http://purl.org/ontology/mo/track_count":
+			if count, ok := integerValue(triple.Object); ok {
+				album.TrackCount = &count
+				continue
+			}
+		case predicate == imp.source.App+"/ontology#discCount":
+			if count, ok := integerValue(triple.Object); ok {
+				album.DiscCount = &count
+				continue
+			}
+		case predicate == "http://xmlns.com/foaf/0.1/depiction":
+			if isIRI {
+				album.Artwork = iri
+				continue
+			}
+		}
+		imp.unmap(triple, "not an album property the export writes")
+	}
+	if album.Name == "" {
+		imp.unmapped = append(imp.unmapped, UnmappedTriple{Subject: imp.source.MediaMetadataManager + "/albums/" + strconv.Itoa(id), Reason: "album has no prefLabel"})
+		return album, false
+	}
+	slices.Sort(album.ArtistIDs)
+	return album, true
+}
+
+// readArtist reads an artist, reporting it as unmapped if it has no name.  The export
+// types orchestras and choirs as groups, so they're read back as groups.
+func (imp *importer) readArtist(id int, triples []*rdf2go.Triple) (ArtistData, bool) {
+	artist := ArtistData{ID: id}
+	for _, triple := range triples {
+		predicate := triple.Predicate.RawValue()
+		iri, isIRI := iriValue(triple.Object)
+		switch {
+		case predicate == rdfType && iri == "http://purl.org/ontology/mo/MusicArtist":
+			continue
+		case predicate == rdfType && iri == moSoloMusicArtist:
+			artist.Type = "person"
+			continue
+		case predicate == rdfType && iri == moMusicGroup:
+			artist.Type = "group"
+			continue
+		case predicate == skosPrefLabel:
+			if value, ok := literalValue(triple.Object); ok {
+				artist.Name = value
+				continue
+			}
+		case predicate == imp.source.App+"/ontology#sortName":
+			if value, ok := literalValue(triple.Object); ok {
+				artist.SortName = value
+				continue
+			}
+		case predicate == skosAltLabel:
+			if value, ok := literalValue(triple.Object); ok {
+				artist.Aliases = append(artist.Aliases, value)
+				continue
+			}
+		case predicate == moMusicBrainz:
+			if mbid, found := strings.CutPrefix(iri, predicateconfig.GetConfig("mbid_artist").URIPrefix); isIRI && found {
+				artist.MBIDArtist = mbid
+				continue
+			}
+		case predicate == "http://purl.org/ontology/mo/member":
+			if memberID, ok := imp.entityID("artists", iri); ok {
+				artist.Members = append(artist.Members, MemberData{ArtistID: memberID})
+				continue
+			} else if isIRI {
+				artist.Members = append(artist.Members, MemberData{PersonURI: iri})
+				continue
+			}
+		case predicate == owlSameAs || predicate == eolasPreferred:
+			if isIRI && (artist.PersonURI == nil || *artist.PersonURI == iri) {
+				artist.PersonURI = &iri
+				continue
+			}
+		}
+		imp.unmap(triple, "not an artist property the export writes")
+	}
+	if artist.Name == "" {
+		imp.unmapped = append(imp.unmapped, UnmappedTriple{Subject: imp.source.MediaMetadataManager + "/artists/" + strconv.Itoa(id), Reason: "artist has no prefLabel"})
+		return artist, false
+	}
+	sort.Slice(artist.Members, func(i, j int) bool {
+		if artist.Members[i].ArtistID != artist.Members[j].ArtistID {
+			return artist.Members[i].ArtistID < artist.Members[j].ArtistID
+		}
+		return artist.Members[i].PersonURI < artist.Members[j].PersonURI
+	})
+	return artist, true
+}
+
+// collectionMembershipType returns the membership type a subclass of ontology#Collection
+// is for, or an empty string if the URI isn't one.
+func (imp *importer) collectionMembershipType(classURI string) string {
+	for membershipType, subclass := range collectionSubclasses {
+		if classURI == imp.source.App+"/ontology#"+subclass {
+			return membershipType
+		}
+	}
+	return ""
+}
+
+// readCollection reads a collection's name, icon and membership type.  Its members are
+// read from the inCollection triples on its tracks.
+func (imp *importer) readCollection(collection *CollectionData, triples []*rdf2go.Triple) {
+	for _, triple := range triples {
+		predicate := triple.Predicate.RawValue()
+		value, isLiteral := literalValue(triple.Object)
+		switch {
+		case predicate == rdfType && triple.Object.RawValue() == imp.source.App+"/ontology#Collection":
+			continue
+		case predicate == rdfType && imp.collectionMembershipType(triple.Object.RawValue()) != "":
+			collection.MembershipType = imp.collectionMembershipType(triple.Object.RawValue())
+			continue
+		case predicate == skosPrefLabel && isLiteral:
+			collection.Name = value
+			continue
+		case predicate == skosNotation && isLiteral && value == collection.Slug:
+			continue
+		case predicate == imp.source.App+"/ontology#icon" && isLiteral:
+			collection.Icon = value
+			continue
+		}
+		imp.unmap(triple, "not a collection property the export writes")
+	}
+}
@@ -0,0 +1,169 @@
+package rdfgen
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/deiu/rdf2go"
+)
+
+// exportAndParse exports a database into a graph and round-trips it through Turtle,
+// as an import of the published export would see it.
+func exportAndParse(t *testing.T, dbPath string) *rdf2go.Graph {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var serialised bytes.Buffer
+	writer, _ := NewTripleWriter(&serialised, "text/turtle")
+	if err := WriteGraph(db, writer.AddTriple); err != nil {
+		t.Fatalf("WriteGraph failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	graph := rdf2go.NewGraph("")
+	if err := graph.Parse(&serialised, "text/turtle"); err != nil {
+		t.Fatalf("could not parse export: %v", err)
+	}
+	return graph
+}
+
+// TestImportRdfRoundTripsExport checks everything the export writes about the library
+// is read back by ImportRdf.
+func TestImportRdfRoundTripsExport(t *testing.T) {
+	t.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(t, 30)
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	UPDATE artist SET person_uri = 'https://eolas.l42.eu/metadata/person/2/', mbid_artist = 'b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d' WHERE id = 1;
+	UPDATE album SET mbid_release = '0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a', artwork = 'https://example.org/cover.jpg' WHERE id = 1;
+	INSERT INTO tag VALUES (1, 'dance', 'Lindy Hop', 'http://localhost:3002/vocab/dance/lindy-hop');
+	INSERT INTO tag VALUES (1, 'about', 'Love', 'https://eolas.l42.eu/metadata/topic/1/');
+	INSERT INTO tag VALUES (1, 'mbid_recording', '9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b', 'https://musicbrainz.org/recording/9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library, unmapped := ImportRdf(exportAndParse(t, dbPath), ImportOrigins{MediaMetadataManager: "http://localhost:8020", App: "http://localhost:3002"})
+	if len(unmapped) > 0 {
+		t.Errorf("expected every triple to be mapped, got %+v", unmapped)
+	}
+	if len(library.Tracks) != 30 || len(library.Albums) != 3 || len(library.Artists) != 2 || len(library.Collections) != 2 {
+		t.Fatalf("expected 30 tracks, 3 albums, 2 artists and 2 collections, got %d, %d, %d and %d",
+			len(library.Tracks), len(library.Albums), len(library.Artists), len(library.Collections))
+	}
+
+	duration := 121
+	expectedTrack := TrackData{ID: 1, URL: "https://example.org/tracks/1.mp3", Duration: &duration, Tags: []TagData{
+		{PredicateID: "about", Value: "", URI: "https://eolas.l42.eu/metadata/topic/1/"},
+		{PredicateID: "album", Value: `Album "2"`, URI: "http://localhost:8020/albums/2"},
+		{PredicateID: "artist", Value: "Artist 2", URI: "http://localhost:8020/artists/2"},
+		{PredicateID: "comment", Value: "Ünïcödé ☃"},
+		{PredicateID: "dance", Value: "Lindy Hop", URI: "http://localhost:3002/vocab/dance/lindy-hop"},
+		{PredicateID: "mbid_recording", Value: "9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b", URI: "https://musicbrainz.org/recording/9b1c7e0e-7d5a-4b8e-9f3a-2c1d0e9f8a7b"},
+		{PredicateID: "title", Value: "Track 1\twith \\ \"odd\" characters\n"},
+		{PredicateID: "track_number", Value: "2"},
+		{PredicateID: "year", Value: "1961"},
+	}}
+	if !reflect.DeepEqual(library.Tracks[0], expectedTrack) {
+		t.Errorf("expected track %+v, got %+v", expectedTrack, library.Tracks[0])
+	}
+
+	year := 1961
+	ten, one := 10, 1
+	expectedAlbum := AlbumData{ID: 1, Name: `Album "1"`, ArtistIDs: []int{2}, Year: &year, MBIDRelease: "0c7f4a2d-3d4e-4c5b-8c1a-1f2e3d4c5b6a",
+		TrackCount: &ten, DiscCount: &one, Artwork: "https://example.org/cover.jpg"}
+	if !reflect.DeepEqual(library.Albums[0], expectedAlbum) {
+		t.Errorf("expected album %+v, got %+v", expectedAlbum, library.Albums[0])
+	}
+
+	personURI := "https://eolas.l42.eu/metadata/person/2/"
+	expectedArtist := ArtistData{ID: 1, Name: "Artist 1", PersonURI: &personURI, SortName: "1, Artist", Aliases: []string{"A1"},
+		MBIDArtist: "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d", Type: "person"}
+	if !reflect.DeepEqual(library.Artists[0], expectedArtist) {
+		t.Errorf("expected artist %+v, got %+v", expectedArtist, library.Artists[0])
+	}
+
+	favourites := library.Collections[0]
+	if favourites.Slug != "favourites" || favourites.Name != "Favourites" || favourites.Icon != "⭐" ||
+		!slices.Equal(favourites.TrackIDs, []int{3, 6, 9, 12, 15, 18, 21, 24, 27, 30}) {
+		t.Errorf("unexpected collection %+v", favourites)
+	}
+	if welsh := library.Collections[1]; welsh.Slug != "welsh" || welsh.Name != "Welsh" || welsh.MembershipType != "smart" || len(welsh.TrackIDs) != 0 {
+		t.Errorf("unexpected collection %+v", welsh)
+	}
+}
+
+// TestImportRdfRewritesOriginsAndReportsUnmapped checks an export from another
+// environment is read back with this environment's URIs, and that triples about the
+// library which can't be mapped are reported.
+func TestImportRdfRewritesOriginsAndReportsUnmapped(t *testing.T) {
+	t.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	source := ImportOrigins{MediaMetadataManager: "https://manager.example", App: "https://api.example"}
+	graph := rdf2go.NewGraph("")
+	track := rdf2go.NewResource("https://manager.example/tracks/7")
+	add := func(subject rdf2go.Term, predicate string, object rdf2go.Term) {
+		graph.AddTriple(subject, rdf2go.NewResource(predicate), object)
+	}
+	add(track, rdfType, rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	add(track, skosPrefLabel, rdf2go.NewLiteral("One"))
+	add(track, skosPrefLabel, rdf2go.NewLiteral("Two"))
+	add(track, "https://api.example/ontology#singalong", rdf2go.NewResource("https://api.example/vocab/singalong/0"))
+	add(track, "https://api.example/ontology#onAlbum", rdf2go.NewResource("https://manager.example/albums/2"))
+	add(track, "http://purl.org/dc/terms/creator", rdf2go.NewResource("https://example.org/not-musicbrainz"))
+	add(track, "http://example.org/unknown", rdf2go.NewLiteral("?"))
+	add(track, "https://api.example/ontology#inCollection", rdf2go.NewResource("https://manager.example/collections/road%20trip"))
+	add(rdf2go.NewResource("https://manager.example/collections/road%20trip"), skosPrefLabel, rdf2go.NewLiteral("Road Trip"))
+	add(rdf2go.NewResource("https://manager.example/artists/3"), "http://www.w3.org/2004/02/skos/core#altLabel", rdf2go.NewLiteral("Nameless"))
+	add(rdf2go.NewResource("https://manager.example/tracks/seven"), skosPrefLabel, rdf2go.NewLiteral("Seven"))
+	add(rdf2go.NewResource("http://localhost:8020/tracks/1"), skosPrefLabel, rdf2go.NewLiteral("Another environment"))
+	add(rdf2go.NewResource("https://api.example/vocab/singalong/0"), skosPrefLabel, rdf2go.NewLiteralWithLanguage("No chance", "en"))
+
+	library, unmapped := ImportRdf(graph, source)
+	expectedTags := []TagData{
+		{PredicateID: "album", URI: "http://localhost:8020/albums/2"},
+		{PredicateID: "singalong", Value: "No chance", URI: "http://localhost:3002/vocab/singalong/0"},
+		{PredicateID: "title", Value: "One"},
+	}
+	if len(library.Tracks) != 1 || library.Tracks[0].ID != 7 || !reflect.DeepEqual(library.Tracks[0].Tags, expectedTags) {
+		t.Errorf("expected track 7 with tags %+v, got %+v", expectedTags, library.Tracks)
+	}
+	if len(library.Collections) != 1 || library.Collections[0].Slug != "road trip" || !slices.Equal(library.Collections[0].TrackIDs, []int{7}) {
+		t.Errorf("expected the road trip collection holding track 7, got %+v", library.Collections)
+	}
+	if len(library.Artists) != 0 {
+		t.Errorf("expected an artist with no name to be skipped, got %+v", library.Artists)
+	}
+
+	reasons := map[string]bool{}
+	for _, triple := range unmapped {
+		reasons[triple.Subject+" "+triple.Reason] = true
+	}
+	for _, expected := range []string{
+		"https://manager.example/tracks/7 more than one value for single-value predicate \"title\"",
+		"https://manager.example/tracks/7 object doesn't fit predicate mbid_artist",
+		"https://manager.example/tracks/7 no predicate maps to this URI",
+		"https://manager.example/artists/3 artist has no prefLabel",
+		"https://manager.example/tracks/seven not a valid track URI",
+	} {
+		if !reasons[expected] {
+			t.Errorf("expected %q to be reported, got %+v", expected, unmapped)
+		}
+	}
+	if len(unmapped) != 5 {
+		t.Errorf("expected 5 unmapped triples, got %d: %+v", len(unmapped), unmapped)
+	}
+}
@@ -0,0 +1,254 @@
+package rdfgen
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deiu/rdf2go"
+)
+
+// ErrUnchanged is returned by ExportRDF when nothing has been written to the library
+// since the last export, so there's nothing new to publish.
+var ErrUnchanged = errors.New("library unchanged since the last export")
+
+// deltaRetention is how many exports' delta files are kept, oldest first to go.
+const deltaRetention = 48
+
+// exportFormatRevision goes up whenever a change to the exporter changes what it outputs
+// for the same library, such as a predicate gaining a datatype, so an export taken
+// before the change isn't left in place as unchanged.
+const exportFormatRevision = 2
+
+// ExportManifest describes the most recent export: the version of the library it was
+// taken from, the version of the exporter's output (see outputVersion), and the delta
+// files listing the triples each recent export added and removed.
+// It's published alongside the export, at ManifestPath.
+type ExportManifest struct {
+	Version       int64         `json:"version"`
+	OutputVersion string        `json:"outputVersion"`
+	ExportedAt    string        `json:"exportedAt"`
+	Deltas        []ExportDelta `json:"deltas"`
+}
+
+// ExportDelta names the N-Triples files holding the triples added and removed between
+// two versions of the library.  File names are relative to the export's directory.
+type ExportDelta struct {
+	From    int64  `json:"from"`
+	To      int64  `json:"to"`
+	Added   string `json:"added"`
+	Removed string `json:"removed"`
+}
+
+// ManifestPath returns where the manifest for the export at outFile is published.
+func ManifestPath(outFile string) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + ".manifest.json"
+}
+
+// ReadManifest reads the manifest for the export at outFile.
+func ReadManifest(outFile string) (manifest ExportManifest, err error) {
+	content, err := os.ReadFile(ManifestPath(outFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &manifest)
+	return
+}
+
+// readDataVersion returns the library's data version, which the api bumps on every write.
+// Databases which predate the data_version table give zero, meaning the version is unknown.
+func readDataVersion(db *sql.DB) (version int64, err error) {
+	err = db.QueryRow("SELECT version FROM data_version WHERE id = 1").Scan(&version)
+	if err != nil && strings.Contains(err.Error(), "no such table") {
+		return 0, nil
+	}
+	return
+}
+
+// outputVersion identifies how the exporter outputs a library: the ontology's version,
+// which changes with any of its definitions, and exportFormatRevision.
+func outputVersion() (string, error) {
+	ontology, err := OntologyToRdf()
+	if err != nil {
+		return "", err
+	}
+	info := ontology.One(rdf2go.NewResource(os.Getenv("APP_ORIGIN")+"/ontology"), rdf2go.NewResource(owlVersionInfo), nil)
+	if info == nil {
+		return "", fmt.Errorf("ontology has no version")
+	}
+	return fmt.Sprintf("%s-%d", info.Object.RawValue(), exportFormatRevision), nil
+}
+
+// tripleHash hashes a line of N-Triples, so a set of triples can be held compactly.
+func tripleHash(line string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(line))
+	return hash.Sum64()
+}
+
+// hashTriples returns the hash of every triple in an N-Triples file.
+func hashTriples(path string) (hashes map[uint64]bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	hashes = make(map[uint64]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		hashes[tripleHash(scanner.Text())] = true
+	}
+	err = scanner.Err()
+	return
+}
+
+// writeDiff writes each triple in the N-Triples file at fromPath which isn't among the
+// hashes given to a new file, once, returning the new file's path.
+func writeDiff(fromPath string, exclude map[uint64]bool, dir string) (path string, err error) {
+	from, err := os.Open(fromPath)
+	if err != nil {
+		return
+	}
+	defer from.Close()
+	tmp, err := os.CreateTemp(dir, "*.nt.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp delta file: %w", err)
+	}
+	path = tmp.Name()
+	defer tmp.Close()
+
+	written := make(map[uint64]bool)
+	output := bufio.NewWriter(tmp)
+	scanner := bufio.NewScanner(from)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		hash := tripleHash(scanner.Text())
+		if exclude[hash] || written[hash] {
+			continue
+		}
+		written[hash] = true
+		if _, err = output.WriteString(scanner.Text() + "\n"); err != nil {
+			return
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if err = output.Flush(); err != nil {
+		return
+	}
+	err = tmp.Close()
+	return
+}
+
+// writeDeltas compares the previously published N-Triples export with a newly written one,
+// writing temp files of the triples added and removed.  Only hashes of the triples are
+// held in memory, rather than the triples themselves.
+func writeDeltas(previousPath string, currentPath string) (addedPath string, removedPath string, err error) {
+	previous, err := hashTriples(previousPath)
+	if err != nil {
+		return
+	}
+	current, err := hashTriples(currentPath)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(currentPath)
+	addedPath, err = writeDiff(currentPath, previous, dir)
+	if err != nil {
+		return
+	}
+	removedPath, err = writeDiff(previousPath, current, dir)
+	return
+}
+
+// exportPublished reports whether the export at outFile, and its dataset description,
+// have been published in every format.
+func exportPublished(outFile string) bool {
+	for _, format := range ExportFormats {
+		if _, err := os.Stat(ExportPath(outFile, format)); err != nil {
+			return false
+		}
+		if _, err := os.Stat(DatasetPath(outFile, format)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// publishDelta compares a newly written N-Triples export with the published one it's
+// replacing, publishing the differences as delta files and adding them to the manifest.
+// Nothing is published if either version is unknown, or there's no previous export.
+// Deltas beyond deltaRetention are dropped from the manifest and deleted.
+func publishDelta(outFile string, previousNTriples string, newNTriples string, manifest *ExportManifest, previous ExportManifest) error {
+	manifest.Deltas = previous.Deltas
+	if _, err := os.Stat(previousNTriples); previous.Version == 0 || manifest.Version == 0 || err != nil {
+		return nil
+	}
+	addedTmp, removedTmp, err := writeDeltas(previousNTriples, newNTriples)
+	defer os.Remove(addedTmp)
+	defer os.Remove(removedTmp)
+	if err != nil {
+		return fmt.Errorf("failed to compare with the previous export: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(outFile), filepath.Ext(outFile))
+	delta := ExportDelta{
+		From:    previous.Version,
+		To:      manifest.Version,
+		Added:   fmt.Sprintf("%s.delta-%d-%d.added.nt", base, previous.Version, manifest.Version),
+		Removed: fmt.Sprintf("%s.delta-%d-%d.removed.nt", base, previous.Version, manifest.Version),
+	}
+	dir := filepath.Dir(outFile)
+	if err := os.Rename(addedTmp, filepath.Join(dir, delta.Added)); err != nil {
+		return fmt.Errorf("failed to publish delta file: %w", err)
+	}
+	if err := os.Rename(removedTmp, filepath.Join(dir, delta.Removed)); err != nil {
+		return fmt.Errorf("failed to publish delta file: %w", err)
+	}
+	manifest.Deltas = append(manifest.Deltas, delta)
+	for len(manifest.Deltas) > deltaRetention {
+		os.Remove(filepath.Join(dir, manifest.Deltas[0].Added))
+		os.Remove(filepath.Join(dir, manifest.Deltas[0].Removed))
+		manifest.Deltas = manifest.Deltas[1:]
+	}
+	return nil
+}
+
+// publishManifest atomically publishes the manifest for the export at outFile.
+func publishManifest(outFile string, manifest ExportManifest) error {
+	if manifest.ExportedAt == "" {
+		manifest.ExportedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if manifest.Deltas == nil {
+		manifest.Deltas = []ExportDelta{}
+	}
+	content, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(outFile), "*.manifest.json.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp manifest file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp manifest file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ManifestPath(outFile)); err != nil {
+		return fmt.Errorf("failed to atomically publish manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package rdfgen
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createVersionedExportDB creates a synthetic library with a data_version table, as the
+// api maintains, returning its path and a connection for making changes.
+func createVersionedExportDB(t *testing.T, tracks int) (string, *sql.DB) {
+	t.Helper()
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(t, tracks)
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+	CREATE TABLE data_version (id INTEGER PRIMARY KEY, version INTEGER NOT NULL, updated_at TEXT NOT NULL);
+	INSERT INTO data_version VALUES (1, 1, '2026-01-01T00:00:00Z');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbPath, db
+}
+
+// bumpDataVersion makes a change to the library, bumping the data version as the api's triggers do.
+func bumpDataVersion(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE data_version SET version = version + 1`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readManifest reads an export's manifest, failing the test if it can't be read.
+func readManifest(t *testing.T, outFile string) ExportManifest {
+	t.Helper()
+	manifest, err := ReadManifest(outFile)
+	if err != nil {
+		t.Fatalf("could not read manifest: %v", err)
+	}
+	return manifest
+}
+
+// withoutDatasetDescription filters out the N-Triples lines describing the dataset, which
+// change with every export, leaving those about the library.
+func withoutDatasetDescription(lines []string) (library []string) {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "<http://localhost:3002/v2/export/dataset#") {
+			library = append(library, line)
+		}
+	}
+	return
+}
+
+// TestExportSkippedWhenUnchanged checks nothing is re-exported until the data version changes.
+func TestExportSkippedWhenUnchanged(t *testing.T) {
+	dbPath, db := createVersionedExportDB(t, 5)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("first export failed: %v", err)
+	}
+	manifest := readManifest(t, outFile)
+	if manifest.Version != 1 || len(manifest.Deltas) != 0 {
+		t.Errorf("expected manifest for version 1 with no deltas, got %+v", manifest)
+	}
+
+	if err := ExportRDF(dbPath, outFile); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("expected ErrUnchanged exporting an unchanged library, got %v", err)
+	}
+
+	// A missing snapshot gets re-exported, even though the version hasn't changed
+	os.Remove(ExportPath(outFile, ExportFormats[3]))
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Errorf("expected a missing snapshot to be re-exported, got %v", err)
+	}
+
+	bumpDataVersion(t, db, `UPDATE artist SET name = 'Renamed' WHERE id = 1`)
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Errorf("expected a changed library to be exported, got %v", err)
+	}
+	if manifest := readManifest(t, outFile); manifest.Version != 2 {
+		t.Errorf("expected manifest for version 2, got %+v", manifest)
+	}
+}
+
+// TestExportRedoneWhenOutputChanges checks an export taken by an exporter which output
+// the library differently isn't skipped, even though the data version hasn't changed.
+func TestExportRedoneWhenOutputChanges(t *testing.T) {
+	dbPath, _ := createVersionedExportDB(t, 5)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("first export failed: %v", err)
+	}
+	output, err := outputVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := readManifest(t, outFile)
+	if manifest.OutputVersion != output {
+		t.Errorf("expected manifest for output version %q, got %+v", output, manifest)
+	}
+
+	// An export from before output versions were recorded has none in its manifest
+	for _, previous := range []string{"0123456789abcdef-0", ""} {
+		manifest.OutputVersion = previous
+		if err := publishManifest(outFile, manifest); err != nil {
+			t.Fatal(err)
+		}
+		if err := ExportRDF(dbPath, outFile); err != nil {
+			t.Errorf("expected an export with output version %q to be redone, got %v", previous, err)
+		}
+		if manifest := readManifest(t, outFile); manifest.OutputVersion != output || manifest.Version != 1 {
+			t.Errorf("expected manifest for version 1 and output version %q, got %+v", output, manifest)
+		}
+	}
+}
+
+// TestExportWithoutDataVersion checks a library without a data version is always exported,
+// without any deltas, as it's unknown what changed.
+func TestExportWithoutDataVersion(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(t, 5)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	for i := 0; i < 2; i++ {
+		if err := ExportRDF(dbPath, outFile); err != nil {
+			t.Fatalf("export %d failed: %v", i, err)
+		}
+	}
+	if manifest := readManifest(t, outFile); manifest.Version != 0 || len(manifest.Deltas) != 0 {
+		t.Errorf("expected manifest for version 0 with no deltas, got %+v", manifest)
+	}
+}
+
+// TestExportPublishesDeltas checks the triples added and removed by a change are published
+// as delta files, and that applying them to the previous snapshot gives the new one.
+// Snapshots can repeat a triple, so they're compared as sets.
+func TestExportPublishesDeltas(t *testing.T) {
+	dbPath, db := createVersionedExportDB(t, 5)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("first export failed: %v", err)
+	}
+	before := readLines(t, ExportPath(outFile, ExportFormats[1]))
+
+	bumpDataVersion(t, db, `UPDATE tag SET value = 'Changed title' WHERE trackid = 1 AND predicateid = 'title'`)
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("second export failed: %v", err)
+	}
+	after := readLines(t, ExportPath(outFile, ExportFormats[1]))
+
+	manifest := readManifest(t, outFile)
+	if len(manifest.Deltas) != 1 {
+		t.Fatalf("expected 1 delta in manifest, got %+v", manifest)
+	}
+	delta := manifest.Deltas[0]
+	if delta.From != 1 || delta.To != 2 || delta.Added != "export.delta-1-2.added.nt" || delta.Removed != "export.delta-1-2.removed.nt" {
+		t.Errorf("unexpected delta %+v", delta)
+	}
+	added := readLines(t, filepath.Join(filepath.Dir(outFile), delta.Added))
+	removed := readLines(t, filepath.Join(filepath.Dir(outFile), delta.Removed))
+	if library := withoutDatasetDescription(added); len(library) != 1 || !strings.Contains(library[0], `"Changed title"`) {
+		t.Errorf("expected only the new title to be added, got %q", added)
+	}
+	if library := withoutDatasetDescription(removed); len(library) != 1 || !strings.Contains(library[0], `"Track 1\t`) {
+		t.Errorf("expected only the old title to be removed, got %q", removed)
+	}
+
+	patched := map[string]bool{}
+	for _, line := range before {
+		patched[line] = true
+	}
+	for _, line := range removed {
+		delete(patched, line)
+	}
+	for _, line := range added {
+		patched[line] = true
+	}
+	expected := map[string]bool{}
+	for _, line := range after {
+		expected[line] = true
+		if !patched[line] {
+			t.Errorf("applying the delta didn't give triple %s", line)
+		}
+	}
+	for line := range patched {
+		if !expected[line] {
+			t.Errorf("applying the delta gave extra triple %s", line)
+		}
+	}
+}
+
+// TestExportPrunesOldDeltas checks only the most recent deltas are kept, and the files of
+// older ones are deleted.
+func TestExportPrunesOldDeltas(t *testing.T) {
+	dbPath, db := createVersionedExportDB(t, 2)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	for i := 0; i <= deltaRetention+2; i++ {
+		if i > 0 {
+			bumpDataVersion(t, db, `UPDATE artist SET name = ? WHERE id = 1`, fmt.Sprintf("Name %d", i))
+		}
+		if err := ExportRDF(dbPath, outFile); err != nil {
+			t.Fatalf("export %d failed: %v", i, err)
+		}
+	}
+	manifest := readManifest(t, outFile)
+	if len(manifest.Deltas) != deltaRetention {
+		t.Fatalf("expected %d deltas, got %d", deltaRetention, len(manifest.Deltas))
+	}
+	if manifest.Deltas[0].From != 3 {
+		t.Errorf("expected oldest remaining delta to be from version 3, got %d", manifest.Deltas[0].From)
+	}
+	deltaFiles, _ := filepath.Glob(filepath.Join(filepath.Dir(outFile), "export.delta-*"))
+	if len(deltaFiles) != deltaRetention*2 {
+		t.Errorf("expected %d delta files, found %d", deltaRetention*2, len(deltaFiles))
+	}
+}
+
+// readLines reads a file's non-empty lines.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
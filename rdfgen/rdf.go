@@ -3,10 +3,13 @@ package rdfgen
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/deiu/rdf2go"
@@ -23,7 +26,10 @@ const (
 	skosPrefLabel     = "http://www.w3.org/2004/02/skos/core#prefLabel"
 	rdfType           = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
 	rdfsComment       = "http://www.w3.org/2000/01/rdf-schema#comment"
+	rdfsLabel         = "http://www.w3.org/2000/01/rdf-schema#label"
+	rdfsIsDefinedBy   = "http://www.w3.org/2000/01/rdf-schema#isDefinedBy"
 	xsdInteger        = "http://www.w3.org/2001/XMLSchema#integer"
+	owlVersionInfo    = "http://www.w3.org/2002/07/owl#versionInfo"
 )
 
 /**
@@ -58,11 +64,19 @@ func resolvePredicateURI(predicateURI string, appOrigin string) string {
 func mapPredicate(predicateID string, value string, uri *string, mediaMetadataManagerOrigin string, appOrigin string) (string, []rdf2go.Term) {
 
 	// Dispatch on PredicateConfig for all explicitly registered predicates
-	// (Literal, URIObject, MBIDPrefix, and explicitly-omitted ones like lastSuccessfulPlay).
+	// (Literal, URIObject, and explicitly-omitted ones like lastSuccessfulPlay).
 	if rdfConfig, ok := predicateconfig.Get(predicateID); ok {
 		switch rdfConfig.ValueShape {
 		case predicateconfig.ValueShapeLiteral:
 			predicateURI := resolvePredicateURI(rdfConfig.PredicateURI, appOrigin)
+			if rdfConfig.ValidateValue != nil && rdfConfig.ValidateValue(value) != "" {
+				// Values written before validation was added (eg a track_number of "3/12")
+				// are left out, as a literal which doesn't fit its datatype fails the export's validation.
+				return "", nil
+			}
+			if rdfConfig.Datatype != "" {
+				return predicateURI, []rdf2go.Term{rdf2go.NewLiteralWithDatatype(value, rdf2go.NewResource(rdfConfig.Datatype))}
+			}
 			return predicateURI, []rdf2go.Term{rdf2go.NewLiteral(value)}
 		case predicateconfig.ValueShapeURIObject:
 			predicateURI := resolvePredicateURI(rdfConfig.PredicateURI, appOrigin)
@@ -70,9 +84,6 @@ func mapPredicate(predicateID string, value string, uri *string, mediaMetadataMa
 				return "", nil // skip tags with no URI — value alone is not a valid IRI
 			}
 			return predicateURI, []rdf2go.Term{rdf2go.NewResource(*uri)}
-		case predicateconfig.ValueShapeMBIDPrefix:
-			predicateURI := resolvePredicateURI(rdfConfig.PredicateURI, appOrigin)
-			return predicateURI, []rdf2go.Term{rdf2go.NewResource(rdfConfig.URIPrefix + value)}
 		case predicateconfig.ValueShapeOmit:
 			// Explicitly suppressed from RDF output (e.g. lastSuccessfulPlay).
 			return "", nil
@@ -87,7 +98,8 @@ func mapPredicate(predicateID string, value string, uri *string, mediaMetadataMa
 }
 
 
-// ExportRDF queries the live database and atomically publishes a Turtle export file.
+// ExportRDF queries the live database and atomically publishes the export in each of
+// ExportFormats, at outFile with its extension swapped for the format's (see ExportPath).
 //
 // Database access: the DB is opened directly (no file copy) with snapshot isolation
 // provided by SQLite WAL mode. The volume mount must be read-write (not :ro) so SQLite
@@ -95,9 +107,27 @@ func mapPredicate(predicateID string, value string, uri *string, mediaMetadataMa
 // defence-in-depth that :ro previously provided by making the connection structurally
 // incapable of writing. _busy_timeout=10000 aligns with the api's setting.
 //
-// Atomic publish: output is serialized to a temp file in the same directory as outFile
+// Streaming: triples are written out by a TripleWriter for each format as the rows are
+// read, rather than built into a graph first, so memory doesn't grow with the number of
+// tracks.  Only the album credits, artist aliases and group members, the ontology, and
+// the triples about the current subject (for counting them once) are held in memory.
+//
+// Atomic publish: each format is serialized to a temp file in the same directory as outFile
 // then renamed into place, so the api's http.ServeFile always sees either the old
 // complete file or the new one — never a partial write.
+//
+// Incremental export: the api bumps a data version on every write which changes what
+// is exported.  If neither it nor the output version (see outputVersion) has changed
+// since the export recorded in the manifest, ErrUnchanged is returned and nothing is
+// written.  Otherwise the triples added and removed since the previous export are
+// published as delta files, listed in the manifest, which is published last.
+//
+// Dataset description: a VoID and DCAT description of the export, counted up as its
+// triples are written, is appended to it and also published on its own at DatasetPath.
+//
+// Validation: the triples are checked as they're written against shapes derived from
+// predicateconfig (see deriveShapes).  If any don't match, a ValidationError is returned
+// and nothing is published, leaving the last good export in place.
 func ExportRDF(dbPath, outFile string) error {
 	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=10000&_query_only=true")
 	if err != nil {
@@ -105,6 +135,106 @@ func ExportRDF(dbPath, outFile string) error {
 	}
 	defer db.Close()
 
+	// Read before any tracks, so a write made mid-export gets picked up by the next one
+	version, err := readDataVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to read data version: %w", err)
+	}
+	output, err := outputVersion()
+	if err != nil {
+		return err
+	}
+	previous, _ := ReadManifest(outFile)
+	if version != 0 && previous.Version == version && previous.OutputVersion == output && exportPublished(outFile) {
+		return ErrUnchanged
+	}
+
+	tmpPaths := make([]string, len(ExportFormats))
+	tmpFiles := make([]*os.File, len(ExportFormats))
+	writers := make([]*TripleWriter, len(ExportFormats))
+	for i, format := range ExportFormats {
+		tmpFiles[i], err = os.CreateTemp(filepath.Dir(outFile), "*"+format.Extension+".tmp")
+		if err != nil {
+			return fmt.Errorf("failed to create temp output file: %w", err)
+		}
+		tmpPaths[i] = tmpFiles[i].Name()
+		defer os.Remove(tmpPaths[i]) // no-op if rename succeeds; cleans up on any error path
+		defer tmpFiles[i].Close()
+		writers[i], err = NewTripleWriter(tmpFiles[i], format.MIME)
+		if err != nil {
+			return err
+		}
+	}
+	add := func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+		for _, writer := range writers {
+			writer.AddTriple(subject, predicate, object)
+		}
+	}
+
+	stats := newDatasetStats()
+	validator := newValidator()
+	trackCount, err := writeExport(db, validator.checking(stats.counting(add)))
+	if err != nil {
+		return err
+	}
+	if trackCount == 0 {
+		return fmt.Errorf("sanity check failed: export produced 0 tracks; refusing to overwrite output file")
+	}
+	if err := validator.Err(); err != nil {
+		return err
+	}
+	generatedAt := time.Now()
+	description := rdf2go.NewGraph("")
+	writeDatasetDescription(stats, version, generatedAt, description.AddTriple)
+	for triple := range description.IterTriples() {
+		add(triple.Subject, triple.Predicate, triple.Object)
+	}
+
+	// A mid-serialize failure never corrupts the previously-good export, and nothing
+	// is renamed until every format has been written, so the formats stay in step.
+	for i, format := range ExportFormats {
+		if err := writers[i].Close(); err != nil {
+			return fmt.Errorf("failed to serialize RDF as %s: %w", format.MIME, err)
+		}
+		if err := tmpFiles[i].Close(); err != nil {
+			return fmt.Errorf("failed to close temp output file: %w", err)
+		}
+	}
+	manifest := ExportManifest{Version: version, OutputVersion: output, ExportedAt: generatedAt.UTC().Format(time.RFC3339)}
+	for i, format := range ExportFormats {
+		if format.MIME == "application/n-triples" {
+			if err := publishDelta(outFile, ExportPath(outFile, format), tmpPaths[i], &manifest, previous); err != nil {
+				return err
+			}
+		}
+	}
+	for i, format := range ExportFormats {
+		if err := os.Rename(tmpPaths[i], ExportPath(outFile, format)); err != nil {
+			return fmt.Errorf("failed to atomically publish output file: %w", err)
+		}
+	}
+	if err := publishDataset(outFile, description); err != nil {
+		return err
+	}
+	return publishManifest(outFile, manifest)
+}
+
+// WriteGraph adds every triple in the bulk export, read from the database as ExportRDF
+// does, for building the export in memory rather than publishing it.
+func WriteGraph(db *sql.DB, add func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term)) error {
+	_, err := writeExport(db, add)
+	return err
+}
+
+// writeExport adds every triple in the export, reading tracks, albums, artists and
+// collections a row at a time, followed by the ontology (see writeOntology).
+// It returns the number of tracks.
+func writeExport(db *sql.DB, add tripleAdder) (int, error) {
+	ontologyGraph, err := OntologyToRdf()
+	if err != nil {
+		return 0, err
+	}
+
 	rows, err := db.Query(`
 		SELECT t.id, t.url, t.duration, tg.predicateid, tg.value, tg.uri
 		FROM track t
@@ -112,120 +242,251 @@ func ExportRDF(dbPath, outFile string) error {
 		ORDER BY t.id
 	`)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer rows.Close()
+	trackCount, err := writeTracks(rows, add)
+	if err != nil {
+		return trackCount, err
+	}
+	rows.Close()
+
+	if err := writeExportAlbums(db, add); err != nil {
+		return trackCount, err
+	}
+	if err := writeExportArtists(db, add); err != nil {
+		return trackCount, err
+	}
+	if err := writeExportCollections(db, add); err != nil {
+		return trackCount, err
+	}
+	writeOntology(ontologyGraph, add)
+	return trackCount, nil
+}
+
+// writeOntology adds the ontology, along with the type-level metadata for each class of
+// entity, which some of the ontology also describes.  Each triple is added once, and
+// the triples about each subject together.
+func writeOntology(ontologyGraph *rdf2go.Graph, add tripleAdder) {
+	triples := map[string]*rdf2go.Triple{}
+	collect := func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+		triple := rdf2go.NewTriple(subject, predicate, object)
+		triples[triple.String()] = triple
+	}
+	for triple := range ontologyGraph.IterTriples() {
+		collect(triple.Subject, triple.Predicate, triple.Object)
+	}
+	writeTrackClass(collect)
+	writeAlbumClass(collect)
+	writeArtistClasses(collect)
+	writeCollectionClass(collect)
+	for _, key := range sortedKeys(triples) {
+		add(triples[key].Subject, triples[key].Predicate, triples[key].Object)
+	}
+}
 
-	albumRows, err := db.Query(`SELECT id, name FROM album ORDER BY id`)
+// writeExportAlbums adds the triples for every album, a row at a time.
+func writeExportAlbums(db *sql.DB, add tripleAdder) error {
+	albumArtistRows, err := db.Query(`SELECT albumid, artistid FROM album_artist ORDER BY albumid, position`)
 	if err != nil {
 		return err
 	}
-	defer albumRows.Close()
+	defer albumArtistRows.Close()
+	albumArtists := make(map[int][]int)
+	for albumArtistRows.Next() {
+		var albumID, artistID int
+		if err := albumArtistRows.Scan(&albumID, &artistID); err != nil {
+			return err
+		}
+		albumArtists[albumID] = append(albumArtists[albumID], artistID)
+	}
+	if err := albumArtistRows.Err(); err != nil {
+		return err
+	}
 
-	artistRows, err := db.Query(`SELECT id, name, person_uri FROM artist ORDER BY id`)
+	albumRows, err := db.Query(`SELECT id, name, year, mbid_release, track_count, disc_count, artwork FROM album ORDER BY id`)
 	if err != nil {
 		return err
 	}
-	defer artistRows.Close()
+	defer albumRows.Close()
+	for albumRows.Next() {
+		var a AlbumData
+		var year, trackCount, discCount sql.NullInt64
+		var mbidRelease, artwork sql.NullString
+		if err := albumRows.Scan(&a.ID, &a.Name, &year, &mbidRelease, &trackCount, &discCount, &artwork); err != nil {
+			return err
+		}
+		a.Year = nullIntToPtr(year)
+		a.TrackCount = nullIntToPtr(trackCount)
+		a.DiscCount = nullIntToPtr(discCount)
+		a.MBIDRelease = mbidRelease.String
+		a.Artwork = artwork.String
+		a.ArtistIDs = albumArtists[a.ID]
+		writeAlbum(a, add)
+	}
+	return albumRows.Err()
+}
 
-	ontologyGraph, err := OntologyToRdf()
+// writeExportArtists adds the triples for every artist, a row at a time.
+func writeExportArtists(db *sql.DB, add tripleAdder) error {
+	artistAliasRows, err := db.Query(`SELECT artistid, name FROM artist_alias ORDER BY artistid, name`)
 	if err != nil {
 		return err
 	}
-	g, trackCount, err := TrackToRdf(rows)
-	if err != nil {
+	defer artistAliasRows.Close()
+	artistAliases := make(map[int][]string)
+	for artistAliasRows.Next() {
+		var artistID int
+		var alias string
+		if err := artistAliasRows.Scan(&artistID, &alias); err != nil {
+			return err
+		}
+		artistAliases[artistID] = append(artistAliases[artistID], alias)
+	}
+	if err := artistAliasRows.Err(); err != nil {
 		return err
 	}
-	if trackCount == 0 {
-		return fmt.Errorf("sanity check failed: export produced 0 tracks; refusing to overwrite output file")
+
+	artistMemberRows, err := db.Query(`SELECT groupid, IFNULL(memberid, 0), IFNULL(person_uri, '') FROM artist_member ORDER BY groupid, position`)
+	if err != nil {
+		return err
 	}
-	var albums []AlbumData
-	for albumRows.Next() {
-		var a AlbumData
-		if err := albumRows.Scan(&a.ID, &a.Name); err != nil {
+	defer artistMemberRows.Close()
+	artistMembers := make(map[int][]MemberData)
+	for artistMemberRows.Next() {
+		var groupID int
+		var m MemberData
+		if err := artistMemberRows.Scan(&groupID, &m.ArtistID, &m.PersonURI); err != nil {
 			return err
 		}
-		albums = append(albums, a)
+		artistMembers[groupID] = append(artistMembers[groupID], m)
 	}
-	if err := albumRows.Err(); err != nil {
+	if err := artistMemberRows.Err(); err != nil {
 		return err
 	}
-	albumGraph, err := AlbumToRdf(albums)
+
+	artistRows, err := db.Query(`SELECT id, name, person_uri, sort_name, mbid_artist, type FROM artist ORDER BY id`)
 	if err != nil {
 		return err
 	}
-	g.Merge(albumGraph)
-
-	var artists []ArtistData
+	defer artistRows.Close()
 	for artistRows.Next() {
 		var a ArtistData
-		var personURIRaw sql.NullString
-		if err := artistRows.Scan(&a.ID, &a.Name, &personURIRaw); err != nil {
+		var personURIRaw, sortName, mbidArtist, artistType sql.NullString
+		if err := artistRows.Scan(&a.ID, &a.Name, &personURIRaw, &sortName, &mbidArtist, &artistType); err != nil {
 			return err
 		}
 		if personURIRaw.Valid && personURIRaw.String != "" {
 			a.PersonURI = &personURIRaw.String
 		}
-		artists = append(artists, a)
+		a.SortName = sortName.String
+		a.MBIDArtist = mbidArtist.String
+		a.Type = artistType.String
+		a.Aliases = artistAliases[a.ID]
+		a.Members = artistMembers[a.ID]
+		writeArtist(a, add)
 	}
-	if err := artistRows.Err(); err != nil {
+	return artistRows.Err()
+}
+
+// writeExportCollections adds the triples for every collection, a row at a time.
+// Only static collections list their tracks, as the membership of smart and composed
+// collections is resolved by the api from their definitions.  They're typed with
+// ontology#SmartCollection or ontology#ComposedCollection, so they aren't taken to be
+// empty static collections.
+func writeExportCollections(db *sql.DB, add tripleAdder) error {
+	memberRows, err := db.Query(`
+		SELECT ct.collectionslug, ct.trackid
+		FROM collection_track ct
+		INNER JOIN collection c ON c.slug = ct.collectionslug
+		WHERE c.query IS NULL AND c.operation IS NULL
+		ORDER BY ct.collectionslug, ct.position
+	`)
+	if err != nil {
 		return err
 	}
-	artistGraph, err := ArtistToRdf(artists)
-	if err != nil {
+	defer memberRows.Close()
+	collectionTracks := make(map[string][]int)
+	for memberRows.Next() {
+		var slug string
+		var trackID int
+		if err := memberRows.Scan(&slug, &trackID); err != nil {
+			return err
+		}
+		collectionTracks[slug] = append(collectionTracks[slug], trackID)
+	}
+	if err := memberRows.Err(); err != nil {
 		return err
 	}
-	g.Merge(artistGraph)
-	g.Merge(ontologyGraph)
 
-	// Serialize to a temp file on the same filesystem, then rename atomically.
-	// Consumers only ever see a complete file; a mid-serialize failure never
-	// corrupts the previously-good export.
-	tmp, err := os.CreateTemp(filepath.Dir(outFile), "*.ttl.tmp")
+	collectionRows, err := db.Query(`
+		SELECT slug, name, IFNULL(icon, ''),
+			CASE WHEN operation IS NOT NULL THEN 'composed' WHEN query IS NOT NULL THEN 'smart' ELSE 'static' END
+		FROM collection
+		ORDER BY slug
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to create temp output file: %w", err)
-	}
-	tmpPath := tmp.Name()
-	defer os.Remove(tmpPath) // no-op if rename succeeds; cleans up on any error path
-
-	if err := g.Serialize(tmp, "turtle"); err != nil {
-		tmp.Close()
-		return fmt.Errorf("failed to serialize RDF: %w", err)
+		return err
 	}
-	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("failed to close temp output file: %w", err)
+	defer collectionRows.Close()
+	for collectionRows.Next() {
+		var c CollectionData
+		if err := collectionRows.Scan(&c.Slug, &c.Name, &c.Icon, &c.MembershipType); err != nil {
+			return err
+		}
+		c.TrackIDs = collectionTracks[c.Slug]
+		writeCollection(c, add)
 	}
-	if err := os.Rename(tmpPath, outFile); err != nil {
-		return fmt.Errorf("failed to atomically publish output file: %w", err)
+	return collectionRows.Err()
+}
+
+// nullIntToPtr converts a nullable integer column to an *int, nil for NULL.
+func nullIntToPtr(ni sql.NullInt64) *int {
+	if !ni.Valid {
+		return nil
 	}
-	return nil
+	i := int(ni.Int64)
+	return &i
 }
+
 // TrackToRdf converts a query result over the track+tag join into an RDF graph.
 // It returns the graph, the number of distinct tracks emitted, and any error.
 // The caller should treat trackCount == 0 as a sign something went wrong.
 func TrackToRdf(rows *sql.Rows) (*rdf2go.Graph, int, error) {
-	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
-	appOrigin := os.Getenv("APP_ORIGIN")
 	g := rdf2go.NewGraph("")
+	writeTrackClass(g.AddTriple)
+	trackCount, err := writeTracks(rows, g.AddTriple)
+	return g, trackCount, err
+}
+
+// writeTrackClass adds the type-level metadata for mo:Track.
+func writeTrackClass(add tripleAdder) {
 	moTrack := rdf2go.NewResource("http://purl.org/ontology/mo/Track")
-	g.AddTriple(moTrack,
+	add(moTrack,
 		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
 		rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class"),
 	)
-	g.AddTriple(moTrack,
+	add(moTrack,
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Track", "en"),
 	)
-	g.AddTriple(
+	add(
 		moTrack,
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/hasCategory"),
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 	)
-	g.AddTriple(
+	add(
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Musical", "en"),
 	)
+}
+
+// writeTracks adds the triples for each track in a query result over the track+tag
+// join, ordered by track, as it goes.  It returns the number of distinct tracks.
+func writeTracks(rows *sql.Rows, add tripleAdder) (int, error) {
+	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	appOrigin := os.Getenv("APP_ORIGIN")
 	var lastTrackID int
 	var subject rdf2go.Term
 	trackCount := 0
@@ -237,18 +498,18 @@ func TrackToRdf(rows *sql.Rows) (*rdf2go.Graph, int, error) {
 		var predicateID, value, uri *string
 
 		if err := rows.Scan(&trackID, &urlStr, &duration, &predicateID, &value, &uri); err != nil {
-			return g, trackCount, err
+			return trackCount, err
 		}
 
 		if trackID != lastTrackID {
 			trackCount++
 			subject = rdf2go.NewResource(fmt.Sprintf("%s/tracks/%d", mediaMetadataManagerOrigin, trackID))
-			g.AddTriple(subject,
+			add(subject,
 				rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
 				rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
 
 			if urlStr != "" {
-				g.AddTriple(subject, rdf2go.NewResource("http://purl.org/dc/terms/identifier"),
+				add(subject, rdf2go.NewResource("http://purl.org/dc/terms/identifier"),
 					rdf2go.NewLiteral(urlStr))
 			}
 			if duration != nil {
@@ -256,7 +517,7 @@ func TrackToRdf(rows *sql.Rows) (*rdf2go.Graph, int, error) {
 					"PT"+strconv.Itoa(*duration)+"S",
 					rdf2go.NewResource("http://www.w3.org/2001/XMLSchema#duration"),
 				)
-				g.AddTriple(subject, rdf2go.NewResource("http://purl.org/ontology/mo/duration"), durLiteral)
+				add(subject, rdf2go.NewResource("http://purl.org/ontology/mo/duration"), durLiteral)
 			}
 			lastTrackID = trackID
 		}
@@ -264,72 +525,148 @@ func TrackToRdf(rows *sql.Rows) (*rdf2go.Graph, int, error) {
 		if predicateID != nil && value != nil {
 			predURI, objs := mapPredicate(*predicateID, *value, uri, mediaMetadataManagerOrigin, appOrigin)
 			for _, obj := range objs {
-				g.AddTriple(subject, rdf2go.NewResource(predURI), obj)
+				add(subject, rdf2go.NewResource(predURI), obj)
 			}
 		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return g, trackCount, err
+		return trackCount, err
 	}
-	return g, trackCount, nil
+	return trackCount, nil
 }
 // AlbumData holds the fields needed by AlbumToRdf to build album RDF triples.
+// Optional fields are nil or empty when unknown.
 type AlbumData struct {
-	ID   int
-	Name string
+	ID          int
+	Name        string
+	ArtistIDs   []int // credited artists, in credit order
+	Year        *int
+	MBIDRelease string
+	TrackCount  *int
+	DiscCount   *int
+	Artwork     string
 }
 
 // AlbumToRdf converts a slice of albums into an RDF graph.
 // Emits rdf:type mo:Record and skos:prefLabel for each album,
 // plus type-level metadata for mo:Record itself so the document is self-contained.
+//
+// Where known, also emits foaf:maker for each credited artist, dc:date for the
+// release year, mo:musicbrainz for the MusicBrainz release, mo:track_count,
+// ontology#discCount and foaf:depiction for the artwork.
 func AlbumToRdf(albums []AlbumData) (*rdf2go.Graph, error) {
-	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
 	g := rdf2go.NewGraph("")
+	writeAlbumClass(g.AddTriple)
+	for _, album := range albums {
+		writeAlbum(album, g.AddTriple)
+	}
+	return g, nil
+}
+
+// writeAlbumClass adds the type-level metadata for mo:Record.
+func writeAlbumClass(add tripleAdder) {
 	moRecord := rdf2go.NewResource("http://purl.org/ontology/mo/Record")
-	g.AddTriple(moRecord,
+	add(moRecord,
 		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
 		rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class"),
 	)
-	g.AddTriple(moRecord,
+	add(moRecord,
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Album", "en"),
 	)
-	g.AddTriple(
+	add(
 		moRecord,
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/hasCategory"),
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 	)
-	g.AddTriple(
+	add(
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Musical", "en"),
 	)
+}
 
-	for _, album := range albums {
-		subject := rdf2go.NewResource(fmt.Sprintf("%s/albums/%d", mediaMetadataManagerOrigin, album.ID))
-		g.AddTriple(subject,
-			rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
-			rdf2go.NewResource("http://purl.org/ontology/mo/Record"))
-		g.AddTriple(subject,
-			rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
-			rdf2go.NewLiteral(album.Name))
+// writeAlbum adds the triples for an album.
+func writeAlbum(album AlbumData, add tripleAdder) {
+	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	appOrigin := os.Getenv("APP_ORIGIN")
+	subject := rdf2go.NewResource(fmt.Sprintf("%s/albums/%d", mediaMetadataManagerOrigin, album.ID))
+	add(subject,
+		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
+		rdf2go.NewResource("http://purl.org/ontology/mo/Record"))
+	add(subject,
+		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
+		rdf2go.NewLiteral(album.Name))
+	for _, artistID := range album.ArtistIDs {
+		add(subject,
+			rdf2go.NewResource("http://xmlns.com/foaf/0.1/maker"),
+			rdf2go.NewResource(fmt.Sprintf("%s/artists/%d", mediaMetadataManagerOrigin, artistID)))
+	}
+	if album.Year != nil {
+		add(subject,
+			rdf2go.NewResource("http://purl.org/dc/terms/date"),
+			rdf2go.NewLiteralWithDatatype(fmt.Sprintf("%04d", *album.Year), rdf2go.NewResource("http://www.w3.org/2001/XMLSchema#gYear")))
+	}
+	if album.MBIDRelease != "" {
+		add(subject,
+			rdf2go.NewResource("http://purl.org/ontology/mo/musicbrainz"),
+			rdf2go.NewResource(predicateconfig.GetConfig("mbid_release").URIPrefix+album.MBIDRelease))
+	}
+	if album.TrackCount != nil {
+		add(subject,
+			rdf2go.NewResource("http://purl.org/ontology/mo/track_count"),
+			rdf2go.NewLiteralWithDatatype(strconv.Itoa(*album.TrackCount), rdf2go.NewResource(xsdInteger)))
+	}
+	if album.DiscCount != nil {
+		add(subject,
+			rdf2go.NewResource(appOrigin+"/ontology#discCount"),
+			rdf2go.NewLiteralWithDatatype(strconv.Itoa(*album.DiscCount), rdf2go.NewResource(xsdInteger)))
+	}
+	if album.Artwork != "" {
+		add(subject,
+			rdf2go.NewResource("http://xmlns.com/foaf/0.1/depiction"),
+			rdf2go.NewResource(album.Artwork))
 	}
-
-	return g, nil
 }
 
 // ArtistData holds the fields needed by ArtistToRdf to build artist RDF triples.
+// Optional string fields are empty when unknown.
 type ArtistData struct {
-	ID        int
-	Name      string
-	PersonURI *string // nil if no identity link (ADR-0009)
+	ID         int
+	Name       string
+	PersonURI  *string // nil if no identity link (ADR-0009)
+	SortName   string
+	Aliases    []string
+	MBIDArtist string
+	Type       string // person, group, orchestra or choir
+	Members    []MemberData
+}
+
+// MemberData is a member of a group: either another artist or an eolas Person.
+type MemberData struct {
+	ArtistID  int    // zero for members who are only an eolas Person
+	PersonURI string // empty for members who are artists
+}
+
+// artistTypeClasses maps artist types to their Music Ontology class.  The Music
+// Ontology has no classes for orchestras or choirs, so they're emitted as groups.
+var artistTypeClasses = map[string]string{
+	"person":    "http://purl.org/ontology/mo/SoloMusicArtist",
+	"group":     "http://purl.org/ontology/mo/MusicGroup",
+	"orchestra": "http://purl.org/ontology/mo/MusicGroup",
+	"choir":     "http://purl.org/ontology/mo/MusicGroup",
 }
 
 // ArtistToRdf converts a slice of artists into an RDF graph.
 // Emits rdf:type mo:MusicArtist and skos:prefLabel for each artist,
 // plus type-level metadata so the document is self-contained.
 //
+// Where known, also emits ontology#sortName, skos:altLabel for each alias,
+// mo:musicbrainz for the MusicBrainz artist and a more specific rdf:type
+// (mo:SoloMusicArtist or mo:MusicGroup) for the artist's type.  Members of a group
+// are emitted as mo:member, pointing at the member's artist or eolas Person.
+//
 // When PersonURI is non-nil and non-empty, also emits:
 //   - owl:sameAs → the eolas:Person URI (joins the arachne closure)
 //   - eolas:preferredIdentifier → the same URI (declares the eolas Person canonical,
@@ -340,30 +677,37 @@ type ArtistData struct {
 // the arachne ingestor (ADR-0004 Phase 2) will fail with a ValueError when it
 // walks the subclass chain and finds an unlabelled parent class.
 func ArtistToRdf(artists []ArtistData) (*rdf2go.Graph, error) {
-	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
 	g := rdf2go.NewGraph("")
+	writeArtistClasses(g.AddTriple)
+	for _, artist := range artists {
+		writeArtist(artist, g.AddTriple)
+	}
+	return g, nil
+}
 
+// writeArtistClasses adds the type-level metadata for mo:MusicArtist, its subclasses and foaf:Agent.
+func writeArtistClasses(add tripleAdder) {
 	moMusicArtist := rdf2go.NewResource("http://purl.org/ontology/mo/MusicArtist")
 	foafAgent := rdf2go.NewResource("http://xmlns.com/foaf/0.1/Agent")
 	owlClass := rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class")
 	rdfsSubClassOf := rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subClassOf")
 
 	// mo:MusicArtist class metadata
-	g.AddTriple(moMusicArtist,
+	add(moMusicArtist,
 		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
 		owlClass,
 	)
-	g.AddTriple(moMusicArtist,
+	add(moMusicArtist,
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Artist", "en"),
 	)
-	g.AddTriple(moMusicArtist, rdfsSubClassOf, foafAgent)
-	g.AddTriple(
+	add(moMusicArtist, rdfsSubClassOf, foafAgent)
+	add(
 		moMusicArtist,
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/hasCategory"),
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 	)
-	g.AddTriple(
+	add(
 		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Musical", "en"),
@@ -371,41 +715,184 @@ func ArtistToRdf(artists []ArtistData) (*rdf2go.Graph, error) {
 
 	// foaf:Agent parent class — must have a prefLabel so arachne's ingestor
 	// (ADR-0004) can label the class when walking the subclass chain.
-	g.AddTriple(foafAgent,
+	add(foafAgent,
 		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
 		owlClass,
 	)
-	g.AddTriple(foafAgent,
+	add(foafAgent,
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Agent", "en"),
 	)
 
-	for _, artist := range artists {
-		subject := rdf2go.NewResource(fmt.Sprintf("%s/artists/%d", mediaMetadataManagerOrigin, artist.ID))
-		g.AddTriple(subject,
+	// Subclasses for artist types, labelled for the same reason as foaf:Agent.
+	for class, label := range map[string]string{
+		"http://purl.org/ontology/mo/SoloMusicArtist": "Solo Artist",
+		"http://purl.org/ontology/mo/MusicGroup":      "Group",
+	} {
+		add(rdf2go.NewResource(class),
 			rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
-			rdf2go.NewResource("http://purl.org/ontology/mo/MusicArtist"))
-		g.AddTriple(subject,
+			owlClass,
+		)
+		add(rdf2go.NewResource(class),
 			rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
-			rdf2go.NewLiteral(artist.Name))
+			rdf2go.NewLiteralWithLanguage(label, "en"),
+		)
+		add(rdf2go.NewResource(class), rdfsSubClassOf, moMusicArtist)
+	}
+}
 
-		// ADR-0009 identity link: emit owl:sameAs + eolas:preferredIdentifier when
-		// a manually-curated eolas:Person URI is stored for this artist.  Groups and
-		// un-curated artists have a nil PersonURI and emit no link triples.
-		if artist.PersonURI != nil && *artist.PersonURI != "" {
-			personURI := rdf2go.NewResource(*artist.PersonURI)
-			g.AddTriple(subject,
-				rdf2go.NewResource("http://www.w3.org/2002/07/owl#sameAs"),
-				personURI)
-			g.AddTriple(subject,
-				rdf2go.NewResource("https://eolas.l42.eu/ontology/preferredIdentifier"),
-				personURI)
+// writeArtist adds the triples for an artist.
+func writeArtist(artist ArtistData, add tripleAdder) {
+	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	appOrigin := os.Getenv("APP_ORIGIN")
+	subject := rdf2go.NewResource(fmt.Sprintf("%s/artists/%d", mediaMetadataManagerOrigin, artist.ID))
+	add(subject,
+		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
+		rdf2go.NewResource("http://purl.org/ontology/mo/MusicArtist"))
+	add(subject,
+		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
+		rdf2go.NewLiteral(artist.Name))
+	if artist.SortName != "" {
+		add(subject,
+			rdf2go.NewResource(appOrigin+"/ontology#sortName"),
+			rdf2go.NewLiteral(artist.SortName))
+	}
+	for _, alias := range artist.Aliases {
+		add(subject,
+			rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#altLabel"),
+			rdf2go.NewLiteral(alias))
+	}
+	if artist.MBIDArtist != "" {
+		add(subject,
+			rdf2go.NewResource("http://purl.org/ontology/mo/musicbrainz"),
+			rdf2go.NewResource(predicateconfig.GetConfig("mbid_artist").URIPrefix+artist.MBIDArtist))
+	}
+	if class, ok := artistTypeClasses[artist.Type]; ok {
+		add(subject,
+			rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
+			rdf2go.NewResource(class))
+	}
+	for _, member := range artist.Members {
+		memberURI := member.PersonURI
+		if member.ArtistID != 0 {
+			memberURI = fmt.Sprintf("%s/artists/%d", mediaMetadataManagerOrigin, member.ArtistID)
 		}
+		add(subject,
+			rdf2go.NewResource("http://purl.org/ontology/mo/member"),
+			rdf2go.NewResource(memberURI))
+	}
+
+	// ADR-0009 identity link: emit owl:sameAs + eolas:preferredIdentifier when
+	// a manually-curated eolas:Person URI is stored for this artist.  Groups and
+	// un-curated artists have a nil PersonURI and emit no link triples.
+	if artist.PersonURI != nil && *artist.PersonURI != "" {
+		personURI := rdf2go.NewResource(*artist.PersonURI)
+		add(subject,
+			rdf2go.NewResource("http://www.w3.org/2002/07/owl#sameAs"),
+			personURI)
+		add(subject,
+			rdf2go.NewResource("https://eolas.l42.eu/ontology/preferredIdentifier"),
+			personURI)
 	}
+}
+
+// CollectionData holds the fields needed by CollectionToRdf to build collection RDF triples.
+type CollectionData struct {
+	Slug           string
+	Name           string
+	Icon           string // empty if the collection has no icon
+	MembershipType string // "static", "smart" or "composed"; empty is taken as static
+	TrackIDs       []int  // the tracks in the collection, in its running order
+}
+
+// collectionSubclasses maps each membership type but static to the local name of the
+// subclass of ontology#Collection its collections are also typed with.
+var collectionSubclasses = map[string]string{
+	"smart":    "SmartCollection",
+	"composed": "ComposedCollection",
+}
+
+// CollectionURI returns the URI of the collection with the given slug.
+func CollectionURI(slug string) string {
+	return fmt.Sprintf("%s/collections/%s", os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN"), url.PathEscape(slug))
+}
 
+// CollectionToRdf converts a slice of collections into an RDF graph.
+// Emits rdf:type ontology#Collection, skos:prefLabel for the name and skos:notation
+// for the slug of each collection, plus ontology#icon where it has one.
+// Smart and composed collections are also typed with ontology#SmartCollection or
+// ontology#ComposedCollection.  Each track in the collection is linked to it with
+// ontology#inCollection, and type-level metadata for ontology#Collection and its
+// subclasses is included so the document is self-contained.
+func CollectionToRdf(collections []CollectionData) (*rdf2go.Graph, error) {
+	g := rdf2go.NewGraph("")
+	writeCollectionClass(g.AddTriple)
+	for _, collection := range collections {
+		writeCollection(collection, g.AddTriple)
+	}
 	return g, nil
 }
 
+// writeCollectionClass adds the type-level metadata for ontology#Collection and its subclasses.
+func writeCollectionClass(add tripleAdder) {
+	collectionClass := rdf2go.NewResource(os.Getenv("APP_ORIGIN") + "/ontology#Collection")
+	add(collectionClass,
+		rdf2go.NewResource(rdfType),
+		rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class"))
+	add(collectionClass,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Collection", "en"))
+	for _, membershipType := range []string{"smart", "composed"} {
+		subclass := rdf2go.NewResource(os.Getenv("APP_ORIGIN") + "/ontology#" + collectionSubclasses[membershipType])
+		add(subclass,
+			rdf2go.NewResource(rdfType),
+			rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class"))
+		add(subclass,
+			rdf2go.NewResource(skosPrefLabel),
+			rdf2go.NewLiteralWithLanguage(strings.ToUpper(membershipType[:1])+membershipType[1:]+" collection", "en"))
+		add(subclass,
+			rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subClassOf"),
+			collectionClass)
+	}
+	add(collectionClass,
+		rdf2go.NewResource("https://eolas.l42.eu/ontology/hasCategory"),
+		rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"))
+	add(rdf2go.NewResource("https://eolas.l42.eu/ontology/Musical"),
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Musical", "en"))
+}
+
+// writeCollection adds the triples for a collection.
+func writeCollection(collection CollectionData, add tripleAdder) {
+	mediaMetadataManagerOrigin := os.Getenv("MEDIA_METADATA_MANAGER_ORIGIN")
+	appOrigin := os.Getenv("APP_ORIGIN")
+	subject := rdf2go.NewResource(CollectionURI(collection.Slug))
+	add(subject,
+		rdf2go.NewResource(rdfType),
+		rdf2go.NewResource(appOrigin+"/ontology#Collection"))
+	if subclass := collectionSubclasses[collection.MembershipType]; subclass != "" {
+		add(subject,
+			rdf2go.NewResource(rdfType),
+			rdf2go.NewResource(appOrigin+"/ontology#"+subclass))
+	}
+	add(subject,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteral(collection.Name))
+	add(subject,
+		rdf2go.NewResource(skosNotation),
+		rdf2go.NewLiteral(collection.Slug))
+	if collection.Icon != "" {
+		add(subject,
+			rdf2go.NewResource(appOrigin+"/ontology#icon"),
+			rdf2go.NewLiteral(collection.Icon))
+	}
+	for _, trackID := range collection.TrackIDs {
+		add(rdf2go.NewResource(fmt.Sprintf("%s/tracks/%d", mediaMetadataManagerOrigin, trackID)),
+			rdf2go.NewResource(appOrigin+"/ontology#inCollection"),
+			subject)
+	}
+}
+
 func OntologyToRdf() (*rdf2go.Graph, error) {
 	appOrigin := os.Getenv("APP_ORIGIN")
 	if appOrigin == "" {
@@ -432,8 +919,9 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 		rdf2go.NewResource("http://purl.org/dc/terms/description"),
 		rdf2go.NewLiteral("An ontology defining custom properties used by the Media Metadata Manager RDF exporter."))
 
-	// Helper for adding a property definition
-	addProperty := func(localName, label string, propertyType rdf2go.Term, rangeURI rdf2go.Term, comment string, inverse string, inverseLabel string) {
+	// Helper for adding a property definition.  inverse is a local name in the ontology,
+	// or the IRI of an external property, which only has its label declared here.
+	addProperty := func(localName, label string, propertyType rdf2go.Term, rangeURI rdf2go.Term, comment string, inverse string, inverseLabel string) rdf2go.Term {
 		subject := rdf2go.NewResource(fmt.Sprintf("%s#%s", ontologyURI, localName))
 		g.AddTriple(subject,
 			rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
@@ -441,6 +929,9 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 		g.AddTriple(subject,
 			rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 			rdf2go.NewLiteralWithLanguage(label, "en"))
+		g.AddTriple(subject,
+			rdf2go.NewResource(rdfsLabel),
+			rdf2go.NewLiteralWithLanguage(label, "en"))
 		g.AddTriple(subject,
 			rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
 			moTrack)
@@ -450,71 +941,63 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 		g.AddTriple(subject,
 			rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#comment"),
 			rdf2go.NewLiteral(comment))
+		g.AddTriple(subject,
+			rdf2go.NewResource(rdfsIsDefinedBy),
+			ontologyRes)
 		if inverse != "" {
-			inverse_uri := rdf2go.NewResource(fmt.Sprintf("%s#%s", ontologyURI, inverse))
+			external := strings.Contains(inverse, "://")
+			if !external {
+				inverse = fmt.Sprintf("%s#%s", ontologyURI, inverse)
+			}
+			inverse_uri := rdf2go.NewResource(inverse)
 			g.AddTriple(subject,
 				rdf2go.NewResource("http://www.w3.org/2002/07/owl#inverseOf"),
 				inverse_uri)
-			g.AddTriple(inverse_uri,
-				rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
-				propertyType)
+			if !external {
+				g.AddTriple(inverse_uri,
+					rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
+					propertyType)
+			}
 			g.AddTriple(inverse_uri,
 				rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 				rdf2go.NewLiteralWithLanguage(inverseLabel, "en"))
 		}
+		return subject
 	}
 
-	// Define all custom ontology properties from mapPredicate
-	addProperty("dateAdded", "Date added", owlDatatypeProperty,
-		rdf2go.NewResource("http://www.w3.org/2001/XMLSchema#dateTime"),
-		"The date the track was added to the collection.", "", "")
-
-	addProperty("trigger", "Trigger (offence)", owlObjectProperty,
-		rdf2go.NewResource("https://eolas.l42.eu/ontology/Offence"),
-		"Any potential triggers or offence covered by the track's subject matter.", "", "")
-
-	addProperty("memory", "Memory", owlObjectProperty,
-		rdf2go.NewResource("https://eolas.l42.eu/ontology/Memory"),
-		"What this song reminds Luke of.", "", "")
-
-	addProperty("soundtrack", "Soundtrack", owlObjectProperty,
-		rdf2go.NewResource("https://eolas.l42.eu/ontology/CreativeWork"),
-		"Creative Work whose soundtrack this track appears in.", "", "")
-
-	addProperty("theme_tune", "Theme tune", owlObjectProperty,
-		rdf2go.NewResource("https://eolas.l42.eu/ontology/CreativeWork"),
-		"Creative Work this track is the primary theme tune of.", "", "")
-
-	addProperty("availability", "Availability", owlObjectProperty,
-		rdf2go.NewResource(fmt.Sprintf("%s#availabilityScheme", ontologyURI)),
-		"How easy it would be to replace this track if something happened to my collection.", "", "")
-
-	addProperty("about", "About", owlObjectProperty,
-		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#Resource"),
-		"Concepts which are the primary topic of this track.", "subjectOf", "Subject Of")
-
-	addProperty("mentions", "Mentions", owlObjectProperty,
-		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#Resource"),
-		"Concepts which are mentioned or alluded to by this track.", "mentionedBy", "Mentioned By")
-
-	// trackLanguage: the scoped predicate for track→language relationships.
-	// The inverse trackInLanguage is materialised by the arachne ingestor via
-	// owl:inverseOf, enabling "Tracks in this language" sections on Language pages.
-	// Range is the eolas language collection URI (individual language URIs are
-	// sub-resources, e.g. https://eolas.l42.eu/metadata/language/gd/).
-	addProperty("trackLanguage", "Track Language", owlObjectProperty,
-		rdf2go.NewResource("https://eolas.l42.eu/metadata/language/"),
-		"The language a track is performed in.",
-		"trackInLanguage", "Tracks in this language")
-
-	// singalong and dance properties (newly promoted from Omit to URIObject).
-	addProperty("singalong", "Singalong", owlObjectProperty,
-		rdf2go.NewResource(fmt.Sprintf("%s#singalongScheme", ontologyURI)),
-		"How well Luke can sing along to this track — an ordinal scale from 0 (no chance) to 5 (can do it a cappella without a lyric sheet).", "", "")
-
-	addProperty("dance", "Dance", owlObjectProperty,
-		rdf2go.NewResource(fmt.Sprintf("%s#danceScheme", ontologyURI)),
-		"The style of dance which goes with this track.", "", "")
+	// Every predicate in the registry which isn't from an external vocabulary is
+	// defined here, from the ontology metadata in its predicateconfig.Config.
+	registry := predicateconfig.All()
+	predicateIDs := make([]string, 0, len(registry))
+	for id, config := range registry {
+		if config.OntologyLocalName() != "" {
+			predicateIDs = append(predicateIDs, id)
+		}
+	}
+	sort.Strings(predicateIDs)
+	for _, id := range predicateIDs {
+		config := registry[id]
+		propertyType, rangeURI := owlObjectProperty, config.Range
+		if config.ValueShape == predicateconfig.ValueShapeLiteral {
+			propertyType = owlDatatypeProperty
+			if rangeURI == "" {
+				rangeURI = config.Datatype
+			}
+			if rangeURI == "" {
+				rangeURI = "http://www.w3.org/2001/XMLSchema#string"
+			}
+		} else if rangeURI == "" {
+			// Predicates with SKOS concepts range over their concept scheme, declared below
+			rangeURI = fmt.Sprintf("%s#%sScheme", ontologyURI, id)
+		}
+		property := addProperty(config.OntologyLocalName(), config.Label, propertyType,
+			rdf2go.NewResource(rangeURI), config.Comment, config.Inverse, config.InverseLabel)
+		if config.SubPropertyOf != "" {
+			g.AddTriple(property,
+				rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subPropertyOf"),
+				rdf2go.NewResource(resolvePredicateURI(registry[config.SubPropertyOf].PredicateURI, appOrigin)))
+		}
+	}
 
 	// Ordinal level properties for availability and singalong.
 	// Each skos:Concept in these schemes carries an integer level via these properties,
@@ -578,12 +1061,6 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 		fmt.Sprintf("%s#singalongLevel", ontologyURI))
 	addSKOSScheme("dance", "danceScheme", "Dance Scheme", "", "")
 
-	g.AddTriple(
-		rdf2go.NewResource(appOrigin + "/ontology#about"),
-		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subPropertyOf"),
-		rdf2go.NewResource(appOrigin + "/ontology#mentions"),
-	)
-
 	// mo:Record class metadata — albums use this type
 	moRecord := rdf2go.NewResource("http://purl.org/ontology/mo/Record")
 	g.AddTriple(moRecord,
@@ -620,11 +1097,12 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Agent", "en"))
 
-	// foaf:maker property — track→artist, pointing at mo:MusicArtist resources.
-	// Declared here so arachne can label the predicate on Track and Artist pages.
+	// foaf:maker property — track→artist and album→artist, pointing at mo:MusicArtist resources.
+	// Declared here so arachne can label the predicate on Track, Album and Artist pages.
+	// No rdfs:domain is declared, as it's used on both tracks and albums.
 	// Note: foaf:maker is an external URI so it cannot be handled by the addProperty
 	// helper above (which creates properties in our own ontology namespace). We
-	// emit a prefLabel manually, matching the pattern used for mo:track below.
+	// emit a prefLabel manually, as addProperty does for mo:track, onAlbum's inverse.
 	foafMaker := rdf2go.NewResource("http://xmlns.com/foaf/0.1/maker")
 	g.AddTriple(foafMaker,
 		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
@@ -632,38 +1110,107 @@ func OntologyToRdf() (*rdf2go.Graph, error) {
 	g.AddTriple(foafMaker,
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
 		rdf2go.NewLiteralWithLanguage("Artist", "en"))
-	g.AddTriple(foafMaker,
-		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
-		moTrack)
 	g.AddTriple(foafMaker,
 		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
 		moMusicArtist)
 
-	// onAlbum property: track→album, declared as owl:inverseOf mo:track.
-	// Note: mo:track is an external URI (not in our custom ontology namespace) so it
-	// cannot be handled by the addProperty helper above. Any owl:inverseOf declaration
-	// for an external property MUST also emit a skos:prefLabel for that inverse predicate,
-	// as the addProperty helper does automatically for inverses in our own namespace.
-	onAlbum := rdf2go.NewResource(ontologyURI + "#onAlbum")
-	g.AddTriple(onAlbum,
-		rdf2go.NewResource("http://www.w3.org/1999/02/22-rdf-syntax-ns#type"),
-		owlObjectProperty)
-	g.AddTriple(onAlbum,
+	// Album detail properties.  mo:track_count is external, so only labelled here;
+	// discCount has no equivalent in the Music Ontology so is our own.
+	g.AddTriple(rdf2go.NewResource("http://purl.org/ontology/mo/track_count"),
 		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
-		rdf2go.NewLiteralWithLanguage("On Album", "en"))
-	g.AddTriple(onAlbum,
+		rdf2go.NewLiteralWithLanguage("Track count", "en"))
+	discCount := rdf2go.NewResource(ontologyURI + "#discCount")
+	g.AddTriple(discCount, rdf2go.NewResource(rdfType), owlDatatypeProperty)
+	g.AddTriple(discCount,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Disc count", "en"))
+	g.AddTriple(discCount,
 		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
-		moTrack)
-	g.AddTriple(onAlbum,
-		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
 		moRecord)
-	moTrackProperty := rdf2go.NewResource("http://purl.org/ontology/mo/track")
-	g.AddTriple(onAlbum,
-		rdf2go.NewResource("http://www.w3.org/2002/07/owl#inverseOf"),
-		moTrackProperty)
-	g.AddTriple(moTrackProperty,
-		rdf2go.NewResource("http://www.w3.org/2004/02/skos/core#prefLabel"),
-		rdf2go.NewLiteralWithLanguage("Track", "en"))
+	g.AddTriple(discCount,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
+		rdf2go.NewResource(xsdInteger))
+	g.AddTriple(discCount,
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("The number of discs an album was released on."))
+
+	// sortName: the name an artist is sorted under, eg "Beatles, The".
+	sortName := rdf2go.NewResource(ontologyURI + "#sortName")
+	g.AddTriple(sortName, rdf2go.NewResource(rdfType), owlDatatypeProperty)
+	g.AddTriple(sortName,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Sort name", "en"))
+	g.AddTriple(sortName,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
+		rdf2go.NewResource("http://purl.org/ontology/mo/MusicArtist"))
+	g.AddTriple(sortName,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
+		rdf2go.NewResource("http://www.w3.org/2001/XMLSchema#string"))
+	g.AddTriple(sortName,
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("The form of an artist's name used to sort listings, eg \"Beatles, The\"."))
+
+	// Collections: the Collection class, its icon and track membership.  The inverse
+	// collectionTrack is materialised by the arachne ingestor, listing a collection's tracks.
+	writeCollectionClass(g.AddTriple)
+	collectionClass := rdf2go.NewResource(ontologyURI + "#Collection")
+	g.AddTriple(collectionClass,
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("A named grouping of tracks, either listed by hand or defined by a query over their tags."))
+	g.AddTriple(rdf2go.NewResource(ontologyURI+"#SmartCollection"),
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("A collection defined by a query over its tracks' tags.  Its tracks aren't listed in the bulk export, as they're resolved by the api."))
+	g.AddTriple(rdf2go.NewResource(ontologyURI+"#ComposedCollection"),
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("A collection defined as the union, intersection or difference of other collections.  Its tracks aren't listed in the bulk export, as they're resolved by the api."))
+	addProperty("inCollection", "In collection", owlObjectProperty, collectionClass,
+		"A collection the track is in.", "collectionTrack", "Tracks")
+	icon := rdf2go.NewResource(ontologyURI + "#icon")
+	g.AddTriple(icon, rdf2go.NewResource(rdfType), owlDatatypeProperty)
+	g.AddTriple(icon,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Icon", "en"))
+	g.AddTriple(icon,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
+		collectionClass)
+	g.AddTriple(icon,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
+		rdf2go.NewResource("http://www.w3.org/2001/XMLSchema#string"))
+	g.AddTriple(icon,
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("An emoji or short piece of text shown alongside a collection's name."))
+
+	// dataVersion: the version of the library a dataset description's export was taken from.
+	dataVersion := rdf2go.NewResource(ontologyURI + "#dataVersion")
+	g.AddTriple(dataVersion, rdf2go.NewResource(rdfType), owlDatatypeProperty)
+	g.AddTriple(dataVersion,
+		rdf2go.NewResource(skosPrefLabel),
+		rdf2go.NewLiteralWithLanguage("Data version", "en"))
+	g.AddTriple(dataVersion,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"),
+		rdf2go.NewResource(voidNamespace+"Dataset"))
+	g.AddTriple(dataVersion,
+		rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"),
+		rdf2go.NewResource(xsdInteger))
+	g.AddTriple(dataVersion,
+		rdf2go.NewResource(rdfsComment),
+		rdf2go.NewLiteral("The version of the library an export was taken from, which goes up with every change.  Matches the version in the export's manifest."))
+
+	g.AddTriple(ontologyRes,
+		rdf2go.NewResource(owlVersionInfo),
+		rdf2go.NewLiteral(ontologyVersion(g, appOrigin)))
 
 	return g, nil
 }
+
+// ontologyVersion identifies the definitions in the ontology, so consumers can tell when
+// they've changed.  It's a hash of the ontology's triples, taken without APP_ORIGIN so the
+// same definitions have the same version in every environment.
+func ontologyVersion(g *rdf2go.Graph, appOrigin string) string {
+	lines := make([]string, 0, g.Len())
+	for triple := range g.IterTriples() {
+		lines = append(lines, strings.ReplaceAll(triple.String(), appOrigin, ""))
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("%016x", tripleHash(strings.Join(lines, "\n")))
+}
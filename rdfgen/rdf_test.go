@@ -10,6 +10,8 @@ import (
 
 	rdf2go "github.com/deiu/rdf2go"
 	_ "github.com/mattn/go-sqlite3"
+
+	"lucos_media_metadata_api/predicateconfig"
 )
 
 // Test mapPredicate returns URIs and terms
@@ -87,8 +89,13 @@ func TestExportRDF(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -142,6 +149,16 @@ func TestExportRDF(t *testing.T) {
 			t.Errorf("expected RDF output to contain %q, but it was missing", expected)
 		}
 	}
+
+	// Every other format is published alongside the Turtle
+	for _, format := range ExportFormats {
+		content, err := os.ReadFile(ExportPath(tmpFile, format))
+		if err != nil {
+			t.Errorf("could not read %s output file: %v", format.MIME, err)
+		} else if !strings.Contains(string(content), "My Song") {
+			t.Errorf("expected %s output to contain \"My Song\"", format.MIME)
+		}
+	}
 }
 
 // TestExportRDFRejectsEmptyTrackTable verifies that ExportRDF returns an error rather than
@@ -158,8 +175,13 @@ func TestExportRDFRejectsEmptyTrackTable(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -194,8 +216,13 @@ func TestExportRDFUsesTagUriForAboutMentions(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -319,8 +346,13 @@ func TestExportRDFSkipsTagsWithNoUri(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -383,9 +415,9 @@ func TestMapPredicateArtistUsesURI(t *testing.T) {
 	}
 }
 
-// TestMapPredicateMBIDPrefixPredicates verifies that all 3 MBID predicates are routed
-// via the registry (ValueShapeMBIDPrefix) and produce IRI objects with the correct prefix.
-func TestMapPredicateMBIDPrefixPredicates(t *testing.T) {
+// TestMapPredicateMBIDPredicates verifies that all 3 MBID predicates are routed via the
+// registry and produce the MusicBrainz IRIs materialised in their tags' uri column.
+func TestMapPredicateMBIDPredicates(t *testing.T) {
 	mbid := "550e8400-e29b-41d4-a716-446655440000"
 	cases := []struct {
 		predicateID  string
@@ -397,7 +429,8 @@ func TestMapPredicateMBIDPrefixPredicates(t *testing.T) {
 		{"mbid_release", "http://purl.org/dc/terms/isPartOf", "https://musicbrainz.org/release/"},
 	}
 	for _, tc := range cases {
-		pred, terms := mapPredicate(tc.predicateID, mbid, nil, "http://localhost:8020", "http://localhost:3002")
+		uri := tc.expectedBase + mbid
+		pred, terms := mapPredicate(tc.predicateID, mbid, &uri, "http://localhost:8020", "http://localhost:3002")
 		if pred != tc.expectedPred {
 			t.Errorf("predicate %q: expected predicate URI %q, got %q", tc.predicateID, tc.expectedPred, pred)
 		}
@@ -496,6 +529,28 @@ func TestMapPredicateAlbumUsesOnAlbum(t *testing.T) {
 	}
 }
 
+// TestMapPredicateTrackNumberIsTypedInteger checks album positions are emitted as xsd:integer literals.
+func TestMapPredicateTrackNumberIsTypedInteger(t *testing.T) {
+	pred, terms := mapPredicate("track_number", "7", nil, "http://localhost:8020", "http://localhost:3002")
+	if pred != "http://purl.org/ontology/mo/track_number" {
+		t.Errorf("expected mo:track_number predicate URI, got %q", pred)
+	}
+	if len(terms) != 1 {
+		t.Fatalf("expected 1 term, got %d", len(terms))
+	}
+	if terms[0].String() != `"7"^^<http://www.w3.org/2001/XMLSchema#integer>` {
+		t.Errorf("expected xsd:integer literal, got %q", terms[0].String())
+	}
+	pred, _ = mapPredicate("disc_number", "2", nil, "http://localhost:8020", "http://localhost:3002")
+	if pred != "http://localhost:3002/ontology#discNumber" {
+		t.Errorf("expected discNumber predicate URI, got %q", pred)
+	}
+	// Legacy values which wouldn't be accepted now are omitted
+	if pred, terms := mapPredicate("track_number", "3/12", nil, "http://localhost:8020", "http://localhost:3002"); pred != "" || terms != nil {
+		t.Errorf("expected an invalid track number to be omitted, got %q %v", pred, terms)
+	}
+}
+
 // TestAlbumToRdf verifies that AlbumToRdf emits mo:Record type and skos:prefLabel.
 func TestAlbumToRdf(t *testing.T) {
 	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
@@ -554,8 +609,13 @@ func TestExportRDFIncludesAlbums(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -662,8 +722,13 @@ func TestExportRDFTrackLanguageEmission(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -885,8 +950,13 @@ func TestExportRDFSKOSConceptEmission(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -1012,8 +1082,13 @@ func TestExportRDFIncludesArtists(t *testing.T) {
 	_, err = db.Exec(`
 	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
 	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
-	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT);
-	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
 	`)
 	if err != nil {
 		t.Fatal(err)
@@ -1174,3 +1249,261 @@ func copyDB(src, dst string, t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestAlbumToRdfDetails checks optional album details are emitted only when known.
+func TestAlbumToRdfDetails(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	year, trackCount := 1969, 17
+
+	g, err := AlbumToRdf([]AlbumData{
+		{ID: 1, Name: "Abbey Road", ArtistIDs: []int{4}, Year: &year, TrackCount: &trackCount, MBIDRelease: "de4c8b16-7d8b-4e6d-a6e3-2f9a0a6d8a5e", Artwork: "https://example.org/abbey.jpg"},
+		{ID: 2, Name: "Let It Be"},
+	})
+	if err != nil {
+		t.Fatalf("AlbumToRdf failed: %v", err)
+	}
+	var buf strings.Builder
+	if err := g.Serialize(&buf, "text/turtle"); err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"<http://localhost:8020/artists/4>",
+		`"1969"^^<http://www.w3.org/2001/XMLSchema#gYear>`,
+		"<http://purl.org/ontology/mo/track_count>",
+		"<https://musicbrainz.org/release/de4c8b16-7d8b-4e6d-a6e3-2f9a0a6d8a5e>",
+		"<https://example.org/abbey.jpg>",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in output, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "discCount") {
+		t.Errorf("expected no disc count when unknown, got:\n%s", output)
+	}
+}
+
+// TestArtistToRdfDetails checks optional artist details are emitted when known.
+func TestArtistToRdfDetails(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	defer os.Unsetenv("APP_ORIGIN")
+
+	g, err := ArtistToRdf([]ArtistData{
+		{ID: 1, Name: "The Beatles", SortName: "Beatles, The", Aliases: []string{"The Fab Four"}, MBIDArtist: "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d", Type: "group",
+			Members: []MemberData{{ArtistID: 3}, {PersonURI: "https://eolas.l42.eu/metadata/person/7/"}}},
+		{ID: 2, Name: "Enya", Type: "person"},
+	})
+	if err != nil {
+		t.Fatalf("ArtistToRdf failed: %v", err)
+	}
+	var buf strings.Builder
+	if err := g.Serialize(&buf, "text/turtle"); err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"<http://localhost:3002/ontology#sortName>",
+		`"Beatles, The"`,
+		"<http://www.w3.org/2004/02/skos/core#altLabel>",
+		`"The Fab Four"`,
+		"<https://musicbrainz.org/artist/b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d>",
+		"<http://purl.org/ontology/mo/MusicGroup>",
+		"<http://purl.org/ontology/mo/SoloMusicArtist>",
+		"<http://purl.org/ontology/mo/member> <http://localhost:8020/artists/3>",
+		"<https://eolas.l42.eu/metadata/person/7/>",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in output, got:\n%s", expected, output)
+		}
+	}
+}
+
+// TestCollectionToRdf checks collections are emitted with their details and membership.
+func TestCollectionToRdf(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	defer os.Unsetenv("APP_ORIGIN")
+
+	g, err := CollectionToRdf([]CollectionData{
+		{Slug: "christmas", Name: "Christmas", Icon: "🎄", TrackIDs: []int{3, 5}},
+		{Slug: "empty set", Name: "Nothing"},
+		{Slug: "welsh", Name: "Welsh", MembershipType: "smart", TrackIDs: []int{1}},
+	})
+	if err != nil {
+		t.Fatalf("CollectionToRdf failed: %v", err)
+	}
+	var buf strings.Builder
+	if err := g.Serialize(&buf, "text/turtle"); err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"<http://localhost:8020/collections/christmas>",
+		"<http://localhost:3002/ontology#Collection>",
+		`"Christmas"`,
+		`"christmas"`,
+		`<http://localhost:3002/ontology#icon> "🎄"`,
+		"<http://localhost:8020/tracks/3>",
+		"<http://localhost:8020/tracks/5>",
+		"<http://localhost:3002/ontology#inCollection>",
+		"<http://localhost:8020/collections/empty%20set>",
+		`"Collection"@en`,
+		"<http://localhost:8020/collections/welsh>",
+		`"Smart collection"@en`,
+		`"Composed collection"@en`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in output, got:\n%s", expected, output)
+		}
+	}
+	// Once for the class, and once for the collection typed with it
+	if strings.Count(output, "ontology#SmartCollection>") != 2 {
+		t.Errorf("expected only the smart collection to be typed as one, got:\n%s", output)
+	}
+	if strings.Count(output, "ontology#icon") != 1 {
+		t.Errorf("expected an icon only for the collection which has one, got:\n%s", output)
+	}
+}
+
+// TestExportRDFIncludesCollections checks the export lists static collections' tracks,
+// but not smart collections', whose membership the api resolves, and which are typed
+// as smart collections instead.
+func TestExportRDFIncludesCollections(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(t, 6)
+	tmpFile := filepath.Join(t.TempDir(), "output.nt")
+	if err := ExportRDF(dbPath, tmpFile); err != nil {
+		t.Fatalf("ExportRDF failed: %v", err)
+	}
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("could not read RDF output file: %v", err)
+	}
+	output := string(content)
+
+	for _, expected := range []string{
+		`<http://localhost:8020/collections/favourites> <http://www.w3.org/2004/02/skos/core#prefLabel> "Favourites" .`,
+		`<http://localhost:8020/collections/welsh> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://localhost:3002/ontology#Collection> .`,
+		`<http://localhost:8020/collections/welsh> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://localhost:3002/ontology#SmartCollection> .`,
+		`<http://localhost:8020/tracks/3> <http://localhost:3002/ontology#inCollection> <http://localhost:8020/collections/favourites> .`,
+		`<http://localhost:8020/tracks/6> <http://localhost:3002/ontology#inCollection> <http://localhost:8020/collections/favourites> .`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in export output", expected)
+		}
+	}
+	if count := strings.Count(output, "<http://localhost:3002/ontology#inCollection> <http://localhost:8020/collections/"); count != 2 {
+		t.Errorf("expected 2 membership triples, got %d", count)
+	}
+	if strings.Contains(output, `<http://localhost:8020/collections/favourites> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://localhost:3002/ontology#SmartCollection>`) {
+		t.Error("expected static collection not to be typed as a smart collection")
+	}
+}
+
+// TestOntologyToRdfIncludesCollections checks the ontology declares the Collection class and its properties.
+func TestOntologyToRdfIncludesCollections(t *testing.T) {
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	defer os.Unsetenv("APP_ORIGIN")
+	g, err := OntologyToRdf()
+	if err != nil {
+		t.Fatalf("OntologyToRdf failed: %v", err)
+	}
+	var buf strings.Builder
+	if err := g.Serialize(&buf, "text/turtle"); err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	output := buf.String()
+	for _, expected := range []string{
+		"<http://localhost:3002/ontology#Collection>",
+		"<http://localhost:3002/ontology#inCollection>",
+		"<http://localhost:3002/ontology#collectionTrack>",
+		"<http://localhost:3002/ontology#icon>",
+		"<http://localhost:3002/ontology#SmartCollection>",
+		"<http://localhost:3002/ontology#ComposedCollection>",
+		`"In collection"@en`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in ontology, got:\n%s", expected, output)
+		}
+	}
+}
+
+// TestOntologyToRdfDefinesRegistryPredicates checks every predicate in the ontology is
+// defined from its predicateconfig metadata, without having to be added by hand.
+func TestOntologyToRdfDefinesRegistryPredicates(t *testing.T) {
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	g, err := OntologyToRdf()
+	if err != nil {
+		t.Fatalf("OntologyToRdf failed: %v", err)
+	}
+	ontology := rdf2go.NewResource("http://localhost:3002/ontology")
+	for id, config := range predicateconfig.All() {
+		if config.OntologyLocalName() == "" {
+			continue
+		}
+		property := rdf2go.NewResource("http://localhost:3002" + config.PredicateURI)
+		propertyType := "http://www.w3.org/2002/07/owl#ObjectProperty"
+		if config.ValueShape == predicateconfig.ValueShapeLiteral {
+			propertyType = "http://www.w3.org/2002/07/owl#DatatypeProperty"
+		}
+		for _, expected := range []struct{ predicate, object rdf2go.Term }{
+			{rdf2go.NewResource(rdfType), rdf2go.NewResource(propertyType)},
+			{rdf2go.NewResource(rdfsLabel), rdf2go.NewLiteralWithLanguage(config.Label, "en")},
+			{rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteralWithLanguage(config.Label, "en")},
+			{rdf2go.NewResource(rdfsComment), rdf2go.NewLiteral(config.Comment)},
+			{rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#domain"), rdf2go.NewResource("http://purl.org/ontology/mo/Track")},
+			{rdf2go.NewResource(rdfsIsDefinedBy), ontology},
+		} {
+			if g.One(property, expected.predicate, expected.object) == nil {
+				t.Errorf("predicate %q: expected %s %s %s in ontology", id, property, expected.predicate, expected.object)
+			}
+		}
+		if ranges := g.All(property, rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"), nil); len(ranges) != 1 {
+			t.Errorf("predicate %q: expected one rdfs:range, got %d", id, len(ranges))
+		}
+	}
+
+	// Predicates with SKOS concepts range over their concept scheme
+	scheme := g.One(rdf2go.NewResource("http://localhost:3002/ontology#dance"), rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#range"), nil)
+	if scheme == nil || g.One(scheme.Object, rdf2go.NewResource(rdfType), rdf2go.NewResource(skosConceptScheme)) == nil {
+		t.Errorf("expected dance to range over its concept scheme, got %v", scheme)
+	}
+	if g.One(rdf2go.NewResource("http://localhost:3002/ontology#about"), rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subPropertyOf"), rdf2go.NewResource("http://localhost:3002/ontology#mentions")) == nil {
+		t.Error("expected about to be declared a sub-property of mentions")
+	}
+}
+
+// TestOntologyToRdfVersionInfo checks the ontology's version depends on its definitions,
+// but not on the environment it's served from.
+func TestOntologyToRdfVersionInfo(t *testing.T) {
+	versionOf := func(appOrigin string) string {
+		t.Setenv("APP_ORIGIN", appOrigin)
+		g, err := OntologyToRdf()
+		if err != nil {
+			t.Fatalf("OntologyToRdf failed: %v", err)
+		}
+		versionInfo := g.One(rdf2go.NewResource(appOrigin+"/ontology"), rdf2go.NewResource("http://www.w3.org/2002/07/owl#versionInfo"), nil)
+		if versionInfo == nil {
+			t.Fatal("expected the ontology to have an owl:versionInfo")
+		}
+		return versionInfo.Object.RawValue()
+	}
+	version := versionOf("http://localhost:3002")
+	if len(version) != 16 {
+		t.Errorf("expected a 16 digit version, got %q", version)
+	}
+	if other := versionOf("https://media-api.l42.eu"); other != version {
+		t.Errorf("expected the same version in every environment, got %q and %q", version, other)
+	}
+
+	g, _ := OntologyToRdf()
+	g.AddTriple(rdf2go.NewResource("https://media-api.l42.eu/ontology#extra"), rdf2go.NewResource(rdfType), rdf2go.NewResource("http://www.w3.org/2002/07/owl#ObjectProperty"))
+	if changed := ontologyVersion(g, "https://media-api.l42.eu"); changed == version {
+		t.Error("expected the version to change with the definitions")
+	}
+}
@@ -0,0 +1,103 @@
+package rdfgen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/deiu/rdf2go"
+)
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// ExportFormat is one of the serialisations the bulk export is published in.
+type ExportFormat struct {
+	MIME      string
+	Extension string
+}
+
+// ExportFormats lists every serialisation of the bulk export, Turtle first as the default.
+var ExportFormats = []ExportFormat{
+	{MIME: "text/turtle", Extension: ".ttl"},
+	{MIME: "application/n-triples", Extension: ".nt"},
+	{MIME: "application/ld+json", Extension: ".jsonld"},
+	{MIME: "application/rdf+xml", Extension: ".rdf"},
+}
+
+// ExportPath returns where the export in a given format is published, alongside outFile
+// (the path given by RDF_OUTPUT_PATH) with its extension swapped for the format's.
+func ExportPath(outFile string, format ExportFormat) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + format.Extension
+}
+
+// SerializeGraph writes a graph in the serialisation given by its MIME type.
+// rdf2go handles Turtle and JSON-LD itself, but not N-Triples or RDF/XML, which are
+// streamed through a TripleWriter a subject at a time.
+func SerializeGraph(g *rdf2go.Graph, w io.Writer, mime string) error {
+	switch mime {
+	case "application/n-triples", "application/rdf+xml":
+	default:
+		return g.Serialize(w, mime)
+	}
+	triplesBySubject := make(map[string][]*rdf2go.Triple)
+	var subjects []string
+	for triple := range g.IterTriples() {
+		subject := triple.Subject.String()
+		if _, ok := triplesBySubject[subject]; !ok {
+			subjects = append(subjects, subject)
+		}
+		triplesBySubject[subject] = append(triplesBySubject[subject], triple)
+	}
+	sort.Strings(subjects)
+
+	writer, err := NewTripleWriter(w, mime)
+	if err != nil {
+		return err
+	}
+	for _, subject := range subjects {
+		for _, triple := range triplesBySubject[subject] {
+			writer.AddTriple(triple.Subject, triple.Predicate, triple.Object)
+		}
+	}
+	return writer.Close()
+}
+
+// splitPredicate splits a predicate URI into a namespace and a local name usable as
+// an XML element name, splitting after the last '#' or '/'.
+func splitPredicate(uri string) (namespace string, local string, err error) {
+	index := strings.LastIndexAny(uri, "#/") + 1
+	namespace, local = uri[:index], uri[index:]
+	if local == "" || !isNameStart(rune(local[0])) {
+		return "", "", fmt.Errorf("predicate %q can't be written as RDF/XML", uri)
+	}
+	for _, char := range local {
+		if !isNameStart(char) && !unicode.IsDigit(char) && char != '-' && char != '.' {
+			return "", "", fmt.Errorf("predicate %q can't be written as RDF/XML", uri)
+		}
+	}
+	return
+}
+
+// isNameStart reports whether a character can start an XML element name.
+func isNameStart(char rune) bool {
+	return unicode.IsLetter(char) || char == '_'
+}
+
+// xmlEscape escapes text for use in XML content or a double-quoted attribute.
+func xmlEscape(text string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
+
+// rdfXMLNode returns the attribute identifying a subject or object node, by URI or blank node id.
+func rdfXMLNode(term rdf2go.Term, uriAttribute string) string {
+	if blank, ok := term.(*rdf2go.BlankNode); ok {
+		return `rdf:nodeID="` + xmlEscape(blank.ID) + `"`
+	}
+	return uriAttribute + `="` + xmlEscape(term.RawValue()) + `"`
+}
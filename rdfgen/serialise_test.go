@@ -0,0 +1,109 @@
+package rdfgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	rdf2go "github.com/deiu/rdf2go"
+)
+
+// serialiseTestGraph returns a small graph covering resources, plain, datatyped
+// and language-tagged literals, and literals needing escaping.
+func serialiseTestGraph() *rdf2go.Graph {
+	g := rdf2go.NewGraph("")
+	track := rdf2go.NewResource("http://localhost:8020/tracks/1")
+	g.AddTriple(track, rdf2go.NewResource(rdfType), rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	g.AddTriple(track, rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteral("Fish & \"Chips\" <live>\nencore"))
+	g.AddTriple(track, rdf2go.NewResource("http://purl.org/ontology/mo/track_number"), rdf2go.NewLiteralWithDatatype("3", rdf2go.NewResource(xsdInteger)))
+	g.AddTriple(track, rdf2go.NewResource(rdfsComment), rdf2go.NewLiteralWithLanguage("Chanson", "fr"))
+	g.AddTriple(rdf2go.NewResource("http://localhost:8020/albums/1"), rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteral("Album"))
+	return g
+}
+
+// TestSerializeNTriplesRoundTrips checks N-Triples output parses back to the same graph.
+func TestSerializeNTriplesRoundTrips(t *testing.T) {
+	g := serialiseTestGraph()
+	var output bytes.Buffer
+	if err := SerializeGraph(g, &output, "application/n-triples"); err != nil {
+		t.Fatalf("SerializeGraph failed: %v", err)
+	}
+	if lines := strings.Count(output.String(), "\n"); lines != g.Len() {
+		t.Errorf("expected %d lines of N-Triples, got %d:\n%s", g.Len(), lines, output.String())
+	}
+
+	// N-Triples is a subset of Turtle, so can be parsed as such
+	parsed := rdf2go.NewGraph("")
+	if err := parsed.Parse(&output, "text/turtle"); err != nil {
+		t.Fatalf("N-Triples output didn't parse: %v", err)
+	}
+	if parsed.Len() != g.Len() {
+		t.Errorf("expected %d triples after parsing, got %d", g.Len(), parsed.Len())
+	}
+	for triple := range g.IterTriples() {
+		if parsed.One(triple.Subject, triple.Predicate, triple.Object) == nil {
+			t.Errorf("triple missing after round trip: %s", triple)
+		}
+	}
+}
+
+// TestSerializeRDFXML checks RDF/XML output is well-formed, with a description of each
+// subject and each literal's datatype or language.
+func TestSerializeRDFXML(t *testing.T) {
+	var output bytes.Buffer
+	if err := SerializeGraph(serialiseTestGraph(), &output, "application/rdf+xml"); err != nil {
+		t.Fatalf("SerializeGraph failed: %v", err)
+	}
+	document := output.String()
+
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	descriptions := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RDF/XML output isn't well-formed: %v\n%s", err, document)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Space == rdfNamespace && start.Name.Local == "Description" {
+			descriptions++
+		}
+	}
+	if descriptions != 2 {
+		t.Errorf("expected 2 rdf:Description elements, got %d:\n%s", descriptions, document)
+	}
+	for _, expected := range []string{
+		`<rdf:Description rdf:about="http://localhost:8020/tracks/1">`,
+		`<rdf:type rdf:resource="http://purl.org/ontology/mo/Track"/>`,
+		`>Fish &amp; &#34;Chips&#34; &lt;live&gt;&#xA;encore</`,
+		` rdf:datatype="` + xsdInteger + `">3</`,
+		` xml:lang="fr">Chanson</`,
+	} {
+		if !strings.Contains(document, expected) {
+			t.Errorf("expected RDF/XML output to contain %q:\n%s", expected, document)
+		}
+	}
+}
+
+// TestSerializeRDFXMLRejectsUnsplittablePredicate checks a predicate with no valid local
+// name is reported, rather than written as malformed XML.
+func TestSerializeRDFXMLRejectsUnsplittablePredicate(t *testing.T) {
+	g := rdf2go.NewGraph("")
+	g.AddTriple(rdf2go.NewResource("http://example.org/a"), rdf2go.NewResource("http://example.org/123"), rdf2go.NewLiteral("b"))
+	if err := SerializeGraph(g, io.Discard, "application/rdf+xml"); err == nil {
+		t.Error("expected an error for a predicate whose local name starts with a digit")
+	}
+}
+
+// TestExportPath checks each format's export sits alongside RDF_OUTPUT_PATH.
+func TestExportPath(t *testing.T) {
+	for _, format := range ExportFormats {
+		expected := "/exports/all-media" + format.Extension
+		if path := ExportPath("/exports/all-media.ttl", format); path != expected {
+			t.Errorf("expected %s export at %q, got %q", format.MIME, expected, path)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package rdfgen
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+
+	"lucos_media_metadata_api/predicateconfig"
+)
+
+// maxReportedViolations is how many violations a ValidationError describes in full.
+// Any more are only counted, so a regression affecting every track doesn't produce
+// an enormous report.
+const maxReportedViolations = 20
+
+// propertyShape constrains the objects of a predicate on a track: whether they may be
+// literals or IRIs, and the datatype literals must have, if any.
+type propertyShape struct {
+	literal  bool
+	iri      bool
+	datatype string
+}
+
+// shapes is what's expected of the exported graph.
+type shapes struct {
+	// trackProperties constrains the objects of each predicate on subjects typed mo:Track
+	trackProperties map[string]propertyShape
+	// labelledClasses lists the classes whose instances must have a skos:prefLabel
+	labelledClasses map[string]bool
+}
+
+// deriveShapes builds the shapes the export is validated against.  Properties of
+// tracks come from predicateconfig, alongside the ones writeTracks adds for every track.
+// Where several predicates share a URI, the shapes are merged, so an object only has
+// to match one of them; a datatype is only required if they all agree on it.
+//
+// Albums, artists, collections, SKOS concepts and classes must all be labelled, as
+// must anything which is a superclass of another — the arachne ingestor fails on an
+// unlabelled parent class (see ArtistToRdf).
+func deriveShapes() shapes {
+	appOrigin := os.Getenv("APP_ORIGIN")
+	trackProperties := map[string]propertyShape{
+		"http://purl.org/dc/terms/identifier":  {literal: true},
+		"http://purl.org/ontology/mo/duration": {literal: true, datatype: "http://www.w3.org/2001/XMLSchema#duration"},
+	}
+	merge := func(predicateURI string, shape propertyShape) {
+		existing, ok := trackProperties[predicateURI]
+		if !ok {
+			trackProperties[predicateURI] = shape
+			return
+		}
+		if existing.datatype != shape.datatype {
+			existing.datatype = ""
+		}
+		existing.literal = existing.literal || shape.literal
+		existing.iri = existing.iri || shape.iri
+		trackProperties[predicateURI] = existing
+	}
+	for _, config := range predicateconfig.All() {
+		predicateURI := resolvePredicateURI(config.PredicateURI, appOrigin)
+		switch config.ValueShape {
+		case predicateconfig.ValueShapeLiteral:
+			merge(predicateURI, propertyShape{literal: true, datatype: config.Datatype})
+		case predicateconfig.ValueShapeURIObject:
+			merge(predicateURI, propertyShape{iri: true})
+		}
+	}
+	return shapes{
+		trackProperties: trackProperties,
+		labelledClasses: map[string]bool{
+			"http://purl.org/ontology/mo/Record":       true,
+			"http://purl.org/ontology/mo/MusicArtist":  true,
+			appOrigin + "/ontology#Collection":         true,
+			appOrigin + "/ontology#SmartCollection":    true,
+			appOrigin + "/ontology#ComposedCollection": true,
+			skosConcept:                                      true,
+			skosConceptScheme:                                true,
+			"http://www.w3.org/2002/07/owl#Class":            true,
+			"http://www.w3.org/2002/07/owl#ObjectProperty":   true,
+			"http://www.w3.org/2002/07/owl#DatatypeProperty": true,
+		},
+	}
+}
+
+// Violation is a way in which the exported graph doesn't match its shapes.
+type Violation struct {
+	Focus   string // the subject the violation was found on
+	Path    string // the predicate concerned, if any
+	Message string
+}
+
+func (violation Violation) String() string {
+	if violation.Path == "" {
+		return fmt.Sprintf("<%s>: %s", violation.Focus, violation.Message)
+	}
+	return fmt.Sprintf("<%s> <%s>: %s", violation.Focus, violation.Path, violation.Message)
+}
+
+// ValidationError is returned by ExportRDF when the graph it produced doesn't match
+// its shapes.  Violations holds the first few found, and Count how many there were.
+type ValidationError struct {
+	Violations []Violation
+	Count      int
+}
+
+func (err *ValidationError) Error() string {
+	details := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		details[i] = violation.String()
+	}
+	message := fmt.Sprintf("export failed validation with %d violation(s): %s", err.Count, strings.Join(details, "; "))
+	if more := err.Count - len(err.Violations); more > 0 {
+		message += fmt.Sprintf("; and %d more", more)
+	}
+	return message
+}
+
+// validator checks triples against shapes as they're added to the export.  It relies
+// on each entity's rdf:type being written before its other properties, as rdfgen
+// always does, so a track's properties can be checked without holding them in memory.
+// Only subjects which need a label are remembered until the end.
+type validator struct {
+	shapes     shapes
+	tracks     map[uint64]bool
+	labelled   map[uint64]bool
+	needsLabel map[uint64]string
+	violations []Violation
+	count      int
+}
+
+func newValidator() *validator {
+	return &validator{
+		shapes:     deriveShapes(),
+		tracks:     map[uint64]bool{},
+		labelled:   map[uint64]bool{},
+		needsLabel: map[uint64]string{},
+	}
+}
+
+func (v *validator) report(violation Violation) {
+	v.count++
+	if len(v.violations) < maxReportedViolations {
+		v.violations = append(v.violations, violation)
+	}
+}
+
+// checking returns an adder which validates each triple before passing it on to add.
+func (v *validator) checking(add tripleAdder) tripleAdder {
+	return func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+		v.check(subject, predicate, object)
+		add(subject, predicate, object)
+	}
+}
+
+func (v *validator) check(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+	focus := subject.RawValue()
+	path := predicate.RawValue()
+	subjectKey := tripleHash(subject.String())
+	if !strings.Contains(path, ":") {
+		v.report(Violation{Focus: focus, Path: path, Message: "predicate isn't an absolute IRI"})
+		return
+	}
+	switch path {
+	case rdfType:
+		if object.RawValue() == "http://purl.org/ontology/mo/Track" {
+			v.tracks[subjectKey] = true
+		}
+		if v.shapes.labelledClasses[object.RawValue()] {
+			v.requireLabel(subject)
+		}
+	case "http://www.w3.org/2000/01/rdf-schema#subClassOf":
+		v.requireLabel(object)
+	case skosPrefLabel:
+		if literal, ok := object.(*rdf2go.Literal); ok && strings.TrimSpace(literal.Value) != "" {
+			v.labelled[subjectKey] = true
+		}
+	}
+	if !v.tracks[subjectKey] {
+		return
+	}
+	if shape, ok := v.shapes.trackProperties[path]; ok {
+		if message := shape.check(object); message != "" {
+			v.report(Violation{Focus: focus, Path: path, Message: message})
+		}
+	}
+}
+
+// requireLabel notes that a node must have a non-empty skos:prefLabel by the end of the export.
+func (v *validator) requireLabel(node rdf2go.Term) {
+	v.needsLabel[tripleHash(node.String())] = node.RawValue()
+}
+
+// check returns why object doesn't match the shape, or an empty string if it does.
+func (shape propertyShape) check(object rdf2go.Term) string {
+	literal, isLiteral := object.(*rdf2go.Literal)
+	_, isIRI := object.(*rdf2go.Resource)
+	switch {
+	case isIRI && !shape.iri:
+		return fmt.Sprintf("expected a literal, got IRI %s", object)
+	case isLiteral && !shape.literal:
+		return fmt.Sprintf("expected an IRI, got literal %s", object)
+	case !isLiteral && !isIRI:
+		return fmt.Sprintf("expected a literal or IRI, got %s", object)
+	case !isLiteral || shape.datatype == "":
+		return ""
+	}
+	datatype := ""
+	if literal.Datatype != nil {
+		datatype = literal.Datatype.RawValue()
+	}
+	if datatype != shape.datatype {
+		return fmt.Sprintf("expected datatype <%s>, got %s", shape.datatype, object)
+	}
+	if datatype == xsdInteger {
+		if _, err := strconv.ParseInt(literal.Value, 10, 64); err != nil {
+			return fmt.Sprintf("%q isn't a valid integer", literal.Value)
+		}
+	}
+	return ""
+}
+
+// Err returns a ValidationError describing any violations found, or nil if there were none.
+func (v *validator) Err() error {
+	unlabelled := []string{}
+	for key, node := range v.needsLabel {
+		if !v.labelled[key] {
+			unlabelled = append(unlabelled, node)
+		}
+	}
+	sort.Strings(unlabelled)
+	for _, node := range unlabelled {
+		v.report(Violation{Focus: node, Path: skosPrefLabel, Message: "missing required label"})
+	}
+	if v.count == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations, Count: v.count}
+}
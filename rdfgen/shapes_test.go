@@ -0,0 +1,155 @@
+package rdfgen
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deiu/rdf2go"
+)
+
+// TestValidatorChecksTrackProperties checks the objects of track properties are held to
+// the shapes derived from predicateconfig.
+func TestValidatorChecksTrackProperties(t *testing.T) {
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	track := rdf2go.NewResource("http://localhost:8020/tracks/1")
+	album := rdf2go.NewResource("http://localhost:8020/albums/1")
+	integer := rdf2go.NewResource(xsdInteger)
+	v := newValidator()
+	add := v.checking(func(rdf2go.Term, rdf2go.Term, rdf2go.Term) {})
+
+	add(track, rdf2go.NewResource(rdfType), rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	add(track, rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteral("Yesterday"))
+	add(track, rdf2go.NewResource("http://purl.org/ontology/mo/track_number"), rdf2go.NewLiteralWithDatatype("3", integer))
+	add(track, rdf2go.NewResource("http://purl.org/dc/terms/identifier"), rdf2go.NewLiteral("https://example.org/1.mp3"))
+	add(track, rdf2go.NewResource("http://purl.org/dc/terms/identifier"), rdf2go.NewResource("https://musicbrainz.org/recording/1"))
+	add(album, rdf2go.NewResource("http://xmlns.com/foaf/0.1/maker"), rdf2go.NewLiteral("Not a track, so not checked"))
+	if err := v.Err(); err != nil {
+		t.Fatalf("expected valid triples to pass, got %v", err)
+	}
+
+	v = newValidator()
+	add = v.checking(func(rdf2go.Term, rdf2go.Term, rdf2go.Term) {})
+	add(track, rdf2go.NewResource(rdfType), rdf2go.NewResource("http://purl.org/ontology/mo/Track"))
+	add(track, rdf2go.NewResource("http://xmlns.com/foaf/0.1/maker"), rdf2go.NewLiteral("The Beatles"))
+	add(track, rdf2go.NewResource(skosPrefLabel), rdf2go.NewResource("http://localhost:8020/titles/1"))
+	add(track, rdf2go.NewResource("http://purl.org/ontology/mo/track_number"), rdf2go.NewLiteral("3"))
+	add(track, rdf2go.NewResource("http://purl.org/ontology/mo/track_number"), rdf2go.NewLiteralWithDatatype("three", integer))
+	add(track, rdf2go.NewResource(""), rdf2go.NewLiteral("A predicate which lost its URI"))
+	var validationErr *ValidationError
+	if !errors.As(v.Err(), &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", v.Err())
+	}
+	expected := []string{
+		`<http://localhost:8020/tracks/1> <http://xmlns.com/foaf/0.1/maker>: expected an IRI, got literal "The Beatles"`,
+		`<http://localhost:8020/tracks/1> <http://www.w3.org/2004/02/skos/core#prefLabel>: expected a literal, got IRI <http://localhost:8020/titles/1>`,
+		`<http://localhost:8020/tracks/1> <http://purl.org/ontology/mo/track_number>: expected datatype <http://www.w3.org/2001/XMLSchema#integer>, got "3"`,
+		`<http://localhost:8020/tracks/1> <http://purl.org/ontology/mo/track_number>: "three" isn't a valid integer`,
+		`<http://localhost:8020/tracks/1>: predicate isn't an absolute IRI`,
+	}
+	if validationErr.Count != len(expected) {
+		t.Errorf("expected %d violations, got %d: %v", len(expected), validationErr.Count, validationErr)
+	}
+	for _, violation := range expected {
+		if !strings.Contains(validationErr.Error(), violation) {
+			t.Errorf("expected violation %s, got %v", violation, validationErr)
+		}
+	}
+}
+
+// TestValidatorRequiresLabels checks entities and parent classes must have a non-empty prefLabel.
+func TestValidatorRequiresLabels(t *testing.T) {
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	v := newValidator()
+	add := v.checking(func(rdf2go.Term, rdf2go.Term, rdf2go.Term) {})
+	artist := rdf2go.NewResource("http://localhost:8020/artists/1")
+	class := rdf2go.NewResource("http://purl.org/ontology/mo/MusicArtist")
+	add(artist, rdf2go.NewResource(rdfType), class)
+	add(artist, rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteral(" "))
+	add(class, rdf2go.NewResource(rdfType), rdf2go.NewResource("http://www.w3.org/2002/07/owl#Class"))
+	add(class, rdf2go.NewResource(skosPrefLabel), rdf2go.NewLiteralWithLanguage("Artist", "en"))
+	add(class, rdf2go.NewResource("http://www.w3.org/2000/01/rdf-schema#subClassOf"), rdf2go.NewResource("http://xmlns.com/foaf/0.1/Agent"))
+
+	err := v.Err()
+	expected := "export failed validation with 2 violation(s): " +
+		"<http://localhost:8020/artists/1> <http://www.w3.org/2004/02/skos/core#prefLabel>: missing required label; " +
+		"<http://xmlns.com/foaf/0.1/Agent> <http://www.w3.org/2004/02/skos/core#prefLabel>: missing required label"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+// TestValidationErrorLimitsDetails checks a ValidationError only describes the first few violations.
+func TestValidationErrorLimitsDetails(t *testing.T) {
+	t.Setenv("APP_ORIGIN", "http://localhost:3002")
+	v := newValidator()
+	add := v.checking(func(rdf2go.Term, rdf2go.Term, rdf2go.Term) {})
+	for i := 0; i < maxReportedViolations+5; i++ {
+		add(rdf2go.NewResource("http://localhost:8020/tracks/1"), rdf2go.NewResource(""), rdf2go.NewLiteral("x"))
+	}
+	var validationErr *ValidationError
+	if !errors.As(v.Err(), &validationErr) {
+		t.Fatal("expected a ValidationError")
+	}
+	if len(validationErr.Violations) != maxReportedViolations || !strings.HasSuffix(validationErr.Error(), "; and 5 more") {
+		t.Errorf("expected %d violations described and 5 more counted, got %v", maxReportedViolations, validationErr)
+	}
+}
+
+// TestExportRDFRefusesInvalidGraph checks an export which fails validation leaves the
+// last good export in place.
+func TestExportRDFRefusesInvalidGraph(t *testing.T) {
+	dbPath, db := createVersionedExportDB(t, 6)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("first export failed: %v", err)
+	}
+	published := map[string][]byte{}
+	paths := []string{ManifestPath(outFile), DatasetPath(outFile, ExportFormats[0])}
+	for _, format := range ExportFormats {
+		paths = append(paths, ExportPath(outFile, format))
+	}
+	for _, path := range paths {
+		published[path], _ = os.ReadFile(path)
+	}
+
+	bumpDataVersion(t, db, `UPDATE artist SET name = '' WHERE id = 1`)
+	err := ExportRDF(dbPath, outFile)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	violation := `<http://localhost:8020/artists/1> <http://www.w3.org/2004/02/skos/core#prefLabel>: missing required label`
+	if !strings.Contains(err.Error(), violation) {
+		t.Errorf("expected violation %s, got %v", violation, err)
+	}
+	for _, path := range paths {
+		if current, _ := os.ReadFile(path); !bytes.Equal(current, published[path]) {
+			t.Errorf("expected %s to be left as it was", filepath.Base(path))
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(outFile), "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("expected temp files to be cleaned up, found %v", leftovers)
+	}
+}
+
+// TestExportRDFLeavesOutInvalidLegacyValues checks tag values written before they were
+// validated are left out of the export, rather than stopping it being published.
+func TestExportRDFLeavesOutInvalidLegacyValues(t *testing.T) {
+	dbPath, db := createVersionedExportDB(t, 6)
+	bumpDataVersion(t, db, `UPDATE tag SET value = '3/12' WHERE trackid = 2 AND predicateid = 'track_number'`)
+	outFile := filepath.Join(t.TempDir(), "export.nt")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("expected the export to be published, got %v", err)
+	}
+	published, _ := os.ReadFile(ExportPath(outFile, ExportFormats[1]))
+	if strings.Contains(string(published), "<http://localhost:8020/tracks/2> <http://purl.org/ontology/mo/track_number>") {
+		t.Error("expected track 2's invalid track number to be left out")
+	}
+	if !strings.Contains(string(published), "<http://localhost:8020/tracks/3> <http://purl.org/ontology/mo/track_number>") {
+		t.Error("expected other tracks' track numbers to be exported")
+	}
+}
@@ -0,0 +1,173 @@
+package rdfgen
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/deiu/rdf2go"
+)
+
+// tripleAdder is anything triples can be added to one at a time: an rdf2go.Graph's
+// AddTriple, to build a graph in memory, or a TripleWriter's, to stream them out.
+type tripleAdder func(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term)
+
+// TripleWriter streams triples out in one of ExportFormats as they're added, without
+// holding them in memory.  Consecutive triples about the same subject are grouped
+// together, so output is most compact when triples are added a subject at a time.
+//
+// Errors are sticky: once a write fails, later triples are dropped and the error is
+// returned by Close.
+type TripleWriter struct {
+	w       *bufio.Writer
+	mime    string
+	subject rdf2go.Term
+	count   int
+	err     error
+}
+
+// NewTripleWriter starts writing triples in the serialisation given by its MIME type.
+func NewTripleWriter(w io.Writer, mime string) (*TripleWriter, error) {
+	writer := &TripleWriter{w: bufio.NewWriter(w), mime: mime}
+	switch mime {
+	case "text/turtle", "application/n-triples":
+	case "application/ld+json":
+		writer.write("[")
+	case "application/rdf+xml":
+		writer.write(xml.Header + `<rdf:RDF xmlns:rdf="` + rdfNamespace + `">` + "\n")
+	default:
+		return nil, fmt.Errorf("can't stream RDF as %q", mime)
+	}
+	return writer, nil
+}
+
+// write writes a string, unless an earlier write has failed.
+func (writer *TripleWriter) write(text string) {
+	if writer.err == nil {
+		_, writer.err = writer.w.WriteString(text)
+	}
+}
+
+// AddTriple writes out a triple.
+func (writer *TripleWriter) AddTriple(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+	if writer.err != nil {
+		return
+	}
+	newSubject := writer.count == 0 || !subject.Equal(writer.subject)
+	switch writer.mime {
+	case "text/turtle":
+		writer.addTurtle(subject, predicate, object, newSubject)
+	case "application/n-triples":
+		writer.write(subject.String() + " " + predicate.String() + " " + object.String() + " .\n")
+	case "application/ld+json":
+		writer.addJSONLD(subject, predicate, object)
+	case "application/rdf+xml":
+		writer.addRDFXML(subject, predicate, object, newSubject)
+	}
+	writer.subject = subject
+	writer.count++
+}
+
+// addTurtle writes a triple as Turtle, laid out as rdf2go does, with a block for each subject.
+func (writer *TripleWriter) addTurtle(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term, newSubject bool) {
+	if !newSubject {
+		writer.write(" ;\n")
+	} else {
+		if writer.count > 0 {
+			writer.write(" .\n")
+		}
+		writer.write(subject.String() + "\n")
+	}
+	writer.write("  " + predicate.String() + " " + object.String())
+}
+
+// addJSONLD writes a triple as a JSON-LD node object of its own, as rdf2go does.
+func (writer *TripleWriter) addJSONLD(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+	node := map[string]interface{}{"@id": subject.RawValue()}
+	if blank, ok := subject.(*rdf2go.BlankNode); ok {
+		node["@id"] = blank.String()
+	}
+	value := map[string]string{}
+	switch object := object.(type) {
+	case *rdf2go.Literal:
+		value["@value"] = object.Value
+		if object.Datatype != nil {
+			value["@type"] = object.Datatype.RawValue()
+		}
+		if object.Language != "" {
+			value["@language"] = object.Language
+		}
+	case *rdf2go.BlankNode:
+		value["@id"] = object.String()
+	default:
+		value["@id"] = object.RawValue()
+	}
+	node[predicate.RawValue()] = []map[string]string{value}
+	encoded, err := json.Marshal(node)
+	if err != nil {
+		writer.err = err
+		return
+	}
+	if writer.count > 0 {
+		writer.write(",\n")
+	}
+	writer.write(string(encoded))
+}
+
+// addRDFXML writes a triple as RDF/XML, with an rdf:Description for each subject.
+// The namespace of each predicate other than RDF's own is declared on its element.
+func (writer *TripleWriter) addRDFXML(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term, newSubject bool) {
+	namespace, local, err := splitPredicate(predicate.RawValue())
+	if err != nil {
+		writer.err = err
+		return
+	}
+	if newSubject {
+		if writer.count > 0 {
+			writer.write("\t</rdf:Description>\n")
+		}
+		writer.write("\t<rdf:Description " + rdfXMLNode(subject, "rdf:about") + ">\n")
+	}
+	element := "rdf:" + local
+	if namespace != rdfNamespace {
+		element = "p:" + local
+		writer.write("\t\t<" + element + ` xmlns:p="` + xmlEscape(namespace) + `"`)
+	} else {
+		writer.write("\t\t<" + element)
+	}
+	switch object := object.(type) {
+	case *rdf2go.Literal:
+		if object.Language != "" {
+			writer.write(` xml:lang="` + xmlEscape(object.Language) + `"`)
+		} else if object.Datatype != nil {
+			writer.write(` rdf:datatype="` + xmlEscape(object.Datatype.RawValue()) + `"`)
+		}
+		writer.write(">" + xmlEscape(object.Value) + "</" + element + ">\n")
+	default:
+		writer.write(" " + rdfXMLNode(object, "rdf:resource") + "/>\n")
+	}
+}
+
+// Close finishes off the serialisation and flushes it, returning the first error
+// encountered while writing.  It doesn't close the underlying writer.
+func (writer *TripleWriter) Close() error {
+	switch writer.mime {
+	case "text/turtle":
+		if writer.count > 0 {
+			writer.write(" .\n")
+		}
+	case "application/ld+json":
+		writer.write("]\n")
+	case "application/rdf+xml":
+		if writer.count > 0 {
+			writer.write("\t</rdf:Description>\n")
+		}
+		writer.write("</rdf:RDF>\n")
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+	return writer.w.Flush()
+}
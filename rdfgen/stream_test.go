@@ -0,0 +1,295 @@
+package rdfgen
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	rdf2go "github.com/deiu/rdf2go"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// createSyntheticExportDB creates a database of the given number of tracks, each with a
+// spread of tags, along with albums and artists for them to reference and collections
+// for them to be in.
+func createSyntheticExportDB(tb testing.TB, tracks int) string {
+	tb.Helper()
+	dbPath := filepath.Join(tb.TempDir(), "synthetic.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+	CREATE TABLE track (id INTEGER PRIMARY KEY, url TEXT, duration INTEGER);
+	CREATE TABLE tag (trackid INTEGER, predicateid TEXT, value TEXT, uri TEXT);
+	CREATE TABLE album (id INTEGER PRIMARY KEY, name TEXT, year INTEGER, mbid_release TEXT, track_count INTEGER, disc_count INTEGER, artwork TEXT);
+	CREATE TABLE album_artist (albumid INTEGER, position INTEGER, artistid INTEGER);
+	CREATE TABLE artist (id INTEGER PRIMARY KEY, name TEXT, person_uri TEXT, sort_name TEXT, mbid_artist TEXT, type TEXT);
+	CREATE TABLE artist_alias (artistid INTEGER, name TEXT);
+	CREATE TABLE artist_member (groupid INTEGER, position INTEGER, memberid INTEGER, person_uri TEXT);
+	CREATE TABLE collection (slug TEXT PRIMARY KEY, name TEXT, icon TEXT, query TEXT, operation TEXT, ordered BOOLEAN);
+	CREATE TABLE collection_track (collectionslug TEXT, trackid INTEGER, position INTEGER);
+	`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	albums := max(tracks/10, 1)
+	artists := max(tracks/20, 2)
+	for id := 1; id <= artists; id++ {
+		artistType := "person"
+		if id%5 == 0 {
+			artistType = "group"
+			tx.Exec(`INSERT INTO artist_member VALUES (?, 1, ?, NULL)`, id, id-1)
+			tx.Exec(`INSERT INTO artist_member VALUES (?, 2, NULL, 'https://eolas.l42.eu/metadata/person/1/')`, id)
+		}
+		tx.Exec(`INSERT INTO artist VALUES (?, ?, NULL, ?, NULL, ?)`, id, fmt.Sprintf("Artist %d", id), fmt.Sprintf("%d, Artist", id), artistType)
+		tx.Exec(`INSERT INTO artist_alias VALUES (?, ?)`, id, fmt.Sprintf("A%d", id))
+	}
+	for id := 1; id <= albums; id++ {
+		tx.Exec(`INSERT INTO album VALUES (?, ?, ?, NULL, 10, 1, NULL)`, id, fmt.Sprintf("Album \"%d\"", id), 1960+id%60)
+		tx.Exec(`INSERT INTO album_artist VALUES (?, 1, ?)`, id, id%artists+1)
+	}
+	for id := 1; id <= tracks; id++ {
+		tx.Exec(`INSERT INTO track VALUES (?, ?, ?)`, id, fmt.Sprintf("https://example.org/tracks/%d.mp3", id), 120+id%300)
+		for _, tag := range [][]string{
+			{"title", fmt.Sprintf("Track %d\twith \\ \"odd\" characters\n", id), ""},
+			{"artist", fmt.Sprintf("Artist %d", id%artists+1), fmt.Sprintf("http://localhost:8020/artists/%d", id%artists+1)},
+			{"album", fmt.Sprintf("Album %d", id%albums+1), fmt.Sprintf("http://localhost:8020/albums/%d", id%albums+1)},
+			{"year", fmt.Sprint(1960 + id%60), ""},
+			{"track_number", fmt.Sprint(id%10 + 1), ""},
+			{"comment", "Ünïcödé ☃", ""},
+			{"genre", "Omitted", ""},
+		} {
+			tx.Exec(`INSERT INTO tag VALUES (?, ?, ?, ?)`, id, tag[0], tag[1], tag[2])
+		}
+	}
+	tx.Exec(`INSERT INTO collection VALUES ('favourites', 'Favourites', '⭐', NULL, NULL, TRUE)`)
+	tx.Exec(`INSERT INTO collection VALUES ('welsh', 'Welsh', '', 'p.language=cy', NULL, FALSE)`)
+	for id := 3; id <= tracks; id += 3 {
+		tx.Exec(`INSERT INTO collection_track VALUES ('favourites', ?, ?)`, id, id/3)
+	}
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+	return dbPath
+}
+
+// canonicalTriples returns a graph's triples as sorted, de-duplicated N-Triples lines.
+// The export has no blank nodes, so two graphs are isomorphic exactly when these match.
+func canonicalTriples(g *rdf2go.Graph) []string {
+	seen := map[string]bool{}
+	var lines []string
+	for triple := range g.IterTriples() {
+		line := triple.String()
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// assertIsomorphic fails the test if two graphs don't hold the same triples.
+func assertIsomorphic(t *testing.T, name string, expected *rdf2go.Graph, actual *rdf2go.Graph) {
+	t.Helper()
+	expectedLines := canonicalTriples(expected)
+	actualLines := canonicalTriples(actual)
+	if strings.Join(expectedLines, "\n") == strings.Join(actualLines, "\n") {
+		return
+	}
+	actualSet := map[string]bool{}
+	for _, line := range actualLines {
+		actualSet[line] = true
+	}
+	for _, line := range expectedLines {
+		if !actualSet[line] {
+			t.Errorf("%s is missing triple %s", name, line)
+			return
+		}
+	}
+	t.Errorf("%s has %d triples, expected %d", name, len(actualLines), len(expectedLines))
+}
+
+// parseFile parses an exported file into a graph.
+func parseFile(t *testing.T, path string, mime string) *rdf2go.Graph {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", path, err)
+	}
+	defer file.Close()
+	g := rdf2go.NewGraph("")
+	if err := g.Parse(file, mime); err != nil {
+		t.Fatalf("could not parse %s: %v", path, err)
+	}
+	return g
+}
+
+// TestStreamedExportIsomorphicToGraph checks the streamed Turtle and N-Triples exports hold
+// exactly the triples of the same export built into a graph and serialised by rdf2go,
+// followed by the dataset description.
+func TestStreamedExportIsomorphicToGraph(t *testing.T) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(t, 200)
+	outFile := filepath.Join(t.TempDir(), "export.ttl")
+	if err := ExportRDF(dbPath, outFile); err != nil {
+		t.Fatalf("ExportRDF failed: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	graph := rdf2go.NewGraph("")
+	if _, err := writeExport(db, graph.AddTriple); err != nil {
+		t.Fatalf("writeExport failed: %v", err)
+	}
+	// The export ends with its dataset description, as published on its own
+	for triple := range parseFile(t, DatasetPath(outFile, ExportFormats[0]), "text/turtle").IterTriples() {
+		graph.AddTriple(triple.Subject, triple.Predicate, triple.Object)
+	}
+	var serialised bytes.Buffer
+	if err := graph.Serialize(&serialised, "text/turtle"); err != nil {
+		t.Fatalf("graph serialisation failed: %v", err)
+	}
+	expected := rdf2go.NewGraph("")
+	if err := expected.Parse(&serialised, "text/turtle"); err != nil {
+		t.Fatalf("could not parse graph serialisation: %v", err)
+	}
+	if len(canonicalTriples(expected)) < 200*6 {
+		t.Fatalf("expected at least %d triples in the graph, got %d", 200*6, len(canonicalTriples(expected)))
+	}
+
+	assertIsomorphic(t, "Streamed Turtle", expected, parseFile(t, outFile, "text/turtle"))
+	// N-Triples is a subset of Turtle, so can be parsed as such
+	assertIsomorphic(t, "Streamed N-Triples", expected, parseFile(t, ExportPath(outFile, ExportFormats[1]), "text/turtle"))
+
+	// rdf2go's JSON-LD parser isn't faithful enough to compare, so just check it's valid JSON
+	jsonld, err := os.ReadFile(ExportPath(outFile, ExportFormats[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(jsonld) {
+		t.Error("Streamed JSON-LD isn't valid JSON")
+	}
+}
+
+// TestTripleWriterTurtleGroupsSubjects checks consecutive triples about a subject share a block.
+func TestTripleWriterTurtleGroupsSubjects(t *testing.T) {
+	var output bytes.Buffer
+	writer, err := NewTripleWriter(&output, "text/turtle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := rdf2go.NewResource("http://example.org/1")
+	second := rdf2go.NewResource("http://example.org/2")
+	label := rdf2go.NewResource(skosPrefLabel)
+	writer.AddTriple(first, label, rdf2go.NewLiteral("One"))
+	writer.AddTriple(first, rdf2go.NewResource(rdfsComment), rdf2go.NewLiteralWithLanguage("Un", "fr"))
+	writer.AddTriple(second, label, rdf2go.NewLiteral("Two"))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<http://example.org/1>\n" +
+		"  <" + skosPrefLabel + "> \"One\" ;\n" +
+		"  <" + rdfsComment + "> \"Un\"@fr .\n" +
+		"<http://example.org/2>\n" +
+		"  <" + skosPrefLabel + "> \"Two\" .\n"
+	if output.String() != expected {
+		t.Errorf("unexpected Turtle:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+}
+
+// TestTripleWriterRejectsUnknownFormat checks only the export formats can be streamed.
+func TestTripleWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewTripleWriter(&bytes.Buffer{}, "text/n3"); err == nil {
+		t.Error("expected an error streaming an unsupported format")
+	}
+}
+
+// reportPeakHeap runs the benchmark loop while sampling the heap, reporting the most
+// memory in use at any point as peak-heap-MB.
+func reportPeakHeap(b *testing.B, run func()) {
+	runtime.GC()
+	var peak uint64
+	done := make(chan bool)
+	sampled := make(chan bool)
+	go func() {
+		var stats runtime.MemStats
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+			select {
+			case <-done:
+				close(sampled)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		run()
+	}
+	b.StopTimer()
+	close(done)
+	<-sampled
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+}
+
+// BenchmarkExportRDF streams the export of a large synthetic library in every format.
+func BenchmarkExportRDF(b *testing.B) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	dbPath := createSyntheticExportDB(b, 20000)
+	outFile := filepath.Join(b.TempDir(), "export.ttl")
+	reportPeakHeap(b, func() {
+		if err := ExportRDF(dbPath, outFile); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+// BenchmarkExportGraph builds the same export into a graph and serialises it in every
+// format, as ExportRDF used to, for comparison with BenchmarkExportRDF.
+func BenchmarkExportGraph(b *testing.B) {
+	os.Setenv("MEDIA_METADATA_MANAGER_ORIGIN", "http://localhost:8020")
+	os.Setenv("APP_ORIGIN", "http://localhost:3002")
+	db, err := sql.Open("sqlite3", createSyntheticExportDB(b, 20000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	reportPeakHeap(b, func() {
+		graph := rdf2go.NewGraph("")
+		if _, err := writeExport(db, graph.AddTriple); err != nil {
+			b.Fatal(err)
+		}
+		for _, format := range ExportFormats {
+			if err := SerializeGraph(graph, io.Discard, format.MIME); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
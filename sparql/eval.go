@@ -0,0 +1,351 @@
+package sparql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+)
+
+// binding maps variable names to the ids of the terms they're bound to.
+type binding map[string]int
+
+func (solution binding) clone() binding {
+	copied := make(binding, len(solution)+2)
+	for variable, id := range solution {
+		copied[variable] = id
+	}
+	return copied
+}
+
+// MaxSolutions is the most solutions evaluation may hold for any part of a query, so a
+// query matching far more of the graph than it returns can't use up all the memory.
+var MaxSolutions = 1000000
+
+// ErrTooManySolutions is returned by Evaluate when part of a query has more than
+// MaxSolutions solutions.
+var ErrTooManySolutions = errors.New("too many solutions")
+
+// checkInterval is how many steps of evaluation are taken between checks for the
+// query having been cancelled or timed out.
+const checkInterval = 1024
+
+// evaluator holds the state of a query's evaluation against a graph.
+type evaluator struct {
+	ctx     context.Context
+	graph   *Graph
+	steps   int
+	regexps map[string]*regexp.Regexp
+}
+
+// Results are the results of evaluating a query: solutions for SELECT, a boolean for
+// ASK, or triples for CONSTRUCT.
+type Results struct {
+	Form      QueryForm
+	Variables []string
+	// Solutions maps each projected variable to its value; unbound variables are absent.
+	Solutions []map[string]Term
+	Boolean   bool
+	Triples   [][3]Term
+}
+
+// Evaluate evaluates the query against a graph.  If the context is cancelled or times
+// out, evaluation is abandoned and the context's error returned, or ErrTooManySolutions
+// if part of the query has more than MaxSolutions solutions.
+func (query *Query) Evaluate(ctx context.Context, graph *Graph) (*Results, error) {
+	e := &evaluator{ctx: ctx, graph: graph, regexps: make(map[string]*regexp.Regexp)}
+	solutions, err := e.evaluateGroup(query.where, []binding{{}})
+	if err != nil {
+		return nil, err
+	}
+	results := &Results{Form: query.Form, Variables: query.Variables}
+	if query.Form == AskQuery {
+		results.Boolean = len(solutions) > 0
+		return results, nil
+	}
+	if len(query.orderBy) > 0 {
+		solutions = e.order(solutions, query.orderBy)
+	}
+
+	if query.Form == ConstructQuery {
+		solutions = slice(solutions, query.offset, query.limit)
+		results.Triples = e.construct(query.template, solutions)
+		return results, nil
+	}
+	seen := make(map[string]bool)
+	for _, solution := range solutions {
+		projected := make(map[string]Term, len(query.Variables))
+		var key strings.Builder
+		for _, variable := range query.Variables {
+			if id, ok := solution[variable]; ok {
+				projected[variable] = graph.terms[id]
+				key.WriteString(graph.terms[id].String())
+			}
+			key.WriteByte(0)
+		}
+		if query.Distinct {
+			if seen[key.String()] {
+				continue
+			}
+			seen[key.String()] = true
+		}
+		results.Solutions = append(results.Solutions, projected)
+	}
+	results.Solutions = slice(results.Solutions, query.offset, query.limit)
+	return results, nil
+}
+
+// slice applies OFFSET and LIMIT, where a negative limit means there isn't one.
+func slice[T any](items []T, offset int, limit int) []T {
+	items = items[min(offset, len(items)):]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// step counts a step of evaluation, returning an error if the query should be abandoned.
+func (e *evaluator) step() error {
+	e.steps++
+	if e.steps%checkInterval == 0 {
+		return e.ctx.Err()
+	}
+	return nil
+}
+
+// collect adds solutions to a list of them, returning an error if there'd be too many.
+func (e *evaluator) collect(solutions []binding, solution ...binding) ([]binding, error) {
+	if len(solutions)+len(solution) > MaxSolutions {
+		return nil, fmt.Errorf("%w: part of the query has more than %d", ErrTooManySolutions, MaxSolutions)
+	}
+	return append(solutions, solution...), nil
+}
+
+// evaluateGroup extends each of the seed solutions with the solutions of a group pattern.
+func (e *evaluator) evaluateGroup(group *groupPattern, seeds []binding) ([]binding, error) {
+	solutions := seeds
+	for _, element := range group.elements {
+		var next []binding
+		switch {
+		case element.triples != nil:
+			for _, solution := range solutions {
+				err := e.matchTriples(element.triples, solution.clone(), func(match binding) (err error) {
+					next, err = e.collect(next, match)
+					return
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+		case element.group != nil:
+			var err error
+			if next, err = e.evaluateGroup(element.group, solutions); err != nil {
+				return nil, err
+			}
+		case element.optional != nil:
+			for _, solution := range solutions {
+				extended, err := e.evaluateGroup(element.optional, []binding{solution})
+				if err != nil {
+					return nil, err
+				}
+				if len(extended) == 0 {
+					extended = []binding{solution}
+				}
+				if next, err = e.collect(next, extended...); err != nil {
+					return nil, err
+				}
+			}
+		}
+		solutions = next
+	}
+	if len(group.filters) == 0 {
+		return solutions, nil
+	}
+	var filtered []binding
+	for _, solution := range solutions {
+		if err := e.step(); err != nil {
+			return nil, err
+		}
+		if e.passes(group.filters, solution) {
+			filtered = append(filtered, solution)
+		}
+	}
+	return filtered, nil
+}
+
+// passes reports whether a solution passes all of a group's filters.  A filter which
+// raises an error rejects the solution.
+func (e *evaluator) passes(filters []expression, solution binding) bool {
+	for _, filter := range filters {
+		if value, err := evaluateBoolean(e, filter, solution); err != nil || !value {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve returns the ids of a pattern's terms and bound variables, with -1 for unbound
+// variables.  ok is false if one of its terms isn't in the graph, so it can't match.
+func (e *evaluator) resolve(pattern triplePattern, solution binding) (ids [3]int, ok bool) {
+	for i, n := range [3]node{pattern.subject, pattern.predicate, pattern.object} {
+		ids[i] = -1
+		if !n.isVariable() {
+			if ids[i] = e.graph.lookup(n.term); ids[i] < 0 {
+				return ids, false
+			}
+		} else if id, bound := solution[n.variable]; bound {
+			ids[i] = id
+		}
+	}
+	return ids, true
+}
+
+// matchTriples finds the ways a basic graph pattern matches the graph, extending the given
+// solution, which is modified as matching proceeds, and passing each to emit.  Matching
+// stops at the first error emit returns.
+// The pattern matching the fewest triples is matched first.
+func (e *evaluator) matchTriples(patterns []triplePattern, solution binding, emit func(binding) error) error {
+	if len(patterns) == 0 {
+		return emit(solution.clone())
+	}
+	best, bestCount := -1, 0
+	var bestIDs [3]int
+	var bestPositions []int
+	bestAll := false
+	for i, pattern := range patterns {
+		ids, ok := e.resolve(pattern, solution)
+		if !ok {
+			return nil
+		}
+		positions, all := e.graph.candidates(ids)
+		count := len(positions)
+		if all {
+			count = len(e.graph.triples)
+		}
+		if best < 0 || count < bestCount {
+			best, bestCount, bestIDs, bestPositions, bestAll = i, count, ids, positions, all
+		}
+	}
+	pattern := patterns[best]
+	rest := make([]triplePattern, 0, len(patterns)-1)
+	rest = append(append(rest, patterns[:best]...), patterns[best+1:]...)
+	nodes := [3]node{pattern.subject, pattern.predicate, pattern.object}
+
+	for i := 0; i < bestCount; i++ {
+		if err := e.step(); err != nil {
+			return err
+		}
+		position := i
+		if !bestAll {
+			position = bestPositions[i]
+		}
+		triple := e.graph.triples[position]
+		var added []string
+		matches := true
+		for k, n := range nodes {
+			if bestIDs[k] >= 0 {
+				matches = triple[k] == bestIDs[k]
+			} else if id, bound := solution[n.variable]; bound {
+				// The same variable appears earlier in the pattern
+				matches = triple[k] == id
+			} else {
+				solution[n.variable] = triple[k]
+				added = append(added, n.variable)
+			}
+			if !matches {
+				break
+			}
+		}
+		if matches {
+			if err := e.matchTriples(rest, solution, emit); err != nil {
+				return err
+			}
+		}
+		for _, variable := range added {
+			delete(solution, variable)
+		}
+	}
+	return nil
+}
+
+// order sorts solutions by the ORDER BY conditions.  Expressions which raise errors
+// sort as though unbound.
+func (e *evaluator) order(solutions []binding, conditions []orderCondition) []binding {
+	keys := make([][]*Term, len(solutions))
+	for i, solution := range solutions {
+		keys[i] = make([]*Term, len(conditions))
+		for j, condition := range conditions {
+			if value, err := condition.expression.evaluate(e, solution); err == nil {
+				keys[i][j] = &value
+			}
+		}
+	}
+	indexes := make([]int, len(solutions))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		for j, condition := range conditions {
+			comparison := orderTerms(keys[indexes[a]][j], keys[indexes[b]][j])
+			if condition.descending {
+				comparison = -comparison
+			}
+			if comparison != 0 {
+				return comparison < 0
+			}
+		}
+		return false
+	})
+	sorted := make([]binding, len(solutions))
+	for i, index := range indexes {
+		sorted[i] = solutions[index]
+	}
+	return sorted
+}
+
+// construct instantiates a CONSTRUCT template with each solution.  Triples with unbound
+// variables, or which wouldn't be valid RDF, are left out.  Blank nodes in the template
+// are fresh for each solution.
+func (e *evaluator) construct(template []triplePattern, solutions []binding) [][3]Term {
+	var triples [][3]Term
+	seen := make(map[[3]Term]bool)
+	for i, solution := range solutions {
+		for _, pattern := range template {
+			var triple [3]Term
+			valid := true
+			for k, n := range [3]node{pattern.subject, pattern.predicate, pattern.object} {
+				switch {
+				case !n.isVariable():
+					triple[k] = n.term
+				case strings.HasPrefix(n.variable, "_:"):
+					triple[k] = Term{Kind: Blank, Value: fmt.Sprintf("%s_%d", strings.TrimPrefix(n.variable, "_:"), i)}
+				default:
+					id, bound := solution[n.variable]
+					valid = valid && bound
+					if bound {
+						triple[k] = e.graph.terms[id]
+					}
+				}
+			}
+			if !valid || triple[0].Kind == Literal || triple[1].Kind != IRI || seen[triple] {
+				continue
+			}
+			seen[triple] = true
+			triples = append(triples, triple)
+		}
+	}
+	return triples
+}
+
+// Graph returns a CONSTRUCT query's triples as a graph, for serialising.
+func (results *Results) Graph() *rdf2go.Graph {
+	g := rdf2go.NewGraph("")
+	for _, triple := range results.Triples {
+		g.AddTriple(triple[0].rdf2go(), triple[1].rdf2go(), triple[2].rdf2go())
+	}
+	return g
+}
@@ -0,0 +1,238 @@
+package sparql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPrefixes = `
+PREFIX mo: <http://purl.org/ontology/mo/>
+PREFIX dc: <http://purl.org/dc/terms/>
+PREFIX foaf: <http://xmlns.com/foaf/0.1/>
+PREFIX skos: <http://www.w3.org/2004/02/skos/core#>
+PREFIX xsd: <http://www.w3.org/2001/XMLSchema#>
+`
+
+// testGraph returns a few tracks, some composed by their own artist.
+func testGraph() *Graph {
+	g := NewGraph()
+	track := func(id int, title string, artist string, composer string, duration int) {
+		subject := NewIRI(fmt.Sprintf("http://localhost/tracks/%d", id))
+		g.Add(subject, NewIRI(rdfType), NewIRI("http://purl.org/ontology/mo/Track"))
+		g.Add(subject, NewIRI("http://www.w3.org/2004/02/skos/core#prefLabel"), NewLiteral(title))
+		g.Add(subject, NewIRI("http://xmlns.com/foaf/0.1/maker"), NewIRI("http://localhost/artists/"+artist))
+		if composer != "" {
+			g.Add(subject, NewIRI("http://purl.org/ontology/mo/composer"), NewIRI("http://localhost/artists/"+composer))
+		}
+		g.Add(subject, NewIRI("http://purl.org/ontology/mo/duration"), NewTypedLiteral(fmt.Sprint(duration), xsdInteger))
+	}
+	track(1, "Yesterday", "beatles", "beatles", 125)
+	track(2, "Respect", "franklin", "redding", 147)
+	track(3, "Imagine", "lennon", "lennon", 183)
+	track(4, "Untitled", "unknown", "", 60)
+	g.Add(NewIRI("http://localhost/artists/lennon"), NewIRI("http://www.w3.org/2004/02/skos/core#prefLabel"), NewLangLiteral("John Lennon", "en"))
+	return g
+}
+
+// run parses and evaluates a query against the test graph, failing the test on error.
+func run(t *testing.T, query string) *Results {
+	t.Helper()
+	parsed, err := Parse(testPrefixes + query)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", query, err)
+	}
+	results, err := parsed.Evaluate(context.Background(), testGraph())
+	if err != nil {
+		t.Fatalf("failed to evaluate %q: %v", query, err)
+	}
+	return results
+}
+
+// column returns the values of a variable across the solutions, with "-" for unbound.
+func column(results *Results, variable string) string {
+	var values []string
+	for _, solution := range results.Solutions {
+		if term, ok := solution[variable]; ok {
+			values = append(values, term.Value)
+		} else {
+			values = append(values, "-")
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func TestSelectJoinsOnSharedVariables(t *testing.T) {
+	results := run(t, `SELECT ?title WHERE { ?track mo:composer ?artist ; foaf:maker ?artist ; skos:prefLabel ?title } ORDER BY ?title`)
+	if got := column(results, "title"); got != "Imagine,Yesterday" {
+		t.Errorf("expected tracks composed by their artist, got %q", got)
+	}
+}
+
+func TestSelectStarProjectsEveryVariable(t *testing.T) {
+	results := run(t, `SELECT * WHERE { ?track a mo:Track ; mo:duration ?duration ; skos:prefLabel _:title FILTER(?duration > 150) }`)
+	if strings.Join(results.Variables, ",") != "track,duration" {
+		t.Errorf("expected variables track and duration, got %v", results.Variables)
+	}
+	if got := column(results, "duration"); got != "183" {
+		t.Errorf("expected only Imagine's duration, got %q", got)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`?duration > 140`, "Respect,Imagine"},
+		{`?duration >= 125 && ?duration < 147`, "Yesterday"},
+		{`?duration < 100 || ?title = "Respect"`, "Respect,Untitled"},
+		{`!(?duration > 100)`, "Untitled"},
+		{`?duration * 2 = 250`, "Yesterday"},
+		{`?duration / 2 > 90.5`, "Imagine"},
+		{`regex(?title, "^y", "i")`, "Yesterday"},
+		{`contains(?title, "tit") || strstarts(lcase(?title), "im")`, "Imagine,Untitled"},
+		{`strlen(?title) = 7`, "Respect,Imagine"},
+		{`isLiteral(?title) && datatype(?duration) = xsd:integer && !bound(?nothing)`, "Yesterday,Respect,Imagine,Untitled"},
+		{`?title > 5`, ""},
+		{`?nothing = 1 || ?duration = 60`, "Untitled"},
+		{`str(?track) = "http://localhost/tracks/2"`, "Respect"},
+		{`?duration = 125.0`, "Yesterday"},
+	}
+	for _, tc := range tests {
+		results := run(t, `SELECT ?title WHERE { ?track skos:prefLabel ?title ; mo:duration ?duration FILTER(`+tc.filter+`) } ORDER BY ?track`)
+		if got := column(results, "title"); got != tc.want {
+			t.Errorf("FILTER(%s): expected %q, got %q", tc.filter, tc.want, got)
+		}
+	}
+}
+
+func TestOptional(t *testing.T) {
+	results := run(t, `SELECT ?title ?composer WHERE {
+		?track a mo:Track ; skos:prefLabel ?title .
+		OPTIONAL { ?track mo:composer ?composer FILTER(?composer != <http://localhost/artists/redding>) }
+	} ORDER BY ?track`)
+	if got := column(results, "composer"); got != "http://localhost/artists/beatles,-,http://localhost/artists/lennon,-" {
+		t.Errorf("unexpected optional composers %q", got)
+	}
+
+	results = run(t, `SELECT ?title WHERE { ?track a mo:Track ; skos:prefLabel ?title OPTIONAL { ?track mo:composer ?composer } FILTER(!bound(?composer)) }`)
+	if got := column(results, "title"); got != "Untitled" {
+		t.Errorf("expected only the track without a composer, got %q", got)
+	}
+}
+
+func TestLanguageTaggedLiterals(t *testing.T) {
+	results := run(t, `SELECT ?name WHERE { ?artist skos:prefLabel ?name FILTER(langMatches(lang(?name), "EN")) }`)
+	if got := column(results, "name"); got != "John Lennon" {
+		t.Errorf("expected the English name, got %q", got)
+	}
+	if term := results.Solutions[0]["name"]; term.Language != "en" {
+		t.Errorf("expected the name's language to be kept, got %+v", term)
+	}
+	results = run(t, `SELECT ?artist WHERE { ?artist skos:prefLabel "John Lennon"@en }`)
+	if len(results.Solutions) != 1 {
+		t.Errorf("expected a language-tagged literal to match, got %d solutions", len(results.Solutions))
+	}
+}
+
+func TestSolutionModifiers(t *testing.T) {
+	results := run(t, `SELECT ?duration WHERE { ?track mo:duration ?duration } ORDER BY DESC(?duration) LIMIT 2 OFFSET 1`)
+	if got := column(results, "duration"); got != "147,125" {
+		t.Errorf("expected second and third longest durations, got %q", got)
+	}
+	results = run(t, `SELECT DISTINCT ?artist WHERE { ?track foaf:maker ?artist ; mo:composer ?artist }`)
+	if len(results.Solutions) != 2 {
+		t.Errorf("expected 2 distinct artists, got %d", len(results.Solutions))
+	}
+	results = run(t, `SELECT ?title WHERE { ?track skos:prefLabel ?title } ORDER BY strlen(?title) ?title LIMIT 0`)
+	if len(results.Solutions) != 0 {
+		t.Errorf("expected LIMIT 0 to give no solutions, got %d", len(results.Solutions))
+	}
+}
+
+func TestAsk(t *testing.T) {
+	if !run(t, `ASK { ?track mo:composer <http://localhost/artists/redding> }`).Boolean {
+		t.Error("expected ASK to find a track composed by Otis Redding")
+	}
+	if run(t, `ASK WHERE { ?track mo:composer <http://localhost/artists/nobody> }`).Boolean {
+		t.Error("expected ASK to find no tracks composed by nobody")
+	}
+}
+
+func TestConstruct(t *testing.T) {
+	results := run(t, `CONSTRUCT { ?artist dc:creator ?track . ?track dc:title ?title . _:note skos:note ?title }
+		WHERE { ?track mo:composer ?artist . OPTIONAL { ?track skos:prefLabel ?title FILTER(?title != "Respect") } }`)
+	if len(results.Triples) != 3+2+2 {
+		t.Fatalf("expected 7 triples, got %d: %v", len(results.Triples), results.Triples)
+	}
+	blanks := map[string]bool{}
+	for _, triple := range results.Triples {
+		if triple[0].Kind == Blank {
+			blanks[triple[0].Value] = true
+		}
+	}
+	if len(blanks) != 2 {
+		t.Errorf("expected a fresh blank node for each solution, got %v", blanks)
+	}
+	if results.Graph().Len() != 7 {
+		t.Errorf("expected 7 triples in the graph, got %d", results.Graph().Len())
+	}
+
+	results = run(t, `CONSTRUCT WHERE { ?track mo:composer <http://localhost/artists/lennon> }`)
+	if len(results.Triples) != 1 || results.Triples[0][0].Value != "http://localhost/tracks/3" {
+		t.Errorf("unexpected short-form CONSTRUCT results %v", results.Triples)
+	}
+}
+
+func TestEvaluateTimesOut(t *testing.T) {
+	g := NewGraph()
+	for i := 0; i < 200; i++ {
+		g.Add(NewIRI(fmt.Sprintf("http://localhost/%d", i)), NewIRI("http://localhost/p"), NewLiteral("x"))
+	}
+	query, err := Parse(`SELECT * { ?a ?p ?x . ?b ?p ?x . ?c ?p ?x }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := query.Evaluate(ctx, g); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the query to time out, got %v", err)
+	}
+}
+
+func TestEvaluateLimitsSolutions(t *testing.T) {
+	g := NewGraph()
+	for i := 0; i < 20; i++ {
+		g.Add(NewIRI(fmt.Sprintf("http://localhost/%d", i)), NewIRI("http://localhost/p"), NewLiteral("x"))
+	}
+	defer func(max int) { MaxSolutions = max }(MaxSolutions)
+	MaxSolutions = 100
+
+	// 400 solutions join the first two patterns, even though only 20 are returned
+	query, err := Parse(`SELECT * { ?a ?p ?x . ?b ?p ?x . FILTER(?a = ?b) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := query.Evaluate(context.Background(), g); !errors.Is(err, ErrTooManySolutions) {
+		t.Errorf("expected too many solutions, got %v", err)
+	}
+	query, err = Parse(`SELECT * { ?a ?p ?x OPTIONAL { ?b ?p ?x } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := query.Evaluate(context.Background(), g); !errors.Is(err, ErrTooManySolutions) {
+		t.Errorf("expected too many solutions from OPTIONAL, got %v", err)
+	}
+
+	query, err = Parse(`SELECT * { ?a ?p ?x }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, err := query.Evaluate(context.Background(), g); err != nil || len(results.Solutions) != 20 {
+		t.Errorf("expected 20 solutions within the limit, got %v, %v", results, err)
+	}
+}
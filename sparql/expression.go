@@ -0,0 +1,644 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// errType is the error raised evaluating an expression on terms of the wrong type, or an
+// unbound variable.  A FILTER whose expression raises it rejects the solution.
+var errType = errors.New("type error")
+
+// expression is a FILTER or ORDER BY expression, evaluated against a solution.
+type expression interface {
+	evaluate(e *evaluator, solution binding) (Term, error)
+}
+
+type variableExpression string
+
+type constantExpression Term
+
+type logicalExpression struct {
+	and         bool
+	left, right expression
+}
+
+type notExpression struct {
+	operand expression
+}
+
+type comparisonExpression struct {
+	operator    string
+	left, right expression
+}
+
+type arithmeticExpression struct {
+	operator    string
+	left, right expression
+}
+
+type boundExpression string
+
+type callExpression struct {
+	function  builtin
+	arguments []expression
+}
+
+// builtin is one of the SPARQL functions which can be called in an expression.
+type builtin struct {
+	minArguments, maxArguments int
+	apply                      func(e *evaluator, arguments []Term) (Term, error)
+}
+
+// builtins lists the functions supported, by upper-cased name.  BOUND is handled
+// separately, as its argument is a variable rather than a value.
+var builtins = map[string]builtin{
+	"STR":         {1, 1, builtinStr},
+	"LANG":        {1, 1, builtinLang},
+	"LANGMATCHES": {2, 2, builtinLangMatches},
+	"DATATYPE":    {1, 1, builtinDatatype},
+	"ISIRI":       {1, 1, termKindTest(IRI)},
+	"ISURI":       {1, 1, termKindTest(IRI)},
+	"ISBLANK":     {1, 1, termKindTest(Blank)},
+	"ISLITERAL":   {1, 1, termKindTest(Literal)},
+	"ISNUMERIC":   {1, 1, builtinIsNumeric},
+	"SAMETERM":    {2, 2, builtinSameTerm},
+	"REGEX":       {2, 3, builtinRegex},
+	"CONTAINS":    {2, 2, stringTest(strings.Contains)},
+	"STRSTARTS":   {2, 2, stringTest(strings.HasPrefix)},
+	"STRENDS":     {2, 2, stringTest(strings.HasSuffix)},
+	"STRLEN":      {1, 1, builtinStrLen},
+	"LCASE":       {1, 1, caseChange(strings.ToLower)},
+	"UCASE":       {1, 1, caseChange(strings.ToUpper)},
+}
+
+// isFunctionName reports whether a word is the name of a function which can be called.
+func isFunctionName(word string) bool {
+	word = strings.ToUpper(word)
+	_, ok := builtins[word]
+	return ok || word == "BOUND"
+}
+
+func booleanTerm(value bool) Term {
+	return NewTypedLiteral(strconv.FormatBool(value), xsdBoolean)
+}
+
+func (expr variableExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	id, ok := solution[string(expr)]
+	if !ok {
+		return Term{}, errType
+	}
+	return e.graph.terms[id], nil
+}
+
+func (expr constantExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	return Term(expr), nil
+}
+
+func (expr boundExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	_, ok := solution[string(expr)]
+	return booleanTerm(ok), nil
+}
+
+// evaluate applies SPARQL's three-valued logic: an error on one side is ignored if the
+// other side decides the result.
+func (expr logicalExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	left, leftErr := evaluateBoolean(e, expr.left, solution)
+	if leftErr == nil && left != expr.and {
+		return booleanTerm(left), nil
+	}
+	right, rightErr := evaluateBoolean(e, expr.right, solution)
+	if rightErr == nil && right != expr.and {
+		return booleanTerm(right), nil
+	}
+	if leftErr != nil {
+		return Term{}, leftErr
+	}
+	if rightErr != nil {
+		return Term{}, rightErr
+	}
+	return booleanTerm(expr.and), nil
+}
+
+func (expr notExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	value, err := evaluateBoolean(e, expr.operand, solution)
+	if err != nil {
+		return Term{}, err
+	}
+	return booleanTerm(!value), nil
+}
+
+func (expr comparisonExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	left, err := expr.left.evaluate(e, solution)
+	if err != nil {
+		return Term{}, err
+	}
+	right, err := expr.right.evaluate(e, solution)
+	if err != nil {
+		return Term{}, err
+	}
+	if expr.operator == "=" || expr.operator == "!=" {
+		equal := termsEqual(left, right)
+		return booleanTerm(equal == (expr.operator == "=")), nil
+	}
+	comparison, err := compareValues(left, right)
+	if err != nil {
+		return Term{}, err
+	}
+	switch expr.operator {
+	case "<":
+		return booleanTerm(comparison < 0), nil
+	case ">":
+		return booleanTerm(comparison > 0), nil
+	case "<=":
+		return booleanTerm(comparison <= 0), nil
+	}
+	return booleanTerm(comparison >= 0), nil
+}
+
+func (expr arithmeticExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	left, err := expr.left.evaluate(e, solution)
+	if err != nil {
+		return Term{}, err
+	}
+	right, err := expr.right.evaluate(e, solution)
+	if err != nil {
+		return Term{}, err
+	}
+	leftValue, leftType, err := numericValue(left)
+	if err != nil {
+		return Term{}, err
+	}
+	rightValue, rightType, err := numericValue(right)
+	if err != nil {
+		return Term{}, err
+	}
+	resultType := max(leftType, rightType)
+	var result float64
+	switch expr.operator {
+	case "+":
+		result = leftValue + rightValue
+	case "-":
+		result = leftValue - rightValue
+	case "*":
+		result = leftValue * rightValue
+	case "/":
+		if rightValue == 0 {
+			return Term{}, errType
+		}
+		result = leftValue / rightValue
+		resultType = max(resultType, numericDecimal)
+	}
+	return numericTerm(result, resultType), nil
+}
+
+func (expr callExpression) evaluate(e *evaluator, solution binding) (Term, error) {
+	arguments := make([]Term, len(expr.arguments))
+	for i, argument := range expr.arguments {
+		value, err := argument.evaluate(e, solution)
+		if err != nil {
+			return Term{}, err
+		}
+		arguments[i] = value
+	}
+	return expr.function.apply(e, arguments)
+}
+
+// evaluateBoolean evaluates an expression to its effective boolean value.
+func evaluateBoolean(e *evaluator, expr expression, solution binding) (bool, error) {
+	value, err := expr.evaluate(e, solution)
+	if err != nil {
+		return false, err
+	}
+	return effectiveBooleanValue(value)
+}
+
+// effectiveBooleanValue converts a term to true or false, as FILTER does: booleans as
+// themselves, numbers as whether they're non-zero, and strings as whether they're non-empty.
+func effectiveBooleanValue(term Term) (bool, error) {
+	if term.Kind != Literal {
+		return false, errType
+	}
+	if term.Datatype == xsdBoolean {
+		return term.Value == "true" || term.Value == "1", nil
+	}
+	if value, _, err := numericValue(term); err == nil {
+		return value != 0 && !math.IsNaN(value), nil
+	} else if isNumeric(term) {
+		return false, nil
+	}
+	if isString(term) {
+		return term.Value != "", nil
+	}
+	return false, errType
+}
+
+// numericType orders numeric datatypes by how operations on them are promoted.
+type numericType int
+
+const (
+	numericInteger numericType = iota
+	numericDecimal
+	numericDouble
+)
+
+// numericDatatypes maps each numeric XSD datatype to the type it's promoted as.
+var numericDatatypes = map[string]numericType{
+	xsdInteger: numericInteger, xsdDecimal: numericDecimal, xsdDouble: numericDouble,
+	xsdNamespace + "float": numericDouble, xsdNamespace + "int": numericInteger,
+	xsdNamespace + "long": numericInteger, xsdNamespace + "short": numericInteger,
+	xsdNamespace + "byte": numericInteger, xsdNamespace + "nonNegativeInteger": numericInteger,
+	xsdNamespace + "positiveInteger": numericInteger, xsdNamespace + "nonPositiveInteger": numericInteger,
+	xsdNamespace + "negativeInteger": numericInteger, xsdNamespace + "unsignedInt": numericInteger,
+	xsdNamespace + "unsignedLong": numericInteger, xsdNamespace + "unsignedShort": numericInteger,
+	xsdNamespace + "unsignedByte": numericInteger,
+}
+
+func isNumeric(term Term) bool {
+	_, ok := numericDatatypes[term.Datatype]
+	return term.Kind == Literal && ok
+}
+
+// numericValue returns the value of a numeric literal.
+func numericValue(term Term) (float64, numericType, error) {
+	if !isNumeric(term) {
+		return 0, 0, errType
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(term.Value), 64)
+	if err != nil {
+		return 0, 0, errType
+	}
+	return value, numericDatatypes[term.Datatype], nil
+}
+
+// numericTerm returns a number as a literal of the given type.
+func numericTerm(value float64, valueType numericType) Term {
+	switch valueType {
+	case numericInteger:
+		return NewTypedLiteral(strconv.FormatInt(int64(value), 10), xsdInteger)
+	case numericDecimal:
+		return NewTypedLiteral(strconv.FormatFloat(value, 'f', -1, 64), xsdDecimal)
+	}
+	return NewTypedLiteral(strconv.FormatFloat(value, 'E', -1, 64), xsdDouble)
+}
+
+// isString reports whether a term is a simple or language-tagged literal.
+func isString(term Term) bool {
+	return term.Kind == Literal && term.Datatype == ""
+}
+
+// comparableDatatypes are the non-numeric datatypes whose values sort in lexical order.
+var comparableDatatypes = map[string]bool{
+	xsdBoolean: true, xsdNamespace + "dateTime": true, xsdNamespace + "date": true,
+	xsdNamespace + "time": true, xsdNamespace + "gYear": true,
+}
+
+// compareValues orders two literals of compatible types: numbers by value, and strings,
+// booleans and dates by their lexical form.  Anything else raises a type error.
+func compareValues(left Term, right Term) (int, error) {
+	if leftValue, _, err := numericValue(left); err == nil {
+		rightValue, _, err := numericValue(right)
+		if err != nil {
+			return 0, errType
+		}
+		switch {
+		case leftValue < rightValue:
+			return -1, nil
+		case leftValue > rightValue:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if left.Kind != Literal || right.Kind != Literal || left.Datatype != right.Datatype || left.Language != right.Language {
+		return 0, errType
+	}
+	if left.Datatype == "" || comparableDatatypes[left.Datatype] {
+		return strings.Compare(left.Value, right.Value), nil
+	}
+	return 0, errType
+}
+
+// termsEqual compares terms for = and !=: values of compatible types by value, anything
+// else by whether they're the same term.
+func termsEqual(left Term, right Term) bool {
+	if comparison, err := compareValues(left, right); err == nil {
+		return comparison == 0
+	}
+	return left == right
+}
+
+// orderTerms orders terms for ORDER BY: unbound first, then blank nodes, IRIs and
+// literals, with comparable literals ordered by value.
+func orderTerms(left *Term, right *Term) int {
+	rank := func(term *Term) int {
+		if term == nil {
+			return 0
+		}
+		return map[TermKind]int{Blank: 1, IRI: 2, Literal: 3}[term.Kind]
+	}
+	if rank(left) != rank(right) || left == nil {
+		return rank(left) - rank(right)
+	}
+	if comparison, err := compareValues(*left, *right); err == nil && comparison != 0 {
+		return comparison
+	}
+	for _, pair := range [][2]string{{left.Value, right.Value}, {left.Datatype, right.Datatype}, {left.Language, right.Language}} {
+		if comparison := strings.Compare(pair[0], pair[1]); comparison != 0 {
+			return comparison
+		}
+	}
+	return 0
+}
+
+func builtinStr(e *evaluator, arguments []Term) (Term, error) {
+	if arguments[0].Kind == Blank {
+		return Term{}, errType
+	}
+	return NewLiteral(arguments[0].Value), nil
+}
+
+func builtinLang(e *evaluator, arguments []Term) (Term, error) {
+	if arguments[0].Kind != Literal {
+		return Term{}, errType
+	}
+	return NewLiteral(arguments[0].Language), nil
+}
+
+func builtinLangMatches(e *evaluator, arguments []Term) (Term, error) {
+	if !isString(arguments[0]) || !isString(arguments[1]) {
+		return Term{}, errType
+	}
+	tag, languageRange := strings.ToLower(arguments[0].Value), strings.ToLower(arguments[1].Value)
+	if languageRange == "*" {
+		return booleanTerm(tag != ""), nil
+	}
+	return booleanTerm(tag == languageRange || strings.HasPrefix(tag, languageRange+"-")), nil
+}
+
+func builtinDatatype(e *evaluator, arguments []Term) (Term, error) {
+	switch literal := arguments[0]; {
+	case literal.Kind != Literal:
+		return Term{}, errType
+	case literal.Language != "":
+		return NewIRI(rdfLangString), nil
+	case literal.Datatype == "":
+		return NewIRI(xsdString), nil
+	default:
+		return NewIRI(literal.Datatype), nil
+	}
+}
+
+// termKindTest returns a function testing whether its argument is an IRI, blank node or literal.
+func termKindTest(kind TermKind) func(*evaluator, []Term) (Term, error) {
+	return func(e *evaluator, arguments []Term) (Term, error) {
+		return booleanTerm(arguments[0].Kind == kind), nil
+	}
+}
+
+func builtinIsNumeric(e *evaluator, arguments []Term) (Term, error) {
+	_, _, err := numericValue(arguments[0])
+	return booleanTerm(err == nil), nil
+}
+
+func builtinSameTerm(e *evaluator, arguments []Term) (Term, error) {
+	return booleanTerm(arguments[0] == arguments[1]), nil
+}
+
+// builtinRegex matches a string against a regular expression, with optional flags.
+// Go's regular expressions are used, so some XPath syntax isn't supported.
+func builtinRegex(e *evaluator, arguments []Term) (Term, error) {
+	for _, argument := range arguments {
+		if !isString(argument) {
+			return Term{}, errType
+		}
+	}
+	pattern := arguments[1].Value
+	if len(arguments) == 3 && arguments[2].Value != "" {
+		if strings.Trim(arguments[2].Value, "ism") != "" {
+			return Term{}, errType
+		}
+		pattern = "(?" + arguments[2].Value + ")" + pattern
+	}
+	compiled, ok := e.regexps[pattern]
+	if !ok {
+		var err error
+		if compiled, err = regexp.Compile(pattern); err != nil {
+			compiled = nil
+		}
+		e.regexps[pattern] = compiled
+	}
+	if compiled == nil {
+		return Term{}, errType
+	}
+	return booleanTerm(compiled.MatchString(arguments[0].Value)), nil
+}
+
+// stringTest returns a function applying a test to two strings, such as CONTAINS.
+func stringTest(test func(string, string) bool) func(*evaluator, []Term) (Term, error) {
+	return func(e *evaluator, arguments []Term) (Term, error) {
+		if !isString(arguments[0]) || !isString(arguments[1]) {
+			return Term{}, errType
+		}
+		return booleanTerm(test(arguments[0].Value, arguments[1].Value)), nil
+	}
+}
+
+func builtinStrLen(e *evaluator, arguments []Term) (Term, error) {
+	if !isString(arguments[0]) {
+		return Term{}, errType
+	}
+	return NewTypedLiteral(strconv.Itoa(utf8.RuneCountInString(arguments[0].Value)), xsdInteger), nil
+}
+
+// caseChange returns a function changing a string's case, keeping its language.
+func caseChange(change func(string) string) func(*evaluator, []Term) (Term, error) {
+	return func(e *evaluator, arguments []Term) (Term, error) {
+		if !isString(arguments[0]) {
+			return Term{}, errType
+		}
+		result := arguments[0]
+		result.Value = change(result.Value)
+		return result, nil
+	}
+}
+
+// parseConstraint parses a FILTER's constraint: a bracketted expression or a function call.
+func (p *parser) parseConstraint() (expression, error) {
+	if p.isPunctuation("(") {
+		return p.parseBracketted()
+	}
+	if p.peek().kind == tokenWord && isFunctionName(p.peek().text) {
+		return p.parsePrimary()
+	}
+	return nil, p.errorf("expected a bracketted expression or function call")
+}
+
+func (p *parser) parseBracketted() (expression, error) {
+	if err := p.expectPunctuation("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return expr, p.expectPunctuation(")")
+}
+
+// parseExpression parses an expression, from the lowest precedence operator up.
+func (p *parser) parseExpression() (expression, error) {
+	left, err := p.parseConjunction()
+	for err == nil && p.isPunctuation("||") {
+		p.next()
+		var right expression
+		right, err = p.parseConjunction()
+		left = logicalExpression{and: false, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseConjunction() (expression, error) {
+	left, err := p.parseComparison()
+	for err == nil && p.isPunctuation("&&") {
+		p.next()
+		var right expression
+		right, err = p.parseComparison()
+		left = logicalExpression{and: true, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseComparison() (expression, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range []string{"=", "!=", "<", ">", "<=", ">="} {
+		if p.isPunctuation(operator) {
+			p.next()
+			right, err := p.parseAdditive()
+			return comparisonExpression{operator: operator, left: left, right: right}, err
+		}
+	}
+	if p.isKeyword("IN") || p.isKeyword("NOT") {
+		return nil, p.errorf("IN is not supported")
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expression, error) {
+	left, err := p.parseMultiplicative()
+	for err == nil && (p.isPunctuation("+") || p.isPunctuation("-")) {
+		operator := p.next().text
+		var right expression
+		right, err = p.parseMultiplicative()
+		left = arithmeticExpression{operator: operator, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseMultiplicative() (expression, error) {
+	left, err := p.parseUnary()
+	for err == nil && (p.isPunctuation("*") || p.isPunctuation("/")) {
+		operator := p.next().text
+		var right expression
+		right, err = p.parseUnary()
+		left = arithmeticExpression{operator: operator, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	switch {
+	case p.isPunctuation("!"):
+		p.next()
+		operand, err := p.parseUnary()
+		return notExpression{operand}, err
+	case p.isPunctuation("-"):
+		p.next()
+		operand, err := p.parseUnary()
+		return arithmeticExpression{operator: "-", left: constantExpression(NewTypedLiteral("0", xsdInteger)), right: operand}, err
+	case p.isPunctuation("+"):
+		p.next()
+		operand, err := p.parseUnary()
+		return arithmeticExpression{operator: "+", left: constantExpression(NewTypedLiteral("0", xsdInteger)), right: operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expression, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenVar:
+		p.next()
+		return variableExpression(tok.text), nil
+	case tokenIRI, tokenPrefixedName:
+		iri, err := p.parseIRI()
+		if err == nil && p.isPunctuation("(") {
+			return nil, p.errorf("calling functions by IRI is not supported")
+		}
+		return constantExpression(iri), err
+	case tokenWord:
+		return p.parseCall()
+	}
+	if p.isPunctuation("(") {
+		return p.parseBracketted()
+	}
+	term, ok, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, p.errorf("expected an expression")
+	}
+	return constantExpression(term), nil
+}
+
+// parseCall parses a call to a builtin function, or a boolean.
+func (p *parser) parseCall() (expression, error) {
+	name := strings.ToUpper(p.peek().text)
+	if name == "TRUE" || name == "FALSE" {
+		term, _, err := p.parseLiteral()
+		return constantExpression(term), err
+	}
+	if name == "EXISTS" || name == "NOT" {
+		return nil, p.errorf("EXISTS is not supported")
+	}
+	function, ok := builtins[name]
+	if !ok && name != "BOUND" {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.next()
+	if err := p.expectPunctuation("("); err != nil {
+		return nil, err
+	}
+	if name == "BOUND" {
+		if p.peek().kind != tokenVar {
+			return nil, p.errorf("expected a variable")
+		}
+		variable := p.next().text
+		return boundExpression(variable), p.expectPunctuation(")")
+	}
+	var arguments []expression
+	for !p.isPunctuation(")") {
+		if len(arguments) > 0 {
+			if err := p.expectPunctuation(","); err != nil {
+				return nil, err
+			}
+		}
+		argument, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	p.next()
+	if len(arguments) < function.minArguments || len(arguments) > function.maxArguments {
+		return nil, fmt.Errorf("syntax error: wrong number of arguments to %s", name)
+	}
+	return callExpression{function: function, arguments: arguments}, nil
+}
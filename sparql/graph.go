@@ -0,0 +1,189 @@
+// Package sparql evaluates a subset of SPARQL 1.1 queries in-process over an in-memory
+// graph: SELECT, ASK and CONSTRUCT over basic graph patterns, with FILTER, OPTIONAL,
+// ORDER BY, LIMIT and OFFSET.
+package sparql
+
+import (
+	"strings"
+
+	"github.com/deiu/rdf2go"
+)
+
+const (
+	xsdNamespace  = "http://www.w3.org/2001/XMLSchema#"
+	xsdString     = xsdNamespace + "string"
+	xsdBoolean    = xsdNamespace + "boolean"
+	xsdInteger    = xsdNamespace + "integer"
+	xsdDecimal    = xsdNamespace + "decimal"
+	xsdDouble     = xsdNamespace + "double"
+	rdfLangString = "http://www.w3.org/1999/02/22-rdf-syntax-ns#langString"
+	rdfType       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+)
+
+// TermKind distinguishes IRIs, literals and blank nodes.
+type TermKind int
+
+const (
+	IRI TermKind = iota
+	Literal
+	Blank
+)
+
+// Term is an RDF term.  Literals with neither a datatype nor a language are simple
+// literals, which SPARQL treats the same as xsd:string.
+type Term struct {
+	Kind     TermKind
+	Value    string
+	Datatype string
+	Language string
+}
+
+// NewIRI returns an IRI term.
+func NewIRI(uri string) Term {
+	return Term{Kind: IRI, Value: uri}
+}
+
+// NewLiteral returns a simple literal.
+func NewLiteral(value string) Term {
+	return Term{Kind: Literal, Value: value}
+}
+
+// NewTypedLiteral returns a literal with a datatype.  xsd:string literals are
+// normalised to simple literals.
+func NewTypedLiteral(value string, datatype string) Term {
+	if datatype == xsdString {
+		datatype = ""
+	}
+	return Term{Kind: Literal, Value: value, Datatype: datatype}
+}
+
+// NewLangLiteral returns a language-tagged literal.
+func NewLangLiteral(value string, language string) Term {
+	return Term{Kind: Literal, Value: value, Language: strings.ToLower(language)}
+}
+
+// String returns the term as written in N-Triples.
+func (term Term) String() string {
+	switch term.Kind {
+	case IRI:
+		return "<" + term.Value + ">"
+	case Blank:
+		return "_:" + term.Value
+	}
+	return term.rdf2go().String()
+}
+
+// termFromRDF2Go converts a term built by rdfgen.
+func termFromRDF2Go(term rdf2go.Term) Term {
+	switch term := term.(type) {
+	case *rdf2go.Literal:
+		if term.Language != "" {
+			return NewLangLiteral(term.Value, term.Language)
+		}
+		if term.Datatype != nil {
+			return NewTypedLiteral(term.Value, term.Datatype.RawValue())
+		}
+		return NewLiteral(term.Value)
+	case *rdf2go.BlankNode:
+		return Term{Kind: Blank, Value: term.ID}
+	}
+	return NewIRI(term.RawValue())
+}
+
+// rdf2go converts a term for serialising with rdfgen.
+func (term Term) rdf2go() rdf2go.Term {
+	switch term.Kind {
+	case IRI:
+		return rdf2go.NewResource(term.Value)
+	case Blank:
+		return rdf2go.NewBlankNode(term.Value)
+	}
+	if term.Language != "" {
+		return rdf2go.NewLiteralWithLanguage(term.Value, term.Language)
+	}
+	if term.Datatype != "" {
+		return rdf2go.NewLiteralWithDatatype(term.Value, rdf2go.NewResource(term.Datatype))
+	}
+	return rdf2go.NewLiteral(term.Value)
+}
+
+// Graph is a set of triples, indexed by subject, predicate and object so patterns with
+// any one of them bound are matched without scanning every triple.
+// Terms are interned, so triples and bindings refer to them by id.
+type Graph struct {
+	terms   []Term
+	termIDs map[Term]int
+	triples [][3]int
+	seen    map[[3]int]bool
+	index   [3]map[int][]int
+}
+
+// NewGraph returns an empty graph.
+func NewGraph() *Graph {
+	return &Graph{
+		termIDs: make(map[Term]int),
+		seen:    make(map[[3]int]bool),
+		index:   [3]map[int][]int{make(map[int][]int), make(map[int][]int), make(map[int][]int)},
+	}
+}
+
+// AddTriple adds a triple of rdf2go terms, so a Graph can be passed to rdfgen in place
+// of an rdf2go.Graph.  Duplicate triples are ignored.
+func (g *Graph) AddTriple(subject rdf2go.Term, predicate rdf2go.Term, object rdf2go.Term) {
+	g.Add(termFromRDF2Go(subject), termFromRDF2Go(predicate), termFromRDF2Go(object))
+}
+
+// Add adds a triple.  Duplicate triples are ignored.
+func (g *Graph) Add(subject Term, predicate Term, object Term) {
+	triple := [3]int{g.intern(subject), g.intern(predicate), g.intern(object)}
+	if g.seen[triple] {
+		return
+	}
+	g.seen[triple] = true
+	position := len(g.triples)
+	g.triples = append(g.triples, triple)
+	for i, id := range triple {
+		g.index[i][id] = append(g.index[i][id], position)
+	}
+}
+
+// Len returns the number of triples in the graph.
+func (g *Graph) Len() int {
+	return len(g.triples)
+}
+
+// intern returns a term's id, adding it to the graph's terms if it's new.
+func (g *Graph) intern(term Term) int {
+	if id, ok := g.termIDs[term]; ok {
+		return id
+	}
+	id := len(g.terms)
+	g.terms = append(g.terms, term)
+	g.termIDs[term] = id
+	return id
+}
+
+// lookup returns a term's id, or -1 if it isn't in the graph.
+func (g *Graph) lookup(term Term) int {
+	if id, ok := g.termIDs[term]; ok {
+		return id
+	}
+	return -1
+}
+
+// candidates returns the positions of the triples which could match a pattern, given
+// the ids bound in it (-1 where unbound), from the smallest applicable index.
+// all is true when nothing is bound, so every triple is a candidate.
+func (g *Graph) candidates(ids [3]int) (positions []int, all bool) {
+	all = true
+	for i, id := range ids {
+		if id < 0 {
+			continue
+		}
+		list := g.index[i][id]
+		if all || len(list) < len(positions) {
+			positions, all = list, false
+		}
+	}
+	return
+}
@@ -0,0 +1,261 @@
+package sparql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies the tokens of a query.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIRI
+	tokenPrefixedName
+	tokenVar
+	tokenBlank
+	tokenString
+	tokenInteger
+	tokenDecimal
+	tokenDouble
+	tokenLangTag
+	tokenWord
+	tokenPunctuation
+)
+
+// token is a lexical unit of a query.  For strings, text holds the unescaped value;
+// for IRIs, variables, blank nodes and language tags, it omits the delimiters.
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+// multiCharPunctuation lists the punctuation longer than a character, longest first.
+var multiCharPunctuation = []string{"^^", "&&", "||", "!=", "<=", ">="}
+
+// tokenise splits a query into tokens, dropping whitespace and comments.
+func tokenise(query string) ([]token, error) {
+	var tokens []token
+	position := 0
+	for {
+		position = skipSpace(query, position)
+		if position >= len(query) {
+			return append(tokens, token{kind: tokenEOF, position: position}), nil
+		}
+		next, length, err := readToken(query, position)
+		if err != nil {
+			return nil, err
+		}
+		next.position = position
+		tokens = append(tokens, next)
+		position += length
+	}
+}
+
+// skipSpace returns the position of the next character which isn't whitespace or in a comment.
+func skipSpace(query string, position int) int {
+	for position < len(query) {
+		switch char := query[position]; {
+		case char == '#':
+			for position < len(query) && query[position] != '\n' {
+				position++
+			}
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			position++
+		default:
+			return position
+		}
+	}
+	return position
+}
+
+// readToken reads the token starting at position, returning it and its length.
+func readToken(query string, position int) (token, int, error) {
+	rest := query[position:]
+	char, _ := utf8.DecodeRuneInString(rest)
+	switch {
+	case char == '<':
+		if end := iriEnd(rest); end > 0 {
+			return token{kind: tokenIRI, text: rest[1:end]}, end + 1, nil
+		}
+	case char == '?' || char == '$':
+		length := nameLength(rest[1:], false)
+		if length == 0 {
+			return token{}, 0, fmt.Errorf("syntax error: variable with no name at position %d", position)
+		}
+		return token{kind: tokenVar, text: rest[1 : 1+length]}, 1 + length, nil
+	case strings.HasPrefix(rest, "_:"):
+		length := nameLength(rest[2:], true)
+		if length == 0 {
+			return token{}, 0, fmt.Errorf("syntax error: blank node with no label at position %d", position)
+		}
+		return token{kind: tokenBlank, text: rest[2 : 2+length]}, 2 + length, nil
+	case char == '"' || char == '\'':
+		return readString(rest, position)
+	case char == '@':
+		length := 1
+		for length < len(rest) && (isLetter(rest[length]) || isDigit(rest[length]) || rest[length] == '-') {
+			length++
+		}
+		if length == 1 {
+			return token{}, 0, fmt.Errorf("syntax error: empty language tag at position %d", position)
+		}
+		return token{kind: tokenLangTag, text: rest[1:length]}, length, nil
+	case isDigit(rest[0]):
+		return readNumber(rest)
+	case char == ':' || unicode.IsLetter(char):
+		return readWord(rest)
+	}
+	for _, punctuation := range multiCharPunctuation {
+		if strings.HasPrefix(rest, punctuation) {
+			return token{kind: tokenPunctuation, text: punctuation}, len(punctuation), nil
+		}
+	}
+	if strings.ContainsRune("{}()[].;,*=<>!+-/", char) {
+		return token{kind: tokenPunctuation, text: string(char)}, 1, nil
+	}
+	return token{}, 0, fmt.Errorf("syntax error: unexpected character %q at position %d", char, position)
+}
+
+// iriEnd returns the index of the '>' closing an IRI at the start of text, or -1 if
+// it isn't an IRI (in which case the '<' is a less-than operator).
+func iriEnd(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch char := text[i]; {
+		case char == '>':
+			return i
+		case char <= ' ' || strings.IndexByte("<\"{}|^`\\", char) >= 0:
+			return -1
+		}
+	}
+	return -1
+}
+
+func isLetter(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+// nameLength returns the length of the name at the start of text: letters, digits and
+// underscores, plus (in prefixed names and blank node labels) dots and hyphens, though
+// not a trailing dot.
+func nameLength(text string, dotsAndHyphens bool) int {
+	length := 0
+	for length < len(text) {
+		char, size := utf8.DecodeRuneInString(text[length:])
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '_' &&
+			!(dotsAndHyphens && (char == '.' || char == '-')) {
+			break
+		}
+		length += size
+	}
+	for length > 0 && text[length-1] == '.' {
+		length--
+	}
+	return length
+}
+
+// readWord reads a keyword, or a prefixed name such as foaf:name or :local.
+func readWord(text string) (token, int, error) {
+	length := nameLength(text, true)
+	if length < len(text) && text[length] == ':' {
+		local := nameLength(text[length+1:], true)
+		return token{kind: tokenPrefixedName, text: text[:length+1+local]}, length + 1 + local, nil
+	}
+	return token{kind: tokenWord, text: text[:length]}, length, nil
+}
+
+// readNumber reads an integer, decimal or double.  Signs are read as punctuation.
+func readNumber(text string) (token, int, error) {
+	length := 0
+	for length < len(text) && isDigit(text[length]) {
+		length++
+	}
+	kind := tokenInteger
+	if length+1 < len(text) && text[length] == '.' && isDigit(text[length+1]) {
+		kind = tokenDecimal
+		length++
+		for length < len(text) && isDigit(text[length]) {
+			length++
+		}
+	}
+	if length < len(text) && (text[length] == 'e' || text[length] == 'E') {
+		exponent := length + 1
+		if exponent < len(text) && (text[exponent] == '+' || text[exponent] == '-') {
+			exponent++
+		}
+		if exponent < len(text) && isDigit(text[exponent]) {
+			kind = tokenDouble
+			length = exponent
+			for length < len(text) && isDigit(text[length]) {
+				length++
+			}
+		}
+	}
+	return token{kind: kind, text: text[:length]}, length, nil
+}
+
+// readString reads a quoted string, long or short, unescaping it.
+func readString(text string, position int) (token, int, error) {
+	quote := text[:1]
+	if strings.HasPrefix(text, strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	var value strings.Builder
+	for i := len(quote); i < len(text); {
+		if strings.HasPrefix(text[i:], quote) {
+			return token{kind: tokenString, text: value.String()}, i + len(quote), nil
+		}
+		char := text[i]
+		if (char == '\n' || char == '\r') && len(quote) == 1 {
+			break
+		}
+		if char != '\\' {
+			value.WriteByte(char)
+			i++
+			continue
+		}
+		if i+1 >= len(text) {
+			break
+		}
+		switch escape := text[i+1]; escape {
+		case 't':
+			value.WriteByte('\t')
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		case 'b':
+			value.WriteByte('\b')
+		case 'f':
+			value.WriteByte('\f')
+		case '"', '\'', '\\':
+			value.WriteByte(escape)
+		case 'u', 'U':
+			digits := 4
+			if escape == 'U' {
+				digits = 8
+			}
+			if i+2+digits > len(text) {
+				return token{}, 0, fmt.Errorf("syntax error: bad escape in string at position %d", position+i)
+			}
+			code, err := strconv.ParseUint(text[i+2:i+2+digits], 16, 32)
+			if err != nil {
+				return token{}, 0, fmt.Errorf("syntax error: bad escape in string at position %d", position+i)
+			}
+			value.WriteRune(rune(code))
+			i += digits
+		default:
+			return token{}, 0, fmt.Errorf("syntax error: bad escape in string at position %d", position+i)
+		}
+		i += 2
+	}
+	return token{}, 0, fmt.Errorf("syntax error: unterminated string at position %d", position)
+}
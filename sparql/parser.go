@@ -0,0 +1,560 @@
+package sparql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryForm is the kind of result a query asks for.
+type QueryForm int
+
+const (
+	SelectQuery QueryForm = iota
+	AskQuery
+	ConstructQuery
+)
+
+// Query is a parsed query, ready to be evaluated against a graph.
+type Query struct {
+	Form     QueryForm
+	Distinct bool
+	// Variables lists the variables a SELECT query projects, in order.
+	// For SELECT *, it's every variable in the WHERE clause.
+	Variables []string
+	template  []triplePattern
+	where     *groupPattern
+	orderBy   []orderCondition
+	limit     int
+	offset    int
+}
+
+// node is a term or a variable in a triple pattern.  Blank nodes in patterns act as
+// variables which can't be projected, so are named with a "_:" prefix.
+type node struct {
+	variable string
+	term     Term
+}
+
+func (n node) isVariable() bool {
+	return n.variable != ""
+}
+
+type triplePattern struct {
+	subject, predicate, object node
+}
+
+// groupPattern is a { } group: a sequence of triples, OPTIONAL groups and nested groups,
+// with filters applied to every solution of the group as a whole.
+type groupPattern struct {
+	elements []patternElement
+	filters  []expression
+}
+
+// patternElement is one of the triples, an OPTIONAL group or a nested group.
+type patternElement struct {
+	triples  []triplePattern
+	optional *groupPattern
+	group    *groupPattern
+}
+
+type orderCondition struct {
+	expression expression
+	descending bool
+}
+
+// unsupportedKeywords are parts of SPARQL 1.1 which are recognised, but not evaluated.
+var unsupportedKeywords = map[string]bool{
+	"DESCRIBE": true, "UNION": true, "MINUS": true, "GRAPH": true, "SERVICE": true,
+	"BIND": true, "VALUES": true, "GROUP": true, "HAVING": true, "FROM": true,
+	"INSERT": true, "DELETE": true, "LOAD": true, "CLEAR": true, "DROP": true,
+	"CREATE": true, "ADD": true, "MOVE": true, "COPY": true, "WITH": true,
+}
+
+// parser turns a query's tokens into a Query.
+type parser struct {
+	tokens    []token
+	position  int
+	base      string
+	prefixes  map[string]string
+	variables []string
+	seen      map[string]bool
+}
+
+// Parse parses a query.  Errors describe the first problem found, and where.
+func Parse(query string) (*Query, error) {
+	tokens, err := tokenise(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, prefixes: make(map[string]string), seen: make(map[string]bool)}
+	return p.parseQuery()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.position]
+	if tok.kind != tokenEOF {
+		p.position++
+	}
+	return tok
+}
+
+// isKeyword reports whether the next token is the given keyword, which is case-insensitive.
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *parser) isPunctuation(punctuation string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunctuation && tok.text == punctuation
+}
+
+// errorf returns a syntax error at the next token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	found := "end of query"
+	if tok.kind != tokenEOF {
+		found = fmt.Sprintf("%q", p.tokens[p.position].text)
+	}
+	return fmt.Errorf("syntax error at position %d, near %s: %s", tok.position, found, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectPunctuation(punctuation string) error {
+	if !p.isPunctuation(punctuation) {
+		return p.errorf("expected %q", punctuation)
+	}
+	p.next()
+	return nil
+}
+
+// checkSupported returns an error if the next token is a keyword which isn't supported.
+func (p *parser) checkSupported() error {
+	if tok := p.peek(); tok.kind == tokenWord && unsupportedKeywords[strings.ToUpper(tok.text)] {
+		return p.errorf("%s is not supported", strings.ToUpper(tok.text))
+	}
+	return nil
+}
+
+// noteVariable records a variable in the order it's first used, for SELECT *.
+func (p *parser) noteVariable(name string) {
+	if !p.seen[name] {
+		p.seen[name] = true
+		if !strings.HasPrefix(name, "_:") {
+			p.variables = append(p.variables, name)
+		}
+	}
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	if err := p.parsePrologue(); err != nil {
+		return nil, err
+	}
+	query := &Query{limit: -1}
+	var projected []string
+	star := false
+	switch {
+	case p.isKeyword("SELECT"):
+		p.next()
+		query.Form = SelectQuery
+		if p.isKeyword("DISTINCT") || p.isKeyword("REDUCED") {
+			query.Distinct = true
+			p.next()
+		}
+		if p.isPunctuation("*") {
+			p.next()
+			star = true
+		}
+		for !star && p.peek().kind == tokenVar {
+			projected = append(projected, p.next().text)
+		}
+		if !star && len(projected) == 0 {
+			if p.isPunctuation("(") {
+				return nil, p.errorf("expressions in SELECT are not supported")
+			}
+			return nil, p.errorf("expected variables or * to select")
+		}
+	case p.isKeyword("ASK"):
+		p.next()
+		query.Form = AskQuery
+	case p.isKeyword("CONSTRUCT"):
+		p.next()
+		query.Form = ConstructQuery
+		if p.isPunctuation("{") {
+			p.next()
+			template, err := p.parseTriples("}")
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunctuation("}"); err != nil {
+				return nil, err
+			}
+			query.template = template
+		} else if !p.isKeyword("WHERE") {
+			return nil, p.errorf("expected a CONSTRUCT template")
+		}
+	default:
+		if err := p.checkSupported(); err != nil {
+			return nil, err
+		}
+		return nil, p.errorf("expected SELECT, ASK or CONSTRUCT")
+	}
+	if err := p.checkSupported(); err != nil {
+		return nil, err
+	}
+
+	// CONSTRUCT WHERE { } uses its pattern as its template
+	shortConstruct := query.Form == ConstructQuery && query.template == nil
+	if p.isKeyword("WHERE") {
+		p.next()
+	} else if shortConstruct {
+		return nil, p.errorf("expected WHERE")
+	}
+	where, err := p.parseGroup()
+	if err != nil {
+		return nil, err
+	}
+	query.where = where
+	if shortConstruct {
+		if len(where.elements) > 1 || len(where.filters) > 0 || (len(where.elements) == 1 && where.elements[0].triples == nil) {
+			return nil, fmt.Errorf("syntax error: CONSTRUCT WHERE may only contain triple patterns")
+		}
+		if len(where.elements) == 1 {
+			query.template = where.elements[0].triples
+		}
+	}
+	if err := p.parseSolutionModifiers(query); err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		if err := p.checkSupported(); err != nil {
+			return nil, err
+		}
+		return nil, p.errorf("expected end of query")
+	}
+	query.Variables = projected
+	if star {
+		query.Variables = p.variables
+	}
+	return query, nil
+}
+
+func (p *parser) parsePrologue() error {
+	for {
+		switch {
+		case p.isKeyword("BASE"):
+			p.next()
+			if p.peek().kind != tokenIRI {
+				return p.errorf("expected an IRI for BASE")
+			}
+			p.base = p.next().text
+		case p.isKeyword("PREFIX"):
+			p.next()
+			if name := p.peek(); name.kind != tokenPrefixedName || !strings.HasSuffix(name.text, ":") {
+				return p.errorf("expected a prefix name ending in a colon")
+			}
+			name := p.next()
+			if p.peek().kind != tokenIRI {
+				return p.errorf("expected an IRI for PREFIX %s", name.text)
+			}
+			p.prefixes[strings.TrimSuffix(name.text, ":")] = p.resolve(p.next().text)
+		default:
+			return nil
+		}
+	}
+}
+
+// resolve resolves a relative IRI against the BASE, if there is one.
+func (p *parser) resolve(iri string) string {
+	if p.base == "" || strings.Contains(iri, ":") {
+		return iri
+	}
+	return p.base + iri
+}
+
+// expandPrefixedName expands a prefixed name using the declared prefixes.
+func (p *parser) expandPrefixedName(name string) (string, error) {
+	prefix, local, _ := strings.Cut(name, ":")
+	namespace, ok := p.prefixes[prefix]
+	if !ok {
+		return "", fmt.Errorf("syntax error: undeclared prefix %q", prefix+":")
+	}
+	return namespace + local, nil
+}
+
+// parseGroup parses a { } group pattern.
+func (p *parser) parseGroup() (*groupPattern, error) {
+	if err := p.expectPunctuation("{"); err != nil {
+		return nil, err
+	}
+	group := &groupPattern{}
+	for !p.isPunctuation("}") {
+		if err := p.checkSupported(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.peek().kind == tokenEOF:
+			return nil, p.errorf("expected \"}\"")
+		case p.isPunctuation("."):
+			p.next()
+		case p.isKeyword("FILTER"):
+			p.next()
+			filter, err := p.parseConstraint()
+			if err != nil {
+				return nil, err
+			}
+			group.filters = append(group.filters, filter)
+		case p.isKeyword("OPTIONAL"):
+			p.next()
+			optional, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			group.elements = append(group.elements, patternElement{optional: optional})
+		case p.isPunctuation("{"):
+			nested, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.checkSupported(); err != nil {
+				return nil, err
+			}
+			group.elements = append(group.elements, patternElement{group: nested})
+		default:
+			triples, err := p.parseTriples("}")
+			if err != nil {
+				return nil, err
+			}
+			if len(triples) == 0 {
+				return nil, p.errorf("expected a triple pattern, FILTER or OPTIONAL")
+			}
+			// Consecutive triples, even with filters between them, form one basic graph pattern
+			if last := len(group.elements) - 1; last >= 0 && group.elements[last].triples != nil {
+				group.elements[last].triples = append(group.elements[last].triples, triples...)
+			} else {
+				group.elements = append(group.elements, patternElement{triples: triples})
+			}
+		}
+	}
+	p.next()
+	return group, nil
+}
+
+// parseTriples parses triple patterns, with ; and , abbreviations, up to a token which
+// can't start another triple.  end is the punctuation closing the enclosing group.
+func (p *parser) parseTriples(end string) ([]triplePattern, error) {
+	var triples []triplePattern
+	for {
+		switch p.peek().kind {
+		case tokenVar, tokenBlank, tokenIRI, tokenPrefixedName:
+		default:
+			if !p.isPunctuation("[") && !p.isPunctuation("(") {
+				return triples, nil
+			}
+		}
+		subject, err := p.parseNode(false)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			predicate, err := p.parseVerb()
+			if err != nil {
+				return nil, err
+			}
+			for {
+				object, err := p.parseNode(true)
+				if err != nil {
+					return nil, err
+				}
+				triples = append(triples, triplePattern{subject, predicate, object})
+				if !p.isPunctuation(",") {
+					break
+				}
+				p.next()
+			}
+			if !p.isPunctuation(";") {
+				break
+			}
+			for p.isPunctuation(";") {
+				p.next()
+			}
+			if p.isPunctuation(".") || p.isPunctuation(end) {
+				break
+			}
+		}
+		if !p.isPunctuation(".") {
+			return triples, nil
+		}
+		p.next()
+	}
+}
+
+// parseVerb parses a predicate: a variable, an IRI or "a" for rdf:type.
+func (p *parser) parseVerb() (node, error) {
+	if p.isKeyword("a") {
+		p.next()
+		return node{term: NewIRI(rdfType)}, nil
+	}
+	if kind := p.peek().kind; kind != tokenVar && kind != tokenIRI && kind != tokenPrefixedName {
+		return node{}, p.errorf("expected a variable, IRI or \"a\" as predicate")
+	}
+	return p.parseNode(false)
+}
+
+// parseNode parses a variable, IRI, blank node or (if allowed) literal in a triple pattern.
+func (p *parser) parseNode(allowLiteral bool) (node, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenVar:
+		p.next()
+		p.noteVariable(tok.text)
+		return node{variable: tok.text}, nil
+	case tokenBlank:
+		p.next()
+		p.noteVariable("_:" + tok.text)
+		return node{variable: "_:" + tok.text}, nil
+	case tokenIRI, tokenPrefixedName:
+		term, err := p.parseIRI()
+		return node{term: term}, err
+	}
+	if p.isPunctuation("[") {
+		return node{}, p.errorf("anonymous blank nodes are not supported")
+	}
+	if p.isPunctuation("(") {
+		return node{}, p.errorf("collections are not supported")
+	}
+	if allowLiteral {
+		if term, ok, err := p.parseLiteral(); ok || err != nil {
+			return node{term: term}, err
+		}
+	}
+	return node{}, p.errorf("expected a variable, IRI or literal")
+}
+
+// parseIRI parses an IRI or prefixed name.
+func (p *parser) parseIRI() (Term, error) {
+	tok := p.next()
+	if tok.kind == tokenIRI {
+		return NewIRI(p.resolve(tok.text)), nil
+	}
+	iri, err := p.expandPrefixedName(tok.text)
+	return NewIRI(iri), err
+}
+
+// parseLiteral parses a string, number or boolean, if one is next.
+func (p *parser) parseLiteral() (term Term, ok bool, err error) {
+	tok := p.peek()
+	sign := ""
+	if p.isPunctuation("-") || p.isPunctuation("+") {
+		if next := p.tokens[p.position+1].kind; next == tokenInteger || next == tokenDecimal || next == tokenDouble {
+			sign = p.next().text
+			tok = p.peek()
+		}
+	}
+	switch tok.kind {
+	case tokenString:
+		p.next()
+		if p.peek().kind == tokenLangTag {
+			return NewLangLiteral(tok.text, p.next().text), true, nil
+		}
+		if p.isPunctuation("^^") {
+			p.next()
+			if kind := p.peek().kind; kind != tokenIRI && kind != tokenPrefixedName {
+				return Term{}, true, p.errorf("expected a datatype IRI")
+			}
+			datatype, err := p.parseIRI()
+			return NewTypedLiteral(tok.text, datatype.Value), true, err
+		}
+		return NewLiteral(tok.text), true, nil
+	case tokenInteger:
+		p.next()
+		return NewTypedLiteral(strings.TrimPrefix(sign, "+")+tok.text, xsdInteger), true, nil
+	case tokenDecimal:
+		p.next()
+		return NewTypedLiteral(strings.TrimPrefix(sign, "+")+tok.text, xsdDecimal), true, nil
+	case tokenDouble:
+		p.next()
+		return NewTypedLiteral(strings.TrimPrefix(sign, "+")+tok.text, xsdDouble), true, nil
+	case tokenWord:
+		if p.isKeyword("true") || p.isKeyword("false") {
+			p.next()
+			return NewTypedLiteral(strings.ToLower(tok.text), xsdBoolean), true, nil
+		}
+	}
+	return Term{}, false, nil
+}
+
+// parseSolutionModifiers parses ORDER BY, then LIMIT and OFFSET in either order.
+func (p *parser) parseSolutionModifiers(query *Query) error {
+	if err := p.checkSupported(); err != nil {
+		return err
+	}
+	if p.isKeyword("ORDER") {
+		p.next()
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		for {
+			condition := orderCondition{}
+			switch {
+			case p.isKeyword("ASC") || p.isKeyword("DESC"):
+				condition.descending = p.isKeyword("DESC")
+				p.next()
+				if !p.isPunctuation("(") {
+					return p.errorf("expected \"(\"")
+				}
+				fallthrough
+			case p.isPunctuation("("):
+				expr, err := p.parseBracketted()
+				if err != nil {
+					return err
+				}
+				condition.expression = expr
+			case p.peek().kind == tokenVar:
+				condition.expression = variableExpression(p.next().text)
+			case p.peek().kind == tokenWord && isFunctionName(p.peek().text):
+				expr, err := p.parsePrimary()
+				if err != nil {
+					return err
+				}
+				condition.expression = expr
+			}
+			if condition.expression == nil {
+				break
+			}
+			query.orderBy = append(query.orderBy, condition)
+		}
+		if len(query.orderBy) == 0 {
+			return p.errorf("expected something to order by")
+		}
+	}
+	for p.isKeyword("LIMIT") || p.isKeyword("OFFSET") {
+		keyword := strings.ToUpper(p.next().text)
+		if p.peek().kind != tokenInteger {
+			return p.errorf("expected a number for %s", keyword)
+		}
+		tok := p.next()
+		value, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return fmt.Errorf("syntax error: %s %s is too large", keyword, tok.text)
+		}
+		if keyword == "LIMIT" {
+			query.limit = value
+		} else {
+			query.offset = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package sparql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAbbreviationsAndLiterals(t *testing.T) {
+	query, err := Parse(`
+		BASE <http://localhost/>
+		PREFIX : <http://localhost/vocab#>  # the default prefix
+		select distinct ?s where {
+			?s a :Thing ; :tag "one", 'two' , """three
+lines""" ;
+			   :count -3, 2.5, 1e3, true ;
+			   :label "esc\"apedé"@en-GB ;
+			   :type "x"^^:custom ;
+			   <relative> ?o .
+		} limit 10 offset 5`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !query.Distinct || query.limit != 10 || query.offset != 5 || strings.Join(query.Variables, ",") != "s" {
+		t.Errorf("unexpected query %+v", query)
+	}
+	triples := query.where.elements[0].triples
+	if len(triples) != 11 {
+		t.Fatalf("expected 11 triple patterns, got %d", len(triples))
+	}
+	expected := []Term{
+		NewIRI("http://localhost/vocab#Thing"),
+		NewLiteral("one"),
+		NewLiteral("two"),
+		NewLiteral("three\nlines"),
+		NewTypedLiteral("-3", xsdInteger),
+		NewTypedLiteral("2.5", xsdDecimal),
+		NewTypedLiteral("1e3", xsdDouble),
+		NewTypedLiteral("true", xsdBoolean),
+		NewLangLiteral("esc\"apedé", "en-gb"),
+		NewTypedLiteral("x", "http://localhost/vocab#custom"),
+	}
+	for i, term := range expected {
+		if triples[i].object.term != term {
+			t.Errorf("triple %d: expected object %+v, got %+v", i, term, triples[i].object.term)
+		}
+	}
+	if triples[0].predicate.term.Value != rdfType {
+		t.Errorf("expected \"a\" to mean rdf:type, got %v", triples[0].predicate.term)
+	}
+	if triples[10].predicate.term.Value != "http://localhost/relative" {
+		t.Errorf("expected a relative IRI to be resolved against BASE, got %v", triples[10].predicate.term)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT ?s WHERE { ?s ?p ?o `, `expected "}"`},
+		{`SELECT WHERE { ?s ?p ?o }`, "expected variables or * to select"},
+		{`SELECT ?s WHERE { ?s foaf:name ?o }`, `undeclared prefix "foaf:"`},
+		{`SELECT ?s WHERE { ?s ?p "unterminated }`, "unterminated string"},
+		{`SELECT ?s WHERE { { ?s ?p ?o } UNION { ?o ?p ?s } }`, "UNION is not supported"},
+		{`DESCRIBE <http://localhost/>`, "DESCRIBE is not supported"},
+		{`INSERT DATA { <a> <b> <c> }`, "INSERT is not supported"},
+		{`SELECT ?s WHERE { ?s ?p ?o FILTER(nope(?o)) }`, "unknown function NOPE"},
+		{`SELECT ?s WHERE { ?s ?p ?o FILTER(regex(?o)) }`, "wrong number of arguments to REGEX"},
+		{`SELECT ?s WHERE { ?s "literal" ?o }`, "as predicate"},
+		{`SELECT ?s WHERE { ?s ?p [ ?q ?r ] }`, "anonymous blank nodes are not supported"},
+		{`SELECT ?s WHERE { ?s ?p ?o } LIMIT many`, "expected a number for LIMIT"},
+		{`SELECT ?s WHERE { ?s ?p ?o } ORDER ?s`, "expected BY"},
+		{`SELECT ?s WHERE { ?s ?p ?o } trailing`, "expected end of query"},
+		{`SELECT (?s AS ?t) WHERE { ?s ?p ?o }`, "expressions in SELECT are not supported"},
+	}
+	for _, tc := range tests {
+		_, err := Parse(tc.query)
+		if err == nil {
+			t.Errorf("expected an error parsing %q", tc.query)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) || !strings.HasPrefix(err.Error(), "syntax error") {
+			t.Errorf("parsing %q: expected a syntax error containing %q, got %q", tc.query, tc.want, err)
+		}
+	}
+}
+
+func TestLessThanIsntAnIRI(t *testing.T) {
+	query, err := Parse(`SELECT ?s WHERE { ?s ?p ?o FILTER(?o<3 && ?o>1) }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(query.where.filters) != 1 {
+		t.Errorf("expected one filter, got %d", len(query.where.filters))
+	}
+}
@@ -0,0 +1,93 @@
+package sparql
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonResults is the SPARQL 1.1 Query Results JSON Format.
+type jsonResults struct {
+	Head    jsonHead    `json:"head"`
+	Results *jsonResult `json:"results,omitempty"`
+	Boolean *bool       `json:"boolean,omitempty"`
+}
+
+type jsonHead struct {
+	Vars []string `json:"vars,omitempty"`
+}
+
+type jsonResult struct {
+	Bindings []map[string]jsonTerm `json:"bindings"`
+}
+
+type jsonTerm struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Datatype string `json:"datatype,omitempty"`
+	Language string `json:"xml:lang,omitempty"`
+}
+
+// WriteJSON writes SELECT or ASK results in the SPARQL 1.1 Query Results JSON Format.
+func (results *Results) WriteJSON(w io.Writer) error {
+	if results.Form == ConstructQuery {
+		return fmt.Errorf("CONSTRUCT results can't be written as SPARQL results")
+	}
+	output := jsonResults{}
+	if results.Form == AskQuery {
+		output.Boolean = &results.Boolean
+	} else {
+		output.Head.Vars = results.Variables
+		if output.Head.Vars == nil {
+			output.Head.Vars = []string{}
+		}
+		output.Results = &jsonResult{Bindings: make([]map[string]jsonTerm, 0, len(results.Solutions))}
+		for _, solution := range results.Solutions {
+			bindings := make(map[string]jsonTerm, len(solution))
+			for variable, term := range solution {
+				bindings[variable] = toJSONTerm(term)
+			}
+			output.Results.Bindings = append(output.Results.Bindings, bindings)
+		}
+	}
+	return json.NewEncoder(w).Encode(output)
+}
+
+func toJSONTerm(term Term) jsonTerm {
+	switch term.Kind {
+	case IRI:
+		return jsonTerm{Type: "uri", Value: term.Value}
+	case Blank:
+		return jsonTerm{Type: "bnode", Value: term.Value}
+	}
+	return jsonTerm{Type: "literal", Value: term.Value, Datatype: term.Datatype, Language: term.Language}
+}
+
+// WriteCSV writes SELECT results in the SPARQL 1.1 Query Results CSV Format, which
+// gives just the value of each term, without its type, datatype or language.
+func (results *Results) WriteCSV(w io.Writer) error {
+	if results.Form != SelectQuery {
+		return fmt.Errorf("only SELECT results can be written as CSV")
+	}
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	writer.Write(results.Variables)
+	row := make([]string, len(results.Variables))
+	for _, solution := range results.Solutions {
+		for i, variable := range results.Variables {
+			term, bound := solution[variable]
+			switch {
+			case !bound:
+				row[i] = ""
+			case term.Kind == Blank:
+				row[i] = "_:" + term.Value
+			default:
+				row[i] = term.Value
+			}
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,86 @@
+package sparql
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	results := &Results{
+		Form:      SelectQuery,
+		Variables: []string{"s", "label", "count", "missing"},
+		Solutions: []map[string]Term{{
+			"s":     NewIRI("http://localhost/1"),
+			"label": NewLangLiteral("Un", "fr"),
+			"count": NewTypedLiteral("3", xsdInteger),
+		}, {
+			"s":     {Kind: Blank, Value: "b0"},
+			"label": NewLiteral("plain"),
+		}},
+	}
+	var output bytes.Buffer
+	if err := results.WriteJSON(&output); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+		"head": {"vars": ["s", "label", "count", "missing"]},
+		"results": {"bindings": [
+			{
+				"s": {"type": "uri", "value": "http://localhost/1"},
+				"label": {"type": "literal", "value": "Un", "xml:lang": "fr"},
+				"count": {"type": "literal", "value": "3", "datatype": "http://www.w3.org/2001/XMLSchema#integer"}
+			},
+			{
+				"s": {"type": "bnode", "value": "b0"},
+				"label": {"type": "literal", "value": "plain"}
+			}
+		]}
+	}`
+	assertJSON(t, expected, output.Bytes())
+
+	output.Reset()
+	if err := (&Results{Form: AskQuery, Boolean: false}).WriteJSON(&output); err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, `{"head": {}, "boolean": false}`, output.Bytes())
+}
+
+func TestWriteCSV(t *testing.T) {
+	results := &Results{
+		Form:      SelectQuery,
+		Variables: []string{"s", "label"},
+		Solutions: []map[string]Term{
+			{"s": NewIRI("http://localhost/1"), "label": NewLangLiteral("Fish, \"Chips\"", "en")},
+			{"s": {Kind: Blank, Value: "b0"}},
+		},
+	}
+	var output bytes.Buffer
+	if err := results.WriteCSV(&output); err != nil {
+		t.Fatal(err)
+	}
+	expected := "s,label\r\nhttp://localhost/1,\"Fish, \"\"Chips\"\"\"\r\n_:b0,\r\n"
+	if output.String() != expected {
+		t.Errorf("expected CSV %q, got %q", expected, output.String())
+	}
+	if err := (&Results{Form: AskQuery}).WriteCSV(&output); err == nil {
+		t.Error("expected an error writing ASK results as CSV")
+	}
+}
+
+// assertJSON fails the test if two JSON documents aren't equivalent.
+func assertJSON(t *testing.T, expected string, actual []byte) {
+	t.Helper()
+	var expectedValue, actualValue interface{}
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(actual, &actualValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", actual, err)
+	}
+	expectedJSON, _ := json.Marshal(expectedValue)
+	actualJSON, _ := json.Marshal(actualValue)
+	if !bytes.Equal(expectedJSON, actualJSON) {
+		t.Errorf("expected JSON %s, got %s", expectedJSON, actualJSON)
+	}
+}